@@ -0,0 +1,171 @@
+package booleanparser
+
+import (
+	"fmt"
+)
+
+// A Node is an element of the syntax tree of a parsed expression, unlike
+// Expression, that computes the value while parsing, the tree can be
+// evaluated several times under different contexts.
+type Node interface {
+	String() string
+	// evaluates the node, values holds the value of every label occurrence
+	// and observe, when not nil, receives the operands and result of every
+	// operator.
+	eval(values []bool, observe func(n Node, operands []bool, result bool)) bool
+}
+
+// A LabelNode is one occurrence of a label in the expression.
+type LabelNode struct {
+	Label      string // the label as written in the expression, upper case
+	Name       string // the universe label, or Label when not in the universe
+	Occurrence int    // position of this occurrence among all the labels
+}
+
+type NotNode struct {
+	Operand Node
+}
+
+type BinaryNode struct {
+	Kind     TokenKind // one of XOR, AND, OR
+	Operator string
+	Left     Node
+	Right    Node
+}
+
+func (l *LabelNode) String() string {
+	return l.Label
+}
+
+func (n *NotNode) String() string {
+	return "!" + n.Operand.String()
+}
+
+func (b *BinaryNode) String() string {
+	return fmt.Sprintf("(%s %s %s)", b.Left.String(), b.Operator, b.Right.String())
+}
+
+func (l *LabelNode) eval(values []bool, observe func(Node, []bool, bool)) bool {
+	return values[l.Occurrence]
+}
+
+func (n *NotNode) eval(values []bool, observe func(Node, []bool, bool)) bool {
+	operand := n.Operand.eval(values, observe)
+	result := !operand
+	if observe != nil {
+		observe(n, []bool{operand}, result)
+	}
+
+	return result
+}
+
+func (b *BinaryNode) eval(values []bool, observe func(Node, []bool, bool)) bool {
+	// Both sides are always evaluated, as Expression and Term do.
+	left := b.Left.eval(values, observe)
+	right := b.Right.eval(values, observe)
+
+	var result bool
+	switch b.Kind {
+	case XOR:
+		result = left != right
+	case AND:
+		result = left && right
+	case OR:
+		result = left || right
+	}
+
+	if observe != nil {
+		observe(b, []bool{left, right}, result)
+	}
+
+	return result
+}
+
+// A ParsedExpression is the syntax tree of an expression together with the
+// universe used to resolve its labels.
+type ParsedExpression struct {
+	Expression string
+	Root       Node
+	Labels     []*LabelNode // every label occurrence, in order of appearance
+	Operators  []Node       // every *NotNode and *BinaryNode, in order of creation
+	universe   LabelResolver
+}
+
+func ParseExpression(expression string, unvrs [][]string) (*ParsedExpression, error) {
+	return ParseExpressionWithUniverse(expression, NewUniverse(unvrs))
+}
+
+// Parses the expression resolving its labels with the given universe, for
+// example a *UniverseSnapshot shared between goroutines.
+func ParseExpressionWithUniverse(expression string, universe LabelResolver) (*ParsedExpression, error) {
+	// Token values are not used by the tree, so an empty context is enough.
+	tokens, tokenizeerror := Tokenize(expression, NewContext(nil, universe), universe)
+	if tokenizeerror != nil {
+		return nil, tokenizeerror
+	}
+
+	pe := &ParsedExpression{Expression: expression, universe: universe}
+	ts := NewTokenStream(tokens)
+	root, parseerror := parseexpression[Node](ts, pe)
+	if parseerror != nil {
+		return nil, parseerror
+	}
+
+	// Unlike EvaluateBooleanExpression, every token must be part of the
+	// expression, so "A B" is not read as "A".
+	if t := ts.Get(); t != nil {
+		text := t.Operator
+		if t.Kind == LABEL {
+			text = t.Label
+		}
+		return nil, NewParserErrorAt(t.Position, UNEXPECTED_TOKEN, text)
+	}
+
+	pe.Root = root
+	return pe, nil
+}
+
+// Returns the value of every label occurrence under the given context.
+func (pe *ParsedExpression) Values(ctx []string) []bool {
+	return pe.ValuesIn(NewContext(ctx, pe.universe))
+}
+
+// Returns the value of every label occurrence under an already extended
+// context, like a *Context or a *ContextSnapshot.
+func (pe *ParsedExpression) ValuesIn(extendedctx LabelSet) []bool {
+	values := make([]bool, len(pe.Labels))
+	for i, l := range pe.Labels {
+		values[i] = extendedctx.Contains(l.Label)
+	}
+
+	return values
+}
+
+func (pe *ParsedExpression) Evaluate(ctx []string) bool {
+	return pe.Root.eval(pe.Values(ctx), nil)
+}
+
+func (pe *ParsedExpression) EvaluateIn(extendedctx LabelSet) bool {
+	return pe.Root.eval(pe.ValuesIn(extendedctx), nil)
+}
+
+// The syntax tree is built by the grammar in grammar.go, with the
+// ParsedExpression as its builder.
+
+func (pe *ParsedExpression) label(t *Token) Node {
+	l := &LabelNode{Label: t.Label, Name: t.Operator, Occurrence: len(pe.Labels)}
+	pe.Labels = append(pe.Labels, l)
+	return l
+}
+
+func (pe *ParsedExpression) not(operand Node) Node {
+	n := &NotNode{Operand: operand}
+	pe.Operators = append(pe.Operators, n)
+	return n
+}
+
+func (pe *ParsedExpression) binary(operator *Token, left Node, right Node) Node {
+	b := &BinaryNode{Kind: operator.Kind, Operator: operator.Operator, Left: left, Right: right}
+	pe.Operators = append(pe.Operators, b)
+	return b
+}
@@ -4,10 +4,7 @@ import (
 	"fmt"
 )
 
-func EvaluateBooleanExpression(
-	expression string,
-	ctx []string,
-	unvrs [][]string) (bool, error) {
+func NewUniverse(unvrs [][]string) *Universe {
 	universe := &Universe{u6e: make(map[string]string)}
 
 	for _, pair := range unvrs {
@@ -18,6 +15,12 @@ func EvaluateBooleanExpression(
 		}
 	}
 
+	return universe
+}
+
+// Builds the context for an evaluation, every label in ctx that is part of
+// the universe also brings its universe label into the context.
+func NewContext(ctx []string, universe LabelResolver) *Context {
 	extendedctx := &Context{c: make(map[string]bool)}
 
 	for _, c := range ctx {
@@ -30,11 +33,10 @@ func EvaluateBooleanExpression(
 		}
 	}
 
-	tokens, tokenizeerror := Tokenize(expression, extendedctx, universe)
-	if tokenizeerror != nil {
-		return false, tokenizeerror
-	}
+	return extendedctx
+}
 
+func NewTokenStream(tokens []Token) *TokenStream {
 	ts := &TokenStream{tokens: make([]*Token, len(tokens))}
 
 	for _, t := range tokens {
@@ -42,6 +44,23 @@ func EvaluateBooleanExpression(
 		ts.Append(&tkn)
 	}
 
+	return ts
+}
+
+func EvaluateBooleanExpression(
+	expression string,
+	ctx []string,
+	unvrs [][]string) (bool, error) {
+	universe := NewUniverse(unvrs)
+	extendedctx := NewContext(ctx, universe)
+
+	tokens, tokenizeerror := Tokenize(expression, extendedctx, universe)
+	if tokenizeerror != nil {
+		return false, tokenizeerror
+	}
+
+	ts := NewTokenStream(tokens)
+
 	ev, evaluationerror := Expression(ts)
 
 	if evaluationerror != nil {
@@ -0,0 +1,143 @@
+package booleanparser
+
+import (
+	"bufio"
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const DEFAULT_LOCALE string = "en"
+
+//go:embed catalog/*.txt
+var _catalogfiles embed.FS
+
+// A Catalog holds the message templates of every locale.
+// Messages are looked up in the requested locale, then in its base language
+// (es-MX -> es) and last in the fallback locale.
+type Catalog struct {
+	fallback string
+	messages map[string]map[string]string
+}
+
+func NewCatalog(fallback string) *Catalog {
+	return &Catalog{fallback: normalizelocale(fallback), messages: make(map[string]map[string]string)}
+}
+
+var _defaultcatalog *Catalog
+var _defaultcatalogonce sync.Once
+
+// Returns the catalog built from the files embedded in the package.
+func DefaultCatalog() *Catalog {
+	_defaultcatalogonce.Do(func() {
+		c, err := loadcatalogfs(_catalogfiles, "catalog", DEFAULT_LOCALE)
+		if err != nil {
+			panic(err)
+		}
+		_defaultcatalog = c
+	})
+
+	return _defaultcatalog
+}
+
+// Loads every <locale>.txt file found in dir.
+func LoadCatalog(dir string, fallback string) (*Catalog, error) {
+	return loadcatalogfs(os.DirFS(dir), ".", fallback)
+}
+
+func loadcatalogfs(fsys fs.FS, dir string, fallback string) (*Catalog, error) {
+	c := NewCatalog(fallback)
+
+	files, err := fs.Glob(fsys, filepath.ToSlash(filepath.Join(dir, "*.txt")))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range files {
+		f, err := fsys.Open(name)
+		if err != nil {
+			return nil, err
+		}
+
+		locale := strings.TrimSuffix(filepath.Base(name), ".txt")
+		err = c.Load(locale, f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	return c, nil
+}
+
+// Adds the messages read from r to the locale, the format is one
+// "CODE = message" per line, blank lines and lines starting with '#' are
+// ignored.
+func (c *Catalog) Load(locale string, r io.Reader) error {
+	locale = normalizelocale(locale)
+	if c.messages[locale] == nil {
+		c.messages[locale] = make(map[string]string)
+	}
+
+	scanner := bufio.NewScanner(r)
+	for linenumber := 1; scanner.Scan(); linenumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		code, message, found := strings.Cut(line, "=")
+		if !found {
+			return fmt.Errorf("line %d: missing '=' in '%s'", linenumber, line)
+		}
+
+		c.messages[locale][strings.TrimSpace(code)] = strings.TrimSpace(message)
+	}
+
+	return scanner.Err()
+}
+
+func normalizelocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+}
+
+func (c *Catalog) template(locale string, code string) (string, bool) {
+	locale = normalizelocale(locale)
+	candidates := []string{locale}
+	if base, _, found := strings.Cut(locale, "-"); found {
+		candidates = append(candidates, base)
+	}
+	candidates = append(candidates, c.fallback)
+
+	for _, l := range candidates {
+		if message, ok := c.messages[l][code]; ok {
+			return message, true
+		}
+	}
+
+	return "", false
+}
+
+// Renders the message for code in the locale, replacing {0}, {1}... with the
+// arguments. Unknown codes render as the code followed by the arguments.
+func (c *Catalog) Message(locale string, code string, args ...any) string {
+	message, ok := c.template(locale, code)
+	if !ok {
+		if len(args) == 0 {
+			return code
+		}
+		return fmt.Sprintf("%s %v", code, args)
+	}
+
+	for i, arg := range args {
+		message = strings.ReplaceAll(message, "{"+strconv.Itoa(i)+"}", fmt.Sprint(arg))
+	}
+
+	return message
+}
@@ -0,0 +1,128 @@
+package booleanparser
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Every code in stringresources.go.
+var codes = []string{
+	EMPTY_EXPRESSION, INVALID_CHAR, UNEXPECTED_END, SYNTAX_ERROR,
+	PRIMARY_NOT_FOUND, CLOSING_PARENTHESES_NOT_FOUND, MISSING_CLOSING_PARENTHESES,
+	PRIMARY_EXPECTED, UNTERMINATED_COMMENT, UNEXPECTED_TOKEN, BUNDLE_ERROR, POLICY_ERROR,
+	MISSING_EQUALS, POLICY_EXPECTED, INVALID_POLICY_NAME, DUPLICATE_POLICY,
+	UNKNOWN_KEY, UNEXPECTED_CONTINUATION, MISSING_EXPRESSION, INVALID_TEST,
+	UNKNOWN_POLICY,
+}
+
+func TestCatalogsHaveEveryCode(t *testing.T) {
+	c := DefaultCatalog()
+	for _, locale := range []string{"en", "es"} {
+		if len(c.messages[locale]) != len(codes) {
+			t.Errorf("%s catalog has %d messages, want %d", locale, len(c.messages[locale]), len(codes))
+		}
+		for _, code := range codes {
+			if _, ok := c.messages[locale][code]; !ok {
+				t.Errorf("%s catalog has no message for %s", locale, code)
+			}
+		}
+	}
+}
+
+func TestCatalogMessage(t *testing.T) {
+	c := DefaultCatalog()
+	for _, test := range []struct {
+		locale string
+		code   string
+		args   []any
+		want   string
+	}{
+		{"en", SYNTAX_ERROR, []any{"+", 7}, "Syntax error found near '+' (position: 7)."},
+		{"es", SYNTAX_ERROR, []any{"+", 7}, "Error de sintaxis cerca de '+' (posición: 7)."},
+		{"es-MX", PRIMARY_EXPECTED, nil, "Se esperaba un primario."},
+		{"ES_mx", PRIMARY_EXPECTED, nil, "Se esperaba un primario."},
+		{"fr-FR", PRIMARY_EXPECTED, nil, "Primary expected."},
+		{"en", "NO_SUCH_CODE", nil, "NO_SUCH_CODE"},
+		{"en", "NO_SUCH_CODE", []any{1, "a"}, "NO_SUCH_CODE [1 a]"},
+	} {
+		if got := c.Message(test.locale, test.code, test.args...); got != test.want {
+			t.Errorf("Message(%q, %s, %v) = %q, want %q", test.locale, test.code, test.args, got, test.want)
+		}
+	}
+}
+
+func TestLocalizeError(t *testing.T) {
+	err := &ParserError{Code: POLICY_ERROR, Args: []any{"p1", 3, 5}, Position: -1, Cause: NewParserErrorAt(2, PRIMARY_EXPECTED)}
+	if got, want := err.Error(), "Policy 'p1' (line: 3, column: 5).\nPrimary expected."; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+
+	joined := errors.Join(err, errors.New("plain"))
+	want := "Política 'p1' (línea: 3, columna: 5).\nSe esperaba un primario.\nplain"
+	if got := LocalizeError(joined, DefaultCatalog(), "es"); got != want {
+		t.Errorf("LocalizeError = %q, want %q", got, want)
+	}
+}
+
+func TestLoadCatalog(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("pt.txt", "# comment\n\nPRIMARY_EXPECTED = Primário esperado.\n")
+	write("pt_BR.txt", "EMPTY_EXPRESSION = Expressão vazia\n")
+	write("notes.md", "not a catalog")
+	c, err := LoadCatalog(dir, "pt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Message("pt-BR", PRIMARY_EXPECTED); got != "Primário esperado." {
+		t.Errorf("pt-BR falls back to pt: got %q", got)
+	}
+	if got := c.Message("pt-BR", EMPTY_EXPRESSION); got != "Expressão vazia" {
+		t.Errorf("pt-BR message: got %q", got)
+	}
+	if got := c.Message("de", PRIMARY_EXPECTED); got != "Primário esperado." {
+		t.Errorf("de falls back to the fallback locale: got %q", got)
+	}
+
+	write("xx.txt", "PRIMARY_EXPECTED = ok\nno equals here\n")
+	_, err = LoadCatalog(dir, "pt")
+	if err == nil || !strings.Contains(err.Error(), "xx.txt: line 2") {
+		t.Errorf("LoadCatalog with a malformed line: got %v", err)
+	}
+}
+
+// Run with -race: the default catalog is loaded once, by whichever
+// goroutine asks first.
+func TestDefaultCatalogConcurrent(t *testing.T) {
+	const goroutines = 8
+
+	// Start over, as other tests may have loaded it already.
+	_defaultcatalog, _defaultcatalogonce = nil, sync.Once{}
+
+	catalogs := make([]*Catalog, goroutines)
+	var wg sync.WaitGroup
+	for i := range catalogs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			catalogs[i] = DefaultCatalog()
+			_ = NewParserError(EMPTY_EXPRESSION).Error()
+		}(i)
+	}
+	wg.Wait()
+
+	for _, c := range catalogs {
+		if c != catalogs[0] {
+			t.Fatalf("DefaultCatalog returned different catalogs")
+		}
+	}
+}
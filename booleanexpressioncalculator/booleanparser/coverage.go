@@ -0,0 +1,394 @@
+package booleanparser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Suggestions enumerate every assignment of the distinct labels, so they are
+// only computed for expressions up to this number of distinct labels.
+const maxSuggestionLabels = 12
+
+// Records which values were observed for a decision, condition or operator.
+type OutcomeCoverage struct {
+	True  bool
+	False bool
+}
+
+func (o *OutcomeCoverage) record(value bool) {
+	if value {
+		o.True = true
+	} else {
+		o.False = true
+	}
+}
+
+func (o OutcomeCoverage) Covered() bool {
+	return o.True && o.False
+}
+
+// Coverage of one label occurrence (a condition).
+//   - Outcomes, the values taken by the occurrence (condition coverage).
+//   - Pair, indexes into CoverageReport.Contexts of two contexts showing the
+//     occurrence independently affects the result (masking MC/DC), nil when
+//     no such pair exists.
+type LabelCoverage struct {
+	Label    *LabelNode
+	Outcomes OutcomeCoverage
+	Pair     []int
+}
+
+func (lc LabelCoverage) MCDC() bool {
+	return lc.Pair != nil
+}
+
+// Coverage of one operator.
+//   - Outcomes, the values produced by the operator.
+//   - Combinations, the operand values observed; for binary operators the
+//     index is left*2+right, for the negation it is the operand value.
+type OperatorCoverage struct {
+	Operator     Node
+	Outcomes     OutcomeCoverage
+	Combinations []bool
+}
+
+// Returns the operand combinations, like "TF", still needed for every operand
+// of the operator to be shown to independently affect its result.
+func (oc OperatorCoverage) Missing() []string {
+	var missing []string
+	switch op := oc.Operator.(type) {
+	case *NotNode:
+		for v, seen := range oc.Combinations {
+			if !seen {
+				missing = append(missing, combinationName(v, 1))
+			}
+		}
+	case *BinaryNode:
+		var required []int
+		switch op.Kind {
+		case AND:
+			required = []int{3, 2, 1}
+		case OR:
+			required = []int{0, 2, 1}
+		case XOR:
+			// Any three of the four combinations pair up both operands.
+			seen := 0
+			for _, s := range oc.Combinations {
+				if s {
+					seen++
+				}
+			}
+			for c := 0; c < 4 && seen < 3; c++ {
+				if !oc.Combinations[c] {
+					missing = append(missing, combinationName(c, 2))
+					seen++
+				}
+			}
+		}
+
+		for _, c := range required {
+			if !oc.Combinations[c] {
+				missing = append(missing, combinationName(c, 2))
+			}
+		}
+	}
+
+	return missing
+}
+
+func combinationName(c int, operands int) string {
+	name := ""
+	for i := operands - 1; i >= 0; i-- {
+		if c&(1<<i) != 0 {
+			name += "T"
+		} else {
+			name += "F"
+		}
+	}
+
+	return name
+}
+
+type CoverageReport struct {
+	Expression  string
+	Contexts    [][]string
+	Results     []bool // the result of the expression under each context
+	Decision    OutcomeCoverage
+	Labels      []LabelCoverage
+	Operators   []OperatorCoverage
+	Suggestions [][]string // contexts that would close the coverage gaps
+}
+
+// Evaluates the expression under every context and reports decision,
+// condition, operator and MC/DC coverage, plus suggested contexts for the
+// gaps found.
+func MeasureCoverage(pe *ParsedExpression, contexts [][]string) *CoverageReport {
+	report := &CoverageReport{
+		Expression: pe.Expression,
+		Contexts:   contexts,
+		Labels:     make([]LabelCoverage, len(pe.Labels)),
+		Operators:  make([]OperatorCoverage, len(pe.Operators)),
+	}
+
+	operatorindex := make(map[Node]int, len(pe.Operators))
+	for i, op := range pe.Operators {
+		operatorindex[op] = i
+		report.Operators[i].Operator = op
+		if _, ok := op.(*NotNode); ok {
+			report.Operators[i].Combinations = make([]bool, 2)
+		} else {
+			report.Operators[i].Combinations = make([]bool, 4)
+		}
+	}
+
+	observe := func(n Node, operands []bool, result bool) {
+		oc := &report.Operators[operatorindex[n]]
+		oc.Outcomes.record(result)
+		c := 0
+		for _, v := range operands {
+			c <<= 1
+			if v {
+				c |= 1
+			}
+		}
+		oc.Combinations[c] = true
+	}
+
+	tests := make([]testcase, len(contexts))
+	for i, ctx := range contexts {
+		values := pe.Values(ctx)
+		result := pe.Root.eval(values, observe)
+		tests[i] = testcase{values: values, result: result}
+		report.Results = append(report.Results, result)
+		report.Decision.record(result)
+		for j, v := range values {
+			report.Labels[j].Outcomes.record(v)
+		}
+	}
+
+	for i, l := range pe.Labels {
+		report.Labels[i].Label = l
+		if a, b, ok := pe.independencePair(tests, i); ok {
+			report.Labels[i].Pair = []int{a, b}
+		}
+	}
+
+	report.Suggestions = pe.suggest(tests)
+	return report
+}
+
+type testcase struct {
+	values []bool
+	result bool
+}
+
+// Reports whether flipping only the given occurrence changes the result.
+func (pe *ParsedExpression) determinative(values []bool, occurrence int) bool {
+	flipped := make([]bool, len(values))
+	copy(flipped, values)
+	flipped[occurrence] = !flipped[occurrence]
+	return pe.Root.eval(values, nil) != pe.Root.eval(flipped, nil)
+}
+
+func (pe *ParsedExpression) pairs(a, b testcase, occurrence int) bool {
+	return a.values[occurrence] != b.values[occurrence] &&
+		a.result != b.result &&
+		pe.determinative(a.values, occurrence) &&
+		pe.determinative(b.values, occurrence)
+}
+
+func (pe *ParsedExpression) independencePair(tests []testcase, occurrence int) (int, int, bool) {
+	for a := range tests {
+		for b := a + 1; b < len(tests); b++ {
+			if pe.pairs(tests[a], tests[b], occurrence) {
+				return a, b, true
+			}
+		}
+	}
+
+	return -1, -1, false
+}
+
+// Proposes contexts that cover the missing decision outcomes and the label
+// occurrences without an independence pair, preferring contexts close to the
+// existing ones. Occurrences that can never affect the result, as in
+// "A & !A", get no suggestion.
+func (pe *ParsedExpression) suggest(tests []testcase) [][]string {
+	var labels []string
+	seen := make(map[string]bool)
+	for _, l := range pe.Labels {
+		if !seen[l.Label] {
+			seen[l.Label] = true
+			labels = append(labels, l.Label)
+		}
+	}
+
+	if len(labels) > maxSuggestionLabels {
+		return nil
+	}
+
+	type candidate struct {
+		ctx []string
+		testcase
+	}
+
+	candidates := make([]candidate, 1<<len(labels))
+	for mask := range candidates {
+		var ctx []string
+		for i, l := range labels {
+			if mask&(1<<i) != 0 {
+				ctx = append(ctx, l)
+			}
+		}
+		values := pe.Values(ctx)
+		candidates[mask] = candidate{ctx: ctx, testcase: testcase{values: values, result: pe.Root.eval(values, nil)}}
+	}
+
+	var suggestions [][]string
+	add := func(c candidate) {
+		suggestions = append(suggestions, c.ctx)
+		tests = append(tests, c.testcase)
+	}
+
+	var decision OutcomeCoverage
+	for _, t := range tests {
+		decision.record(t.result)
+	}
+	for _, missing := range []bool{true, false} {
+		if (missing && decision.True) || (!missing && decision.False) {
+			continue
+		}
+		for _, c := range candidates {
+			if c.result == missing {
+				add(c)
+				break
+			}
+		}
+	}
+
+	for occurrence, l := range pe.Labels {
+		if _, _, ok := pe.independencePair(tests, occurrence); ok {
+			continue
+		}
+
+		best, bestdistance := -1, len(pe.Labels)+1
+		for i, c := range candidates {
+			for _, t := range tests {
+				if d := distance(c.values, t.values); d < bestdistance && pe.pairs(c.testcase, t, occurrence) {
+					best, bestdistance = i, d
+				}
+			}
+		}
+
+		if best >= 0 {
+			add(candidates[best])
+			continue
+		}
+
+		// No existing context pairs with any candidate, look for two new
+		// contexts that only differ on the label of this occurrence.
+		bit := 0
+		for i, name := range labels {
+			if name == l.Label {
+				bit = 1 << i
+			}
+		}
+		for mask, c := range candidates {
+			if mask&bit == 0 && pe.pairs(c.testcase, candidates[mask|bit].testcase, occurrence) {
+				add(c)
+				add(candidates[mask|bit])
+				break
+			}
+		}
+	}
+
+	return suggestions
+}
+
+func distance(a, b []bool) int {
+	d := 0
+	for i := range a {
+		if a[i] != b[i] {
+			d++
+		}
+	}
+
+	return d
+}
+
+func ratio(covered, total int) float64 {
+	if total == 0 {
+		return 1
+	}
+
+	return float64(covered) / float64(total)
+}
+
+func (r *CoverageReport) ConditionRatio() float64 {
+	covered := 0
+	for _, lc := range r.Labels {
+		if lc.Outcomes.Covered() {
+			covered++
+		}
+	}
+
+	return ratio(covered, len(r.Labels))
+}
+
+func (r *CoverageReport) MCDCRatio() float64 {
+	covered := 0
+	for _, lc := range r.Labels {
+		if lc.MCDC() {
+			covered++
+		}
+	}
+
+	return ratio(covered, len(r.Labels))
+}
+
+func outcomeName(o OutcomeCoverage) string {
+	switch {
+	case o.Covered():
+		return "true and false"
+	case o.True:
+		return "only true"
+	case o.False:
+		return "only false"
+	}
+
+	return "never evaluated"
+}
+
+func (r *CoverageReport) String() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "Expression: %s\n", r.Expression)
+	fmt.Fprintf(&sb, "Contexts: %d\n", len(r.Contexts))
+	fmt.Fprintf(&sb, "Decision: %s\n", outcomeName(r.Decision))
+	fmt.Fprintf(&sb, "Condition coverage: %.0f%%\n", 100*r.ConditionRatio())
+	fmt.Fprintf(&sb, "MC/DC coverage: %.0f%%\n", 100*r.MCDCRatio())
+
+	for _, lc := range r.Labels {
+		fmt.Fprintf(&sb, "  [label #%d %s] %s", lc.Label.Occurrence, lc.Label.Label, outcomeName(lc.Outcomes))
+		if lc.MCDC() {
+			fmt.Fprintf(&sb, ", independence shown by contexts %d and %d\n", lc.Pair[0], lc.Pair[1])
+		} else {
+			fmt.Fprintf(&sb, ", independence not shown\n")
+		}
+	}
+
+	for _, oc := range r.Operators {
+		fmt.Fprintf(&sb, "  [operator %s] %s", oc.Operator.String(), outcomeName(oc.Outcomes))
+		if missing := oc.Missing(); len(missing) > 0 {
+			fmt.Fprintf(&sb, ", missing operands %s\n", strings.Join(missing, " "))
+		} else {
+			fmt.Fprintf(&sb, "\n")
+		}
+	}
+
+	for _, s := range r.Suggestions {
+		fmt.Fprintf(&sb, "Suggested context: [%s]\n", strings.Join(s, ", "))
+	}
+
+	return sb.String()
+}
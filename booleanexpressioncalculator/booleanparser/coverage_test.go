@@ -0,0 +1,158 @@
+package booleanparser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func mustParse(t *testing.T, expression string) *ParsedExpression {
+	t.Helper()
+	pe, err := ParseExpression(expression, nil)
+	if err != nil {
+		t.Fatalf("ParseExpression(%q): %v", expression, err)
+	}
+
+	return pe
+}
+
+func TestParseExpressionFollowsGrammar(t *testing.T) {
+	pe := mustParse(t, "A ^ B ^ C & !D | (A)")
+	if got, want := pe.Root.String(), "(((A ^ (B ^ C)) & !D) | A)"; got != want {
+		t.Errorf("Root = %s, want %s", got, want)
+	}
+
+	var labels []string
+	for i, l := range pe.Labels {
+		if l.Occurrence != i {
+			t.Errorf("label %s has occurrence %d, want %d", l.Label, l.Occurrence, i)
+		}
+		labels = append(labels, l.Label)
+	}
+	if want := []string{"A", "B", "C", "D", "A"}; !reflect.DeepEqual(labels, want) {
+		t.Errorf("Labels = %v, want %v", labels, want)
+	}
+
+	var operators []string
+	for _, op := range pe.Operators {
+		operators = append(operators, op.String())
+	}
+	want := []string{"(B ^ C)", "(A ^ (B ^ C))", "!D", "((A ^ (B ^ C)) & !D)", "(((A ^ (B ^ C)) & !D) | A)"}
+	if !reflect.DeepEqual(operators, want) {
+		t.Errorf("Operators = %v, want %v", operators, want)
+	}
+
+	// The tree evaluates like the expression does while parsing.
+	for _, ctx := range [][]string{nil, {"A"}, {"B"}, {"A", "B", "C"}, {"D"}, {"B", "C", "D"}} {
+		value, err := EvaluateBooleanExpression(pe.Expression, ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := pe.Evaluate(ctx); got != value {
+			t.Errorf("Evaluate(%v) = %v, EvaluateBooleanExpression = %v", ctx, got, value)
+		}
+	}
+}
+
+func TestMeasureCoverage(t *testing.T) {
+	pe := mustParse(t, "A & B")
+	report := MeasureCoverage(pe, [][]string{{"A", "B"}, {"A"}, {"B"}})
+
+	if !report.Decision.Covered() {
+		t.Errorf("Decision = %+v, want both outcomes", report.Decision)
+	}
+	if report.ConditionRatio() != 1 || report.MCDCRatio() != 1 {
+		t.Errorf("ConditionRatio = %v, MCDCRatio = %v, want 1 and 1", report.ConditionRatio(), report.MCDCRatio())
+	}
+	if want := []bool{true, false, false}; !reflect.DeepEqual(report.Results, want) {
+		t.Errorf("Results = %v, want %v", report.Results, want)
+	}
+	if got := report.Labels[0].Pair; !reflect.DeepEqual(got, []int{0, 2}) {
+		t.Errorf("pair of A = %v, want [0 2]", got)
+	}
+	if got := report.Labels[1].Pair; !reflect.DeepEqual(got, []int{0, 1}) {
+		t.Errorf("pair of B = %v, want [0 1]", got)
+	}
+	if missing := report.Operators[0].Missing(); len(missing) != 0 {
+		t.Errorf("Missing = %v, want none", missing)
+	}
+	if len(report.Suggestions) != 0 {
+		t.Errorf("Suggestions = %v, want none", report.Suggestions)
+	}
+
+	s := report.String()
+	for _, want := range []string{"Condition coverage: 100%", "MC/DC coverage: 100%", "independence shown by contexts 0 and 2"} {
+		if !strings.Contains(s, want) {
+			t.Errorf("String() = %q, without %q", s, want)
+		}
+	}
+}
+
+func TestSuggestionsCloseTheGaps(t *testing.T) {
+	for _, test := range []struct {
+		expression string
+		contexts   [][]string
+	}{
+		{"A & B", [][]string{{"A", "B"}}},
+		{"A | B & C", nil},
+		{"(A | B) & !C", [][]string{{"A"}, {"C"}}},
+		{"A ^ B ^ C", [][]string{{"A", "B", "C"}}},
+	} {
+		pe := mustParse(t, test.expression)
+		report := MeasureCoverage(pe, test.contexts)
+		if report.MCDCRatio() == 1 {
+			t.Errorf("%s: MCDCRatio = 1 before the suggestions", test.expression)
+		}
+		if len(report.Suggestions) == 0 {
+			t.Errorf("%s: no suggestions", test.expression)
+			continue
+		}
+
+		contexts := append(append([][]string{}, test.contexts...), report.Suggestions...)
+		report = MeasureCoverage(pe, contexts)
+		if !report.Decision.Covered() || report.MCDCRatio() != 1 {
+			t.Errorf("%s: with suggestions %v, Decision = %+v and MCDCRatio = %v", test.expression, contexts, report.Decision, report.MCDCRatio())
+		}
+	}
+}
+
+func TestNoSuggestionsForMaskedLabels(t *testing.T) {
+	// Neither occurrence of A can change the result, which is always false.
+	pe := mustParse(t, "A & !A")
+	report := MeasureCoverage(pe, [][]string{{"A"}, nil})
+	if report.Decision.True || report.MCDCRatio() != 0 {
+		t.Errorf("Decision = %+v, MCDCRatio = %v", report.Decision, report.MCDCRatio())
+	}
+	if len(report.Suggestions) != 0 {
+		t.Errorf("Suggestions = %v, want none", report.Suggestions)
+	}
+}
+
+func TestMissing(t *testing.T) {
+	and := &BinaryNode{Kind: AND, Operator: "&"}
+	or := &BinaryNode{Kind: OR, Operator: "|"}
+	xor := &BinaryNode{Kind: XOR, Operator: "^"}
+	not := &NotNode{}
+
+	for _, test := range []struct {
+		operator     Node
+		combinations []bool
+		want         []string
+	}{
+		{and, []bool{false, false, false, true}, []string{"TF", "FT"}},
+		{and, []bool{false, true, true, true}, nil},
+		{and, []bool{true, false, false, false}, []string{"TT", "TF", "FT"}},
+		{or, []bool{true, false, false, false}, []string{"TF", "FT"}},
+		{or, []bool{true, true, true, false}, nil},
+		{xor, []bool{false, false, false, true}, []string{"FF", "FT"}},
+		{xor, []bool{true, false, true, false}, []string{"FT"}},
+		{xor, []bool{false, true, true, true}, nil},
+		{not, []bool{true, false}, []string{"T"}},
+		{not, []bool{true, true}, nil},
+	} {
+		oc := OperatorCoverage{Operator: test.operator, Combinations: test.combinations}
+		if got := oc.Missing(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Missing of %T with %v = %v, want %v", test.operator, test.combinations, got, test.want)
+		}
+	}
+}
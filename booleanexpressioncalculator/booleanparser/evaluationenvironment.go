@@ -14,11 +14,24 @@ func IsProperLabel(label string) bool {
 	return true
 }
 
+// The label sets used while tokenizing an expression, implemented by
+// Context and Universe, and by their immutable snapshots.
+type LabelSet interface {
+	Contains(label string) bool
+}
+
+type LabelResolver interface {
+	Contains(label string) bool
+	GetLabel(label string) string
+}
+
 type LabelIdPair struct {
 	Label string
 	Id    string
 }
 
+// A Universe is not safe for concurrent use when labels are added while it is
+// being read, share a UniverseSnapshot or an AtomicUniverse instead.
 type Universe struct {
 	u6e map[string]string
 }
@@ -43,6 +56,8 @@ func (u *Universe) GetLabel(label string) string {
 	return u.u6e[strings.ToUpper(label)]
 }
 
+// Like Universe, a Context is not safe for concurrent use while labels are
+// added, see ContextSnapshot.
 type Context struct {
 	c map[string]bool
 }
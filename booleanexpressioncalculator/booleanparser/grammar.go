@@ -1,114 +1,146 @@
 package booleanparser
 
-import "errors"
-
 type ExpressionValue struct {
 	Value bool
 }
 
+// A builder makes the result of every rule of the grammar: valuebuilder
+// computes the value of the expression while parsing, and a
+// *ParsedExpression builds its syntax tree. Both are called in the order the
+// tokens are consumed, so the operands of an operator are always built
+// before the operator.
+type builder[T any] interface {
+	label(t *Token) T
+	not(operand T) T
+	binary(operator *Token, left T, right T) T
+}
+
+type valuebuilder struct{}
+
+func (valuebuilder) label(t *Token) *ExpressionValue {
+	return &ExpressionValue{Value: t.Value}
+}
+
+func (valuebuilder) not(operand *ExpressionValue) *ExpressionValue {
+	return &ExpressionValue{Value: !operand.Value}
+}
+
+func (valuebuilder) binary(operator *Token, left *ExpressionValue, right *ExpressionValue) *ExpressionValue {
+	switch operator.Kind {
+	case XOR:
+		return &ExpressionValue{Value: left.Value != right.Value}
+	case AND:
+		return &ExpressionValue{Value: left.Value && right.Value}
+	}
+
+	return &ExpressionValue{Value: left.Value || right.Value}
+}
+
 func Primary(ts *TokenStream) (*ExpressionValue, error) {
+	return parseprimary[*ExpressionValue](ts, valuebuilder{})
+}
+
+func Term(ts *TokenStream) (*ExpressionValue, error) {
+	return parseterm[*ExpressionValue](ts, valuebuilder{})
+}
+
+func Expression(ts *TokenStream) (*ExpressionValue, error) {
+	return parseexpression[*ExpressionValue](ts, valuebuilder{})
+}
+
+func parseprimary[T any](ts *TokenStream, b builder[T]) (T, error) {
+	var none T
+
 	t := ts.Get()
 	if t == nil {
-		return nil, errors.New("Unexpected end-of-stream, Primary not found.")
+		return none, NewParserError(PRIMARY_NOT_FOUND)
 	}
 
 	switch tokenkind := t.Kind; tokenkind {
 	case NOT:
-		ev, err := Primary(ts)
+		operand, err := parseprimary(ts, b)
 		if err != nil {
-			return nil, err
+			return none, err
 		}
 
-		return &ExpressionValue{Value: !ev.Value}, nil
+		return b.not(operand), nil
 
 	case OPENPARENTHESES:
-		ev, err := Expression(ts)
+		inner, err := parseexpression(ts, b)
 		if err != nil {
-			return nil, err
+			return none, err
 		}
 
 		t = ts.Get()
 		if t == nil {
-			return nil, errors.New("Unexpected end-of-stream, closing parentheses not found.")
+			return none, NewParserError(CLOSING_PARENTHESES_NOT_FOUND)
 		}
 
 		if t.Kind != CLOSEPARENTHESES {
-			return nil, errors.New("Missing closing parentheses.")
+			return none, NewParserErrorAt(t.Position, MISSING_CLOSING_PARENTHESES)
 		}
 
-		return &ExpressionValue{Value: ev.Value}, nil
+		return inner, nil
 
 	case LABEL:
-		return &ExpressionValue{Value: t.Value}, nil
+		return b.label(t), nil
 
 	default:
 		// Do nothing, the error will be thrown in the return after the
 		// switch statement
 	}
 
-	return nil, errors.New("Primary expected.")
+	return none, NewParserErrorAt(t.Position, PRIMARY_EXPECTED)
 }
 
-func Term(ts *TokenStream) (*ExpressionValue, error) {
-	ev, err := Primary(ts)
+func parseterm[T any](ts *TokenStream, b builder[T]) (T, error) {
+	left, err := parseprimary(ts, b)
 	if err != nil {
-		return nil, err
+		return left, err
 	}
 
-	left := ev.Value
-
 	for t := ts.Get(); t != nil; {
 		switch tokenkind := t.Kind; tokenkind {
 		case XOR:
-			ev, err = Term(ts)
+			right, err := parseterm(ts, b)
 			if err != nil {
-				return nil, err
+				return right, err
 			}
 
-			right := ev.Value
-			left = left != right
+			left = b.binary(t, left, right)
 		default:
 			ts.Push(t)
-			return &ExpressionValue{Value: left}, nil
+			return left, nil
 		}
 
 		t = ts.Get()
 	}
 
-	return &ExpressionValue{Value: left}, nil
+	return left, nil
 }
 
-func Expression(ts *TokenStream) (*ExpressionValue, error) {
-	ev, err := Term(ts)
+func parseexpression[T any](ts *TokenStream, b builder[T]) (T, error) {
+	left, err := parseterm(ts, b)
 	if err != nil {
-		return nil, err
+		return left, err
 	}
 
-	left := ev.Value
-
 	for t := ts.Get(); t != nil; {
 		switch tokenkind := t.Kind; tokenkind {
-		case AND:
-			ev, err = Term(ts)
-			if err != nil {
-				return nil, err
-			}
-
-			left = left && ev.Value
-		case OR:
-			ev, err = Term(ts)
+		case AND, OR:
+			right, err := parseterm(ts, b)
 			if err != nil {
-				return nil, err
+				return right, err
 			}
 
-			left = left || ev.Value
+			left = b.binary(t, left, right)
 		default:
 			ts.Push(t)
-			return &ExpressionValue{Value: left}, nil
+			return left, nil
 		}
 
 		t = ts.Get()
 	}
 
-	return &ExpressionValue{Value: left}, nil
+	return left, nil
 }
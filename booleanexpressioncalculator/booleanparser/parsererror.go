@@ -0,0 +1,62 @@
+package booleanparser
+
+import (
+	"errors"
+	"strings"
+)
+
+// A ParserError is an error with a stable code and the arguments of its
+// message, so it can be rendered in any locale of a Catalog.
+type ParserError struct {
+	Code     string
+	Args     []any
+	Position int // index of the rune where the error was found, -1 if unknown
+	Cause    error
+}
+
+func NewParserError(code string, args ...any) *ParserError {
+	return &ParserError{Code: code, Args: args, Position: -1}
+}
+
+func NewParserErrorAt(position int, code string, args ...any) *ParserError {
+	return &ParserError{Code: code, Args: args, Position: position}
+}
+
+// Renders the error, and its causes, with the default catalog.
+func (e *ParserError) Error() string {
+	return e.Localize(DefaultCatalog(), DEFAULT_LOCALE)
+}
+
+func (e *ParserError) Unwrap() error {
+	return e.Cause
+}
+
+// Renders the error, and its causes one per line, in the given locale.
+func (e *ParserError) Localize(c *Catalog, locale string) string {
+	lines := []string{c.Message(locale, e.Code, e.Args...)}
+	if e.Cause != nil {
+		lines = append(lines, LocalizeError(e.Cause, c, locale))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Renders any error returned by the package in the given locale, errors that
+// are not a ParserError are rendered as is.
+func LocalizeError(err error, c *Catalog, locale string) string {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var lines []string
+		for _, e := range joined.Unwrap() {
+			lines = append(lines, LocalizeError(e, c, locale))
+		}
+
+		return strings.Join(lines, "\n")
+	}
+
+	var pe *ParserError
+	if errors.As(err, &pe) {
+		return pe.Localize(c, locale)
+	}
+
+	return err.Error()
+}
@@ -0,0 +1,265 @@
+package booleanparser
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+// A policy bundle holds several named policies, for example:
+//
+//	# Access policies of the data team
+//	[can-modify]
+//	description = Users allowed to change the data
+//	owner = data-team
+//	owner = security
+//	expression =
+//	    (Update | Insert)   # write access
+//	    & !Execute          /* but never execute */
+//	test = true: Update, Alter
+//	test = false: Update, Execute
+//
+// Lines are either a "[policy-name]" section, a "key = value" pair, a
+// comment starting with '#' or blank. Indented lines continue the value of
+// the previous description or expression, so long expressions can span
+// several lines. A test lists the expected result and the labels of the
+// context, separated by ':'. The owner and test keys can be repeated.
+
+type PolicyTest struct {
+	Context  []string
+	Expected bool
+	Line     int
+}
+
+type Policy struct {
+	Name        string
+	Description string
+	Owners      []string
+	Expression  string
+	Parsed      *ParsedExpression
+	Tests       []PolicyTest
+	Line        int // line of the policy section in the bundle
+
+	// Location in the bundle of the pieces of Expression.
+	segments []segment
+}
+
+// A segment is a piece of an expression that starts at offset, in runes, of
+// the expression and at line and column of the bundle.
+type segment struct {
+	offset int
+	line   int
+	column int
+}
+
+type PolicySet struct {
+	Policies map[string]*Policy
+	Names    []string // policy names in order of appearance
+}
+
+type PolicyTestResult struct {
+	Policy   string
+	Test     PolicyTest
+	Observed bool
+	Passed   bool
+}
+
+func LoadPolicySetFile(path string, unvrs [][]string) (*PolicySet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return LoadPolicySet(f, unvrs)
+}
+
+// Reads a policy bundle and parses every policy with the given universe.
+// All the errors found are returned joined; each one is a ParserError that
+// reports the policy name plus line and column within the bundle.
+func LoadPolicySet(r io.Reader, unvrs [][]string) (*PolicySet, error) {
+	ps := &PolicySet{Policies: make(map[string]*Policy)}
+	var errs []error
+	var current *Policy
+	lastkey := ""
+
+	fail := func(line int, column int, cause error) {
+		var e *ParserError
+		if current == nil {
+			e = NewParserError(BUNDLE_ERROR, line, column)
+		} else {
+			e = NewParserError(POLICY_ERROR, current.Name, line, column)
+		}
+		e.Cause = cause
+		errs = append(errs, e)
+	}
+
+	scanner := bufio.NewScanner(r)
+	for linenumber := 1; scanner.Scan(); linenumber++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		trimmed := strings.TrimSpace(line)
+		column := len([]rune(line)) - len([]rune(strings.TrimLeft(line, _whitespace))) + 1
+
+		switch {
+		case trimmed == "":
+			continue
+
+		case column > 1 && current != nil && lastkey == "expression",
+			column > 1 && current != nil && lastkey == "description" && !strings.HasPrefix(trimmed, "#"):
+			if lastkey == "description" {
+				current.Description = strings.TrimSpace(current.Description + " " + trimmed)
+				continue
+			}
+
+			current.segments = append(current.segments, segment{offset: len([]rune(current.Expression)) + 1, line: linenumber, column: 1})
+			current.Expression += "\n" + line
+
+		case strings.HasPrefix(trimmed, "#"):
+			continue
+
+		case column > 1:
+			fail(linenumber, column, NewParserError(UNEXPECTED_CONTINUATION))
+
+		case strings.HasPrefix(trimmed, "["):
+			name := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(trimmed, "["), "]"))
+			lastkey = ""
+			// Invalid or duplicated policies are still read, so their keys
+			// don't report more errors, but they are not added to the set.
+			current = &Policy{Name: name, Line: linenumber}
+			if !strings.HasSuffix(trimmed, "]") || !IsProperLabel(name) {
+				fail(linenumber, column, NewParserError(INVALID_POLICY_NAME, name))
+				continue
+			}
+
+			if previous, ok := ps.Policies[name]; ok {
+				fail(linenumber, column, NewParserError(DUPLICATE_POLICY, previous.Line))
+				continue
+			}
+
+			ps.Policies[name] = current
+			ps.Names = append(ps.Names, name)
+
+		default:
+			key, value, found := strings.Cut(line, "=")
+			if !found {
+				fail(linenumber, column, NewParserError(MISSING_EQUALS))
+				continue
+			}
+
+			key = strings.ToLower(strings.TrimSpace(key))
+			lastkey = key
+			if current == nil {
+				fail(linenumber, column, NewParserError(POLICY_EXPECTED, key))
+				continue
+			}
+
+			switch key {
+			case "description":
+				current.Description = strings.TrimSpace(value)
+
+			case "owner":
+				current.Owners = append(current.Owners, strings.TrimSpace(value))
+
+			case "expression":
+				valuecolumn := len([]rune(line)) - len([]rune(value)) + 1
+				current.Expression = value
+				current.segments = []segment{{offset: 0, line: linenumber, column: valuecolumn}}
+
+			case "test":
+				outcome, labels, found := strings.Cut(value, ":")
+				outcome = strings.ToLower(strings.TrimSpace(outcome))
+				if !found || (outcome != "true" && outcome != "false") {
+					fail(linenumber, column, NewParserError(INVALID_TEST, strings.TrimSpace(value)))
+					continue
+				}
+
+				test := PolicyTest{Expected: outcome == "true", Line: linenumber}
+				for _, l := range strings.Split(labels, ",") {
+					if l = strings.TrimSpace(l); l != "" {
+						test.Context = append(test.Context, l)
+					}
+				}
+				current.Tests = append(current.Tests, test)
+
+			default:
+				fail(linenumber, column, NewParserError(UNKNOWN_KEY, key))
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, name := range ps.Names {
+		current = ps.Policies[name]
+		if current.segments == nil {
+			fail(current.Line, 1, NewParserError(MISSING_EXPRESSION))
+			continue
+		}
+
+		parsed, parseerror := ParseExpression(current.Expression, unvrs)
+		if parseerror != nil {
+			line, column := current.location(parseerror)
+			fail(line, column, parseerror)
+			continue
+		}
+
+		current.Parsed = parsed
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return ps, nil
+}
+
+// Returns the line and column of the bundle where the expression error was
+// found, errors without position point right after the expression.
+func (p *Policy) location(err error) (int, int) {
+	position := len([]rune(p.Expression))
+	var pe *ParserError
+	if errors.As(err, &pe) && pe.Position >= 0 {
+		position = pe.Position
+	}
+
+	s := p.segments[0]
+	for _, candidate := range p.segments {
+		if candidate.offset <= position {
+			s = candidate
+		}
+	}
+
+	return s.line, s.column + position - s.offset
+}
+
+func (ps *PolicySet) Evaluate(name string, ctx []string) (bool, error) {
+	policy, ok := ps.Policies[name]
+	if !ok {
+		return false, NewParserError(UNKNOWN_POLICY, name)
+	}
+
+	return policy.Parsed.Evaluate(ctx), nil
+}
+
+// Evaluates every test of every policy in the set.
+func (ps *PolicySet) RunTests() []PolicyTestResult {
+	var results []PolicyTestResult
+	for _, name := range ps.Names {
+		policy := ps.Policies[name]
+		for _, test := range policy.Tests {
+			observed := policy.Parsed.Evaluate(test.Context)
+			results = append(results, PolicyTestResult{
+				Policy:   name,
+				Test:     test,
+				Observed: observed,
+				Passed:   observed == test.Expected,
+			})
+		}
+	}
+
+	return results
+}
@@ -0,0 +1,141 @@
+package booleanparser
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const bundle = `# Access policies of the data team
+[can-modify]
+description = Users allowed
+    to change the data
+owner = data-team
+owner = security
+expression =
+    (Update | Insert)   # write access
+    & !Execute          /* but never execute */
+test = true: Update, Alter
+test = false: Update, Execute
+
+[can-read]
+expression = Read
+test = true: Read
+`
+
+func TestLoadPolicySet(t *testing.T) {
+	ps, err := LoadPolicySet(strings.NewReader(bundle), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"can-modify", "can-read"}; !reflect.DeepEqual(ps.Names, want) {
+		t.Errorf("Names = %v, want %v", ps.Names, want)
+	}
+
+	p := ps.Policies["can-modify"]
+	if p.Description != "Users allowed to change the data" {
+		t.Errorf("Description = %q", p.Description)
+	}
+	if want := []string{"data-team", "security"}; !reflect.DeepEqual(p.Owners, want) {
+		t.Errorf("Owners = %v, want %v", p.Owners, want)
+	}
+	if p.Line != 2 || len(p.Tests) != 2 || p.Tests[1].Line != 11 || p.Tests[1].Expected {
+		t.Errorf("Line = %d, Tests = %+v", p.Line, p.Tests)
+	}
+
+	for _, result := range ps.RunTests() {
+		if !result.Passed {
+			t.Errorf("test of %s at line %d failed", result.Policy, result.Test.Line)
+		}
+	}
+
+	if value, err := ps.Evaluate("can-modify", []string{"Insert"}); err != nil || !value {
+		t.Errorf("Evaluate(can-modify) = %v, %v", value, err)
+	}
+	var pe *ParserError
+	if _, err := ps.Evaluate("can-delete", nil); !errors.As(err, &pe) || pe.Code != UNKNOWN_POLICY {
+		t.Errorf("Evaluate(can-delete) error = %v", err)
+	}
+}
+
+// locations renders every error of a bundle as "[policy] line:column CODE".
+func locations(t *testing.T, err error) []string {
+	t.Helper()
+	var errs []error
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	} else if err != nil {
+		errs = []error{err}
+	}
+
+	var got []string
+	for _, err := range errs {
+		var pe *ParserError
+		if !errors.As(err, &pe) || pe.Cause == nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		cause := pe.Cause.(*ParserError).Code
+		switch pe.Code {
+		case BUNDLE_ERROR:
+			got = append(got, fmt.Sprintf("%d:%d %s", pe.Args[0], pe.Args[1], cause))
+		case POLICY_ERROR:
+			got = append(got, fmt.Sprintf("%s %d:%d %s", pe.Args[0], pe.Args[1], pe.Args[2], cause))
+		default:
+			t.Fatalf("unexpected error code %s", pe.Code)
+		}
+	}
+
+	return got
+}
+
+func TestLoadPolicySetErrors(t *testing.T) {
+	for _, test := range []struct {
+		bundle string
+		want   []string
+	}{
+		{
+			"[p3]\nexpression = A B\n",
+			[]string{"p3 2:16 UNEXPECTED_TOKEN"},
+		},
+		{
+			"[p3]\nexpression = (A | B) C & D\n",
+			[]string{"p3 2:22 UNEXPECTED_TOKEN"},
+		},
+		{
+			"[p3]\nexpression = A )\n",
+			[]string{"p3 2:16 UNEXPECTED_TOKEN"},
+		},
+		{
+			"[p]\nexpression =\n    (A |\n     ) & B\n",
+			[]string{"p 4:6 PRIMARY_EXPECTED"},
+		},
+		{
+			"[p]\nexpression = (A | B\n",
+			[]string{"p 2:20 CLOSING_PARENTHESES_NOT_FOUND"},
+		},
+		{
+			"[p]\nexpression = A & $\n",
+			[]string{"p 2:18 SYNTAX_ERROR"},
+		},
+		{
+			"owner = nobody\n  indented\n[p]\nexpression = A\nno equals\n",
+			[]string{"1:1 POLICY_EXPECTED", "2:3 UNEXPECTED_CONTINUATION", "p 5:1 MISSING_EQUALS"},
+		},
+		{
+			"[p]\nexpression = A\n[p]\nexpression = B\n[bad name]\nexpression = C\n[q\n",
+			[]string{"p 3:1 DUPLICATE_POLICY", "bad name 5:1 INVALID_POLICY_NAME", "q 7:1 INVALID_POLICY_NAME"},
+		},
+		{
+			"[p]\ncolor = red\ntest = maybe: A\n[q]\ndescription = no expression\n",
+			[]string{"p 2:1 UNKNOWN_KEY", "p 3:1 INVALID_TEST", "p 1:1 MISSING_EXPRESSION", "q 4:1 MISSING_EXPRESSION"},
+		},
+	} {
+		_, err := LoadPolicySet(strings.NewReader(test.bundle), nil)
+		if got := locations(t, err); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("LoadPolicySet(%q) errors = %q, want %q", test.bundle, got, test.want)
+		}
+	}
+}
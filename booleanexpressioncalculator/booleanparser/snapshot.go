@@ -0,0 +1,216 @@
+package booleanparser
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// A UniverseSnapshot is an immutable Universe, it is built with a
+// UniverseBuilder and can be shared by any number of goroutines.
+type UniverseSnapshot struct {
+	u6e map[string]string
+}
+
+func (u *UniverseSnapshot) Contains(label string) bool {
+	return u.u6e[strings.ToUpper(label)] != ""
+}
+
+func (u *UniverseSnapshot) GetLabel(label string) string {
+	return u.u6e[strings.ToUpper(label)]
+}
+
+func (u *UniverseSnapshot) Len() int {
+	return len(u.u6e)
+}
+
+// A UniverseBuilder accumulates label/id pairs, on top of the pairs of a
+// previous snapshot, until Build is called.
+type UniverseBuilder struct {
+	u6e map[string]string
+}
+
+// Returns a builder holding a copy of the pairs of base, base can be nil.
+func NewUniverseBuilder(base *UniverseSnapshot) *UniverseBuilder {
+	b := &UniverseBuilder{u6e: make(map[string]string)}
+	if base != nil {
+		for k, v := range base.u6e {
+			b.u6e[k] = v
+		}
+	}
+
+	return b
+}
+
+// Same rules as Universe.Add
+func (b *UniverseBuilder) Add(p LabelIdPair) bool {
+	if IsProperLabel(p.Label) && IsProperLabel(p.Id) {
+		l := strings.ToUpper(p.Label)
+		i := strings.ToUpper(p.Id)
+		b.u6e[l] = l
+		b.u6e[i] = l
+		return true
+	}
+
+	return false
+}
+
+// Returns a snapshot of the pairs added so far, the builder can still be
+// used afterwards without affecting the snapshot.
+func (b *UniverseBuilder) Build() *UniverseSnapshot {
+	u6e := make(map[string]string, len(b.u6e))
+	for k, v := range b.u6e {
+		u6e[k] = v
+	}
+
+	return &UniverseSnapshot{u6e: u6e}
+}
+
+// A ContextSnapshot is an immutable, already extended, Context.
+type ContextSnapshot struct {
+	c map[string]bool
+}
+
+func (ctx *ContextSnapshot) Contains(label string) bool {
+	return ctx.c[strings.ToUpper(label)]
+}
+
+func (ctx *ContextSnapshot) Len() int {
+	return len(ctx.c)
+}
+
+type ContextBuilder struct {
+	c map[string]bool
+}
+
+func NewContextBuilder(base *ContextSnapshot) *ContextBuilder {
+	b := &ContextBuilder{c: make(map[string]bool)}
+	if base != nil {
+		for k := range base.c {
+			b.c[k] = true
+		}
+	}
+
+	return b
+}
+
+// Adds a label to the context, and its universe label when universe is not
+// nil, as NewContext does.
+// Returns FALSE if the label isn't a proper label.
+func (b *ContextBuilder) Add(label string, universe LabelResolver) bool {
+	if !IsProperLabel(label) {
+		return false
+	}
+
+	b.c[strings.ToUpper(label)] = true
+	if universe != nil {
+		if universelabel := universe.GetLabel(label); universelabel != "" {
+			b.c[universelabel] = true
+		}
+	}
+
+	return true
+}
+
+func (b *ContextBuilder) Build() *ContextSnapshot {
+	c := make(map[string]bool, len(b.c))
+	for k := range b.c {
+		c[k] = true
+	}
+
+	return &ContextSnapshot{c: c}
+}
+
+// An AtomicUniverse publishes universe snapshots: readers Load the current
+// snapshot without locking while writers Update a copy of it and publish the
+// result atomically, so an evaluation always sees one consistent universe.
+type AtomicUniverse struct {
+	mu      sync.Mutex // serializes writers
+	current atomic.Pointer[UniverseSnapshot]
+}
+
+func NewAtomicUniverse(initial *UniverseSnapshot) *AtomicUniverse {
+	au := &AtomicUniverse{}
+	if initial == nil {
+		initial = NewUniverseBuilder(nil).Build()
+	}
+	au.current.Store(initial)
+	return au
+}
+
+func (au *AtomicUniverse) Load() *UniverseSnapshot {
+	return au.current.Load()
+}
+
+// Applies update to a copy of the current snapshot and publishes it.
+// Returns the published snapshot.
+func (au *AtomicUniverse) Update(update func(b *UniverseBuilder)) *UniverseSnapshot {
+	au.mu.Lock()
+	defer au.mu.Unlock()
+
+	b := NewUniverseBuilder(au.current.Load())
+	update(b)
+	snapshot := b.Build()
+	au.current.Store(snapshot)
+	return snapshot
+}
+
+// Adds the pairs in a single update, returns FALSE if any of them isn't made
+// of proper labels, the proper ones are added anyway.
+func (au *AtomicUniverse) Add(pairs ...LabelIdPair) bool {
+	ok := true
+	au.Update(func(b *UniverseBuilder) {
+		for _, p := range pairs {
+			ok = b.Add(p) && ok
+		}
+	})
+
+	return ok
+}
+
+// An AtomicContext publishes context snapshots the same way AtomicUniverse
+// does.
+type AtomicContext struct {
+	mu      sync.Mutex
+	current atomic.Pointer[ContextSnapshot]
+}
+
+func NewAtomicContext(initial *ContextSnapshot) *AtomicContext {
+	ac := &AtomicContext{}
+	if initial == nil {
+		initial = NewContextBuilder(nil).Build()
+	}
+	ac.current.Store(initial)
+	return ac
+}
+
+func (ac *AtomicContext) Load() *ContextSnapshot {
+	return ac.current.Load()
+}
+
+func (ac *AtomicContext) Update(update func(b *ContextBuilder)) *ContextSnapshot {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	b := NewContextBuilder(ac.current.Load())
+	update(b)
+	snapshot := b.Build()
+	ac.current.Store(snapshot)
+	return snapshot
+}
+
+// Evaluates the expression under a context snapshot, the labels of the
+// expression are resolved with the universe snapshot.
+func EvaluateSnapshot(expression string, ctx *ContextSnapshot, universe *UniverseSnapshot) (bool, error) {
+	tokens, tokenizeerror := Tokenize(expression, ctx, universe)
+	if tokenizeerror != nil {
+		return false, tokenizeerror
+	}
+
+	ev, evaluationerror := Expression(NewTokenStream(tokens))
+	if evaluationerror != nil {
+		return false, evaluationerror
+	}
+
+	return ev.Value, nil
+}
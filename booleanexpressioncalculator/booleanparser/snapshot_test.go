@@ -0,0 +1,124 @@
+package booleanparser
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestBuilderDoesNotChangeSnapshot(t *testing.T) {
+	b := NewUniverseBuilder(nil)
+	b.Add(LabelIdPair{Label: "Read", Id: "4246b7a7-1e49-40dd-8fa6-7aebdd70f34d"})
+	snapshot := b.Build()
+
+	b.Add(LabelIdPair{Label: "Update", Id: "44379cdf-2521-42f9-904e-c31d7244ed6c"})
+	if snapshot.Contains("Update") {
+		t.Errorf("snapshot changed after Build: contains 'Update'")
+	}
+
+	next := NewUniverseBuilder(snapshot)
+	next.Add(LabelIdPair{Label: "Delete", Id: "aa1ee703-e889-4b0d-8fa3-a39118a3443e"})
+	next.Build()
+	if snapshot.Contains("Delete") {
+		t.Errorf("base snapshot changed by a builder: contains 'Delete'")
+	}
+
+	if got := snapshot.GetLabel("4246B7A7-1E49-40DD-8FA6-7AEBDD70F34D"); got != "READ" {
+		t.Errorf("GetLabel = %q, want %q", got, "READ")
+	}
+}
+
+// Run with -race: readers evaluate while a writer keeps publishing new
+// universes, every result must match the snapshot it was computed with.
+func TestConcurrentEvaluationDuringUpdates(t *testing.T) {
+	const readers = 8
+	const updates = 200
+
+	au := NewAtomicUniverse(nil)
+	au.Add(LabelIdPair{Label: "Read", Id: "read-id"})
+
+	parsed, err := ParseExpressionWithUniverse("Read & (Label0 | Label199)", au.Load())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				universe := au.Load()
+				cb := NewContextBuilder(nil)
+				cb.Add("read-id", universe)
+				cb.Add("id0", universe)
+				cb.Add("id199", universe)
+				ctx := cb.Build()
+
+				want := universe.Contains("id0") || universe.Contains("id199")
+				got, err := EvaluateSnapshot("Read & (Label0 | Label199)", ctx, universe)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if got != want {
+					t.Errorf("EvaluateSnapshot = %v, want %v for a universe of %d labels", got, want, universe.Len())
+					return
+				}
+
+				// The parsed expression is shared by all the readers too.
+				if got := parsed.EvaluateIn(ctx); got != want {
+					t.Errorf("EvaluateIn = %v, want %v for a universe of %d labels", got, want, universe.Len())
+					return
+				}
+
+				if _, err := EvaluateSnapshot("Read +", ctx, universe); err == nil || err.Error() == "" {
+					t.Errorf("EvaluateSnapshot of an invalid expression returned no error")
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < updates; i++ {
+		au.Add(LabelIdPair{Label: fmt.Sprintf("Label%d", i), Id: fmt.Sprintf("id%d", i)})
+	}
+	close(done)
+	wg.Wait()
+
+	if got := au.Load().Len(); got != 2*(updates+1) {
+		t.Errorf("final universe has %d entries, want %d", got, 2*(updates+1))
+	}
+}
+
+func TestAtomicContextUpdate(t *testing.T) {
+	ac := NewAtomicContext(nil)
+	before := ac.Load()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ac.Update(func(b *ContextBuilder) {
+				b.Add(fmt.Sprintf("Label%d", i), nil)
+			})
+			ac.Load().Contains("Label0")
+		}(i)
+	}
+	wg.Wait()
+
+	if before.Len() != 0 {
+		t.Errorf("initial snapshot changed, has %d labels", before.Len())
+	}
+	if got := ac.Load().Len(); got != 50 {
+		t.Errorf("final context has %d labels, want 50", got)
+	}
+}
@@ -1,4 +1,27 @@
 package booleanparser
 
-const INVALID_CHAR_ON_TEMPLATE string = "Invalid or unexpected character in expression: %s"
-const UNEXPECTED_END_OF_TEMPLATE string = "Unexpected end of expression"
+// Codes of the errors reported by the parser, the text for every code lives
+// in the message catalogs under catalog/, one file per locale.
+const (
+	EMPTY_EXPRESSION              string = "EMPTY_EXPRESSION"
+	INVALID_CHAR                  string = "INVALID_CHAR"
+	UNEXPECTED_END                string = "UNEXPECTED_END"
+	SYNTAX_ERROR                  string = "SYNTAX_ERROR"
+	PRIMARY_NOT_FOUND             string = "PRIMARY_NOT_FOUND"
+	CLOSING_PARENTHESES_NOT_FOUND string = "CLOSING_PARENTHESES_NOT_FOUND"
+	MISSING_CLOSING_PARENTHESES   string = "MISSING_CLOSING_PARENTHESES"
+	PRIMARY_EXPECTED              string = "PRIMARY_EXPECTED"
+	UNTERMINATED_COMMENT          string = "UNTERMINATED_COMMENT"
+	UNEXPECTED_TOKEN              string = "UNEXPECTED_TOKEN"
+	BUNDLE_ERROR                  string = "BUNDLE_ERROR"
+	POLICY_ERROR                  string = "POLICY_ERROR"
+	MISSING_EQUALS                string = "MISSING_EQUALS"
+	POLICY_EXPECTED               string = "POLICY_EXPECTED"
+	INVALID_POLICY_NAME           string = "INVALID_POLICY_NAME"
+	DUPLICATE_POLICY              string = "DUPLICATE_POLICY"
+	UNKNOWN_KEY                   string = "UNKNOWN_KEY"
+	UNEXPECTED_CONTINUATION       string = "UNEXPECTED_CONTINUATION"
+	MISSING_EXPRESSION            string = "MISSING_EXPRESSION"
+	INVALID_TEST                  string = "INVALID_TEST"
+	UNKNOWN_POLICY                string = "UNKNOWN_POLICY"
+)
@@ -1,14 +1,14 @@
 package booleanparser
 
 import (
-	"errors"
-	"fmt"
 	"strings"
 )
 
 type Token struct {
 	Kind       TokenKind
 	Operator   string
+	Label      string
+	Position   int // index of the first rune of the token in the expression
 	HasValue   bool
 	Value      bool
 	InUniverse bool
@@ -101,19 +101,25 @@ func isvalidfirstruneforlabel(_rune rune) bool {
 	return false
 }
 
-func Get_Token(expressionrunes []rune, index int, cp *Context, up *Universe) (Token, int, error) {
+func Get_Token(expressionrunes []rune, index int, cp LabelSet, up LabelResolver) (Token, int, error) {
 	var newtoken Token
 
-	// skip whitespace in between tokens
-	for ; index < len(expressionrunes) && IsWhiteSpace(expressionrunes[index]); index++ {
+	// skip whitespace and comments in between tokens
+	index, skiperror := SkipBlanks(expressionrunes, index)
+	if skiperror != nil {
+		newtoken.Kind = INVALID
+		newtoken.Operator = string(expressionrunes[index])
+		newtoken.HasValue = false
+		return newtoken, index, skiperror
 	}
 
+	newtoken.Position = index
+
 	if index >= len(expressionrunes) {
 		newtoken.Kind = INVALID
 		newtoken.Operator = ""
 		newtoken.HasValue = false
-		errmsg := UNEXPECTED_END_OF_TEMPLATE
-		return newtoken, index, errors.New(errmsg)
+		return newtoken, index, NewParserError(UNEXPECTED_END)
 	}
 
 	switch _rune := expressionrunes[index]; _rune {
@@ -164,8 +170,7 @@ func Get_Token(expressionrunes []rune, index int, cp *Context, up *Universe) (To
 		newtoken.Kind = INVALID
 		newtoken.Operator = string(expressionrunes[index])
 		newtoken.HasValue = false
-		errmsg := fmt.Sprintf(INVALID_CHAR_ON_TEMPLATE, newtoken.Operator)
-		return newtoken, index, errors.New(errmsg)
+		return newtoken, index, NewParserError(INVALID_CHAR, newtoken.Operator)
 	}
 
 	label := ""
@@ -175,6 +180,7 @@ func Get_Token(expressionrunes []rune, index int, cp *Context, up *Universe) (To
 
 	ulabel := strings.ToUpper(label)
 	newtoken.Kind = LABEL
+	newtoken.Label = ulabel
 	newtoken.InUniverse = up.Contains(ulabel)
 	newtoken.Operator = ulabel
 	if newtoken.InUniverse {
@@ -185,28 +191,32 @@ func Get_Token(expressionrunes []rune, index int, cp *Context, up *Universe) (To
 	return newtoken, index - 1, nil
 }
 
-func Tokenize(expression string, cp *Context, up *Universe) ([]Token, error) {
-	var _expression string
+func Tokenize(expression string, cp LabelSet, up LabelResolver) ([]Token, error) {
 	var _expressionrunes []rune
 	var _tokens []Token
 
-	expression = strings.Trim(expression, _whitespace)
-	if expression == "" {
-		return nil, errors.New("Empty expression not allowed")
-	}
+	_expressionrunes = []rune(expression)
 
-	_expression = expression
-	_expressionrunes = []rune(_expression)
+	for runeindex := 0; ; {
+		nextindex, skiperror := SkipBlanks(_expressionrunes, runeindex)
+		if nextindex >= len(_expressionrunes) && skiperror == nil {
+			break
+		}
 
-	for runeindex := 0; runeindex < len(_expressionrunes); {
-		token, lastindex, get_token_error := Get_Token(_expressionrunes, runeindex, cp, up)
+		token, lastindex, get_token_error := Get_Token(_expressionrunes, nextindex, cp, up)
 		if get_token_error != nil {
-			return nil, errors.Join(errors.New(fmt.Sprintf("Syntax error found near '%s' (position: %d).", string(_expressionrunes[lastindex]), lastindex)), get_token_error)
+			syntaxerror := NewParserErrorAt(lastindex, SYNTAX_ERROR, string(_expressionrunes[lastindex]), lastindex)
+			syntaxerror.Cause = get_token_error
+			return nil, syntaxerror
 		}
 
 		_tokens = append(_tokens, token)
 		runeindex = lastindex + 1
 	}
 
+	if len(_tokens) == 0 {
+		return nil, NewParserError(EMPTY_EXPRESSION)
+	}
+
 	return _tokens, nil
 }
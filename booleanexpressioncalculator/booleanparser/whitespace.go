@@ -16,3 +16,37 @@ func IsWhiteSpace(r rune) bool {
 	_, ok := _whitespacemap[r]
 	return ok
 }
+
+// Returns the index of the first rune at or after index that is neither
+// whitespace nor part of a comment. Comments are either '#' up to the end of
+// the line or '/*' up to the next '*/'.
+// An unterminated block comment returns the index where it starts and an
+// error.
+func SkipBlanks(expressionrunes []rune, index int) (int, error) {
+	for index < len(expressionrunes) {
+		switch {
+		case IsWhiteSpace(expressionrunes[index]):
+			index++
+
+		case expressionrunes[index] == '#':
+			for ; index < len(expressionrunes) && expressionrunes[index] != '\n'; index++ {
+			}
+
+		case expressionrunes[index] == '/' && index+1 < len(expressionrunes) && expressionrunes[index+1] == '*':
+			start := index
+			for index += 2; index < len(expressionrunes) && !(expressionrunes[index] == '*' && index+1 < len(expressionrunes) && expressionrunes[index+1] == '/'); index++ {
+			}
+
+			if index >= len(expressionrunes) {
+				return start, NewParserError(UNTERMINATED_COMMENT)
+			}
+
+			index += 2
+
+		default:
+			return index, nil
+		}
+	}
+
+	return index, nil
+}
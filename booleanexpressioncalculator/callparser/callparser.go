@@ -73,7 +73,37 @@ func main() {
 				}
 			} else {
 				fmt.Printf("[TEST SUCCEEDED # '%s'] Exception received '%s'\n", _case.expression, evaluationerror)
+				fmt.Printf("[TEST SUCCEEDED # '%s'] Exception received, es: '%s'\n", _case.expression,
+					booleanparser.LocalizeError(evaluationerror, booleanparser.DefaultCatalog(), "es-MX"))
 			}
 		}
 	}
+
+	coverageexpression := "(Update | Insert) & !Execute"
+	coveragecontexts := [][]string{
+		expressiontst.context,
+		{"Insert", "Execute"},
+	}
+
+	parsedexpression, parseerror := booleanparser.ParseExpression(coverageexpression, expressiontst.universe)
+	if parseerror != nil {
+		fmt.Printf("[COVERAGE # '%s'] Parse error '%s'\n", coverageexpression, parseerror)
+		return
+	}
+
+	fmt.Print(booleanparser.MeasureCoverage(parsedexpression, coveragecontexts))
+
+	policyset, loaderror := booleanparser.LoadPolicySetFile("policies.bundle", expressiontst.universe)
+	if loaderror != nil {
+		fmt.Printf("[POLICIES] Load error '%s'\n", loaderror)
+		return
+	}
+
+	for _, result := range policyset.RunTests() {
+		if result.Passed {
+			fmt.Printf("[POLICY TEST SUCCEEDED # '%s' line %d] Expected value '%v' == Observed value '%v'\n", result.Policy, result.Test.Line, result.Test.Expected, result.Observed)
+		} else {
+			fmt.Printf("[POLICY TEST FAILED    # '%s' line %d] Expected value '%v' != Observed value '%v'\n", result.Policy, result.Test.Line, result.Test.Expected, result.Observed)
+		}
+	}
 }
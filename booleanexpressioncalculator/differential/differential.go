@@ -0,0 +1,162 @@
+package differential
+
+import (
+	"fmt"
+	"strings"
+
+	calculator "example.com/booleanparser"
+	simpleparser "example.com/simpleparser"
+	simpleparserv2 "example.com/simpleparserv2"
+)
+
+type Evaluator func(expression string, ctx []string, unvrs [][]string) (bool, error)
+
+type Implementation struct {
+	Name     string
+	Evaluate Evaluator
+}
+
+// The reference goes first, every other implementation is compared with it.
+var Implementations = []Implementation{
+	{Name: "reference", Evaluate: ReferenceEvaluate},
+	{Name: "simpleparser", Evaluate: simpleparser.EvaluateBooleanExpression},
+	{Name: "simpleparser-v2-go", Evaluate: simpleparserv2.EvaluateBooleanExpression},
+	{Name: "booleanexpressioncalculator", Evaluate: calculator.EvaluateBooleanExpression},
+}
+
+type Case struct {
+	Expression string
+	Context    []string
+	Universe   [][]string
+}
+
+func (c Case) String() string {
+	return fmt.Sprintf("expression %q, context %q, universe %q", c.Expression, c.Context, c.Universe)
+}
+
+// The outcome of one evaluation, the value is only meaningful without error.
+type Outcome struct {
+	Value bool
+	Error bool
+}
+
+func (o Outcome) String() string {
+	if o.Error {
+		return "error"
+	}
+
+	return fmt.Sprint(o.Value)
+}
+
+func evaluate(impl Implementation, c Case) Outcome {
+	value, err := impl.Evaluate(c.Expression, c.Context, c.Universe)
+	if err != nil {
+		return Outcome{Error: true}
+	}
+
+	return Outcome{Value: value}
+}
+
+// Returns the outcome of every implementation, in the order of
+// Implementations, and whether any of them disagrees with the reference.
+func Compare(c Case) ([]Outcome, bool) {
+	outcomes := make([]Outcome, len(Implementations))
+	agree := true
+	for i, impl := range Implementations {
+		outcomes[i] = evaluate(impl, c)
+		if outcomes[i] != outcomes[0] {
+			agree = false
+		}
+	}
+
+	return outcomes, agree
+}
+
+// Describes a discrepancy found by Compare.
+func Describe(c Case, outcomes []Outcome) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s\n", c)
+	for i, impl := range Implementations {
+		fmt.Fprintf(&sb, "  %-28s %s\n", impl.Name, outcomes[i])
+	}
+
+	return sb.String()
+}
+
+// Returns a smaller case with the same disagreement: it keeps removing
+// lexemes of the expression, context labels and universe pairs while the
+// implementations still disagree in the same way.
+func Minimize(c Case) Case {
+	outcomes, agree := Compare(c)
+	if agree {
+		return c
+	}
+
+	same := func(candidate Case) bool {
+		o, _ := Compare(candidate)
+		for i := range o {
+			if o[i] != outcomes[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	for changed := true; changed; {
+		changed = false
+
+		lexemes := lex(c.Expression)
+		for size := len(lexemes) / 2; size >= 1; size /= 2 {
+			for start := 0; start+size <= len(lexemes); {
+				candidate := c
+				candidate.Expression = join(append(append([]lexeme{}, lexemes[:start]...), lexemes[start+size:]...))
+				if same(candidate) {
+					c = candidate
+					lexemes = lex(c.Expression)
+					changed = true
+				} else {
+					start++
+				}
+			}
+		}
+
+		// Keep the original spacing only if it matters.
+		if candidate := (Case{Expression: join(lexemes), Context: c.Context, Universe: c.Universe}); candidate.Expression != c.Expression && same(candidate) {
+			c = candidate
+			changed = true
+		}
+
+		for i := 0; i < len(c.Context); {
+			candidate := c
+			candidate.Context = append(append([]string{}, c.Context[:i]...), c.Context[i+1:]...)
+			if same(candidate) {
+				c = candidate
+				changed = true
+			} else {
+				i++
+			}
+		}
+
+		for i := 0; i < len(c.Universe); {
+			candidate := c
+			candidate.Universe = append(append([][]string{}, c.Universe[:i]...), c.Universe[i+1:]...)
+			if same(candidate) {
+				c = candidate
+				changed = true
+			} else {
+				i++
+			}
+		}
+	}
+
+	return c
+}
+
+func join(lexemes []lexeme) string {
+	texts := make([]string, len(lexemes))
+	for i, l := range lexemes {
+		texts[i] = l.text
+	}
+
+	return strings.Join(texts, " ")
+}
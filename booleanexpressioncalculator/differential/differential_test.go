@@ -0,0 +1,139 @@
+package differential
+
+import (
+	"strings"
+	"testing"
+)
+
+// The expressions of callparser plus the readme examples.
+var seedExpressions = []string{
+	"Read, Update, Insert, Delete, Create, Alter, Execute, Take_Ownership, Impersonate",
+	"Read | Update | Insert | Delete | Create | Alter | Execute | Take_Ownership | Impersonate",
+	"Take_Ownership",
+	"!Take_Ownership",
+	"00000000-0000-0000-0000-000000000000",
+	"Update&Delete&Alter",
+	"!(Update&Delete&Alter)",
+	"(Update | Insert) & !Execute)",
+	"Update+Delete*Alter",
+	"!(mañana * (pingüino,árbol,garçon))",
+	"!(ba26bcea-634b-43fe-b38a-e01b98e1c84e | READONLY) & (84feaab0-5a3a-4efa-a185-593ebe40aa04 | 7977e542-a838-417d-bc82-dbf740379522 | 3461f6ad-6242-430f-954b-72b8380088f0) ^ (READWRITE | ADMIN | BACKUP)",
+	"Read ^ Update ^ Delete",
+	"Read ^ !Update & Delete",
+	"",
+	" \t ",
+	"()",
+	"(Read",
+	"Read Update",
+	"-Read",
+}
+
+var seedContext = []string{
+	"44379cdf-2521-42f9-904e-c31d7244ed6c", // Update
+	"aa1ee703-e889-4b0d-8fa3-a39118a3443e", // Delete
+	"6c639a12-53fd-4575-abfb-0bd61913c2af", // Take_Ownership
+	"00000000-0000-0000-0000-000000000000", // Not in universe
+	"READWRITE",
+}
+
+func TestSeedsAgree(t *testing.T) {
+	for _, expression := range seedExpressions {
+		c := Case{Expression: expression, Context: seedContext, Universe: generatedUniverse}
+		if outcomes, agree := Compare(c); !agree {
+			t.Errorf("implementations disagree, minimized:\n%s", Describe(Minimize(c), outcomes))
+		}
+	}
+}
+
+func TestReference(t *testing.T) {
+	ctx := []string{"A", "b-id"}
+	unvrs := [][]string{{"B", "b-id"}}
+	var tests = []struct {
+		expression string
+		want       bool
+		err        bool
+	}{
+		{expression: "A", want: true},
+		{expression: "b", want: true},
+		{expression: "b-id", want: true},
+		{expression: "C", want: false},
+		{expression: "A ^ B", want: false},
+		{expression: "A & C | B", want: true},
+		{expression: "A | B & C", want: false}, // left to right
+		{expression: "A & B ^ B", want: false}, // ^ first
+		{expression: "!C & A", want: true},
+		{expression: "A )", want: true}, // trailing tokens ignored
+		{expression: "(A", err: true},
+		{expression: "A &", err: true},
+		{expression: "A ) +", err: true},
+		{expression: "", err: true},
+	}
+
+	for _, test := range tests {
+		got, err := ReferenceEvaluate(test.expression, ctx, unvrs)
+		if (err != nil) != test.err || (err == nil && got != test.want) {
+			t.Errorf("ReferenceEvaluate(%q) = %v, %v; want %v, error %v", test.expression, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestMinimize(t *testing.T) {
+	// A broken implementation that ignores XOR, as if it were an AND.
+	saved := Implementations
+	defer func() { Implementations = saved }()
+	Implementations = append([]Implementation{}, saved[0], Implementation{
+		Name: "broken",
+		Evaluate: func(expression string, ctx []string, unvrs [][]string) (bool, error) {
+			return ReferenceEvaluate(strings.ReplaceAll(expression, "^", "&"), ctx, unvrs)
+		},
+	})
+
+	c := Case{
+		Expression: "(Read | Update) & !(Delete & Insert) ^ Take_Ownership",
+		Context:    []string{"Read", "Update", "Delete"},
+		Universe:   generatedUniverse,
+	}
+	if _, agree := Compare(c); agree {
+		t.Fatalf("expected a discrepancy for %s", c)
+	}
+
+	m := Minimize(c)
+	if _, agree := Compare(m); agree {
+		t.Fatalf("minimized case lost the discrepancy: %s", m)
+	}
+	if len(lex(m.Expression)) >= len(lex(c.Expression)) || len(m.Context) > 1 || len(m.Universe) > 0 {
+		t.Errorf("case not minimized: %s", m)
+	}
+}
+
+func FuzzDifferential(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte("Read & Update"))
+	f.Add([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16})
+	f.Add([]byte{255, 7, 7, 7, 7, 7, 7, 7, 7, 3, 4, 5, 5, 5, 5, 5, 5, 0, 1})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		c := Generate(data)
+		if outcomes, agree := Compare(c); !agree {
+			t.Errorf("implementations disagree, minimized:\n%s", Describe(Minimize(c), outcomes))
+		}
+	})
+}
+
+// Arbitrary expression text under a fixed context and universe.
+func FuzzExpression(f *testing.F) {
+	for _, expression := range seedExpressions {
+		f.Add(expression)
+	}
+
+	f.Fuzz(func(t *testing.T, expression string) {
+		if strings.ContainsAny(expression, "#/") {
+			t.Skip("comments are only supported by booleanexpressioncalculator")
+		}
+
+		c := Case{Expression: expression, Context: seedContext, Universe: generatedUniverse}
+		if outcomes, agree := Compare(c); !agree {
+			t.Errorf("implementations disagree, minimized:\n%s", Describe(Minimize(c), outcomes))
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package differential
+
+import (
+	"strings"
+)
+
+// Labels and ids used by generated cases, the same ones as callparser.
+var generatedUniverse = [][]string{
+	{"Read", "4246b7a7-1e49-40dd-8fa6-7aebdd70f34d"},
+	{"Update", "44379cdf-2521-42f9-904e-c31d7244ed6c"},
+	{"Insert", "d31aeb5b-e357-4a50-9a0f-3dda18b632ff"},
+	{"Delete", "aa1ee703-e889-4b0d-8fa3-a39118a3443e"},
+	{"Take_Ownership", "6c639a12-53fd-4575-abfb-0bd61913c2af"},
+}
+
+// Labels that are never part of the universe.
+var generatedOutsiders = []string{"Execute", "00000000-0000-0000-0000-000000000000", "_x", "9"}
+
+// Tokens outside the grammar, '#' and '/' are left out because only
+// booleanexpressioncalculator accepts comments.
+var generatedNoise = []string{"+", "*", "ñ", "-", ")", "(", "&", "!", "^", ""}
+
+var generatedSpaces = []string{"", " ", " ", "  ", "\t", "\n"}
+
+// A source hands out the bytes of the fuzzer input, zeros once exhausted,
+// so every input maps to exactly one Case.
+type source struct {
+	data []byte
+	next int
+}
+
+func (s *source) byte() byte {
+	if s.next >= len(s.data) {
+		return 0
+	}
+
+	b := s.data[s.next]
+	s.next++
+	return b
+}
+
+func (s *source) pick(n int) int {
+	return int(s.byte()) % n
+}
+
+func (s *source) casing(label string) string {
+	switch s.pick(3) {
+	case 1:
+		return strings.ToLower(label)
+	case 2:
+		return strings.ToUpper(label)
+	}
+
+	return label
+}
+
+func (s *source) label() string {
+	switch s.pick(3) {
+	case 0:
+		return s.casing(generatedUniverse[s.pick(len(generatedUniverse))][0])
+	case 1:
+		return s.casing(generatedUniverse[s.pick(len(generatedUniverse))][1])
+	}
+
+	return s.casing(generatedOutsiders[s.pick(len(generatedOutsiders))])
+}
+
+func (s *source) expression(sb *strings.Builder, depth int) {
+	sb.WriteString(generatedSpaces[s.pick(len(generatedSpaces))])
+
+	if s.pick(16) == 0 {
+		sb.WriteString(generatedNoise[s.pick(len(generatedNoise))])
+	}
+
+	form := s.pick(8)
+	if depth <= 0 {
+		form = 0
+	}
+
+	switch form {
+	case 0, 1, 2:
+		sb.WriteString(s.label())
+	case 3:
+		sb.WriteString("!")
+		s.expression(sb, depth-1)
+	case 4:
+		sb.WriteString("(")
+		s.expression(sb, depth-1)
+		sb.WriteString(generatedSpaces[s.pick(len(generatedSpaces))])
+		sb.WriteString(")")
+	default:
+		s.expression(sb, depth-1)
+		sb.WriteString(generatedSpaces[s.pick(len(generatedSpaces))])
+		sb.WriteString(string("&|,^"[s.pick(4)]))
+		s.expression(sb, depth-1)
+	}
+
+	sb.WriteString(generatedSpaces[s.pick(len(generatedSpaces))])
+}
+
+// Generate maps fuzzer bytes to a case: a random part of the universe, a
+// context with some of its labels and ids, plus outsiders, and an
+// expression that is mostly well formed with some noise.
+func Generate(data []byte) Case {
+	s := &source{data: data}
+	var c Case
+
+	for _, pair := range generatedUniverse {
+		if s.pick(4) != 0 {
+			c.Universe = append(c.Universe, []string{s.casing(pair[0]), s.casing(pair[1])})
+		}
+	}
+
+	for n := s.pick(5); n > 0; n-- {
+		c.Context = append(c.Context, s.label())
+	}
+
+	var sb strings.Builder
+	s.expression(&sb, 1+s.pick(5))
+	c.Expression = sb.String()
+
+	return c
+}
@@ -0,0 +1,15 @@
+module example.com/differential
+
+go 1.20
+
+require (
+	example.com/booleanparser v0.0.0-00010101000000-000000000000
+	example.com/simpleparser v0.0.0-00010101000000-000000000000
+	example.com/simpleparserv2 v0.0.0-00010101000000-000000000000
+)
+
+replace example.com/booleanparser => ../booleanparser
+
+replace example.com/simpleparser => ../../simpleparser/booleanparser
+
+replace example.com/simpleparserv2 => ../../simpleparser-v2-go/booleanparser
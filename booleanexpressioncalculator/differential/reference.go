@@ -0,0 +1,206 @@
+// Package differential compares the three booleanparser implementations of
+// the repository (simpleparser, simpleparser-v2-go and
+// booleanexpressioncalculator) against each other and against a reference
+// evaluator written from the grammar in booleanexpressioncalculator/readme.md.
+package differential
+
+import (
+	"errors"
+	"strings"
+)
+
+// The reference evaluator follows the readme grammar:
+//
+//	Expression: Term | Expression "&" Term | Expression "|" Term | Expression "," Term
+//	Term:       Primary | Term "^" Primary
+//	Primary:    Label | "!" Primary | "(" Expression ")"
+//
+// Labels are case insensitive, start with [A-Za-z0-9_] and continue with
+// [A-Za-z0-9_-]. Like every implementation, and as the callparser cases
+// expect, tokens left after a complete Expression are ignored.
+//
+// A label is true when it is in the context, or when it is the universe label
+// of an id or label in the context.
+
+const whitespace = " \b\f\n\r\t\v"
+
+type lexeme struct {
+	text    string
+	invalid bool
+}
+
+func isLabelRune(r rune, first bool) bool {
+	switch {
+	case r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+		return true
+	case r == '-':
+		return !first
+	}
+
+	return false
+}
+
+func isProperLabel(label string) bool {
+	for i, r := range []rune(label) {
+		if !isLabelRune(r, i == 0) {
+			return false
+		}
+	}
+
+	return label != ""
+}
+
+// Splits the expression into lexemes, invalid characters become one lexeme
+// each so the minimizer can remove them.
+func lex(expression string) []lexeme {
+	var lexemes []lexeme
+	runes := []rune(expression)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case strings.ContainsRune(whitespace, r):
+			i++
+		case strings.ContainsRune("&|,^!()", r):
+			lexemes = append(lexemes, lexeme{text: string(r)})
+			i++
+		case isLabelRune(r, true):
+			start := i
+			for i < len(runes) && isLabelRune(runes[i], false) {
+				i++
+			}
+			lexemes = append(lexemes, lexeme{text: string(runes[start:i])})
+		default:
+			lexemes = append(lexemes, lexeme{text: string(r), invalid: true})
+			i++
+		}
+	}
+
+	return lexemes
+}
+
+type reference struct {
+	lexemes []lexeme
+	next    int
+	values  map[string]bool
+}
+
+var errReference = errors.New("reference: syntax error")
+
+func (ref *reference) peek() string {
+	if ref.next < len(ref.lexemes) {
+		return ref.lexemes[ref.next].text
+	}
+
+	return ""
+}
+
+func (ref *reference) expression() (bool, error) {
+	left, err := ref.term()
+	if err != nil {
+		return false, err
+	}
+
+	for {
+		switch op := ref.peek(); op {
+		case "&", "|", ",":
+			ref.next++
+			right, err := ref.term()
+			if err != nil {
+				return false, err
+			}
+			if op == "&" {
+				left = left && right
+			} else {
+				left = left || right
+			}
+		default:
+			return left, nil
+		}
+	}
+}
+
+func (ref *reference) term() (bool, error) {
+	left, err := ref.primary()
+	if err != nil {
+		return false, err
+	}
+
+	for ref.peek() == "^" {
+		ref.next++
+		right, err := ref.primary()
+		if err != nil {
+			return false, err
+		}
+		left = left != right
+	}
+
+	return left, nil
+}
+
+func (ref *reference) primary() (bool, error) {
+	if ref.next >= len(ref.lexemes) {
+		return false, errReference
+	}
+
+	l := ref.lexemes[ref.next]
+	ref.next++
+	switch {
+	case l.text == "!":
+		v, err := ref.primary()
+		return !v, err
+	case l.text == "(":
+		v, err := ref.expression()
+		if err != nil {
+			return false, err
+		}
+		if ref.peek() != ")" {
+			return false, errReference
+		}
+		ref.next++
+		return v, nil
+	case !l.invalid && isLabelRune([]rune(l.text)[0], true):
+		return ref.values[strings.ToUpper(l.text)], nil
+	}
+
+	return false, errReference
+}
+
+// ReferenceEvaluate has the same signature and outcome, value or error, as
+// booleanparser.EvaluateBooleanExpression.
+func ReferenceEvaluate(expression string, ctx []string, unvrs [][]string) (bool, error) {
+	lexemes := lex(expression)
+	if len(lexemes) == 0 {
+		return false, errReference
+	}
+
+	// The whole expression is tokenized before parsing, so an invalid
+	// character is an error even after the end of the Expression.
+	for _, l := range lexemes {
+		if l.invalid {
+			return false, errReference
+		}
+	}
+
+	universe := make(map[string]string)
+	for _, pair := range unvrs {
+		if !isProperLabel(pair[0]) || !isProperLabel(pair[1]) {
+			continue
+		}
+		label := strings.ToUpper(pair[0])
+		universe[label] = label
+		universe[strings.ToUpper(pair[1])] = label
+	}
+
+	values := make(map[string]bool)
+	for _, c := range ctx {
+		if isProperLabel(c) {
+			values[strings.ToUpper(c)] = true
+		}
+		if label, ok := universe[strings.ToUpper(c)]; ok {
+			values[label] = true
+		}
+	}
+
+	ref := &reference{lexemes: lexemes, values: values}
+	return ref.expression()
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"image/color"
+	"math"
+)
+
+// A curve returns the point at t of a figure, within [-1, 1]², for a
+// frame whose phase is phase.
+type curve func(t, phase float64) (x, y float64)
+
+// curveOf returns the curve of p.
+func curveOf(p *params) curve {
+	switch p.curve {
+	case "harmonograph":
+		// Two damped pendulums swing the pen along each axis.
+		return func(t, phase float64) (x, y float64) {
+			decay := math.Exp(-p.damping * t)
+			x = decay * (math.Sin(t) + math.Sin(t*p.freq2+phase)) / 2
+			y = decay * (math.Sin(t*p.freq+phase) + math.Sin(t*p.freq2)) / 2
+			return x, y
+		}
+	case "spirograph":
+		// A circle of radius r rolls inside one of radius 1, turning
+		// the pen, at pen·r from its center, in the opposite sense.
+		r := float64(p.ratio[0]) / float64(p.ratio[1])
+		d := p.pen * r
+		scale := 1 - r + d
+		return func(t, phase float64) (x, y float64) {
+			u := (1-r)/r*t + phase
+			x = ((1-r)*math.Cos(t) + d*math.Cos(u)) / scale
+			y = ((1-r)*math.Sin(t) - d*math.Sin(u)) / scale
+			return x, y
+		}
+	}
+	return func(t, phase float64) (x, y float64) {
+		return math.Sin(t), math.Sin(t*p.freq + phase)
+	}
+}
+
+// -- palettes --
+
+// palettes are gradients from which the colors of the curve are drawn,
+// evenly and cyclically: back and forth along the gradient, or along
+// the rainbow, whose ends are the same.
+var palettes = map[string][]color.RGBA{
+	"mono": {{0x00, 0x00, 0x00, 0xff}},
+	"rainbow": {
+		{0xff, 0x00, 0x00, 0xff}, {0xff, 0xff, 0x00, 0xff}, {0x00, 0xff, 0x00, 0xff},
+		{0x00, 0xff, 0xff, 0xff}, {0x00, 0x00, 0xff, 0xff}, {0xff, 0x00, 0xff, 0xff},
+		{0xff, 0x00, 0x00, 0xff},
+	},
+	"fire":  {{0x40, 0x00, 0x00, 0xff}, {0xd0, 0x20, 0x00, 0xff}, {0xff, 0xa0, 0x00, 0xff}},
+	"ocean": {{0x00, 0x20, 0x50, 0xff}, {0x00, 0x80, 0xa0, 0xff}, {0x20, 0xc0, 0x90, 0xff}},
+}
+
+// colorsOf returns the colors of the curve of p, p.colors of them.
+func colorsOf(p *params) []color.RGBA {
+	g := palettes[p.palette]
+	colors := make([]color.RGBA, p.colors)
+	for i := range colors {
+		// t goes from 0 to 1 and back.
+		t := 2 * float64(i) / float64(len(colors))
+		if t > 1 {
+			t = 2 - t
+		}
+		if p.palette == "rainbow" {
+			t = float64(i) / float64(len(colors)) // the hues are a cycle
+		}
+		t *= float64(len(g) - 1)
+		k := min(int(t), len(g)-1)
+		if k == len(g)-1 {
+			colors[i] = g[k]
+			continue
+		}
+		t -= float64(k)
+		mix := func(a, b uint8) uint8 { return uint8(float64(a) + t*(float64(b)-float64(a)) + 0.5) }
+		a, b := g[k], g[k+1]
+		colors[i] = color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 0xff}
+	}
+	return colors
+}
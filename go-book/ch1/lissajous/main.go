@@ -14,73 +14,98 @@ import (
 	"image/gif"
 	"io"
 	"math"
-	"math/rand"
 	"os"
 )
 
 //!-main
 // Packages not needed by version in book.
 import (
+	"fmt"
 	"log"
 	"net/http"
-	"time"
+	"net/url"
+	"strings"
 )
 
 //!+main
 
-var palette = []color.Color{color.White, color.Black}
-
-const (
-	whiteIndex = 0 // first color in palette
-	blackIndex = 1 // next color in palette
-)
+const whiteIndex = 0 // first color in palette
 
 func main() {
 	//!-main
-	// The sequence of images is deterministic unless we seed
-	// the pseudo-random number generator using the current time.
-	// Thanks to Randall McPherson for pointing out the omission.
-	rand.Seed(time.Now().UTC().UnixNano())
-
+	// The parameters, described at params, come from the query of a
+	// request, or from the other arguments, as name=value.
+	// The figures are random unless a seed is given.
 	if len(os.Args) > 1 && os.Args[1] == "web" {
 		//!+http
 		handler := func(w http.ResponseWriter, r *http.Request) {
-			lissajous(w)
+			r.ParseForm()
+			p, err := parseParams(r.Form)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if p.format == "svg" {
+				w.Header().Set("Content-Type", "image/svg+xml")
+				writeSVG(w, p)
+				return
+			}
+			w.Header().Set("Content-Type", "image/gif")
+			lissajous(w, p)
 		}
 		http.HandleFunc("/", handler)
 		//!-http
 		log.Fatal(http.ListenAndServe("localhost:8000", nil))
 		return
 	}
+	form, err := url.ParseQuery(strings.Join(os.Args[1:], "&"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lissajous: %v\n", err)
+		os.Exit(1)
+	}
+	p, err := parseParams(form)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lissajous: %v\n", err)
+		os.Exit(1)
+	}
+	if p.format == "svg" {
+		writeSVG(os.Stdout, p)
+		return
+	}
 	//!+main
-	lissajous(os.Stdout)
+	lissajous(os.Stdout, p)
 }
 
-func lissajous(out io.Writer) {
-	const (
-		cycles  = 5     // number of complete x oscillator revolutions
-		res     = 0.001 // angular resolution
-		size    = 100   // image canvas covers [-size..+size]
-		nframes = 64    // number of animation frames
-		delay   = 8     // delay between frames in 10ms units
-	)
-	freq := rand.Float64() * 3.0 // relative frequency of y oscillator
-	anim := gif.GIF{LoopCount: nframes}
-	phase := 0.0 // phase difference
-	for i := 0; i < nframes; i++ {
-		rect := image.Rect(0, 0, 2*size+1, 2*size+1)
+func lissajous(out io.Writer, p *params) {
+	f := curveOf(p)
+	palette := []color.Color{color.White}
+	for _, c := range colorsOf(p) {
+		palette = append(palette, c)
+	}
+	size := float64(p.size)
+	anim := gif.GIF{LoopCount: p.nframes}
+	phase := p.phase // phase difference
+	for i := 0; i < p.nframes; i++ {
+		rect := image.Rect(0, 0, 2*p.size+1, 2*p.size+1)
 		img := image.NewPaletted(rect, palette)
-		for t := 0.0; t < cycles*2*math.Pi; t += res {
-			x := math.Sin(t)
-			y := math.Sin(t*freq + phase)
-			img.SetColorIndex(size+int(x*size+0.5), size+int(y*size+0.5),
-				blackIndex)
+		for t := 0.0; t < p.cycles*2*math.Pi; t += p.res {
+			x, y := f(t, phase)
+			img.SetColorIndex(p.size+int(x*size+0.5), p.size+int(y*size+0.5),
+				p.colorIndex(t, i))
 		}
-		phase += 0.1
-		anim.Delay = append(anim.Delay, delay)
+		phase += p.dphase
+		anim.Delay = append(anim.Delay, p.delay)
 		anim.Image = append(anim.Image, img)
 	}
 	gif.EncodeAll(out, &anim) // NOTE: ignoring encoding errors
 }
 
 //!-main
+
+// colorIndex returns the index in the palette of the color of the
+// curve at t in frame i. The colors run along the curve in bands, which
+// move along it by one band a frame.
+func (p *params) colorIndex(t float64, i int) uint8 {
+	band := int(t / (p.cycles * 2 * math.Pi) * float64(p.colors))
+	return uint8(1 + (band+i)%p.colors)
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// params are the parameters of an animation. They come from the query
+// of a request, or the name=value arguments of the command line:
+//
+//	curve    lissajous, harmonograph or spirograph (lissajous)
+//	cycles   number of complete x oscillator revolutions (5, 20, or
+//	         enough to close a spirograph)
+//	res      angular resolution (0.001)
+//	size     image canvas covers [-size..+size] (100)
+//	nframes  number of animation frames (64)
+//	delay    delay between frames in 10ms units (8)
+//	freq     relative frequency of y oscillator (random in [0, 3))
+//	phase    phase difference of the first frame (0)
+//	dphase   change of phase from frame to frame (0.1)
+//	freq2    relative frequency of the second pendulums of a
+//	         harmonograph (random, near 1, 2 or 3)
+//	damping  decay of the swing of a harmonograph per radian (0.01)
+//	ratio    of the radius of the rolling circle of a spirograph to
+//	         that of the fixed one, as a fraction a/b (random)
+//	pen      distance of the pen of a spirograph from the center of the
+//	         rolling circle, in its radii (random in [0.3, 1))
+//	palette  mono, rainbow, fire or ocean (mono)
+//	colors   number of colors of the palette, which cycle along the
+//	         curve and from frame to frame (1 for mono, else 8)
+//	format   gif or svg (gif)
+//	seed     seed of the random parameters (the time)
+//
+// The random parameters are drawn in the same order whichever are
+// given, so a seed gives the same figure with or without them.
+type params struct {
+	curve         string
+	cycles        float64
+	res           float64
+	size          int
+	nframes       int
+	delay         int
+	freq          float64
+	phase, dphase float64
+	freq2         float64
+	damping       float64
+	ratio         [2]int // a/b
+	pen           float64
+	palette       string
+	colors        int
+	format        string
+}
+
+// Limits on the parameters.
+const (
+	maxCycles  = 1000
+	maxSize    = 1000
+	maxFrames  = 500
+	maxDelay   = 1000
+	maxColors  = 255
+	maxSamples = 5e7 // points of all frames
+	maxPixels  = 1e8 // of all frames of a GIF, a byte each
+)
+
+// parseParams returns the params of form, or an error for malformed or
+// out of range values.
+func parseParams(form url.Values) (*params, error) {
+	p := new(params)
+	var err error
+	get := func(name string) (string, bool) {
+		s := form.Get(name)
+		return s, s != "" && err == nil
+	}
+	integer := func(name string, v *int, def, lo, hi int) {
+		*v = def
+		if s, ok := get(name); ok {
+			n, e := strconv.Atoi(s)
+			if e != nil || n < lo || n > hi {
+				err = fmt.Errorf("bad %s %q: want an integer in [%d, %d]", name, s, lo, hi)
+				return
+			}
+			*v = n
+		}
+	}
+	number := func(name string, v *float64, def, lo, hi float64) {
+		*v = def
+		if s, ok := get(name); ok {
+			x, e := strconv.ParseFloat(s, 64)
+			if e != nil || !(lo <= x && x <= hi) {
+				err = fmt.Errorf("bad %s %q: want a number in [%g, %g]", name, s, lo, hi)
+				return
+			}
+			*v = x
+		}
+	}
+
+	var seed int64
+	integer64 := func(name string, v *int64, def int64) {
+		*v = def
+		if s, ok := get(name); ok {
+			if *v, err = strconv.ParseInt(s, 10, 64); err != nil {
+				err = fmt.Errorf("bad %s %q: want an integer", name, s)
+			}
+		}
+	}
+	integer64("seed", &seed, time.Now().UnixNano())
+	rng := rand.New(rand.NewSource(seed))
+	freq := rng.Float64() * 3.0
+	freq2 := float64(1+rng.Intn(3)) + rng.NormFloat64()*0.01
+	ratio := [2]int{1 + rng.Intn(9), 2 + rng.Intn(9)}
+	pen := 0.3 + rng.Float64()*0.7
+
+	p.curve = "lissajous"
+	if s, ok := get("curve"); ok {
+		if s != "lissajous" && s != "harmonograph" && s != "spirograph" {
+			return nil, fmt.Errorf("unknown curve %q", s)
+		}
+		p.curve = s
+	}
+	number("res", &p.res, 0.001, 1e-4, 1)
+	integer("size", &p.size, 100, 1, maxSize)
+	integer("nframes", &p.nframes, 64, 1, maxFrames)
+	integer("delay", &p.delay, 8, 0, maxDelay)
+	number("freq", &p.freq, freq, 0, 1000)
+	number("phase", &p.phase, 0, -1000, 1000)
+	number("dphase", &p.dphase, 0.1, -1000, 1000)
+	number("freq2", &p.freq2, freq2, 0, 1000)
+	number("damping", &p.damping, 0.01, 0, 10)
+	number("pen", &p.pen, pen, 0, 10)
+	if s, ok := get("ratio"); ok {
+		var a, b int
+		if n, _ := fmt.Sscanf(s, "%d/%d", &a, &b); n != 2 || a <= 0 || b <= a || b > 1000 {
+			return nil, fmt.Errorf("bad ratio %q: want a/b, for 0 < a < b <= 1000", s)
+		}
+		ratio = [2]int{a, b}
+	}
+	if ratio[0] >= ratio[1] {
+		ratio[0] = ratio[1] - 1
+	}
+	g := gcd(ratio[0], ratio[1])
+	p.ratio = [2]int{ratio[0] / g, ratio[1] / g}
+
+	cycles := 5.0
+	switch p.curve {
+	case "harmonograph":
+		cycles = 20
+	case "spirograph":
+		cycles = float64(p.ratio[0]) // enough to close the curve
+	}
+	number("cycles", &p.cycles, cycles, 0, maxCycles)
+
+	p.palette = "mono"
+	if s, ok := get("palette"); ok {
+		if _, ok := palettes[s]; !ok {
+			return nil, fmt.Errorf("unknown palette %q", s)
+		}
+		p.palette = s
+	}
+	colors := 8
+	if p.palette == "mono" {
+		colors = 1
+	}
+	integer("colors", &p.colors, colors, 1, maxColors)
+	p.format = "gif"
+	if s, ok := get("format"); ok {
+		if s != "gif" && s != "svg" {
+			return nil, fmt.Errorf("unknown format %q: want gif or svg", s)
+		}
+		p.format = s
+	}
+	if err != nil {
+		return nil, err
+	}
+	if n := float64(p.nframes) * p.cycles * 2 * math.Pi / p.res; n > maxSamples {
+		return nil, fmt.Errorf("%.3g points, more than %.3g: fewer cycles or frames, or a coarser res", n, float64(maxSamples))
+	}
+	side := float64(2*p.size + 1)
+	if n := float64(p.nframes) * side * side; p.format == "gif" && n > maxPixels {
+		return nil, fmt.Errorf("%.3g pixels, more than %.3g: fewer frames or a smaller size", n, float64(maxPixels))
+	}
+	return p, nil
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseParams(t *testing.T) {
+	for _, test := range []struct {
+		query string
+		want  string // the error, or "" for none
+	}{
+		{"", ""},
+		{"size=1000&nframes=100&format=svg", ""},
+		{"curve=spirograph&ratio=4/6&seed=-3", ""},
+		{"size=0", `bad size "0": want an integer in [1, 1000]`},
+		{"size=1001", `bad size "1001": want an integer in [1, 1000]`},
+		{"nframes=501", `bad nframes "501": want an integer in [1, 500]`},
+		{"res=0", `bad res "0": want a number in [0.0001, 1]`},
+		{"cycles=NaN", `bad cycles "NaN": want a number in [0, 1000]`},
+		{"freq=-1", `bad freq "-1": want a number in [0, 1000]`},
+		{"colors=256", `bad colors "256": want an integer in [1, 255]`},
+		{"seed=x", `bad seed "x": want an integer`},
+		{"ratio=3/2", `bad ratio "3/2": want a/b, for 0 < a < b <= 1000`},
+		{"curve=rose", `unknown curve "rose"`},
+		{"palette=sepia", `unknown palette "sepia"`},
+		{"format=png", `unknown format "png": want gif or svg`},
+		// maxSamples
+		{"cycles=1000&res=0.001&nframes=8", "5.03e+07 points, more than 5e+07: fewer cycles or frames, or a coarser res"},
+		{"cycles=1000&res=0.001&nframes=7", ""},
+		// maxPixels, of GIFs only
+		{"size=1000&nframes=25", "1e+08 pixels, more than 1e+08: fewer frames or a smaller size"},
+		{"size=1000&nframes=24", ""},
+		{"size=1000&nframes=25&format=svg", ""},
+	} {
+		form, err := url.ParseQuery(test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = parseParams(form)
+		if got := fmt.Sprint(err); (err != nil || test.want != "") && got != test.want {
+			t.Errorf("parseParams(%s) = %s, want %s", test.query, got, test.want)
+		}
+	}
+}
+
+// TestSeed checks that a seed gives the same animation whether or not
+// the other random parameters are given.
+func TestSeed(t *testing.T) {
+	for _, curve := range []string{"lissajous", "harmonograph", "spirograph"} {
+		for _, format := range []string{"gif", "svg"} {
+			query := "seed=7&size=20&nframes=3&res=0.01&palette=fire&curve=" + curve + "&format=" + format
+			random := render(t, query)
+			p := parse(t, query)
+			given := render(t, query+fmt.Sprintf("&freq=%s&freq2=%s&ratio=%d/%d&pen=%s",
+				strconv.FormatFloat(p.freq, 'g', -1, 64), strconv.FormatFloat(p.freq2, 'g', -1, 64),
+				p.ratio[0], p.ratio[1], strconv.FormatFloat(p.pen, 'g', -1, 64)))
+			if !bytes.Equal(random, given) {
+				t.Errorf("%s: the random parameters given change the %s", curve, format)
+			}
+			if again := render(t, query); !bytes.Equal(random, again) {
+				t.Errorf("%s: the same seed gives a different %s", curve, format)
+			}
+		}
+	}
+}
+
+func parse(t *testing.T, query string) *params {
+	form, err := url.ParseQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := parseParams(form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// render returns the animation of the parameters of query.
+func render(t *testing.T, query string) []byte {
+	p := parse(t, query)
+	var buf bytes.Buffer
+	if p.format == "svg" {
+		writeSVG(&buf, p)
+	} else {
+		lissajous(&buf, p)
+	}
+	return buf.Bytes()
+}
+
+func TestKeyTimes(t *testing.T) {
+	for _, test := range []struct {
+		i, n int
+		want string
+	}{
+		{0, 1, "values='visible' keyTimes='0'"},
+		{0, 4, "values='visible;hidden' keyTimes='0;0.25'"},
+		{1, 4, "values='hidden;visible;hidden' keyTimes='0;0.25;0.5'"},
+		{3, 4, "values='hidden;visible' keyTimes='0;0.75'"},
+	} {
+		if got := keyTimes(test.i, test.n); got != test.want {
+			t.Errorf("keyTimes(%d, %d) = %s, want %s", test.i, test.n, got, test.want)
+		}
+	}
+	// A single frame is always visible.
+	var buf bytes.Buffer
+	writeSVG(&buf, parse(t, "seed=1&nframes=1&format=svg"))
+	if !strings.Contains(buf.String(), "values='visible' keyTimes='0'") {
+		t.Errorf("writeSVG of 1 frame does not keep it visible")
+	}
+}
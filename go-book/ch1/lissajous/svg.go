@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// writeSVG writes the animation of p as an SVG whose frames are shown in
+// turn by SMIL animations of their visibility.
+func writeSVG(out io.Writer, p *params) {
+	f := curveOf(p)
+	colors := colorsOf(p)
+	size := float64(p.size)
+	w := 2*p.size + 1
+	frame := max(p.delay, 1) * 10 // milliseconds
+	fmt.Fprintf(out, "<svg xmlns='http://www.w3.org/2000/svg' width='%d' height='%d'>\n", w, w)
+	fmt.Fprintf(out, "<rect width='%d' height='%d' fill='white'/>\n", w, w)
+	phase := p.phase
+	for i := 0; i < p.nframes; i++ {
+		fmt.Fprintln(out, "<g fill='none' visibility='hidden'>")
+		fmt.Fprintf(out, "<animate attributeName='visibility' %s dur='%dms' calcMode='discrete' repeatCount='indefinite'/>\n",
+			keyTimes(i, p.nframes), frame*p.nframes)
+
+		// The curve is a polyline for each band of color, of the points
+		// at least a pixel apart.
+		band := -1
+		var pts strings.Builder
+		var lastX, lastY float64
+		flush := func() {
+			if pts.Len() > 0 {
+				c := colors[band-1]
+				fmt.Fprintf(out, "<polyline stroke='#%02x%02x%02x' points='%s'/>\n", c.R, c.G, c.B, pts.String())
+				pts.Reset()
+			}
+		}
+		for t := 0.0; t < p.cycles*2*math.Pi; t += p.res {
+			x, y := f(t, phase)
+			x, y = size+x*size+0.5, size+y*size+0.5
+			if b := int(p.colorIndex(t, i)); b != band {
+				flush()
+				if band >= 0 {
+					fmt.Fprintf(&pts, "%.1f,%.1f", lastX, lastY) // join the bands
+				}
+				band = b
+			} else if math.Hypot(x-lastX, y-lastY) < 1 {
+				continue
+			}
+			if pts.Len() > 0 {
+				pts.WriteByte(' ')
+			}
+			fmt.Fprintf(&pts, "%.1f,%.1f", x, y)
+			lastX, lastY = x, y
+		}
+		flush()
+		fmt.Fprintln(out, "</g>")
+		phase += p.dphase
+	}
+	fmt.Fprintln(out, "</svg>")
+}
+
+// keyTimes returns the values and keyTimes attributes of the animation
+// that shows frame i of n only for its share of the whole.
+func keyTimes(i, n int) string {
+	var values, times []string
+	if i > 0 {
+		values, times = append(values, "hidden"), append(times, "0")
+	}
+	values, times = append(values, "visible"), append(times, fmt.Sprintf("%g", float64(i)/float64(n)))
+	if i+1 < n {
+		values, times = append(values, "hidden"), append(times, fmt.Sprintf("%g", float64(i+1)/float64(n)))
+	}
+	return fmt.Sprintf("values='%s' keyTimes='%s'", strings.Join(values, ";"), strings.Join(times, ";"))
+}
@@ -0,0 +1,105 @@
+// The convert command converts an image from one format to another,
+// using gopl.io/ch10/imageconv. Unlike gopl.io/ch10/jpeg, it reads and
+// writes JPEG, PNG, GIF, BMP, PPM and PGM images.
+//
+// Usage:
+//
+//	convert [flags] [in [out]]
+//
+// It reads the image from the file in, or the standard input if in is
+// absent or "-", and writes it to the file out, or the standard output.
+// The format of the input is detected unless -from gives it; that of
+// the output is -to, or else that of the extension of out, or else
+// JPEG. For example:
+//
+//	$ ./mandelbrot | ./convert -to gif -colors 64 >mandelbrot.gif
+//	$ ./convert photo.jpg photo.bmp
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"gopl.io/ch10/imageconv"
+)
+
+var (
+	from     = flag.String("from", "", "`format` of the input (default detected)")
+	to       = flag.String("to", "", "`format` of the output: jpeg, png, gif, bmp, ppm or pgm (default by the extension of out, or jpeg)")
+	quality  = flag.Int("quality", 95, "quality of JPEG output, 1 to 100")
+	colors   = flag.Int("colors", 256, "number of colors of GIF output, 2 to 256")
+	noDither = flag.Bool("nodither", false, "map the colors of GIF output to the nearest, without dithering")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: convert [flags] [in [out]]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() > 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := convert(flag.Arg(0), flag.Arg(1)); err != nil {
+		fmt.Fprintf(os.Stderr, "convert: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// convert converts the image of the file in to the file out, either
+// of which may be "" or "-" for the standard input or output.
+func convert(in, out string) error {
+	o := &imageconv.Options{From: *from, To: *to, Quality: *quality, Colors: *colors, NoDither: *noDither}
+	if o.To == "" {
+		if o.To = imageconv.FormatOf(out); o.To == "" {
+			o.To = "jpeg"
+		}
+	}
+	// Check the formats before creating out.
+	for _, f := range []string{o.From, o.To} {
+		if f == "" {
+			continue
+		}
+		if _, err := imageconv.ParseFormat(f); err != nil {
+			return err
+		}
+	}
+
+	var r io.Reader = os.Stdin
+	if in != "" && in != "-" {
+		f, err := os.Open(in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	m, _, err := imageconv.Decode(r, o.From)
+	if err != nil {
+		return fmt.Errorf("%s: %v", name(in, "standard input"), err)
+	}
+
+	if out == "" || out == "-" {
+		return imageconv.Encode(os.Stdout, m, o)
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	if err := imageconv.Encode(f, m, o); err != nil {
+		f.Close()
+		os.Remove(out)
+		return err
+	}
+	return f.Close()
+}
+
+func name(file, std string) string {
+	if file == "" || file == "-" {
+		return std
+	}
+	return file
+}
@@ -0,0 +1,373 @@
+// Package bmp implements a decoder and encoder of Windows BMP images.
+//
+// It decodes uncompressed images of 1, 4, 8, 16, 24 and 32 bits per
+// pixel, bottom-up or top-down, with color masks (BI_BITFIELDS) or
+// without, but not compressed (RLE, JPEG or PNG) ones.
+//
+// Importing it registers the decoder with image.Decode as "bmp".
+package bmp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"math/bits"
+)
+
+func init() {
+	image.RegisterFormat("bmp", "BM????\x00\x00\x00\x00", Decode, DecodeConfig)
+}
+
+// Sizes of the headers.
+const (
+	fileHeaderLen = 14
+	infoHeaderLen = 40  // BITMAPINFOHEADER
+	v4HeaderLen   = 108 // BITMAPV4HEADER, with color masks
+)
+
+// Compression methods.
+const (
+	biRGB            = 0
+	biBitfields      = 3
+	biAlphaBitfields = 6
+)
+
+// maxPixels limits the size of the images decoded. Memory is not
+// allocated by the size in the header, but once the pixels are read, so
+// a malformed header alone does not exhaust it.
+const maxPixels = 1 << 28
+
+// A header is what the file and info headers of a file say of its image.
+type header struct {
+	offset        uint32 // of the pixels, from the start of the file
+	width, height int
+	topDown       bool
+	bpp           int           // bits per pixel
+	masks         [4]uint32     // of red, green, blue and alpha, of 16 and 32 bpp
+	palette       color.Palette // of 1, 4 and 8 bpp
+}
+
+// readHeader reads the headers of a file from r, and its palette, and
+// returns the number of bytes it read.
+func readHeader(r io.Reader) (*header, int, error) {
+	var buf [fileHeaderLen + v4HeaderLen]byte
+	if _, err := io.ReadFull(r, buf[:fileHeaderLen+4]); err != nil {
+		return nil, 0, noEOF(err)
+	}
+	if string(buf[:2]) != "BM" {
+		return nil, 0, errors.New("bmp: not a BMP file")
+	}
+	le := binary.LittleEndian
+	h := &header{offset: le.Uint32(buf[10:])}
+	n := le.Uint32(buf[14:])
+	switch n {
+	case infoHeaderLen, 52, 56, v4HeaderLen, 124: // the later ones extend the first
+	default:
+		return nil, 0, fmt.Errorf("bmp: unsupported header of %d bytes", n)
+	}
+	read := fileHeaderLen + int(n)
+	info := buf[fileHeaderLen:]
+	if _, err := io.ReadFull(r, info[4:min(n, v4HeaderLen)]); err != nil {
+		return nil, 0, noEOF(err)
+	}
+	if n > v4HeaderLen { // the V5 header: color profiles, which we ignore
+		if _, err := io.CopyN(io.Discard, r, int64(n-v4HeaderLen)); err != nil {
+			return nil, 0, noEOF(err)
+		}
+	}
+
+	width, height := int32(le.Uint32(info[4:])), int32(le.Uint32(info[8:]))
+	h.bpp = int(le.Uint16(info[14:]))
+	compression := le.Uint32(info[16:])
+	colors := int(le.Uint32(info[32:]))
+	if height < 0 {
+		h.topDown, height = true, -height
+	}
+	h.width, h.height = int(width), int(height)
+	if h.width <= 0 || h.height <= 0 || int64(h.width)*int64(h.height) > maxPixels {
+		return nil, 0, fmt.Errorf("bmp: bad size %dx%d", width, height)
+	}
+	if planes := le.Uint16(info[12:]); planes != 1 {
+		return nil, 0, fmt.Errorf("bmp: %d planes", planes)
+	}
+
+	switch h.bpp {
+	case 1, 4, 8:
+		if compression != biRGB {
+			return nil, 0, fmt.Errorf("bmp: unsupported compression %d", compression)
+		}
+		if colors == 0 || colors > 1<<h.bpp {
+			colors = 1 << h.bpp
+		}
+		p := make([]byte, 4*colors) // blue, green, red, unused
+		if _, err := io.ReadFull(r, p); err != nil {
+			return nil, 0, noEOF(err)
+		}
+		read += len(p)
+		h.palette = make(color.Palette, colors)
+		for i := range h.palette {
+			h.palette[i] = color.RGBA{p[4*i+2], p[4*i+1], p[4*i], 0xff}
+		}
+	case 16, 32:
+		switch {
+		case compression == biRGB && h.bpp == 16:
+			h.masks = [4]uint32{0x7c00, 0x03e0, 0x001f, 0}
+		case compression == biRGB:
+			h.masks = [4]uint32{0xff0000, 0x00ff00, 0x0000ff, 0}
+		case compression == biBitfields || compression == biAlphaBitfields:
+			if n == infoHeaderLen { // the masks follow the header
+				k := 3
+				if compression == biAlphaBitfields {
+					k = 4
+				}
+				if _, err := io.ReadFull(r, info[40:40+4*k]); err != nil {
+					return nil, 0, noEOF(err)
+				}
+				read += 4 * k
+			}
+			for i := range h.masks {
+				h.masks[i] = le.Uint32(info[40+4*i:])
+			}
+		default:
+			return nil, 0, fmt.Errorf("bmp: unsupported compression %d", compression)
+		}
+	case 24:
+		if compression != biRGB {
+			return nil, 0, fmt.Errorf("bmp: unsupported compression %d", compression)
+		}
+	default:
+		return nil, 0, fmt.Errorf("bmp: unsupported %d bits per pixel", h.bpp)
+	}
+	if int(h.offset) < read {
+		return nil, 0, fmt.Errorf("bmp: pixels at %d, within the headers", h.offset)
+	}
+	return h, read, nil
+}
+
+func (h *header) colorModel() color.Model {
+	switch {
+	case h.palette != nil:
+		return h.palette
+	case h.masks[3] != 0:
+		return color.NRGBAModel
+	}
+	return color.RGBAModel
+}
+
+// noEOF turns io.EOF into io.ErrUnexpectedEOF, as the data ended early.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// DecodeConfig returns the color model and dimensions of a BMP image
+// without decoding the entire image.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	h, _, err := readHeader(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: h.colorModel(), Width: h.width, Height: h.height}, nil
+}
+
+// Decode reads a BMP image from r and returns it as an *image.Paletted,
+// if it has a palette, as an *image.NRGBA, if it has an alpha channel,
+// and as an *image.RGBA otherwise.
+func Decode(r io.Reader) (image.Image, error) {
+	h, read, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(io.Discard, r, int64(h.offset)-int64(read)); err != nil {
+		return nil, noEOF(err)
+	}
+	// Rows are padded to 4 bytes. They are read before the image is
+	// allocated, into a buffer that grows with them.
+	rowLen := (h.width*h.bpp + 31) / 32 * 4
+	data, err := io.ReadAll(io.LimitReader(r, int64(rowLen)*int64(h.height)))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < rowLen*h.height {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	rect := image.Rect(0, 0, h.width, h.height)
+	var m image.Image
+	var pix []byte
+	var stride int
+	switch {
+	case h.palette != nil:
+		p := image.NewPaletted(rect, h.palette)
+		m, pix, stride = p, p.Pix, p.Stride
+	case h.masks[3] != 0:
+		p := image.NewNRGBA(rect)
+		m, pix, stride = p, p.Pix, p.Stride
+	default:
+		p := image.NewRGBA(rect)
+		m, pix, stride = p, p.Pix, p.Stride
+	}
+
+	for i := 0; i < h.height; i++ {
+		row := data[i*rowLen : (i+1)*rowLen]
+		y := h.height - 1 - i
+		if h.topDown {
+			y = i
+		}
+		if err := h.decodeRow(pix[y*stride:], row); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// decodeRow decodes the pixels of row, a row of the file, into p.
+func (h *header) decodeRow(p, row []byte) error {
+	switch h.bpp {
+	case 1, 4, 8:
+		perByte := 8 / h.bpp
+		mask := byte(1<<h.bpp - 1)
+		for x := 0; x < h.width; x++ {
+			shift := 8 - h.bpp*(x%perByte+1)
+			i := (row[x/perByte] >> shift) & mask
+			if int(i) >= len(h.palette) {
+				return fmt.Errorf("bmp: color %d outside the palette of %d", i, len(h.palette))
+			}
+			p[x] = i
+		}
+	case 24:
+		for x := 0; x < h.width; x++ {
+			b := row[3*x:]
+			p[4*x], p[4*x+1], p[4*x+2], p[4*x+3] = b[2], b[1], b[0], 0xff
+		}
+	case 16, 32:
+		for x := 0; x < h.width; x++ {
+			var v uint32
+			if h.bpp == 16 {
+				v = uint32(binary.LittleEndian.Uint16(row[2*x:]))
+			} else {
+				v = binary.LittleEndian.Uint32(row[4*x:])
+			}
+			for c, mask := range h.masks {
+				p[4*x+c] = channel(v, mask)
+			}
+			if h.masks[3] == 0 {
+				p[4*x+3] = 0xff
+			}
+		}
+	}
+	return nil
+}
+
+// channel returns the bits of v in mask, scaled to 8 bits.
+func channel(v, mask uint32) byte {
+	if mask == 0 {
+		return 0
+	}
+	shift := bits.TrailingZeros32(mask)
+	max := uint64(mask >> shift)
+	return byte((uint64((v&mask)>>shift)*255 + max/2) / max)
+}
+
+// Encode writes the image m to w in BMP format: of 8 bits per pixel
+// and a palette if m is an *image.Paletted of opaque colors, of 24 bits
+// per pixel if m is otherwise opaque, and of 32 bits per pixel, with an
+// alpha channel, if not.
+func Encode(w io.Writer, m image.Image) error {
+	b := m.Bounds()
+	if b.Empty() {
+		return errors.New("bmp: empty image")
+	}
+
+	var palette color.Palette
+	if p, ok := m.(*image.Paletted); ok && len(p.Palette) <= 256 && p.Opaque() {
+		palette = p.Palette
+	}
+	bpp, headerLen := 24, infoHeaderLen
+	switch {
+	case palette != nil:
+		bpp = 8
+	case !opaque(m):
+		bpp, headerLen = 32, v4HeaderLen
+	}
+	rowLen := (b.Dx()*bpp + 31) / 32 * 4
+	offset := fileHeaderLen + headerLen + 4*len(palette)
+	size := int64(offset) + int64(rowLen)*int64(b.Dy())
+	if size > math.MaxUint32 {
+		return errors.New("bmp: image too large")
+	}
+
+	le := binary.LittleEndian
+	hdr := make([]byte, offset)
+	copy(hdr, "BM")
+	le.PutUint32(hdr[2:], uint32(size))
+	le.PutUint32(hdr[10:], uint32(offset))
+	info := hdr[fileHeaderLen:]
+	le.PutUint32(info[0:], uint32(headerLen))
+	le.PutUint32(info[4:], uint32(b.Dx()))
+	le.PutUint32(info[8:], uint32(b.Dy())) // bottom-up
+	le.PutUint16(info[12:], 1)             // planes
+	le.PutUint16(info[14:], uint16(bpp))
+	le.PutUint32(info[20:], uint32(rowLen*b.Dy()))
+	le.PutUint32(info[24:], 2835) // 72 dpi, in pixels per meter
+	le.PutUint32(info[28:], 2835)
+	le.PutUint32(info[32:], uint32(len(palette)))
+	if bpp == 32 {
+		le.PutUint32(info[16:], biBitfields)
+		for i, mask := range []uint32{0x00ff0000, 0x0000ff00, 0x000000ff, 0xff000000} {
+			le.PutUint32(info[40+4*i:], mask)
+		}
+		copy(info[56:], "BGRs") // LCS_sRGB, little-endian
+	}
+	for i, c := range palette {
+		r, g, b, _ := c.RGBA()
+		p := hdr[fileHeaderLen+headerLen+4*i:]
+		p[0], p[1], p[2] = byte(b>>8), byte(g>>8), byte(r>>8)
+	}
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+
+	row := make([]byte, rowLen)
+	for y := b.Max.Y - 1; y >= b.Min.Y; y-- {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			i := x - b.Min.X
+			switch bpp {
+			case 8:
+				row[i] = m.(*image.Paletted).ColorIndexAt(x, y)
+			case 24:
+				r, g, b, _ := m.At(x, y).RGBA()
+				row[3*i], row[3*i+1], row[3*i+2] = byte(b>>8), byte(g>>8), byte(r>>8)
+			case 32:
+				c := color.NRGBAModel.Convert(m.At(x, y)).(color.NRGBA)
+				row[4*i], row[4*i+1], row[4*i+2], row[4*i+3] = c.B, c.G, c.R, c.A
+			}
+		}
+		if _, err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// opaque reports whether all the pixels of m are opaque.
+func opaque(m image.Image) bool {
+	if o, ok := m.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	b := m.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := m.At(x, y).RGBA(); a != 0xffff {
+				return false
+			}
+		}
+	}
+	return true
+}
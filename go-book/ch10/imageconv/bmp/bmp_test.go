@@ -0,0 +1,222 @@
+package bmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// Test images of 13×7 pixels, so that rows need padding, offset from
+// the origin.
+var (
+	bounds = image.Rect(-2, 3, 11, 10)
+	rgb    = image.NewRGBA(bounds)          // opaque
+	nrgba  = image.NewNRGBA(bounds)         // translucent
+	pal    = image.NewPaletted(bounds, nil) // of 5 colors
+)
+
+func init() {
+	pal.Palette = color.Palette{
+		color.RGBA{0, 0, 0, 0xff}, color.RGBA{0xff, 0, 0, 0xff}, color.RGBA{0, 0xc0, 0, 0xff},
+		color.RGBA{0, 0, 0xa0, 0xff}, color.RGBA{0xff, 0xff, 0xff, 0xff},
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			rgb.SetRGBA(x, y, color.RGBA{uint8(x * 20), uint8(y * 30), uint8(x * y), 0xff})
+			nrgba.SetNRGBA(x, y, color.NRGBA{uint8(x * 20), uint8(y * 30), uint8(x * y), uint8(x * 23)})
+			pal.SetColorIndex(x, y, uint8((x+y+10)%5))
+		}
+	}
+}
+
+// golden compares got with the golden file name in testdata, or, with
+// the -update flag, writes it.
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	name = filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(name, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s: got %d bytes different from the golden ones; run with -update if intended", name, len(got))
+	}
+}
+
+// sameImage reports whether a and b have the same pixels, relative to
+// their bounds.
+func sameImage(a, b image.Image) bool {
+	ab, bb := a.Bounds(), b.Bounds()
+	if ab.Size() != bb.Size() {
+		return false
+	}
+	for y := 0; y < ab.Dy(); y++ {
+		for x := 0; x < ab.Dx(); x++ {
+			r1, g1, b1, a1 := a.At(ab.Min.X+x, ab.Min.Y+y).RGBA()
+			r2, g2, b2, a2 := b.At(bb.Min.X+x, bb.Min.Y+y).RGBA()
+			if r1 != r2 || g1 != g2 || b1 != b2 || a1 != a2 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestGolden(t *testing.T) {
+	for _, test := range []struct {
+		file string
+		m    image.Image
+		bpp  int
+	}{
+		{"rgb.bmp", rgb, 24},
+		{"nrgba.bmp", nrgba, 32},
+		{"paletted.bmp", pal, 8},
+	} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, test.m); err != nil {
+			t.Fatalf("%s: %v", test.file, err)
+		}
+		golden(t, test.file, buf.Bytes())
+		if bpp := binary.LittleEndian.Uint16(buf.Bytes()[28:]); int(bpp) != test.bpp {
+			t.Errorf("%s: %d bits per pixel, want %d", test.file, bpp, test.bpp)
+		}
+
+		m, format, err := image.Decode(&buf)
+		if err != nil || format != "bmp" {
+			t.Fatalf("%s: Decode = %s, %v", test.file, format, err)
+		}
+		if !sameImage(m, test.m) {
+			t.Errorf("%s: decoded image differs from the encoded one", test.file)
+		}
+	}
+}
+
+// file returns a BMP file of a BITMAPINFOHEADER of width, height, bits
+// per pixel and compression, followed by extra, e.g., a palette, which
+// is all of extra, and rows.
+func file(width, height int32, bpp uint16, compression uint32, extra []byte, rows ...string) []byte {
+	le := binary.LittleEndian
+	hdr := make([]byte, fileHeaderLen+infoHeaderLen)
+	copy(hdr, "BM")
+	le.PutUint32(hdr[10:], uint32(len(hdr)+len(extra)))
+	info := hdr[fileHeaderLen:]
+	le.PutUint32(info, infoHeaderLen)
+	le.PutUint32(info[4:], uint32(width))
+	le.PutUint32(info[8:], uint32(height))
+	le.PutUint16(info[12:], 1)
+	le.PutUint16(info[14:], bpp)
+	le.PutUint32(info[16:], compression)
+	if bpp <= 8 {
+		le.PutUint32(info[32:], uint32(len(extra)/4))
+	}
+	data := append(hdr, extra...)
+	for _, row := range rows {
+		data = append(data, row...)
+	}
+	le.PutUint32(data[2:], uint32(len(data)))
+	return data
+}
+
+func TestDecode(t *testing.T) {
+	// A palette of black, white and red, the colors 0, 1 and 2.
+	palette := "\x00\x00\x00\x00\xff\xff\xff\x00\x00\x00\xff\x00"
+	black, white, red := color.RGBA{0, 0, 0, 0xff}, color.RGBA{0xff, 0xff, 0xff, 0xff}, color.RGBA{0xff, 0, 0, 0xff}
+	blue, green := color.RGBA{0, 0, 0xff, 0xff}, color.RGBA{0, 0xff, 0, 0xff}
+	le32 := func(vs ...uint32) []byte {
+		b := make([]byte, 4*len(vs))
+		for i, v := range vs {
+			binary.LittleEndian.PutUint32(b[4*i:], v)
+		}
+		return b
+	}
+
+	for _, test := range []struct {
+		name string
+		data []byte
+		want [][]color.Color // rows, top to bottom
+	}{
+		{"1 bpp, bottom-up",
+			file(3, 2, 1, biRGB, []byte(palette[:8]), "\x40\x00\x00\x00", "\xa0\x00\x00\x00"),
+			[][]color.Color{{white, black, white}, {black, white, black}}},
+		{"4 bpp, top-down",
+			file(3, -2, 4, biRGB, []byte(palette), "\x01\x20\x00\x00", "\x22\x10\x00\x00"),
+			[][]color.Color{{black, white, red}, {red, red, white}}},
+		{"16 bpp, 5-5-5",
+			file(2, 1, 16, biRGB, nil, "\x00\x7c\x1f\x00"),
+			[][]color.Color{{red, blue}}},
+		{"16 bpp, 5-6-5 masks",
+			file(2, 1, 16, biBitfields, le32(0xf800, 0x07e0, 0x001f), "\xe0\x07\x1f\x00"),
+			[][]color.Color{{green, blue}}},
+		{"32 bpp, no alpha",
+			file(1, 1, 32, biRGB, nil, "\x00\x00\xff\x00"),
+			[][]color.Color{{red}}},
+		{"32 bpp, alpha masks",
+			file(1, 1, 32, biAlphaBitfields, le32(0xff, 0xff00, 0xff0000, 0xff000000), "\xff\x00\x00\x80"),
+			[][]color.Color{{color.NRGBA{0xff, 0, 0, 0x80}}}},
+	} {
+		m, err := Decode(bytes.NewReader(test.data))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got, want := m.Bounds().Size(), image.Pt(len(test.want[0]), len(test.want)); got != want {
+			t.Errorf("%s: size %v, want %v", test.name, got, want)
+			continue
+		}
+		for y, row := range test.want {
+			for x, want := range row {
+				r1, g1, b1, a1 := m.At(x, y).RGBA()
+				r2, g2, b2, a2 := want.RGBA()
+				if r1 != r2 || g1 != g2 || b1 != b2 || a1 != a2 {
+					t.Errorf("%s: pixel (%d, %d) = %v, want %v", test.name, x, y, m.At(x, y), want)
+				}
+			}
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"empty":          nil,
+		"not BMP":        []byte("GIF89a"),
+		"RLE":            file(1, 1, 8, 1, make([]byte, 1024), "\x00\x00\x00\x00"),
+		"2 bpp":          file(1, 1, 2, biRGB, nil, "\x00\x00\x00\x00"),
+		"short":          file(4, 4, 24, biRGB, nil, "\x00\x00\x00"),
+		"huge":           file(1<<20, 1<<20, 24, biRGB, nil),
+		"out of palette": file(1, 1, 8, biRGB, make([]byte, 8), "\x05\x00\x00\x00"),
+		"no palette":     file(1, 1, 8, 1, nil),
+	} {
+		if _, err := Decode(bytes.NewReader(data)); err == nil {
+			t.Errorf("Decode(%s) succeeded", name)
+		}
+	}
+}
+
+// TestDecodeHeaderOnly checks that a header of a large image, without its
+// pixels, does not take the memory of the image.
+func TestDecodeHeaderOnly(t *testing.T) {
+	data := file(16384, 16384, 32, biRGB, nil)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if _, err := Decode(bytes.NewReader(data)); err == nil {
+		t.Errorf("Decode of a header without pixels succeeded")
+	}
+	runtime.ReadMemStats(&after)
+	if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+		t.Errorf("Decode of a header without pixels allocated %d bytes", n)
+	}
+}
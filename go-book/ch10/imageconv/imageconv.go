@@ -0,0 +1,171 @@
+// Package imageconv converts images between the JPEG, PNG, GIF, BMP,
+// PPM and PGM formats.
+//
+// Converting to GIF, it reduces the colors of the image to a palette by
+// median cut, and dithers them by Floyd-Steinberg error diffusion.
+package imageconv
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"gopl.io/ch10/imageconv/bmp"
+	"gopl.io/ch10/imageconv/pnm"
+)
+
+// Formats are the names of the formats, as image.Decode returns them.
+var Formats = []string{"jpeg", "png", "gif", "bmp", "ppm", "pgm"}
+
+// aliases are other names of formats, and their file name extensions.
+var aliases = map[string]string{"jpg": "jpeg", "jpe": "jpeg", "dib": "bmp", "pnm": "ppm"}
+
+// ParseFormat returns the format of the name or alias name, e.g., "jpeg"
+// of "JPG".
+func ParseFormat(name string) (string, error) {
+	name = strings.ToLower(name)
+	if f, ok := aliases[name]; ok {
+		return f, nil
+	}
+	for _, f := range Formats {
+		if f == name {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("unknown format %q: want one of %s", name, strings.Join(Formats, ", "))
+}
+
+// FormatOf returns the format of the file name by its extension, or ""
+// if it has none of a format.
+func FormatOf(name string) string {
+	f, err := ParseFormat(strings.TrimPrefix(filepath.Ext(name), "."))
+	if err != nil {
+		return ""
+	}
+	return f
+}
+
+// Options are the options of a conversion.
+type Options struct {
+	From string // format of the input, or "" to detect it
+	To   string // format of the output
+
+	Quality  int  // of JPEG output, 1 to 100, or 0 for 95
+	Colors   int  // of the palette of GIF output, 2 to 256, or 0 for 256
+	NoDither bool // of GIF output: map each pixel to the nearest color
+}
+
+// Convert reads an image from r, of the format o.From or of any, and
+// writes it to w in the format o.To. It returns the format of the
+// input.
+func Convert(w io.Writer, r io.Reader, o *Options) (string, error) {
+	m, from, err := Decode(r, o.From)
+	if err != nil {
+		return from, err
+	}
+	return from, Encode(w, m, o)
+}
+
+// Decode reads an image from r in the format from, or in any format if
+// from is "", and returns it and its format.
+func Decode(r io.Reader, from string) (image.Image, string, error) {
+	if from == "" {
+		m, format, err := image.Decode(r)
+		if err != nil {
+			return nil, "", err
+		}
+		return m, format, nil
+	}
+	from, err := ParseFormat(from)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Check the format of the data, so that its decoder gives no
+	// puzzling errors of other data.
+	br := bufio.NewReader(r)
+	if head, _ := br.Peek(16); !is(head, from) {
+		return nil, "", fmt.Errorf("input is not %s", from)
+	}
+	var m image.Image
+	switch from {
+	case "jpeg":
+		m, err = jpeg.Decode(br)
+	case "png":
+		m, err = png.Decode(br)
+	case "gif":
+		m, err = gif.Decode(br)
+	case "bmp":
+		m, err = bmp.Decode(br)
+	case "ppm", "pgm":
+		m, err = pnm.Decode(br)
+	}
+	return m, from, err
+}
+
+// is reports whether head, the first bytes of a file, are those of the
+// format.
+func is(head []byte, format string) bool {
+	s := string(head)
+	switch format {
+	case "jpeg":
+		return strings.HasPrefix(s, "\xff\xd8")
+	case "png":
+		return strings.HasPrefix(s, "\x89PNG\r\n\x1a\n")
+	case "gif":
+		return strings.HasPrefix(s, "GIF87a") || strings.HasPrefix(s, "GIF89a")
+	case "bmp":
+		return strings.HasPrefix(s, "BM")
+	case "ppm":
+		return strings.HasPrefix(s, "P3") || strings.HasPrefix(s, "P6")
+	case "pgm":
+		return strings.HasPrefix(s, "P2") || strings.HasPrefix(s, "P5")
+	}
+	return false
+}
+
+// Encode writes the image m to w in the format o.To.
+func Encode(w io.Writer, m image.Image, o *Options) error {
+	to, err := ParseFormat(o.To)
+	if err != nil {
+		return err
+	}
+	switch to {
+	case "jpeg":
+		q := o.Quality
+		if q == 0 {
+			q = 95
+		} else if q < 1 || q > 100 {
+			return fmt.Errorf("bad JPEG quality %d: want 1 to 100", q)
+		}
+		return jpeg.Encode(w, m, &jpeg.Options{Quality: q})
+	case "png":
+		return png.Encode(w, m)
+	case "gif":
+		n := o.Colors
+		if n == 0 {
+			n = 256
+		} else if n < 2 || n > 256 {
+			return fmt.Errorf("bad number of GIF colors %d: want 2 to 256", n)
+		}
+		opts := &gif.Options{NumColors: n, Quantizer: MedianCut{}, Drawer: draw.FloydSteinberg}
+		if o.NoDither {
+			opts.Drawer = draw.Src
+		}
+		return gif.Encode(w, m, opts)
+	case "bmp":
+		return bmp.Encode(w, m)
+	case "ppm":
+		return pnm.EncodeColor(w, m)
+	case "pgm":
+		return pnm.EncodeGray(w, m)
+	}
+	panic("unreachable")
+}
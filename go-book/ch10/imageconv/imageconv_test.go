@@ -0,0 +1,263 @@
+package imageconv
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// gradient returns a 64×48 image of smooth gradients of hue and
+// lightness, with a transparent corner if transparent.
+func gradient(transparent bool) *image.NRGBA {
+	m := image.NewNRGBA(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			c := color.NRGBA{uint8(x * 4), uint8(y * 5), uint8(255 - x*2 - y*2), 0xff}
+			if transparent && x+y < 10 {
+				c.A = 0
+			}
+			m.SetNRGBA(x, y, c)
+		}
+	}
+	return m
+}
+
+func TestConvert(t *testing.T) {
+	src := gradient(false)
+	for _, from := range Formats {
+		var in bytes.Buffer
+		if err := Encode(&in, src, &Options{To: from}); err != nil {
+			t.Fatalf("Encode to %s: %v", from, err)
+		}
+		for _, to := range Formats {
+			for _, detect := range []bool{false, true} {
+				o := &Options{From: from, To: to, Colors: 32}
+				if detect {
+					o.From = ""
+				}
+				var out bytes.Buffer
+				got, err := Convert(&out, bytes.NewReader(in.Bytes()), o)
+				if err != nil || got != from {
+					t.Errorf("Convert %s to %s = %s, %v", from, to, got, err)
+					continue
+				}
+				cfg, format, err := image.DecodeConfig(&out)
+				if err != nil || format != to || cfg.Width != 64 || cfg.Height != 48 {
+					t.Errorf("Convert %s to %s: got %s %dx%d, %v", from, to, format, cfg.Width, cfg.Height, err)
+				}
+			}
+		}
+	}
+
+	var png bytes.Buffer
+	if err := Encode(&png, src, &Options{To: "png"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, o := range []*Options{
+		{From: "gif", To: "png"},  // not GIF
+		{From: "tiff", To: "png"}, // unknown
+		{To: "webp"},
+		{To: "jpeg", Quality: 101},
+		{To: "gif", Colors: 1},
+		{To: "gif", Colors: 257},
+	} {
+		var out bytes.Buffer
+		if _, err := Convert(&out, bytes.NewReader(png.Bytes()), o); err == nil {
+			t.Errorf("Convert(%+v) succeeded", *o)
+		}
+	}
+}
+
+func TestFormats(t *testing.T) {
+	for name, want := range map[string]string{
+		"photo.JPG": "jpeg", "a.jpeg": "jpeg", "b.png": "png", "c.gif": "gif",
+		"d.bmp": "bmp", "e.dib": "bmp", "f.ppm": "ppm", "g.pnm": "ppm", "h.pgm": "pgm",
+		"i.tiff": "", "noext": "",
+	} {
+		if got := FormatOf(name); got != want {
+			t.Errorf("FormatOf(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+// colors returns the colors of the pixels of m.
+func colors(m image.Image) map[color.NRGBA]bool {
+	cs := make(map[color.NRGBA]bool)
+	b := m.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			cs[color.NRGBAModel.Convert(m.At(x, y)).(color.NRGBA)] = true
+		}
+	}
+	return cs
+}
+
+// meanError returns the mean distance of the colors of the pixels of a
+// from those of b, smoothed over 4×4 blocks, as the eye sees dithering,
+// in 8-bit units.
+func meanError(a, b image.Image) float64 {
+	r := a.Bounds()
+	var sum float64
+	n := 0
+	for y := r.Min.Y; y+4 <= r.Max.Y; y += 4 {
+		for x := r.Min.X; x+4 <= r.Max.X; x += 4 {
+			var d [3]int64
+			for j := 0; j < 4; j++ {
+				for i := 0; i < 4; i++ {
+					r1, g1, b1, _ := a.At(x+i, y+j).RGBA()
+					r2, g2, b2, _ := b.At(x+i, y+j).RGBA()
+					d[0] += int64(r1) - int64(r2)
+					d[1] += int64(g1) - int64(g2)
+					d[2] += int64(b1) - int64(b2)
+				}
+			}
+			for _, v := range d {
+				sum += float64(max(v, -v)) / 16 / 257
+			}
+			n += 3
+		}
+	}
+	return sum / float64(n)
+}
+
+func TestMedianCut(t *testing.T) {
+	// An image of few colors gets exactly those.
+	few := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	want := []color.NRGBA{{0xff, 0, 0, 0xff}, {0, 0x80, 0, 0xff}, {0x10, 0x20, 0xf0, 0xff}, {0xff, 0xff, 0xff, 0xff}}
+	for i := range few.Pix[:len(few.Pix)/4] {
+		c := want[i%len(want)]
+		copy(few.Pix[4*i:], []uint8{c.R, c.G, c.B, c.A})
+	}
+	p := MedianCut{}.Quantize(make(color.Palette, 0, 16), few)
+	got := make(map[color.NRGBA]bool)
+	for _, c := range p {
+		got[color.NRGBAModel.Convert(c).(color.NRGBA)] = true
+	}
+	if len(p) != len(want) {
+		t.Errorf("Quantize of %d colors = %v", len(want), p)
+	}
+	for _, c := range want {
+		if !got[c] {
+			t.Errorf("Quantize of %v = %v, without %v", want, p, c)
+		}
+	}
+
+	// A transparent pixel gets a transparent color.
+	m := gradient(true)
+	p = MedianCut{}.Quantize(make(color.Palette, 0, 8), m)
+	if len(p) != 8 || p[0] != (color.NRGBA{}) {
+		t.Errorf("Quantize with transparency = %v", p)
+	}
+
+	// More colors are nearer.
+	m = gradient(false)
+	last := 256.0
+	for _, n := range []int{2, 4, 16, 64, 256} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, m, &Options{To: "gif", Colors: n, NoDither: true}); err != nil {
+			t.Fatal(err)
+		}
+		g, err := gif.Decode(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k := len(colors(g)); k > n {
+			t.Errorf("%d colors: got %d", n, k)
+		}
+		e := meanError(g, m)
+		if e >= last {
+			t.Errorf("%d colors: mean error %.1f, no less than %.1f of fewer", n, e, last)
+		}
+		last = e
+	}
+	if last > 2 {
+		t.Errorf("256 colors: mean error %.1f", last)
+	}
+}
+
+func TestDither(t *testing.T) {
+	// Dithering a few colors is nearer the image, as the eye sees it.
+	m := gradient(false)
+	var errs [2]float64
+	for i, noDither := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, m, &Options{To: "gif", Colors: 8, NoDither: noDither}); err != nil {
+			t.Fatal(err)
+		}
+		g, err := gif.Decode(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		errs[i] = meanError(g, m)
+	}
+	if errs[0] >= errs[1] {
+		t.Errorf("mean error dithered %.1f, not less than %.1f without", errs[0], errs[1])
+	}
+}
+
+func TestGolden(t *testing.T) {
+	for _, test := range []struct {
+		file        string
+		transparent bool
+		o           Options
+	}{
+		{"gradient-16.gif", false, Options{To: "gif", Colors: 16}},
+		{"gradient-16-nodither.gif", false, Options{To: "gif", Colors: 16, NoDither: true}},
+		{"gradient-transparent-8.gif", true, Options{To: "gif", Colors: 8}},
+	} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, gradient(test.transparent), &test.o); err != nil {
+			t.Fatal(err)
+		}
+		name := filepath.Join("testdata", test.file)
+		if *update {
+			if err := os.WriteFile(name, buf.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		// Compare the images, not the files, which the encoder of
+		// the standard library may compress differently.
+		got, err := gif.Decode(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := gif.Decode(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameImage(got, want) {
+			t.Errorf("%s: image differs from the golden one; run with -update if intended", name)
+		}
+	}
+}
+
+// sameImage reports whether a and b have the same bounds and pixels.
+func sameImage(a, b image.Image) bool {
+	if a.Bounds() != b.Bounds() {
+		return false
+	}
+	r := a.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			r1, g1, b1, a1 := a.At(x, y).RGBA()
+			r2, g2, b2, a2 := b.At(x, y).RGBA()
+			if r1 != r2 || g1 != g2 || b1 != b2 || a1 != a2 {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,327 @@
+// Package pnm implements a decoder and encoder of the Netpbm PPM and PGM
+// image formats: color and grey pixmaps, in their raw (P6, P5) and plain
+// (P3, P2) forms, of 8 or 16 bits per sample.
+//
+// Importing it registers the decoder with image.Decode as "ppm" and "pgm".
+package pnm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strconv"
+)
+
+func init() {
+	image.RegisterFormat("ppm", "P3", Decode, DecodeConfig)
+	image.RegisterFormat("ppm", "P6", Decode, DecodeConfig)
+	image.RegisterFormat("pgm", "P2", Decode, DecodeConfig)
+	image.RegisterFormat("pgm", "P5", Decode, DecodeConfig)
+}
+
+// maxPixels limits the size of the images decoded. Memory is not
+// allocated by the size in the header, but as the samples are read, so
+// a malformed header alone does not exhaust it.
+const maxPixels = 1 << 28
+
+// A header is the header of a file.
+type header struct {
+	magic         string // "P2", "P3", "P5" or "P6"
+	width, height int
+	maxval        int // the largest sample, in [1, 65535]
+}
+
+func (h *header) color() bool { return h.magic == "P3" || h.magic == "P6" }
+func (h *header) plain() bool { return h.magic == "P2" || h.magic == "P3" }
+
+// channels returns the number of samples of a pixel, and size the
+// bytes of a sample, in a raw file and in an image of the color model
+// of h.
+func (h *header) channels() int {
+	if h.color() {
+		return 3
+	}
+	return 1
+}
+
+func (h *header) size() int {
+	if h.maxval > 255 {
+		return 2
+	}
+	return 1
+}
+
+func (h *header) colorModel() color.Model {
+	switch {
+	case h.color() && h.maxval > 255:
+		return color.RGBA64Model
+	case h.color():
+		return color.RGBAModel
+	case h.maxval > 255:
+		return color.Gray16Model
+	}
+	return color.GrayModel
+}
+
+// readHeader reads the header of a file from r, and the single
+// whitespace byte after it.
+func readHeader(r *bufio.Reader) (*header, error) {
+	magic := make([]byte, 2)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, err
+	}
+	h := &header{magic: string(magic)}
+	switch h.magic {
+	case "P2", "P3", "P5", "P6":
+	default:
+		return nil, fmt.Errorf("pnm: unsupported format %q", h.magic)
+	}
+	for _, v := range []*int{&h.width, &h.height, &h.maxval} {
+		n, err := readInt(r)
+		if err != nil {
+			return nil, err
+		}
+		*v = n
+	}
+	if h.width <= 0 || h.height <= 0 || h.width*h.height > maxPixels {
+		return nil, fmt.Errorf("pnm: bad size %dx%d", h.width, h.height)
+	}
+	if h.maxval <= 0 || h.maxval > 65535 {
+		return nil, fmt.Errorf("pnm: bad maximum value %d", h.maxval)
+	}
+	return h, nil
+}
+
+// readInt reads a decimal integer from r, skipping the whitespace and
+// comments before it, and the whitespace byte after it.
+func readInt(r *bufio.Reader) (int, error) {
+	var digits []byte
+	for {
+		b, err := r.ReadByte()
+		if err == io.EOF && len(digits) > 0 {
+			break
+		} else if err != nil {
+			return 0, noEOF(err)
+		}
+		switch {
+		case '0' <= b && b <= '9':
+			digits = append(digits, b)
+			continue
+		case b == '#' && len(digits) == 0: // a comment, to the end of the line
+			if _, err := r.ReadBytes('\n'); err != nil {
+				return 0, noEOF(err)
+			}
+			continue
+		case isSpace(b) && len(digits) == 0:
+			continue
+		case !isSpace(b):
+			return 0, fmt.Errorf("pnm: unexpected byte %q", b)
+		}
+		break
+	}
+	n, err := strconv.Atoi(string(digits))
+	if err != nil || n > 1<<30 {
+		return 0, fmt.Errorf("pnm: bad number %q", digits)
+	}
+	return n, nil
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\v' || b == '\f'
+}
+
+// noEOF turns io.EOF into io.ErrUnexpectedEOF, as the data ended early.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// DecodeConfig returns the color model and dimensions of a PPM or PGM
+// image without decoding the entire image.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	h, err := readHeader(bufio.NewReader(r))
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: h.colorModel(), Width: h.width, Height: h.height}, nil
+}
+
+// Decode reads a PPM or PGM image from r and returns it as an
+// *image.Gray or *image.RGBA, or, of samples of more than 8 bits, an
+// *image.Gray16 or *image.RGBA64. Samples are scaled from the maximum
+// value of the file to that of the image.
+func Decode(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	h, err := readHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	samples, err := h.readSamples(br)
+	if err != nil {
+		return nil, err
+	}
+	rect := image.Rect(0, 0, h.width, h.height)
+	var m image.Image
+	var pix []byte
+	switch h.colorModel() {
+	case color.RGBA64Model:
+		rgba := image.NewRGBA64(rect)
+		m, pix = rgba, rgba.Pix
+	case color.RGBAModel:
+		rgba := image.NewRGBA(rect)
+		m, pix = rgba, rgba.Pix
+	case color.Gray16Model:
+		gray := image.NewGray16(rect)
+		m, pix = gray, gray.Pix
+	default:
+		gray := image.NewGray(rect)
+		m, pix = gray, gray.Pix
+	}
+	h.convert(pix, samples)
+	return m, nil
+}
+
+// readSamples reads the samples of the image of h from r, as a raw file
+// has them: of 1 or 2 bytes, most significant first. The samples grow as
+// they are read, so that a short file takes only as much memory as its
+// data.
+func (h *header) readSamples(r *bufio.Reader) ([]byte, error) {
+	n := h.width * h.height * h.channels() * h.size()
+	if !h.plain() {
+		samples, err := io.ReadAll(io.LimitReader(r, int64(n)))
+		if err == nil && len(samples) < n {
+			err = io.ErrUnexpectedEOF
+		}
+		return samples, err
+	}
+	var samples []byte
+	for len(samples) < n {
+		v, err := readInt(r)
+		if err != nil {
+			return nil, err
+		}
+		if v > h.maxval {
+			return nil, fmt.Errorf("pnm: sample %d greater than %d", v, h.maxval)
+		}
+		if h.size() == 2 {
+			samples = append(samples, byte(v>>8), byte(v))
+		} else {
+			samples = append(samples, byte(v))
+		}
+	}
+	return samples, nil
+}
+
+// convert converts samples, those of the image of h, into pix, the
+// pixels of an image of its color model.
+func (h *header) convert(pix, samples []byte) {
+	channels, size := h.channels(), h.size()
+	stride := channels * size // of a pixel in pix
+	if h.color() {
+		stride += size // alpha
+	}
+	for k := 0; k < h.width*h.height; k++ {
+		p := pix[k*stride : (k+1)*stride]
+		for c := 0; c < channels; c++ {
+			i := (k*channels + c) * size
+			j := c * size
+			if size == 1 {
+				p[j] = byte(h.scale(int(samples[i]), 255))
+			} else {
+				v := h.scale(int(samples[i])<<8|int(samples[i+1]), 65535)
+				p[j], p[j+1] = byte(v>>8), byte(v)
+			}
+		}
+		for j := channels * size; j < stride; j++ {
+			p[j] = 0xff // opaque
+		}
+	}
+}
+
+// scale returns the sample v, in [0, h.maxval], scaled to [0, max].
+// Samples greater than h.maxval are taken as h.maxval.
+func (h *header) scale(v, max int) int {
+	if v >= h.maxval {
+		return max
+	}
+	if h.maxval == max {
+		return v
+	}
+	return (v*max + h.maxval/2) / h.maxval
+}
+
+// Encode writes the image m to w as a raw PGM image if its color model
+// is grey, and as a raw PPM image otherwise, of 16-bit samples if its
+// color model has them, and of 8-bit samples otherwise. Like JPEG, the
+// formats have no alpha channel, so translucent pixels come out as if
+// over black.
+func Encode(w io.Writer, m image.Image) error {
+	switch m.ColorModel() {
+	case color.GrayModel, color.Gray16Model:
+		return EncodeGray(w, m)
+	}
+	return EncodeColor(w, m)
+}
+
+// EncodeGray is like Encode, but always writes a PGM image, converting
+// the colors of m to grey.
+func EncodeGray(w io.Writer, m image.Image) error {
+	return encode(w, m, true, m.ColorModel() == color.Gray16Model)
+}
+
+// EncodeColor is like Encode, but always writes a PPM image.
+func EncodeColor(w io.Writer, m image.Image) error {
+	switch m.ColorModel() {
+	case color.Gray16Model, color.RGBA64Model, color.NRGBA64Model:
+		return encode(w, m, false, true)
+	}
+	return encode(w, m, false, false)
+}
+
+func encode(w io.Writer, m image.Image, gray, wide bool) error {
+	b := m.Bounds()
+	if b.Empty() {
+		return errors.New("pnm: empty image")
+	}
+	magic, maxval := "P6", 255
+	if gray {
+		magic = "P5"
+	}
+	if wide {
+		maxval = 65535
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%s\n%d %d\n%d\n", magic, b.Dx(), b.Dy(), maxval)
+
+	var row []byte
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row = row[:0]
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := m.At(x, y)
+			var samples []uint32
+			if gray {
+				g := color.Gray16Model.Convert(c).(color.Gray16).Y
+				samples = []uint32{uint32(g)}
+			} else {
+				r, g, b, _ := c.RGBA()
+				samples = []uint32{r, g, b}
+			}
+			for _, s := range samples {
+				if wide {
+					row = append(row, byte(s>>8), byte(s))
+				} else {
+					row = append(row, byte(s>>8))
+				}
+			}
+		}
+		if _, err := bw.Write(row); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,175 @@
+package pnm
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// testImage returns a 40×30 gradient of the image type of newImage,
+// offset from the origin.
+func testImage(newImage func(image.Rectangle) draw.Image) image.Image {
+	b := image.Rect(5, -3, 45, 27)
+	m := newImage(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			m.Set(x, y, color.RGBA64{uint16(x * 1600), uint16((y + 3) * 2200), uint16(x * y * 40), 0xffff})
+		}
+	}
+	return m
+}
+
+var (
+	rgba   = testImage(func(r image.Rectangle) draw.Image { return image.NewRGBA(r) })
+	rgba64 = testImage(func(r image.Rectangle) draw.Image { return image.NewRGBA64(r) })
+	gray   = testImage(func(r image.Rectangle) draw.Image { return image.NewGray(r) })
+	gray16 = testImage(func(r image.Rectangle) draw.Image { return image.NewGray16(r) })
+)
+
+// golden compares got with the golden file name in testdata, or, with
+// the -update flag, writes it.
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	name = filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(name, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s: got %d bytes different from the golden ones; run with -update if intended", name, len(got))
+	}
+}
+
+// sameImage reports whether a and b have the same pixels, relative to
+// their bounds.
+func sameImage(a, b image.Image) bool {
+	ab, bb := a.Bounds(), b.Bounds()
+	if ab.Size() != bb.Size() {
+		return false
+	}
+	for y := 0; y < ab.Dy(); y++ {
+		for x := 0; x < ab.Dx(); x++ {
+			r1, g1, b1, a1 := a.At(ab.Min.X+x, ab.Min.Y+y).RGBA()
+			r2, g2, b2, a2 := b.At(bb.Min.X+x, bb.Min.Y+y).RGBA()
+			if r1 != r2 || g1 != g2 || b1 != b2 || a1 != a2 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestGolden(t *testing.T) {
+	for _, test := range []struct {
+		file     string
+		m        image.Image
+		encode   func(io.Writer, image.Image) error
+		lossless bool
+	}{
+		{"rgba.ppm", rgba, Encode, true},
+		{"rgba64.ppm", rgba64, Encode, true},
+		{"gray.pgm", gray, Encode, true},
+		{"gray16.pgm", gray16, Encode, true},
+		{"rgba-gray.pgm", rgba, EncodeGray, false},
+		{"gray-color.ppm", gray, EncodeColor, true},
+	} {
+		var buf bytes.Buffer
+		if err := test.encode(&buf, test.m); err != nil {
+			t.Fatalf("%s: %v", test.file, err)
+		}
+		golden(t, test.file, buf.Bytes())
+
+		m, format, err := image.Decode(&buf)
+		if err != nil {
+			t.Fatalf("%s: %v", test.file, err)
+		}
+		if want := filepath.Ext(test.file)[1:]; format != want {
+			t.Errorf("%s: decoded as %s", test.file, format)
+		}
+		if test.lossless && !sameImage(m, test.m) {
+			t.Errorf("%s: decoded image differs from the encoded one", test.file)
+		}
+	}
+}
+
+func TestPlain(t *testing.T) {
+	// A plain PPM of a maximum value of 15, with comments.
+	const ppm = "P3\n# a 3x2 image\n3 2 # width and height\n15\n" +
+		"15 0 0   0 15 0   0 0 15\n" +
+		"0 0 0   7 7 7  15 15 15\n"
+	m, format, err := image.Decode(strings.NewReader(ppm))
+	if err != nil || format != "ppm" {
+		t.Fatalf("Decode = %v, %v", format, err)
+	}
+	want := []color.RGBA{
+		{0xff, 0, 0, 0xff}, {0, 0xff, 0, 0xff}, {0, 0, 0xff, 0xff},
+		{0, 0, 0, 0xff}, {0x77, 0x77, 0x77, 0xff}, {0xff, 0xff, 0xff, 0xff},
+	}
+	for i, w := range want {
+		if got := m.At(i%3, i/3); got != w {
+			t.Errorf("pixel %d = %v, want %v", i, got, w)
+		}
+	}
+
+	// A plain PGM of 16-bit samples.
+	m, format, err = image.Decode(strings.NewReader("P2 2 1 1000 0 1000"))
+	if err != nil || format != "pgm" {
+		t.Fatalf("Decode = %v, %v", format, err)
+	}
+	if got, ok := m.(*image.Gray16); !ok || got.Gray16At(0, 0).Y != 0 || got.Gray16At(1, 0).Y != 0xffff {
+		t.Errorf("Decode 16-bit PGM = %#v", m)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"P4\n1 1\n",              // PBM
+		"P6\n0 1\n255\n",         // empty
+		"P6\n1 1\n0\n",           // bad maximum value
+		"P6\n1 1\n70000\n",       // bad maximum value
+		"P6\n2 1\n255\nabc",      // short
+		"P5\n2 x\n255\n\x00\x00", // bad number
+		"P2\n2 1\n10\n3 11\n",    // sample too large
+		"P3\n1 1\n255\n1 2\n",    // short
+		"P5\n100000 100000\n255\n",
+	} {
+		if _, err := Decode(strings.NewReader(data)); err == nil {
+			t.Errorf("Decode(%q) succeeded", data)
+		}
+	}
+	cfg, err := DecodeConfig(strings.NewReader("P5 7 3 65535\n"))
+	if err != nil || cfg.Width != 7 || cfg.Height != 3 || cfg.ColorModel != color.Gray16Model {
+		t.Errorf("DecodeConfig = %+v, %v", cfg, err)
+	}
+}
+
+// TestDecodeHeaderOnly checks that a header of a large image, without its
+// pixels, does not take the memory of the image.
+func TestDecodeHeaderOnly(t *testing.T) {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if _, err := Decode(strings.NewReader("P6\n16384 16384\n65535\n")); err == nil {
+		t.Errorf("Decode of a header without pixels succeeded")
+	}
+	runtime.ReadMemStats(&after)
+	if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+		t.Errorf("Decode of a header without pixels allocated %d bytes", n)
+	}
+}
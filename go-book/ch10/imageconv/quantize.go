@@ -0,0 +1,143 @@
+package imageconv
+
+import (
+	"image"
+	"image/color"
+	"sort"
+)
+
+// MedianCut is a draw.Quantizer that chooses the colors of a palette by
+// median cut: it puts the colors of the image in a box, splits the box
+// with the widest range of colors, weighted by its pixels, across its
+// longest side at the median pixel, and so on, until there are as many
+// boxes as colors to choose, and then chooses the mean of each.
+//
+// Colors are binned to 5 bits a channel. If the image has transparent
+// pixels, one of the colors chosen is transparent.
+type MedianCut struct{}
+
+// A bin is the pixels of the image in a bin of colors.
+type bin struct {
+	rgb     [3]uint8 // the bin, of 5 bits a channel
+	n       int      // number of pixels
+	r, g, b uint64   // sums of the 16-bit channels of the pixels
+}
+
+// A box is a box of bins, the bins of a slice.
+type box struct {
+	bins []bin
+	n    int // number of pixels
+}
+
+// Quantize appends to p the colors chosen for m, up to cap(p)-len(p).
+func (MedianCut) Quantize(p color.Palette, m image.Image) color.Palette {
+	want := cap(p) - len(p)
+	if want <= 0 {
+		return p
+	}
+	bins := make([]bin, 1<<15)
+	transparent := false
+	b := m.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBA64Model.Convert(m.At(x, y)).(color.NRGBA64)
+			if c.A < 0x8000 {
+				transparent = true
+				continue
+			}
+			i := int(c.R>>11)<<10 | int(c.G>>11)<<5 | int(c.B>>11)
+			bn := &bins[i]
+			bn.n++
+			bn.r += uint64(c.R)
+			bn.g += uint64(c.G)
+			bn.b += uint64(c.B)
+		}
+	}
+	if transparent {
+		p = append(p, color.NRGBA{})
+		want--
+	}
+
+	var all box
+	for i := range bins {
+		if bins[i].n > 0 {
+			bins[i].rgb = [3]uint8{uint8(i >> 10), uint8(i >> 5 & 31), uint8(i & 31)}
+			all.bins = append(all.bins, bins[i])
+			all.n += bins[i].n
+		}
+	}
+	if all.n == 0 || want <= 0 {
+		return p
+	}
+	boxes := []box{all}
+	for len(boxes) < want {
+		// Split the box of the most pixels times its longest side.
+		k, best := -1, 0
+		for i, bx := range boxes {
+			if _, length := bx.longest(); length > 0 && bx.n*length > best {
+				k, best = i, bx.n*length
+			}
+		}
+		if k < 0 {
+			break // each box is a single bin
+		}
+		lo, hi := boxes[k].split()
+		boxes[k] = lo
+		boxes = append(boxes, hi)
+	}
+	for _, bx := range boxes {
+		p = append(p, bx.mean())
+	}
+	return p
+}
+
+// longest returns the longest side of bx, the channel 0, 1 or 2, and its
+// length, in bins.
+func (bx *box) longest() (channel, length int) {
+	for c := 0; c < 3; c++ {
+		lo, hi := uint8(31), uint8(0)
+		for _, bn := range bx.bins {
+			lo, hi = min(lo, bn.rgb[c]), max(hi, bn.rgb[c])
+		}
+		if int(hi)-int(lo) > length {
+			channel, length = c, int(hi)-int(lo)
+		}
+	}
+	return channel, length
+}
+
+// split splits bx across its longest side, between the bins nearest
+// its median pixel that differ along it.
+func (bx *box) split() (lo, hi box) {
+	c, _ := bx.longest()
+	sort.SliceStable(bx.bins, func(i, j int) bool { return bx.bins[i].rgb[c] < bx.bins[j].rgb[c] })
+	cut, n, best := 0, 0, -1
+	sum := 0
+	for i := 1; i < len(bx.bins); i++ {
+		sum += bx.bins[i-1].n
+		if bx.bins[i].rgb[c] == bx.bins[i-1].rgb[c] {
+			continue
+		}
+		d := 2*sum - bx.n // from the median
+		if d < 0 {
+			d = -d
+		}
+		if best < 0 || d < best {
+			cut, n, best = i, sum, d
+		}
+	}
+	return box{bx.bins[:cut], n}, box{bx.bins[cut:], bx.n - n}
+}
+
+// mean returns the mean color of the pixels of bx.
+func (bx *box) mean() color.Color {
+	var r, g, b uint64
+	for _, bn := range bx.bins {
+		r += bn.r
+		g += bn.g
+		b += bn.b
+	}
+	n := uint64(bx.n)
+	to8 := func(sum uint64) uint8 { return uint8((sum/n*0xff + 0x7fff) / 0xffff) }
+	return color.RGBA{to8(r), to8(g), to8(b), 0xff}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A diskCache is a directory of tiles of at most max bytes, from which
+// the least recently used tiles are evicted. Their modification times
+// are the times they were last used.
+type diskCache struct {
+	dir string
+	max int64
+
+	mu   sync.Mutex // guards size and the writing and removing of files
+	size int64      // of the files in dir, or -1 if not yet known
+}
+
+// get returns the tile key from the cache, if it is there.
+func (c *diskCache) get(key string) ([]byte, bool) {
+	name := filepath.Join(c.dir, key)
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, false
+	}
+	now := time.Now()
+	os.Chtimes(name, now, now) // best effort: it may have been evicted
+	return data, true
+}
+
+// put adds the tile key to the cache, first evicting the least recently
+// used tiles, down to three quarters of max, if it would not fit.
+func (c *diskCache) put(key string, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.size < 0 {
+		c.size = 0
+		for _, f := range c.files() {
+			c.size += f.size
+		}
+	}
+	n := int64(len(data))
+	if n > c.max {
+		return nil
+	}
+	name := filepath.Join(c.dir, key)
+	if fi, err := os.Stat(name); err == nil {
+		c.size -= fi.Size() // replaced
+	}
+	if c.size+n > c.max {
+		c.evict(c.max*3/4 - n)
+	}
+	if err := writeFile(name, data); err != nil {
+		return err
+	}
+	c.size += n
+	return nil
+}
+
+// A cachedFile is a file of a cache.
+type cachedFile struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+// files returns the files of the cache, in no particular order.
+func (c *diskCache) files() []cachedFile {
+	var files []cachedFile
+	filepath.WalkDir(c.dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil // skip what cannot be read
+		}
+		if fi, err := d.Info(); err == nil {
+			files = append(files, cachedFile{name, fi.Size(), fi.ModTime()})
+		}
+		return nil
+	})
+	return files
+}
+
+// evict removes the least recently used files of the cache, and the
+// directories they leave empty, until it holds at most size bytes.
+func (c *diskCache) evict(size int64) {
+	files := c.files()
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	c.size = 0
+	for _, f := range files {
+		c.size += f.size
+	}
+	for _, f := range files {
+		if c.size <= size {
+			break
+		}
+		if os.Remove(f.name) == nil {
+			c.size -= f.size
+			dir := filepath.Dir(f.name)
+			for len(dir) > len(filepath.Clean(c.dir)) && os.Remove(dir) == nil {
+				dir = filepath.Dir(dir) // it was empty; so may its parent be
+			}
+		}
+	}
+}
+
+// writeFile writes data to the file name, creating its directory, by
+// renaming a temporary file so that readers never see part of it.
+func writeFile(name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(name), ".tile-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
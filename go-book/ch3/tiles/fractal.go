@@ -0,0 +1,116 @@
+package main
+
+import (
+	"math"
+	"math/big"
+)
+
+// A fractal is the Mandelbrot set, or the Julia set of c.
+type fractal struct {
+	julia bool
+	c     complex128 // of a Julia set
+	iter  int        // maximum number of iterations
+}
+
+// bailout is the radius beyond which orbits escape. It is much larger
+// than 2 so that the smooth iteration counts are smooth.
+const bailout = 1 << 8
+
+// escape returns the smooth iteration count at which the orbit of the
+// point p escapes, or -1 if it does not within f.iter iterations. For
+// the Mandelbrot set, the orbit is of z = z² + p from 0; for a Julia
+// set, of z = z² + c from p.
+func (f *fractal) escape(p complex128) float64 {
+	z, c := complex128(0), p
+	if f.julia {
+		z, c = p, f.c
+	}
+	for n := 0; n < f.iter; n++ {
+		z = z*z + c
+		if r2 := abs2(z); r2 > bailout*bailout {
+			return smooth(n, r2)
+		}
+	}
+	return -1
+}
+
+// smooth returns the continuous count of iterations of an orbit that
+// escaped at iteration n to a point whose squared modulus is r2.
+func smooth(n int, r2 float64) float64 {
+	return float64(n) + 1 - math.Log2(math.Log(r2)/2/math.Log(bailout))
+}
+
+func abs2(z complex128) float64 { return real(z)*real(z) + imag(z)*imag(z) }
+
+// -- perturbation, for deep zooms --
+
+// At deep zooms, the points of a tile are closer together than float64
+// can tell apart. The orbit of the center of the tile, its reference,
+// is computed with big.Float; the orbits of the points, in float64, are
+// their offsets from it, which are small but precise. With Z the
+// reference and z = Z + δ, z² + c = Z² + C + 2Zδ + δ² + (c - C), so the
+// offset of the next point is 2Zδ + δ² + δc, where δc is c - C.
+
+// reference returns the orbit of the point re + im·i, computed with prec
+// bits of precision, up to the iteration at which it escapes.
+func (f *fractal) reference(re, im *big.Float, prec uint) []complex128 {
+	newFloat := func() *big.Float { return new(big.Float).SetPrec(prec) }
+	zr, zi, cr, ci := newFloat(), newFloat(), newFloat().Set(re), newFloat().Set(im)
+	if f.julia {
+		zr.Set(re)
+		zi.Set(im)
+		cr.SetFloat64(real(f.c))
+		ci.SetFloat64(imag(f.c))
+	}
+	point := func() complex128 {
+		x, _ := zr.Float64()
+		y, _ := zi.Float64()
+		return complex(x, y)
+	}
+	orbit := []complex128{point()}
+	t, u := newFloat(), newFloat()
+	for n := 0; n < f.iter; n++ {
+		// zr, zi = zr² - zi² + cr, 2·zr·zi + ci
+		t.Mul(zr, zr)
+		u.Mul(zi, zi)
+		t.Sub(t, u)
+		zi.Mul(zi, zr)
+		zi.Add(zi, zi)
+		zi.Add(zi, ci)
+		zr.Add(t, cr)
+		orbit = append(orbit, point())
+		if abs2(orbit[len(orbit)-1]) > bailout*bailout {
+			break
+		}
+	}
+	return orbit
+}
+
+// escapeNear is escape for the point at the offset d from the start of
+// the reference orbit.
+//
+// Where z comes closer to 0 than δ, or the reference orbit ends, the
+// offsets lose their precision, so the orbit is rebased: it continues
+// as an offset from the start of the reference. For the Mandelbrot set,
+// that start is 0, and rebasing loses nothing; for a Julia set, it is
+// the center of the tile, and rebasing leaves the precision of float64.
+func (f *fractal) escapeNear(orbit []complex128, d complex128) float64 {
+	delta, dc := complex128(0), d
+	if f.julia {
+		delta, dc = d, 0
+	}
+	m := 0 // the iteration of the reference
+	for n := 0; n < f.iter; n++ {
+		delta = 2*orbit[m]*delta + delta*delta + dc
+		m++
+		z := orbit[m] + delta
+		r2 := abs2(z)
+		if r2 > bailout*bailout {
+			return smooth(n, r2)
+		}
+		if r2 < abs2(delta) || m == len(orbit)-1 {
+			delta, m = z-orbit[0], 0
+		}
+	}
+	return -1
+}
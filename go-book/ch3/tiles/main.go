@@ -0,0 +1,201 @@
+// The tiles program serves PNG tiles of the Mandelbrot set and of Julia
+// sets, generalizing gopl.io/ch3/mandelbrot for map viewers that zoom by
+// tiles, such as Leaflet or OpenLayers.
+//
+// A tile is at /set/z/x/y.png, where set is mandelbrot or julia, and the
+// tiles at zoom z divide [-2, 2]² into 2^z × 2^z, tile 0/0/0.png being
+// all of it. These optional parameters change the rendering:
+//
+//	c        the point of a Julia set, as re,im (-0.8,0.156)
+//	iter     the maximum number of iterations (256 + 32z)
+//	palette  classic, fire, ocean or grey
+//	ss       samples per pixel along each axis, for anti-aliasing (2)
+//	size     in pixels (256)
+//
+// The iterations of a tile, iter × size² × ss², are limited, as are the
+// tiles rendered at once.
+//
+// For example:
+//
+//	tiles -cache /var/cache/tiles &
+//	http://localhost:8000/mandelbrot/3/2/3.png?palette=fire
+//	http://localhost:8000/julia/0/0/0.png?c=0.285,0.01
+//
+// Points are computed in float64 up to zoom 40 and by perturbation of
+// an orbit computed with math/big beyond it, to zoom 256. Tiles are
+// cached on disk by their parameters, up to -cachesize bytes, the least
+// recently used evicted first.
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"image/png"
+	"log"
+	"math"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var (
+	addr      = flag.String("http", "localhost:8000", "HTTP service address")
+	cacheDir  = flag.String("cache", filepath.Join(os.TempDir(), "fractal-tiles"), "tile cache `directory`, or none if empty")
+	cacheSize = flag.Int64("cachesize", 1<<30, "maximum `bytes` of the tile cache")
+)
+
+// Limits on the requests.
+const (
+	maxZoom    = 256
+	maxIter    = 100000
+	maxSamples = 4
+	minSize    = 16
+	maxSize    = 1024
+	maxWork    = 1 << 32 // iterations of a tile, iter × size² × ss²
+)
+
+var cache *diskCache
+
+func main() {
+	flag.Parse()
+	if *cacheDir != "" {
+		cache = &diskCache{dir: *cacheDir, max: *cacheSize, size: -1}
+	}
+	http.HandleFunc("/", handler)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
+
+func handler(w http.ResponseWriter, r *http.Request) {
+	t, err := parseTile(r.URL.Path, r.URL.Query())
+	if err == errNotFound {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if cache != nil {
+		if data, ok := cache.get(t.key()); ok {
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(data)
+			return
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, t.render()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if cache != nil {
+		if err := cache.put(t.key(), buf.Bytes()); err != nil {
+			log.Print(err) // serve the tile anyway
+		}
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(buf.Bytes())
+}
+
+var errNotFound = fmt.Errorf("not found")
+
+// parseTile returns the tile of the path /set/z/x/y.png and its query
+// parameters.
+func parseTile(path string, query map[string][]string) (*tile, error) {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(parts) != 4 || !strings.HasSuffix(parts[3], ".png") {
+		return nil, errNotFound
+	}
+	t := &tile{f: new(fractal), size: 256, samples: 2, pal: palettes["classic"]}
+	switch parts[0] {
+	case "mandelbrot":
+	case "julia":
+		t.f.julia = true
+		t.f.c = complex(-0.8, 0.156)
+	default:
+		return nil, errNotFound
+	}
+	z, err := strconv.ParseUint(parts[1], 10, 0)
+	if err != nil || z > maxZoom {
+		return nil, fmt.Errorf("bad zoom %q: want an integer in [0, %d]", parts[1], maxZoom)
+	}
+	t.z = uint(z)
+	tiles := new(big.Int).Lsh(big.NewInt(1), t.z)
+	for i, v := range []**big.Int{&t.x, &t.y} {
+		s := parts[2+i]
+		if i == 1 {
+			s = strings.TrimSuffix(s, ".png")
+		}
+		n, ok := new(big.Int).SetString(s, 10)
+		if !ok || n.Sign() < 0 || n.Cmp(tiles) >= 0 {
+			return nil, fmt.Errorf("bad tile %q: want an integer in [0, 2^%d)", s, t.z)
+		}
+		*v = n
+	}
+
+	get := func(name string) string {
+		if v := query[name]; len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	integer := func(name string, v *int, lo, hi int) error {
+		s := get(name)
+		if s == "" {
+			return nil
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < lo || n > hi {
+			return fmt.Errorf("bad %s %q: want an integer in [%d, %d]", name, s, lo, hi)
+		}
+		*v = n
+		return nil
+	}
+	t.f.iter = min(256+32*int(t.z), maxIter)
+	if err := integer("iter", &t.f.iter, 1, maxIter); err != nil {
+		return nil, err
+	}
+	if err := integer("ss", &t.samples, 1, maxSamples); err != nil {
+		return nil, err
+	}
+	if err := integer("size", &t.size, minSize, maxSize); err != nil {
+		return nil, err
+	}
+	if work := int64(t.f.iter) * int64(t.size*t.size*t.samples*t.samples); work > maxWork {
+		return nil, fmt.Errorf("too many iterations: iter × size² × ss² is %d, want at most %d", work, maxWork)
+	}
+	if s := get("palette"); s != "" {
+		pal, ok := palettes[s]
+		if !ok {
+			return nil, fmt.Errorf("unknown palette %q", s)
+		}
+		t.pal = pal
+	}
+	if s := get("c"); s != "" {
+		re, im, ok := strings.Cut(s, ",")
+		x, err1 := strconv.ParseFloat(re, 64)
+		y, err2 := strconv.ParseFloat(im, 64)
+		if !ok || err1 != nil || err2 != nil || math.Hypot(x, y) > 2 {
+			return nil, fmt.Errorf("bad c %q: want re,im within 2 of 0", s)
+		}
+		t.f.c = complex(x, y)
+	}
+	return t, nil
+}
+
+// key returns the name in the cache of t, by its parameters and its
+// place: set/params/z/x/y.png.
+func (t *tile) key() string {
+	set := "mandelbrot"
+	if t.f.julia {
+		set = "julia"
+	}
+	params := fmt.Sprintf("c=%g iter=%d palette=%v ss=%d size=%d",
+		t.f.c, t.f.iter, t.pal, t.samples, t.size)
+	return filepath.Join(set, fmt.Sprintf("%x", sha256.Sum256([]byte(params)))[:16],
+		strconv.FormatUint(uint64(t.z), 10), t.x.String(), t.y.String()+".png")
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/big"
+	"runtime"
+	"sync"
+)
+
+// -- palettes --
+
+// A palette is a cycle of colors by which escaping points are shaded
+// according to their smooth iteration counts, period iterations per
+// cycle. Points that do not escape are black.
+type palette struct {
+	colors []color.RGBA
+	period float64
+}
+
+var palettes = map[string]palette{
+	"classic": {[]color.RGBA{
+		{0x00, 0x07, 0x64, 0xff}, {0x20, 0x6b, 0xcb, 0xff}, {0xed, 0xff, 0xff, 0xff},
+		{0xff, 0xaa, 0x00, 0xff}, {0x00, 0x02, 0x00, 0xff},
+	}, 64},
+	"fire": {[]color.RGBA{
+		{0x20, 0x00, 0x00, 0xff}, {0xc0, 0x20, 0x00, 0xff}, {0xff, 0xc0, 0x00, 0xff},
+		{0xff, 0xff, 0xe0, 0xff}, {0xff, 0x80, 0x00, 0xff},
+	}, 48},
+	"ocean": {[]color.RGBA{
+		{0x00, 0x10, 0x30, 0xff}, {0x00, 0x60, 0x90, 0xff}, {0x40, 0xc0, 0xc0, 0xff},
+		{0xe0, 0xff, 0xf0, 0xff},
+	}, 40},
+	"grey": {[]color.RGBA{{0x10, 0x10, 0x10, 0xff}, {0xf0, 0xf0, 0xf0, 0xff}}, 32},
+}
+
+// at returns the color of the smooth iteration count mu.
+func (p palette) at(mu float64) color.RGBA {
+	if mu < 0 {
+		return color.RGBA{0, 0, 0, 0xff}
+	}
+	t := math.Mod(mu/p.period, 1) * float64(len(p.colors))
+	i := int(t)
+	t -= float64(i)
+	a, b := p.colors[i%len(p.colors)], p.colors[(i+1)%len(p.colors)]
+	mix := func(a, b uint8) uint8 { return uint8(float64(a) + t*(float64(b)-float64(a)) + 0.5) }
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 0xff}
+}
+
+// -- tiles --
+
+// The tiles at zoom z divide the square [-2, 2]² of the complex plane
+// into 2^z × 2^z tiles. Tile (0, 0) is at its top left, -2 + 2i.
+const extent = 4 // the width of the square
+
+// deepZoom is the least zoom at which tiles are rendered by
+// perturbation, where their pixels are 4/2^40/256 ≈ 1.4e-14 apart.
+const deepZoom = 40
+
+// A tile is a tile of a fractal, and how to render it.
+type tile struct {
+	f       *fractal
+	z       uint
+	x, y    *big.Int
+	size    int // in pixels
+	samples int // per pixel along each axis, for anti-aliasing
+	pal     palette
+}
+
+// workers limits the rows of pixels rendered at once, by all requests.
+var workers = make(chan struct{}, runtime.NumCPU())
+
+// render returns the image of t, rendering rows of pixels in parallel.
+func (t *tile) render() *image.RGBA {
+	// The center of the tile, to z + 64 bits, for the reference orbit
+	// of perturbation, and to float64, for the points of shallow tiles.
+	prec := t.z + 64
+	re := new(big.Float).SetPrec(prec).SetInt(t.x)
+	im := new(big.Float).SetPrec(prec).SetInt(t.y)
+	half := big.NewFloat(0.5)
+	re.Add(re, half).SetMantExp(re, 2-int(t.z)) // ×4/2^z, exactly
+	im.Add(im, half).SetMantExp(im, 2-int(t.z))
+	re.Sub(re, big.NewFloat(2))
+	im.Sub(big.NewFloat(2), im)
+	cr, _ := re.Float64()
+	ci, _ := im.Float64()
+	center := complex(cr, ci)
+
+	escape := func(d complex128) float64 { return t.f.escape(center + d) }
+	if t.z >= deepZoom {
+		orbit := t.f.reference(re, im, prec)
+		escape = func(d complex128) float64 { return t.f.escapeNear(orbit, d) }
+	}
+
+	// The offsets of the samples from the center of the tile.
+	spacing := math.Ldexp(extent/float64(t.size*t.samples), -int(t.z))
+	offset := func(p, s int) float64 {
+		return (float64(p*t.samples+s) + 0.5 - float64(t.size*t.samples)/2) * spacing
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, t.size, t.size))
+	rows := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for py := range rows {
+				workers <- struct{}{}
+				for px := 0; px < t.size; px++ {
+					var r, g, b int
+					for sy := 0; sy < t.samples; sy++ {
+						for sx := 0; sx < t.samples; sx++ {
+							// The imaginary axis points up.
+							c := t.pal.at(escape(complex(offset(px, sx), -offset(py, sy))))
+							r, g, b = r+int(c.R), g+int(c.G), b+int(c.B)
+						}
+					}
+					n := t.samples * t.samples
+					img.SetRGBA(px, py, color.RGBA{uint8(r / n), uint8(g / n), uint8(b / n), 0xff})
+				}
+				<-workers
+			}
+		}()
+	}
+	for py := 0; py < t.size; py++ {
+		rows <- py
+	}
+	close(rows)
+	wg.Wait()
+	return img
+}
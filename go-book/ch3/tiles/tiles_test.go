@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestPerturbation checks that perturbation agrees with float64 at a
+// zoom where float64 is precise enough.
+func TestPerturbation(t *testing.T) {
+	for _, f := range []*fractal{
+		{iter: 1000},
+		{julia: true, c: complex(-0.8, 0.156), iter: 1000},
+	} {
+		center := complex(-0.7436438870371, 0.1318259042053)
+		if f.julia {
+			center = complex(0.3, 0.01)
+		}
+		orbit := f.reference(big.NewFloat(real(center)), big.NewFloat(imag(center)), 128)
+		const n, spacing = 32, 1e-8
+		differ := 0
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				d := complex(float64(i-n/2)*spacing, float64(j-n/2)*spacing)
+				want, got := f.escape(center+d), f.escapeNear(orbit, d)
+				if (want < 0) != (got < 0) || math.Abs(want-got) > 0.01 {
+					differ++
+				}
+			}
+		}
+		if differ > n*n/100 {
+			t.Errorf("julia=%t: %d of %d points escape otherwise by perturbation", f.julia, differ, n*n)
+		}
+	}
+}
+
+// TestDeepZoom checks the pixels of a tile beyond the precision of
+// float64, where several neighbors would be the same point.
+func TestDeepZoom(t *testing.T) {
+	const z = 52
+	// The tile of a point of the boundary of the Mandelbrot set.
+	re, im := -0.743643887037151, 0.131825904205330
+	index := func(v float64) *big.Int {
+		f := big.NewFloat(v / extent)
+		n, _ := f.SetMantExp(f, z).Int(nil)
+		return n
+	}
+	x, y := index(re+2), index(2-im)
+	tl := &tile{f: &fractal{iter: 4000}, z: z, x: x, y: y, size: 32, samples: 1, pal: palettes["grey"]}
+	img := tl.render()
+	same := 0 // pixels the color of their left neighbor
+	for py := 0; py < tl.size; py++ {
+		for px := 1; px < tl.size; px++ {
+			if img.At(px, py) == img.At(px-1, py) {
+				same++
+			}
+		}
+	}
+	if same > tl.size*tl.size/10 {
+		t.Errorf("tile %d/%v/%v: %d pixels are the color of their left neighbor", z, x, y, same)
+	}
+}
+
+func TestParseTile(t *testing.T) {
+	for _, test := range []struct {
+		path, query string
+		want        string // error
+	}{
+		{"/mandelbrot/3/7/0.png", "", ""},
+		{"/julia/300/0/0.png", "", `bad zoom "300": want an integer in [0, 256]`},
+		{"/mandelbrot/3/8/0.png", "", `bad tile "8": want an integer in [0, 2^3)`},
+		{"/mandelbrot/3/-1/0.png", "", `bad tile "-1": want an integer in [0, 2^3)`},
+		{"/mandelbrot/100/1267650600228229401496703205375/0.png", "", ""},
+		{"/mandelbrot/0/0/0.png", "palette=pink", `unknown palette "pink"`},
+		{"/mandelbrot/0/0/0.png", "ss=5", `bad ss "5": want an integer in [1, 4]`},
+		{"/mandelbrot/0/0/0.png", "size=1024&ss=4", ""},
+		{"/mandelbrot/256/0/0.png", "", ""},
+		{"/mandelbrot/0/0/0.png", "iter=100000&size=1024&ss=4",
+			"too many iterations: iter × size² × ss² is 1677721600000, want at most 4294967296"},
+		{"/julia/0/0/0.png", "c=3,0", `bad c "3,0": want re,im within 2 of 0`},
+		{"/mandelbrot/0/0/0.gif", "", "not found"},
+		{"/newton/0/0/0.png", "", "not found"},
+	} {
+		query, _ := url.ParseQuery(test.query)
+		_, err := parseTile(test.path, query)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != test.want {
+			t.Errorf("parseTile(%s?%s) error = %q, want %q", test.path, test.query, got, test.want)
+		}
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	c := &diskCache{dir: t.TempDir(), max: 100, size: -1}
+	tile := bytes.Repeat([]byte{'x'}, 30)
+	now := time.Now()
+	for i, key := range []string{"a/0.png", "b/0.png", "c/0.png"} {
+		if err := c.put(key, tile); err != nil {
+			t.Fatal(err)
+		}
+		// b was used least recently, then c, then a.
+		used := now.Add(time.Duration([]int{0, -2, -1}[i]) * time.Hour)
+		if err := os.Chtimes(filepath.Join(c.dir, key), used, used); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := c.get("a/0.png"); !ok {
+		t.Fatalf("get(a/0.png) missed")
+	}
+	// Adding d evicts the least recently used down to 75 - 30 bytes.
+	if err := c.put("d/0.png", tile); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]bool{"a/0.png": true, "b/0.png": false, "c/0.png": false, "d/0.png": true} {
+		if _, ok := c.get(key); ok != want {
+			t.Errorf("after eviction, get(%s) = %t, want %t", key, ok, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(c.dir, "b")); !os.IsNotExist(err) {
+		t.Errorf("the directory of an evicted tile remains: %v", err)
+	}
+	if c.size != 60 {
+		t.Errorf("size = %d, want 60", c.size)
+	}
+
+	// The size of a cache is that of the tiles in it from before.
+	c = &diskCache{dir: c.dir, max: 100, size: -1}
+	if err := c.put("e/0.png", tile); err != nil {
+		t.Fatal(err)
+	}
+	if c.size != 90 {
+		t.Errorf("size of a reopened cache = %d, want 90", c.size)
+	}
+}
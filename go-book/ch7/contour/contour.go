@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// -- marching squares --
+
+// A point is a point of an isoline, in the units of its grid or of the
+// canvas.
+type point struct{ x, y float64 }
+
+// An isoline is a polyline along which a function has the same value,
+// its level. A closed isoline ends where it starts.
+type isoline struct {
+	level  float64
+	pts    []point
+	closed bool
+}
+
+// An edge is a side of a cell of a grid, from the corner (i, j) along
+// the i or the j axis.
+type edge struct {
+	i, j   int
+	alongJ bool
+}
+
+// isolines returns the isolines of level through the grid of values z,
+// where z[i][j] is the value at the corner (i, j). Cells with a corner
+// that is not finite are left out, so isolines end at them as at the
+// sides of the grid.
+func isolines(z [][]float64, level float64) []isoline {
+	var segs [][2]edge
+	pts := make(map[edge]point)
+	cross := func(e edge) bool {
+		i1, j1 := e.i+1, e.j
+		if e.alongJ {
+			i1, j1 = e.i, e.j+1
+		}
+		a, b := z[e.i][e.j], z[i1][j1]
+		if (a >= level) == (b >= level) {
+			return false
+		}
+		if _, ok := pts[e]; !ok {
+			t := (level - a) / (b - a)
+			pts[e] = point{float64(e.i) + t*float64(i1-e.i), float64(e.j) + t*float64(j1-e.j)}
+		}
+		return true
+	}
+	for i := 0; i+1 < len(z); i++ {
+		for j := 0; j+1 < len(z[i]); j++ {
+			a, b, c, d := z[i][j], z[i+1][j], z[i+1][j+1], z[i][j+1]
+			if !finite(a) || !finite(b) || !finite(c) || !finite(d) {
+				continue
+			}
+			// The sides of the cell, anticlockwise from its corner (i, j).
+			sides := [4]edge{{i, j, false}, {i + 1, j, true}, {i, j + 1, false}, {i, j, true}}
+			var crossed []edge
+			for _, e := range sides {
+				if cross(e) {
+					crossed = append(crossed, e)
+				}
+			}
+			switch len(crossed) {
+			case 2:
+				segs = append(segs, [2]edge{crossed[0], crossed[1]})
+			case 4:
+				// A saddle: a and c are on one side of level, b and d on
+				// the other. The value at the center decides whether
+				// the isolines cut off the corners b and d, or a and c.
+				if ((a+b+c+d)/4 >= level) == (a >= level) {
+					segs = append(segs, [2]edge{sides[0], sides[1]}, [2]edge{sides[2], sides[3]})
+				} else {
+					segs = append(segs, [2]edge{sides[3], sides[0]}, [2]edge{sides[1], sides[2]})
+				}
+			}
+		}
+	}
+
+	// Join the segments at their shared edges, first from the ends of
+	// the open isolines, then around the closed ones.
+	at := make(map[edge][]int) // indexes of the segments at each edge
+	for k, s := range segs {
+		at[s[0]] = append(at[s[0]], k)
+		at[s[1]] = append(at[s[1]], k)
+	}
+	used := make([]bool, len(segs))
+	walk := func(start edge) isoline {
+		line := isoline{level: level, pts: []point{pts[start]}}
+		for e := start; ; {
+			next := -1
+			for _, k := range at[e] {
+				if !used[k] {
+					next = k
+					break
+				}
+			}
+			if next < 0 {
+				line.closed = e == start && len(line.pts) > 2
+				return line
+			}
+			used[next] = true
+			if s := segs[next]; s[0] == e {
+				e = s[1]
+			} else {
+				e = s[0]
+			}
+			line.pts = append(line.pts, pts[e])
+		}
+	}
+	var lines []isoline
+	for k, s := range segs {
+		for _, e := range s {
+			if !used[k] && len(at[e]) == 1 {
+				lines = append(lines, walk(e))
+			}
+		}
+	}
+	for k, s := range segs {
+		if !used[k] {
+			lines = append(lines, walk(s[0]))
+		}
+	}
+	return lines
+}
+
+func finite(x float64) bool { return !math.IsNaN(x) && !math.IsInf(x, 0) }
+
+// -- the SVG of the isolines --
+
+// minLabel is the least length in pixels of a labelled isoline.
+const minLabel = 60
+
+// writeContours writes the isolines of p as an SVG.
+func writeContours(w http.ResponseWriter, p *plot) {
+	z := make([][]float64, p.cells+1)
+	var zs []float64
+	for i := range z {
+		z[i] = make([]float64, p.cells+1)
+		for j := range z[i] {
+			// Row j of the grid is up from the bottom of the canvas.
+			z[i][j] = p.f(p.x(p.gridX(float64(i))), p.y(p.gridY(float64(j))))
+			zs = append(zs, z[i][j])
+		}
+	}
+	lo, hi := p.zrange(zs)
+	levels := p.level
+	if len(levels) == 0 {
+		levels = niceLevels(lo, hi, p.levels)
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	fmt.Fprintf(w, "<svg xmlns='http://www.w3.org/2000/svg' width='%d' height='%d'>\n", p.width, p.height)
+	fmt.Fprintln(w, "<style>path { fill: none; stroke-width: 1 } "+
+		"text { font: 10px sans-serif; text-anchor: middle; dominant-baseline: middle; "+
+		"stroke: white; stroke-width: 3; paint-order: stroke }</style>")
+	fmt.Fprintf(w, "<rect width='%d' height='%d' fill='white' stroke='grey'/>\n", p.width, p.height)
+	for _, level := range levels {
+		color := isolineColor(p.color, lo, hi, level)
+		for _, line := range isolines(z, level) {
+			for k, pt := range line.pts {
+				line.pts[k] = point{p.gridX(pt.x), p.gridY(pt.y)}
+			}
+			writeIsoline(w, line, color)
+		}
+	}
+	fmt.Fprintln(w, "</svg>")
+}
+
+// gridX and gridY return the canvas coordinates of the grid coordinates
+// x and y, whose y axis points up.
+func (p *plot) gridX(x float64) float64 { return x * float64(p.width) / float64(p.cells) }
+func (p *plot) gridY(y float64) float64 {
+	return float64(p.height) - y*float64(p.height)/float64(p.cells)
+}
+
+// isolineColor returns the SVG color of the isolines of level in the
+// range [lo, hi] colored by the color map of name, or black.
+func isolineColor(name string, lo, hi, level float64) string {
+	m, ok := colorMaps[name]
+	if !ok {
+		return "black"
+	}
+	t := 0.5
+	if hi > lo {
+		t = (level - lo) / (hi - lo)
+	}
+	c := m.at(t)
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// writeIsoline writes line as an SVG path of the color, labelled with
+// its level halfway along it if it is long enough.
+func writeIsoline(w io.Writer, line isoline, color string) {
+	var d strings.Builder
+	length := 0.0
+	for k, pt := range line.pts {
+		if k == 0 {
+			fmt.Fprintf(&d, "M%.2f,%.2f", pt.x, pt.y)
+			continue
+		}
+		fmt.Fprintf(&d, " L%.2f,%.2f", pt.x, pt.y)
+		length += math.Hypot(pt.x-line.pts[k-1].x, pt.y-line.pts[k-1].y)
+	}
+	if line.closed {
+		d.WriteString(" Z")
+	}
+	fmt.Fprintf(w, "<path d='%s' stroke='%s'/>\n", d.String(), color)
+	if length < minLabel {
+		return
+	}
+
+	// The label is along the segment halfway along the line, upright.
+	half := length / 2
+	for k := 1; k < len(line.pts); k++ {
+		a, b := line.pts[k-1], line.pts[k]
+		n := math.Hypot(b.x-a.x, b.y-a.y)
+		if n < half {
+			half -= n
+			continue
+		}
+		t := half / n
+		x, y := a.x+t*(b.x-a.x), a.y+t*(b.y-a.y)
+		angle := math.Atan2(b.y-a.y, b.x-a.x) * 180 / math.Pi
+		if angle > 90 {
+			angle -= 180
+		} else if angle < -90 {
+			angle += 180
+		}
+		fmt.Fprintf(w, "<text x='%.2f' y='%.2f' transform='rotate(%.1f %.2f %.2f)' fill='%s'>%s</text>\n",
+			x, y, angle, x, y, color, strconv.FormatFloat(line.level, 'g', 4, 64))
+		return
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestIsolines(t *testing.T) {
+	// A cone around (10, 10), whose isolines are circles.
+	z := make([][]float64, 21)
+	for i := range z {
+		z[i] = make([]float64, 21)
+		for j := range z[i] {
+			z[i][j] = math.Hypot(float64(i-10), float64(j-10))
+		}
+	}
+	for _, level := range []float64{2.5, 5, 9.5} {
+		lines := isolines(z, level)
+		if len(lines) != 1 || !lines[0].closed {
+			t.Errorf("isolines(cone, %g): got %d lines, want one closed line", level, len(lines))
+			continue
+		}
+		pts := lines[0].pts
+		if pts[0] != pts[len(pts)-1] {
+			t.Errorf("isolines(cone, %g): closed line ends at %v, not its start %v", level, pts[len(pts)-1], pts[0])
+		}
+		for _, pt := range pts {
+			if r := math.Hypot(pt.x-10, pt.y-10); math.Abs(r-level) > 0.1 {
+				t.Errorf("isolines(cone, %g): point %v at distance %g", level, pt, r)
+				break
+			}
+		}
+	}
+
+	// At the side of the grid, and around a hole, isolines are open.
+	if lines := isolines(z, 12); len(lines) != 4 || lines[0].closed {
+		t.Errorf("isolines(cone, 12): got %d lines, want four open lines at the corners", len(lines))
+	}
+	z[12][10] = math.NaN()
+	if lines := isolines(z, 2.5); len(lines) != 1 || lines[0].closed {
+		t.Errorf("isolines(cone with a hole, 2.5) = %v, want one open line", lines)
+	}
+}
+
+func TestSaddle(t *testing.T) {
+	for _, test := range []struct {
+		level float64
+		want  string // the points of the isolines
+	}{
+		{0.4, "[{0.6 0} {1 0.4}] [{0.4 1} {0 0.6}]"}, // the center 0.5 is above: cut off the lows
+		{0.6, "[{0 0.4} {0.4 0}] [{1 0.6} {0.6 1}]"}, // below: cut off the highs
+	} {
+		z := [][]float64{{1, 0}, {0, 1}} // highs at (0, 0) and (1, 1)
+		var got []string
+		for _, line := range isolines(z, test.level) {
+			got = append(got, fmt.Sprint(line.pts))
+		}
+		if len(got) != 2 || got[0]+" "+got[1] != test.want {
+			t.Errorf("isolines(saddle, %g) = %v, want %s", test.level, got, test.want)
+		}
+	}
+}
+
+func TestNiceLevels(t *testing.T) {
+	for _, test := range []struct {
+		lo, hi float64
+		n      int
+		want   string
+	}{
+		{0, 1, 5, "[0.2 0.4 0.6 0.8]"},
+		{-1, 1, 4, "[-0.5 0 0.5]"},
+		{-0.3, 97, 10, "[0 10 20 30 40 50 60 70 80 90]"},
+		{3, 3, 10, "[]"},
+		{1e17, 1e17 + 16, 10, "[]"},
+		{1e17 - 1e3, 1e17 + 1e3, 4, "[9.99999999999995e+16 1e+17 1.000000000000005e+17]"},
+		{-1e300, 1e300, 2, "[0]"},
+		{1, math.Nextafter(1, 2), 1, "[]"},
+	} {
+		if got := fmt.Sprint(niceLevels(test.lo, test.hi, test.n)); got != test.want {
+			t.Errorf("niceLevels(%g, %g, %d) = %s, want %s", test.lo, test.hi, test.n, got, test.want)
+		}
+	}
+}
+
+func TestHandleLimits(t *testing.T) {
+	// f22 inlines to 2^24 - 1 nodes.
+	defs := []string{"f0(t) = t + 1"}
+	for i := 1; i <= 22; i++ {
+		defs = append(defs, fmt.Sprintf("f%d(t) = f%d(t) + f%d(t)", i, i-1, i-1))
+	}
+	nested := strings.Join(defs, "; ") + "; f22(x)"
+
+	for _, test := range []struct {
+		query url.Values
+		code  int
+		want  string // in the body
+	}{
+		{url.Values{"expr": {"f(t) = t * t; f(x) - y"}, "width": {"64"}, "height": {"64"}}, http.StatusOK, "<svg"},
+		{url.Values{"expr": {strings.Repeat("x+", maxExpr/2) + "x"}}, http.StatusBadRequest, "more than 1000"},
+		{url.Values{"expr": {nested}}, http.StatusBadRequest, "bad expr: 16777215 nodes inlined, more than 2000"},
+		{url.Values{"expr": {"f(t) = f(t); f(x)"}}, http.StatusBadRequest, "bad expr"},
+	} {
+		w := httptest.NewRecorder()
+		handle(writeContours)(w, httptest.NewRequest("GET", "/contour?"+test.query.Encode(), nil))
+		if body := w.Body.String(); w.Code != test.code || !strings.Contains(body, test.want) {
+			if len(body) > 100 {
+				body = body[:100]
+			}
+			t.Errorf("contour(%.60s): %d %q, want %d with %q", test.query.Encode(), w.Code, body, test.code, test.want)
+		}
+	}
+}
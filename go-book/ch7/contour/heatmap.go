@@ -0,0 +1,154 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"net/http"
+	"strconv"
+)
+
+// -- color maps, as in gopl.io/ch7/surface --
+
+// A colorMap is a sequence of colors evenly spaced from the lowest
+// values to the highest.
+type colorMap []color.RGBA
+
+var colorMaps = map[string]colorMap{
+	"grey":    {{0x40, 0x40, 0x40, 0xff}, {0xf0, 0xf0, 0xf0, 0xff}},
+	"redblue": {{0x00, 0x00, 0xff, 0xff}, {0xff, 0xff, 0xff, 0xff}, {0xff, 0x00, 0x00, 0xff}},
+	"heat": {
+		{0x00, 0x00, 0x00, 0xff}, {0x80, 0x00, 0x00, 0xff}, {0xff, 0x40, 0x00, 0xff},
+		{0xff, 0xc0, 0x00, 0xff}, {0xff, 0xff, 0xc0, 0xff},
+	},
+	"viridis": {
+		{0x44, 0x01, 0x54, 0xff}, {0x3b, 0x52, 0x8b, 0xff}, {0x21, 0x91, 0x8c, 0xff},
+		{0x5e, 0xc9, 0x62, 0xff}, {0xfd, 0xe7, 0x25, 0xff},
+	},
+}
+
+// at returns the color of m at t, from 0 for the lowest values to 1 for
+// the highest; t outside [0, 1] is clamped.
+func (m colorMap) at(t float64) color.RGBA {
+	if len(m) == 1 || !(t > 0) {
+		return m[0]
+	}
+	if t >= 1 {
+		return m[len(m)-1]
+	}
+	t *= float64(len(m) - 1)
+	i := int(t)
+	t -= float64(i)
+	mix := func(a, b uint8) uint8 { return uint8(float64(a) + t*(float64(b)-float64(a)) + 0.5) }
+	a, b := m[i], m[i+1]
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 0xff}
+}
+
+// -- the heatmap --
+
+// The legend is a bar of the colors of the range, to the right of the
+// plot, with ticks at round values.
+const (
+	legendWidth = 96 // pixels, including a margin of barX
+	barX        = 10 // from the plot
+	barWidth    = 16
+	tickLength  = 4
+)
+
+// writeHeatmap writes the heatmap of p as a PNG. Pixels where the
+// function is not finite are transparent.
+func writeHeatmap(w http.ResponseWriter, p *plot) {
+	zs := make([]float64, p.width*p.height)
+	for j := 0; j < p.height; j++ {
+		for i := 0; i < p.width; i++ {
+			zs[j*p.width+i] = p.f(p.x(float64(i)+0.5), p.y(float64(j)+0.5))
+		}
+	}
+	lo, hi := p.zrange(zs)
+	m, ok := colorMaps[p.color]
+	if !ok {
+		m = colorMaps["viridis"]
+	}
+	scale := func(z float64) float64 {
+		if hi > lo {
+			return (z - lo) / (hi - lo)
+		}
+		return 0.5
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, p.width+legendWidth, p.height))
+	legend := image.Rect(p.width, 0, p.width+legendWidth, p.height)
+	draw.Draw(img, legend, image.White, image.Point{}, draw.Src)
+	for j := 0; j < p.height; j++ {
+		for i := 0; i < p.width; i++ {
+			if z := zs[j*p.width+i]; finite(z) {
+				img.SetRGBA(i, j, m.at(scale(z)))
+			}
+		}
+	}
+
+	// The bar runs from hi at the top to lo at the bottom, inset by half
+	// a line of text so that the labels at its ends fit.
+	top, bottom := glyphHeight, p.height-1-glyphHeight
+	x0 := p.width + barX
+	for y := top; y <= bottom; y++ {
+		c := m.at(float64(bottom-y) / float64(bottom-top))
+		for x := x0; x < x0+barWidth; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+	ticks := niceLevels(lo, hi, 5)
+	if len(ticks) == 0 {
+		ticks = []float64{lo}
+	}
+	for _, z := range ticks {
+		y := bottom - int(scale(z)*float64(bottom-top)+0.5)
+		for x := x0 + barWidth; x < x0+barWidth+tickLength; x++ {
+			img.SetRGBA(x, y, black)
+		}
+		drawText(img, x0+barWidth+tickLength+2, y-glyphHeight/2, strconv.FormatFloat(z, 'g', 4, 64))
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	png.Encode(w, img)
+}
+
+// -- a pixel font for the labels of the legend --
+
+var black = color.RGBA{0, 0, 0, 0xff}
+
+// glyphs are the characters of numbers, as rows of 3×5 bits, drawn at
+// twice their size.
+var glyphs = map[rune]string{
+	'0': "111101101101111", '1': "010110010010111", '2': "111001111100111",
+	'3': "111001111001111", '4': "101101111001001", '5': "111100111001111",
+	'6': "111100111101111", '7': "111001001001001", '8': "111101111101111",
+	'9': "111101111001111", '-': "000000111000000", '+': "000010111010000",
+	'.': "000000000000010", 'e': "000011111100011",
+}
+
+const (
+	glyphScale  = 2
+	glyphWidth  = 3 * glyphScale
+	glyphHeight = 5 * glyphScale
+)
+
+// drawText draws the number s in black with its top left corner at
+// (x, y). It leaves out other characters.
+func drawText(img *image.RGBA, x, y int, s string) {
+	for _, r := range s {
+		bits, ok := glyphs[r]
+		if !ok {
+			continue
+		}
+		for k, b := range bits {
+			if b == '1' {
+				px, py := x+k%3*glyphScale, y+k/3*glyphScale
+				draw.Draw(img, image.Rect(px, py, px+glyphScale, py+glyphScale),
+					image.Black, image.Point{}, draw.Src)
+			}
+		}
+		x += glyphWidth + glyphScale
+	}
+}
@@ -0,0 +1,305 @@
+// The contour program serves top-down plots of a function of x and y,
+// as seen from above by the isometric plots of gopl.io/ch7/surface.
+//
+// The /contour handler draws the isolines of the function, found by
+// marching squares, as an SVG with each line labelled by its level. The
+// /heatmap handler colors each pixel by the value of the function, as a
+// PNG with a legend of its colors. Both take the function as expr, of x,
+// y and r, the distance from (0,0), and these optional parameters:
+//
+//	width, height  size of the plot in pixels (512, 512)
+//	xmin, xmax     x axis range (-15, 15)
+//	ymin, ymax     y axis range (-15, 15)
+//	zmin, zmax     range of the function, by default that of its values
+//	var            a variable of expr as name=value, e.g. k=2; repeatable
+//	color          grey, redblue, heat or viridis; by default, isolines
+//	               are black and heatmaps viridis
+//	cells          grid cells along each axis for isolines (100)
+//	levels         about how many isolines to draw, at round numbers (10)
+//	level          the value of an isoline to draw instead; repeatable
+//
+// For example:
+//
+//	http://localhost:8000/contour?expr=sin(x)*cos(y/2)&levels=6
+//	http://localhost:8000/heatmap?expr=sin(k*r)/r&var=k=0.5&color=heat
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"gopl.io/ch7/eval"
+)
+
+func main() {
+	http.HandleFunc("/contour", handle(writeContours))
+	http.HandleFunc("/heatmap", handle(writeHeatmap))
+	log.Fatal(http.ListenAndServe("localhost:8000", nil))
+}
+
+// handle returns a handler that parses the plot of a request and writes
+// it with write.
+func handle(write func(http.ResponseWriter, *plot)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		p, err := parsePlot(r.Form)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		write(w, p)
+	}
+}
+
+// Limits on the requests.
+const (
+	maxExpr   = 1000 // bytes of expr
+	maxNodes  = 2000 // of expr with its functions inlined
+	minCanvas = 64   // pixels
+	maxCanvas = 4096
+	maxCells  = 400
+	maxVars   = 10
+	maxLevels = 50
+)
+
+// A plot is a function of x and y over a rectangle, and the options to
+// draw it.
+type plot struct {
+	f                      func(x, y float64) float64
+	width, height          int
+	xmin, xmax, ymin, ymax float64
+	zmin, zmax             float64
+	zset                   bool // zmin and zmax are given
+	color                  string
+	cells                  int
+	levels                 int       // number of round levels
+	level                  []float64 // or these levels
+}
+
+// parsePlot returns the plot of the query form, or an error for
+// missing, malformed or out of range values.
+func parsePlot(form url.Values) (*plot, error) {
+	p := new(plot)
+	var err error
+	integer := func(name string, v *int, def, lo, hi int) {
+		*v = def
+		s := form.Get(name)
+		if s == "" || err != nil {
+			return
+		}
+		n, e := strconv.Atoi(s)
+		if e != nil || n < lo || n > hi {
+			err = fmt.Errorf("bad %s %q: want an integer in [%d, %d]", name, s, lo, hi)
+			return
+		}
+		*v = n
+	}
+	number := func(name, s string, v *float64) {
+		if err != nil {
+			return
+		}
+		x, e := strconv.ParseFloat(s, 64)
+		if e != nil || math.IsNaN(x) || math.IsInf(x, 0) {
+			err = fmt.Errorf("bad %s %q: want a finite number", name, s)
+			return
+		}
+		*v = x
+	}
+	option := func(name string, v *float64, def float64) bool {
+		*v = def
+		if s := form.Get(name); s != "" {
+			number(name, s, v)
+			return true
+		}
+		return false
+	}
+	integer("width", &p.width, 512, minCanvas, maxCanvas)
+	integer("height", &p.height, 512, minCanvas, maxCanvas)
+	integer("cells", &p.cells, 100, 1, maxCells)
+	integer("levels", &p.levels, 10, 1, maxLevels)
+	option("xmin", &p.xmin, -15)
+	option("xmax", &p.xmax, 15)
+	option("ymin", &p.ymin, -15)
+	option("ymax", &p.ymax, 15)
+	zmin := option("zmin", &p.zmin, 0)
+	zmax := option("zmax", &p.zmax, 0)
+	if len(form["level"]) > maxLevels {
+		return nil, fmt.Errorf("%d levels, more than %d", len(form["level"]), maxLevels)
+	}
+	p.level = make([]float64, len(form["level"]))
+	for i, s := range form["level"] {
+		number("level", s, &p.level[i])
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case p.xmin >= p.xmax:
+		return nil, fmt.Errorf("xmin %g is not less than xmax %g", p.xmin, p.xmax)
+	case p.ymin >= p.ymax:
+		return nil, fmt.Errorf("ymin %g is not less than ymax %g", p.ymin, p.ymax)
+	case zmin != zmax:
+		return nil, fmt.Errorf("zmin and zmax must be given together")
+	case zmin && p.zmin >= p.zmax:
+		return nil, fmt.Errorf("zmin %g is not less than zmax %g", p.zmin, p.zmax)
+	}
+	p.zset = zmin
+
+	p.color = form.Get("color")
+	if _, ok := colorMaps[p.color]; !ok && p.color != "" {
+		return nil, fmt.Errorf("unknown color %q", p.color)
+	}
+
+	env, err := parseVars(form["var"])
+	if err != nil {
+		return nil, err
+	}
+	if p.f, err = compile(form.Get("expr"), env); err != nil {
+		return nil, fmt.Errorf("bad expr: %v", err)
+	}
+	return p, nil
+}
+
+// parseVars returns the variables of the name=value strings vars.
+func parseVars(vars []string) (eval.Env, error) {
+	if len(vars) > maxVars {
+		return nil, fmt.Errorf("%d vars, more than %d", len(vars), maxVars)
+	}
+	env := eval.Env{}
+	for _, s := range vars {
+		name, value, ok := strings.Cut(s, "=")
+		if !ok {
+			return nil, fmt.Errorf("bad var %q: want name=value", s)
+		}
+		v := eval.Var(name)
+		if e, err := eval.Parse(name); err != nil || e != v || v == "x" || v == "y" || v == "r" {
+			return nil, fmt.Errorf("bad var name %q", name)
+		}
+		x, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(x) || math.IsInf(x, 0) {
+			return nil, fmt.Errorf("bad value of var %s: %q", name, value)
+		}
+		if _, ok := env[v]; ok {
+			return nil, fmt.Errorf("var %s given twice", name)
+		}
+		env[v] = x
+	}
+	return env, nil
+}
+
+// compile returns the function of x and y of the expression s, which
+// may also use r, the distance from (0,0), and the variables of env.
+func compile(s string, env eval.Env) (f func(x, y float64) float64, err error) {
+	if s == "" {
+		return nil, fmt.Errorf("empty expression")
+	}
+	if len(s) > maxExpr {
+		return nil, fmt.Errorf("%d bytes, more than %d", len(s), maxExpr)
+	}
+	expr, err := eval.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	vars := map[eval.Var]bool{}
+	if err := expr.Check(vars); err != nil {
+		return nil, err
+	}
+	names := []eval.Var{"x", "y", "r"}
+	for v := range vars {
+		if _, ok := env[v]; ok {
+			names = append(names, v)
+		} else if v != "x" && v != "y" && v != "r" {
+			return nil, fmt.Errorf("undefined variable: %s", v)
+		}
+	}
+	// Scripts of a few lines may inline to millions of nodes.
+	if n := eval.Size(expr); n > maxNodes {
+		return nil, fmt.Errorf("%d nodes inlined, more than %d", n, maxNodes)
+	}
+
+	defer func() {
+		// eval.Compile panics on recursive scripts.
+		if x := recover(); x != nil {
+			err = fmt.Errorf("%v", x)
+		}
+	}()
+	prog := eval.Compile(expr, names)
+	values := make([]float64, len(names))
+	for i, v := range names[3:] {
+		values[3+i] = env[v]
+	}
+	return func(x, y float64) float64 {
+		values[0], values[1], values[2] = x, y, math.Hypot(x, y)
+		return prog.Eval(values)
+	}, nil
+}
+
+// x and y return the coordinates of the pixel column or row i of p,
+// whose y axis points up.
+func (p *plot) x(i float64) float64 { return p.xmin + (p.xmax-p.xmin)*i/float64(p.width) }
+func (p *plot) y(j float64) float64 { return p.ymax - (p.ymax-p.ymin)*j/float64(p.height) }
+
+// zrange returns the range of the plot: zmin and zmax, or else the
+// range of the finite values zs.
+func (p *plot) zrange(zs []float64) (lo, hi float64) {
+	if p.zset {
+		return p.zmin, p.zmax
+	}
+	lo, hi = math.Inf(+1), math.Inf(-1)
+	for _, z := range zs {
+		if !math.IsNaN(z) && !math.IsInf(z, 0) {
+			lo, hi = math.Min(lo, z), math.Max(hi, z)
+		}
+	}
+	if lo > hi {
+		return 0, 0
+	}
+	return lo, hi
+}
+
+// niceLevels returns about n levels at round multiples, 1, 2 or 5 times
+// a power of ten, strictly between lo and hi. There are none if the
+// levels would be closer than the floats about lo and hi.
+func niceLevels(lo, hi float64, n int) []float64 {
+	if !(lo < hi) || n < 1 {
+		return nil
+	}
+	if a := math.Max(math.Abs(lo), math.Abs(hi)); hi-lo < float64(n)*(math.Nextafter(a, math.Inf(+1))-a) {
+		return nil
+	}
+	// The levels are k*m*10^e, computed as k*m / 10^-e for e < 0 so
+	// that they are the nearest floats to their decimals, e.g., 0.6, not
+	// 3*0.2 = 0.6000000000000001.
+	step := (hi - lo) / float64(n)
+	e := math.Floor(math.Log10(step))
+	m := 10.0
+	for _, x := range []float64{1, 2, 5} {
+		if step <= x*math.Pow(10, e) {
+			m = x
+			break
+		}
+	}
+	level := func(k float64) float64 {
+		if e < 0 {
+			return k * m / math.Pow(10, -e)
+		}
+		return k * m * math.Pow(10, e)
+	}
+	// There are at most about n levels, unless k is too large to count
+	// in floats.
+	var levels []float64
+	k := math.Floor(lo/(m*math.Pow(10, e))) + 1
+	for i := 0; i <= 2*n+1 && level(k) < hi && level(k+1) != level(k); i, k = i+1, k+1 {
+		if k == 0 {
+			levels = append(levels, 0) // not level(0), which may be -0
+		} else if level(k) > lo {
+			levels = append(levels, level(k))
+		}
+	}
+	return levels
+}
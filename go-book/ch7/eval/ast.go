@@ -9,6 +9,9 @@ type Expr interface {
 	Eval(env Env) float64
 	// Check reports errors in this Expr and adds its Vars to the set.
 	Check(vars map[Var]bool) error
+	// EvalChecked is like Eval, but it reports an *EvalError instead of
+	// returning NaN or ±Inf, or 0 for a variable missing from env.
+	EvalChecked(env Env) (float64, error)
 }
 
 //!+ast
@@ -19,22 +22,55 @@ type Var string
 // A literal is a numeric constant, e.g., 3.141.
 type literal float64
 
+// An imaginary is an imaginary constant, e.g., 2i. It is only meaningful
+// to EvalComplex.
+type imaginary float64
+
 // A unary represents a unary operator expression, e.g., -x.
 type unary struct {
-	op rune // one of '+', '-'
+	op rune // one of '+', '-', '!'
 	x  Expr
 }
 
 // A binary represents a binary operator expression, e.g., x+y.
 type binary struct {
-	op   rune // one of '+', '-', '*', '/'
+	op   rune // one of '+', '-', '*', '/', '%', '^', '<', '>', or one in opNames
 	x, y Expr
 }
 
+// A ternary represents a conditional expression, e.g., x > 0 ? x : -x.
+type ternary struct {
+	cond, x, y Expr
+}
+
 // A call represents a function call expression, e.g., sin(x).
 type call struct {
-	fn   string // one of "pow", "sin", "sqrt"
+	fn   string // a function of reg, e.g. "pow", "sin", "sqrt"
 	args []Expr
+	reg  *FuncRegistry // nil means DefaultRegistry
 }
 
 //!-ast
+
+// Operators of two characters are represented by a single rune.
+const (
+	opLE  = '≤' // <=
+	opGE  = '≥' // >=
+	opEQ  = '≡' // ==
+	opNE  = '≠' // !=
+	opAND = '∧' // &&
+	opOR  = '∨' // ||
+)
+
+// opNames maps operator runes to their text in expressions.
+var opNames = map[rune]string{
+	opLE: "<=", opGE: ">=", opEQ: "==", opNE: "!=", opAND: "&&", opOR: "||",
+}
+
+// opName returns the text of operator op.
+func opName(op rune) string {
+	if name, ok := opNames[op]; ok {
+		return name
+	}
+	return string(op)
+}
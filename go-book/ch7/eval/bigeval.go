@@ -0,0 +1,358 @@
+package eval
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+)
+
+// DefaultPrec is the precision, in bits of mantissa, of EvalFloat when
+// called with a precision of 0.
+const DefaultPrec = 256
+
+// A FloatEnv maps variables to arbitrary-precision values.
+type FloatEnv map[Var]*big.Float
+
+// A RatEnv maps variables to exact rational values.
+type RatEnv map[Var]*big.Rat
+
+// Numeric literals are parsed to float64. EvalFloat and EvalRat convert
+// them back to the shortest decimal that parses to the same float64, so
+// 0.1 is exactly 1/10 for EvalRat, and 0.1 to prec bits for EvalFloat.
+
+// EvalFloat is like Eval, but computes with big.Float values of prec
+// bits of mantissa, or DefaultPrec if prec is 0. The functions of
+// DefaultRegistry that have an arbitrary-precision implementation (all
+// but the Bessel, error and gamma functions, and nextafter) are accurate
+// to about prec bits; calls to other functions are errors, as are the
+// cases for which Eval would return NaN or ±Inf.
+func EvalFloat(e Expr, env FloatEnv, prec uint) (z *big.Float, err error) {
+	if prec == 0 {
+		prec = DefaultPrec
+	}
+	defer func() {
+		// Operations on infinities that are not numbers panic.
+		switch x := recover().(type) {
+		case nil:
+		case big.ErrNaN:
+			z, err = nil, &EvalError{e, x.Error()}
+		default:
+			panic(x)
+		}
+	}()
+	return floatEval{env, prec}.eval(e)
+}
+
+// EvalRat is like Eval, but computes exactly with big.Rat values. Only
+// + - * /, integer powers, comparisons and logical operators, and the
+// functions of DefaultRegistry that are exact (abs, ceil, copysign, dim,
+// floor, fma, max, min, mod, pow of integer exponents, round and trunc) are
+// allowed; calls to other functions, such as sqrt, are errors.
+func EvalRat(e Expr, env RatEnv) (*big.Rat, error) {
+	return ratEval{env}.eval(e)
+}
+
+// builtin returns the function called, and whether it is the one of
+// DefaultRegistry, not one registered in its place.
+func (c call) builtin() (*Func, bool, error) {
+	f, ok := c.registry().Lookup(c.fn)
+	if !ok {
+		return nil, false, &EvalError{c, fmt.Sprintf("unknown function %q", c.fn)}
+	}
+	if err := f.checkArity(len(c.args)); err != nil {
+		return nil, false, &EvalError{c, err.Error()}
+	}
+	def, _ := DefaultRegistry.Lookup(c.fn)
+	return f, f == def, nil
+}
+
+// shortest returns the shortest decimal representation of x.
+func shortest(x literal) string {
+	return strconv.FormatFloat(float64(x), 'g', -1, 64)
+}
+
+type floatEval struct {
+	env  FloatEnv
+	prec uint
+}
+
+func (ev floatEval) eval(e Expr) (*big.Float, error) {
+	switch e := e.(type) {
+	case *Script, apply:
+		x, err := inline(e)
+		if err != nil {
+			return nil, &EvalError{e, err.Error()}
+		}
+		return ev.eval(x)
+	case Var:
+		x, ok := ev.env[e]
+		if !ok {
+			return nil, &EvalError{e, "undefined variable"}
+		}
+		if x.IsInf() {
+			return nil, &EvalError{e, "infinite value"}
+		}
+		return newFloat(ev.prec).Set(x), nil
+
+	case imaginary:
+		return nil, &EvalError{e, "imaginary number in real expression"}
+
+	case quantity:
+		return ev.eval(e.expr())
+
+	case literal:
+		z, ok := newFloat(ev.prec).SetString(shortest(e))
+		if !ok || z.IsInf() {
+			return nil, &EvalError{e, "not a finite number"}
+		}
+		return z, nil
+
+	case unary:
+		x, err := ev.eval(e.x)
+		if err != nil {
+			return nil, err
+		}
+		switch e.op {
+		case '+':
+			return x, nil
+		case '-':
+			return x.Neg(x), nil
+		case '!':
+			return ev.truth(x.Sign() == 0), nil
+		}
+		return nil, &EvalError{e, fmt.Sprintf("unsupported unary operator: %q", e.op)}
+
+	case binary:
+		x, err := ev.eval(e.x)
+		if err != nil {
+			return nil, err
+		}
+		if e.op == opAND || e.op == opOR {
+			if (x.Sign() != 0) == (e.op == opOR) {
+				return ev.truth(x.Sign() != 0), nil // y is not needed
+			}
+		}
+		y, err := ev.eval(e.y)
+		if err != nil {
+			return nil, err
+		}
+		z := newFloat(ev.prec)
+		switch e.op {
+		case '+':
+			return z.Add(x, y), nil
+		case '-':
+			return z.Sub(x, y), nil
+		case '*':
+			return z.Mul(x, y), nil
+		case '/':
+			if y.Sign() == 0 {
+				return nil, &EvalError{e, "division by zero"}
+			}
+			return z.Quo(x, y), nil
+		case '%':
+			if y.Sign() == 0 {
+				return nil, &EvalError{e, "division by zero"}
+			}
+			return floatMod(x, y, ev.prec), nil
+		case '^':
+			z, err := floatPow(x, y, ev.prec)
+			if err != nil {
+				return nil, &EvalError{e, err.Error()}
+			}
+			return z, nil
+		case opAND, opOR:
+			return ev.truth(y.Sign() != 0), nil
+		}
+		if cmp, ok := compare(e.op, x.Cmp(y)); ok {
+			return ev.truth(cmp), nil
+		}
+		return nil, &EvalError{e, fmt.Sprintf("unsupported binary operator: %q", e.op)}
+
+	case ternary:
+		cond, err := ev.eval(e.cond)
+		if err != nil {
+			return nil, err
+		}
+		if cond.Sign() != 0 {
+			return ev.eval(e.x)
+		}
+		return ev.eval(e.y)
+
+	case call:
+		f, builtin, err := e.builtin()
+		if err != nil {
+			return nil, err
+		}
+		impl, ok := floatFuncs[e.fn]
+		if !builtin || !ok {
+			return nil, &EvalError{e, fmt.Sprintf("no arbitrary-precision implementation of %s", f.Name)}
+		}
+		args := make([]*big.Float, len(e.args))
+		for i, arg := range e.args {
+			if args[i], err = ev.eval(arg); err != nil {
+				return nil, err
+			}
+		}
+		z, err := impl(args, ev.prec)
+		if err != nil {
+			return nil, &EvalError{e, err.Error()}
+		}
+		return z, nil
+	}
+	panic(fmt.Sprintf("unknown Expr: %T", e))
+}
+
+func (ev floatEval) truth(cond bool) *big.Float {
+	return newFloat(ev.prec).SetFloat64(truth(cond))
+}
+
+// compare returns the result of comparison op given the result cmp of
+// x.Cmp(y), and whether op is a comparison.
+func compare(op rune, cmp int) (result, ok bool) {
+	switch op {
+	case '<':
+		return cmp < 0, true
+	case opLE:
+		return cmp <= 0, true
+	case '>':
+		return cmp > 0, true
+	case opGE:
+		return cmp >= 0, true
+	case opEQ:
+		return cmp == 0, true
+	case opNE:
+		return cmp != 0, true
+	}
+	return false, false
+}
+
+type ratEval struct {
+	env RatEnv
+}
+
+func (ev ratEval) eval(e Expr) (*big.Rat, error) {
+	switch e := e.(type) {
+	case *Script, apply:
+		x, err := inline(e)
+		if err != nil {
+			return nil, &EvalError{e, err.Error()}
+		}
+		return ev.eval(x)
+	case Var:
+		x, ok := ev.env[e]
+		if !ok {
+			return nil, &EvalError{e, "undefined variable"}
+		}
+		return new(big.Rat).Set(x), nil
+
+	case imaginary:
+		return nil, &EvalError{e, "imaginary number in real expression"}
+
+	case quantity:
+		return ev.eval(e.expr())
+
+	case literal:
+		z, ok := new(big.Rat).SetString(shortest(e))
+		if !ok {
+			return nil, &EvalError{e, "not a finite number"}
+		}
+		return z, nil
+
+	case unary:
+		x, err := ev.eval(e.x)
+		if err != nil {
+			return nil, err
+		}
+		switch e.op {
+		case '+':
+			return x, nil
+		case '-':
+			return x.Neg(x), nil
+		case '!':
+			return ratTruth(x.Sign() == 0), nil
+		}
+		return nil, &EvalError{e, fmt.Sprintf("unsupported unary operator: %q", e.op)}
+
+	case binary:
+		x, err := ev.eval(e.x)
+		if err != nil {
+			return nil, err
+		}
+		if e.op == opAND || e.op == opOR {
+			if (x.Sign() != 0) == (e.op == opOR) {
+				return ratTruth(x.Sign() != 0), nil // y is not needed
+			}
+		}
+		y, err := ev.eval(e.y)
+		if err != nil {
+			return nil, err
+		}
+		z := new(big.Rat)
+		switch e.op {
+		case '+':
+			return z.Add(x, y), nil
+		case '-':
+			return z.Sub(x, y), nil
+		case '*':
+			return z.Mul(x, y), nil
+		case '/':
+			if y.Sign() == 0 {
+				return nil, &EvalError{e, "division by zero"}
+			}
+			return z.Quo(x, y), nil
+		case '%':
+			if y.Sign() == 0 {
+				return nil, &EvalError{e, "division by zero"}
+			}
+			return ratMod(x, y), nil
+		case '^':
+			z, err := ratPow(x, y)
+			if err != nil {
+				return nil, &EvalError{e, err.Error()}
+			}
+			return z, nil
+		case opAND, opOR:
+			return ratTruth(y.Sign() != 0), nil
+		}
+		if cmp, ok := compare(e.op, x.Cmp(y)); ok {
+			return ratTruth(cmp), nil
+		}
+		return nil, &EvalError{e, fmt.Sprintf("unsupported binary operator: %q", e.op)}
+
+	case ternary:
+		cond, err := ev.eval(e.cond)
+		if err != nil {
+			return nil, err
+		}
+		if cond.Sign() != 0 {
+			return ev.eval(e.x)
+		}
+		return ev.eval(e.y)
+
+	case call:
+		f, builtin, err := e.builtin()
+		if err != nil {
+			return nil, err
+		}
+		impl, ok := ratFuncs[e.fn]
+		if !builtin || !ok {
+			return nil, &EvalError{e, fmt.Sprintf("%s is not exact", f.Name)}
+		}
+		args := make([]*big.Rat, len(e.args))
+		for i, arg := range e.args {
+			if args[i], err = ev.eval(arg); err != nil {
+				return nil, err
+			}
+		}
+		z, err := impl(args)
+		if err != nil {
+			return nil, &EvalError{e, err.Error()}
+		}
+		return z, nil
+	}
+	panic(fmt.Sprintf("unknown Expr: %T", e))
+}
+
+func ratTruth(cond bool) *big.Rat {
+	return new(big.Rat).SetFloat64(truth(cond))
+}
@@ -0,0 +1,255 @@
+package eval
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestEvalRat(t *testing.T) {
+	tests := []struct {
+		expr string
+		env  RatEnv
+		want string // result, or error
+	}{
+		{"0.1 + 0.2 == 0.3", nil, "1/1"},
+		{"0.1 + 0.2", nil, "3/10"},
+		{"1 / 3 + 1 / 6", nil, "1/2"},
+		{"p * (1 + r / 12) ^ 12", RatEnv{"p": big.NewRat(1000, 1), "r": big.NewRat(5, 100)},
+			"38388797722185519065061084481/36520347436056576000000000"}, // 1000 * (241/240)^12
+		{"2 ^ -3 + (-2) ^ 3", nil, "-63/8"},
+		{"7.5 % 2 + -7 % 3", nil, "1/2"},
+		{"round(-2.5) + floor(-2.5) + ceil(2.25) + trunc(-2.75)", nil, "-5/1"},
+		{"min(1/3, 0.3) + max(1/3, 0.3) + abs(-1/7) + copysign(2, -1) + dim(1, 3)", nil, "-257/210"},
+		{"mod(7, 2.5) + fma(1/3, 3, 1) + pow(2/3, 2)", nil, "40/9"},
+		{"x > 0 && 1 / x > 1 ? 1 : 0", RatEnv{"x": big.NewRat(0, 1)}, "0/1"},
+		{"x", nil, "x: undefined variable"},
+		{"1 / (x - x)", RatEnv{"x": big.NewRat(1, 1)}, "(1 / (x - x)): division by zero"},
+		{"sqrt(2)", nil, "sqrt(2): sqrt is not exact"},
+		{"2 ^ 0.5", nil, "(2 ^ 0.5): non-integer exponent is not exact"},
+		{"2 ^ 100000", nil, "(2 ^ 100000): result out of range"},
+		{"nosuch(1)", nil, `nosuch(1): unknown function "nosuch"`},
+	}
+	for _, test := range tests {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		z, err := EvalRat(expr, test.env)
+		var got string
+		if err != nil {
+			got = err.Error()
+		} else {
+			got = z.String()
+		}
+		if got != test.want {
+			t.Errorf("EvalRat(%s) = %s, want %s", test.expr, got, test.want)
+		}
+	}
+}
+
+// The first digits of some constants, to 300 bits.
+const (
+	piDigits  = "3.14159265358979323846264338327950288419716939937510582097494459230781640628620899862803482534211706798"
+	eDigits   = "2.71828182845904523536028747135266249775724709369995957496696762772407663035354759457138217852516642742"
+	ln2Digits = "0.693147180559945309417232121458176568075500134360255254120680009493393621969694715605863326996418687542"
+)
+
+func TestEvalFloatConstants(t *testing.T) {
+	for _, prec := range []uint{53, 113, 300} {
+		for _, test := range []struct{ expr, want string }{
+			{"4 * atan(1)", piDigits},
+			{"2 * asin(1)", piDigits},
+			{"acos(-1)", piDigits},
+			{"atan2(0, -1)", piDigits},
+			{"exp(1)", eDigits},
+			{"log(2)", ln2Digits},
+			{"-log(0.5)", ln2Digits},
+			{"1 / log2(e)", ln2Digits},
+		} {
+			expr, err := Parse(test.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			env := FloatEnv{"e": mustFloat(eDigits, prec+10)}
+			got, err := EvalFloat(expr, env, prec)
+			if err != nil {
+				t.Errorf("%s: %v", test.expr, err)
+				continue
+			}
+			if !closeTo(got, mustFloat(test.want, prec+10), prec-4) {
+				t.Errorf("EvalFloat(%s, %d) = %s, want %.40s", test.expr, prec, got.Text('g', 40), test.want)
+			}
+		}
+	}
+}
+
+func TestEvalFloatNegativePowers(t *testing.T) {
+	for _, test := range []struct{ expr, want string }{
+		{"2 ^ -1", "0.5"},
+		{"2 ^ -3", "0.125"},
+		{"(-2) ^ -3", "-0.125"},
+		{"0.5 ^ -10", "1024"},
+		{"2 ^ -1000", "9.33263618503218878990089544723817169617091446371708024621714339795966910975775634454440327097881102359e-302"},
+		{"10 ^ -400", "1e-400"},
+		{"pow(10, -400) * 10 ^ 400", "1"},
+	} {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := EvalFloat(expr, nil, 100)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if !closeTo(got, mustFloat(test.want, 110), 96) {
+			t.Errorf("EvalFloat(%s) = %s, want %s", test.expr, got.Text('g', 30), test.want)
+		}
+	}
+}
+
+func mustFloat(s string, prec uint) *big.Float {
+	x, ok := newFloat(prec).SetString(s)
+	if !ok {
+		panic(s)
+	}
+	return x
+}
+
+// closeTo reports whether x and y agree to about bits bits.
+func closeTo(x, y *big.Float, bits uint) bool {
+	d := new(big.Float).Sub(x, y)
+	if d.Sign() == 0 {
+		return true
+	}
+	scale := y.MantExp(nil)
+	if y.Sign() == 0 {
+		scale = 0
+	}
+	return d.MantExp(nil) <= scale-int(bits)
+}
+
+// TestEvalFloatFuncs compares the functions at 53 bits with the math
+// package, and checks identities at 200 bits.
+func TestEvalFloatFuncs(t *testing.T) {
+	args := []float64{-7.25, -1, -0.6, -1e-9, 0, 1e-9, 0.3, 0.5, 1, 2.5, 10, 123.456}
+	for name := range floatFuncs {
+		f, _ := DefaultRegistry.Lookup(name)
+		for _, x := range args {
+			for _, y := range args[:f.MinArgs] {
+				callArgs := []float64{x, y, 0.5}[:f.MinArgs]
+				if f.MinArgs == 1 {
+					callArgs = []float64{x}
+				}
+				want := f.Impl(callArgs)
+				bigArgs := make([]*big.Float, len(callArgs))
+				for i, a := range callArgs {
+					bigArgs[i] = newFloat(53).SetFloat64(a)
+				}
+				z, err := floatFuncs[name](bigArgs, 53)
+				if math.IsNaN(want) || math.IsInf(want, 0) {
+					if err == nil {
+						t.Errorf("%s%v = %s, want error like %g", name, callArgs, z.Text('g', 17), want)
+					}
+					continue
+				}
+				if err != nil {
+					t.Errorf("%s%v: %v, want %g", name, callArgs, err, want)
+					continue
+				}
+				got, _ := z.Float64()
+				if math.Abs(got-want) > 4e-16*math.Max(math.Abs(want), 1e-300) {
+					t.Errorf("%s%v = %g, want %g", name, callArgs, got, want)
+				}
+			}
+		}
+	}
+
+	identities := []string{
+		"sin(x)^2 + cos(x)^2 - 1",
+		"exp(log(x)) - x",
+		"tan(x) - sin(x) / cos(x)",
+		"atan(tan(x)) - x",
+		"sinh(x) - (exp(x) - exp(-x)) / 2",
+		"cosh(x)^2 - sinh(x)^2 - 1",
+		"asinh(sinh(x)) - x",
+		"atanh(tanh(x)) - x",
+		"cbrt(x)^3 - x",
+		"sqrt(x)^2 - x",
+		"x ^ 2.5 - x * x * sqrt(x)",
+		"log10(x) - log(x) / log(10)",
+		"exp2(x) - 2 ^ x",
+		"expm1(x) - (exp(x) - 1)",
+		"log1p(x) - log(1 + x)",
+		"hypot(x, 1) - sqrt(x^2 + 1)",
+		"acosh(cosh(x)) - x",
+	}
+	const prec = 200
+	for _, s := range identities {
+		expr, err := Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, x := range []float64{1e-3, 0.3, 1, 1.25} {
+			z, err := EvalFloat(expr, FloatEnv{"x": big.NewFloat(x)}, prec)
+			if err != nil {
+				t.Errorf("%s at %g: %v", s, x, err)
+				continue
+			}
+			if z.Sign() != 0 && z.MantExp(nil) > -prec+12 {
+				t.Errorf("%s at %g = %s, want 0", s, x, z.Text('g', 5))
+			}
+		}
+	}
+}
+
+func TestEvalFloatErrors(t *testing.T) {
+	for _, test := range []struct{ expr, want string }{
+		{"1 / 0", "(1 / 0): division by zero"},
+		{"log(-1)", "log((-1)): argument out of domain"},
+		{"sqrt(-1)", "sqrt((-1)): argument out of domain"},
+		{"(-8) ^ (1 / 3)", "((-8) ^ (1 / 3)): argument out of domain"},
+		{"exp(1e10)", "exp(1e+10): result out of range"},
+		{"gamma(2)", "gamma(2): no arbitrary-precision implementation of gamma"},
+		{"y", "y: undefined variable"},
+	} {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = EvalFloat(expr, nil, 0)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("EvalFloat(%s) error = %v, want %s", test.expr, err, test.want)
+		}
+	}
+
+	// Functions registered in place of those of DefaultRegistry have no
+	// arbitrary-precision implementation.
+	reg := DefaultRegistry.Clone()
+	reg.Register1("sin", func(x float64) float64 { return x })
+	expr, _ := ParseWith("sin(1)", reg)
+	if _, err := EvalFloat(expr, nil, 0); err == nil {
+		t.Errorf("EvalFloat of a replaced function succeeded")
+	}
+}
+
+func TestEvalFloatPrecision(t *testing.T) {
+	// Summing 0.1 ten times is not 1 in float64, but is at 200 bits.
+	expr, _ := Parse("x+x+x+x+x+x+x+x+x+x - 1")
+	if got := expr.Eval(Env{"x": 0.1}); got == 0 {
+		t.Fatalf("float64 sum is exact")
+	}
+	x := mustFloat("0.1", 200)
+	z, err := EvalFloat(expr, FloatEnv{"x": x}, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if z.Sign() != 0 && z.MantExp(nil) > -195 {
+		t.Errorf("sum at 200 bits = %g, want about 0", z)
+	}
+	if z.Prec() != 200 {
+		t.Errorf("precision = %d, want 200", z.Prec())
+	}
+}
@@ -0,0 +1,709 @@
+package eval
+
+import (
+	"errors"
+	"math/big"
+)
+
+// Arbitrary-precision implementations of the functions of DefaultRegistry.
+// The series and reductions work with guard bits beyond the precision
+// of the result, which is accurate to about prec bits, not correctly
+// rounded.
+
+const guardBits = 64
+
+var (
+	errDomain     = errors.New("argument out of domain")
+	errRange      = errors.New("result out of range")
+	errDivZero    = errors.New("division by zero")
+	errNotInteger = errors.New("non-integer exponent is not exact")
+)
+
+// newFloat returns a zero of precision prec.
+func newFloat(prec uint) *big.Float {
+	return new(big.Float).SetPrec(prec)
+}
+
+func floatInt(x int64, prec uint) *big.Float {
+	return newFloat(prec).SetInt64(x)
+}
+
+// negligible reports whether adding term to sum would not change sum
+// at precision prec.
+func negligible(term, sum *big.Float, prec uint) bool {
+	if term.Sign() == 0 {
+		return true
+	}
+	if sum.Sign() == 0 {
+		return false
+	}
+	return term.MantExp(nil) < sum.MantExp(nil)-int(prec)
+}
+
+// isInt returns x as an integer, if it is one.
+func isInt(x *big.Float) (*big.Int, bool) {
+	if !x.IsInt() {
+		return nil, false
+	}
+	n, _ := x.Int(nil)
+	return n, true
+}
+
+// floatTrunc returns x rounded toward zero.
+func floatTrunc(x *big.Float, prec uint) *big.Float {
+	n, _ := x.Int(nil)
+	return newFloat(prec).SetInt(n)
+}
+
+// floatMod returns x - y * trunc(x / y), like math.Mod.
+func floatMod(x, y *big.Float, prec uint) *big.Float {
+	p := prec + guardBits + uint(max(0, x.MantExp(nil)-y.MantExp(nil)))
+	q := newFloat(p).Quo(x, y)
+	q = floatTrunc(q, p)
+	z := newFloat(p).Mul(q, y)
+	return newFloat(prec).Sub(x, z)
+}
+
+// floatPowInt returns x^n.
+func floatPowInt(x *big.Float, n *big.Int, prec uint) (*big.Float, error) {
+	if x.Sign() == 0 && n.Sign() < 0 {
+		return nil, errDivZero
+	}
+	p := prec + guardBits + uint(n.BitLen())
+	z := floatInt(1, p)
+	b := newFloat(p).Set(x)
+	abs := new(big.Int).Abs(n) // Bit of a negative n is of two's complement
+	for i := 0; i < abs.BitLen(); i++ {
+		if abs.Bit(i) == 1 {
+			z.Mul(z, b)
+		}
+		b.Mul(b, b)
+	}
+	if n.Sign() < 0 {
+		z.Quo(floatInt(1, p), z)
+	}
+	if z.IsInf() {
+		return nil, errRange
+	}
+	return newFloat(prec).Set(z), nil
+}
+
+// floatPow returns x^y, like math.Pow for finite results.
+func floatPow(x, y *big.Float, prec uint) (*big.Float, error) {
+	if n, ok := isInt(y); ok {
+		return floatPowInt(x, n, prec)
+	}
+	switch x.Sign() {
+	case -1:
+		return nil, errDomain
+	case 0:
+		if y.Sign() < 0 {
+			return nil, errDivZero
+		}
+		return newFloat(prec), nil
+	}
+	p := prec + guardBits
+	l, err := floatLog(x, p+uint(max(0, y.MantExp(nil))))
+	if err != nil {
+		return nil, err
+	}
+	return floatExp(l.Mul(l, y), prec)
+}
+
+// floatExp returns e^x: the Taylor series of x / 2^k, squared k times.
+func floatExp(x *big.Float, prec uint) (*big.Float, error) {
+	if x.Sign() == 0 {
+		return floatInt(1, prec), nil
+	}
+	exp := x.MantExp(nil)
+	if exp > 30 {
+		if x.Sign() < 0 {
+			return newFloat(prec), nil // underflow
+		}
+		return nil, errRange
+	}
+	k := max(0, exp+8)
+	p := prec + guardBits + uint(k)
+	r := newFloat(p).SetMantExp(x, -k)
+	sum, term := floatInt(1, p), floatInt(1, p)
+	for i := int64(1); ; i++ {
+		term.Mul(term, r)
+		term.Quo(term, floatInt(i, p))
+		if negligible(term, sum, p) {
+			break
+		}
+		sum.Add(sum, term)
+	}
+	for ; k > 0; k-- {
+		sum.Mul(sum, sum)
+	}
+	return newFloat(prec).Set(sum), nil
+}
+
+// atanhSeries returns atanh(z) = z + z^3/3 + z^5/5 + ..., for small z.
+func atanhSeries(z *big.Float, prec uint) *big.Float {
+	sum := newFloat(prec).Set(z)
+	pow := newFloat(prec).Set(z)
+	z2 := newFloat(prec).Mul(z, z)
+	term := newFloat(prec)
+	for i := int64(3); ; i += 2 {
+		pow.Mul(pow, z2)
+		term.Quo(pow, floatInt(i, prec))
+		if negligible(term, sum, prec) {
+			return sum
+		}
+		sum.Add(sum, term)
+	}
+}
+
+// ln2 returns log(2) = 2 atanh(1/3).
+func ln2(prec uint) *big.Float {
+	z := newFloat(prec).Quo(floatInt(1, prec), floatInt(3, prec))
+	l := atanhSeries(z, prec)
+	return l.Add(l, l)
+}
+
+// floatLog returns log(x), x > 0: for x = m × 2^e with m in
+// [sqrt(1/2), sqrt(2)), log(x) = 2 atanh((m-1)/(m+1)) + e log(2).
+func floatLog(x *big.Float, prec uint) (*big.Float, error) {
+	if x.Sign() <= 0 {
+		return nil, errDomain
+	}
+	p := prec + guardBits
+	m := newFloat(p)
+	e := x.MantExp(m)
+	if m.Cmp(big.NewFloat(0.7071067811865476)) < 0 {
+		m.SetMantExp(m, 1)
+		e--
+	}
+	one := floatInt(1, p)
+	z := newFloat(p).Quo(newFloat(p).Sub(m, one), newFloat(p).Add(m, one))
+	l := atanhSeries(z, p)
+	l.Add(l, l)
+	if e != 0 {
+		l.Add(l, ln2(p).Mul(ln2(p), floatInt(int64(e), p)))
+	}
+	return newFloat(prec).Set(l), nil
+}
+
+// atanSeries returns atan(z) = z - z^3/3 + z^5/5 - ..., for small z.
+func atanSeries(z *big.Float, prec uint) *big.Float {
+	sum := newFloat(prec).Set(z)
+	pow := newFloat(prec).Set(z)
+	z2 := newFloat(prec).Mul(z, z)
+	z2.Neg(z2)
+	term := newFloat(prec)
+	for i := int64(3); ; i += 2 {
+		pow.Mul(pow, z2)
+		term.Quo(pow, floatInt(i, prec))
+		if negligible(term, sum, prec) {
+			return sum
+		}
+		sum.Add(sum, term)
+	}
+}
+
+// floatPi returns pi = 16 atan(1/5) - 4 atan(1/239) (Machin).
+func floatPi(prec uint) *big.Float {
+	p := prec + guardBits
+	a := atanSeries(newFloat(p).Quo(floatInt(1, p), floatInt(5, p)), p)
+	b := atanSeries(newFloat(p).Quo(floatInt(1, p), floatInt(239, p)), p)
+	a.Mul(a, floatInt(16, p))
+	b.Mul(b, floatInt(4, p))
+	return newFloat(prec).Sub(a, b)
+}
+
+// floatAtan returns atan(x), with |x| reduced to at most 1 by
+// atan(x) = pi/2 - atan(1/x), then halved by
+// atan(x) = 2 atan(x / (1 + sqrt(1 + x^2))) until small.
+func floatAtan(x *big.Float, prec uint) *big.Float {
+	if x.Sign() == 0 {
+		return newFloat(prec)
+	}
+	p := prec + guardBits
+	one := floatInt(1, p)
+	a := newFloat(p).Abs(x)
+	invert := a.Cmp(one) > 0
+	if invert {
+		a.Quo(one, a)
+	}
+	n := 0
+	for ; a.MantExp(nil) > -8; n++ {
+		d := newFloat(p).Mul(a, a)
+		d.Add(d, one)
+		d.Sqrt(d)
+		d.Add(d, one)
+		a.Quo(a, d)
+	}
+	z := atanSeries(a, p)
+	z.SetMantExp(z, n)
+	if invert {
+		halfPi := floatPi(p)
+		z.Sub(halfPi.SetMantExp(halfPi, -1), z)
+	}
+	if x.Sign() < 0 {
+		z.Neg(z)
+	}
+	return newFloat(prec).Set(z)
+}
+
+// floatSin returns sin(x + quarter pi/2): x is reduced by a multiple n of
+// pi/2 to [-pi/4, pi/4], where the Taylor series of sin or cos converges
+// quickly, the quadrant n + quarter picking which and the sign.
+func floatSin(x *big.Float, quarter int64, prec uint) (*big.Float, error) {
+	exp := x.MantExp(nil)
+	if exp > 1<<16 {
+		return nil, errRange // too many bits of pi
+	}
+	p := prec + guardBits + uint(max(0, exp))
+	halfPi := floatPi(p)
+	halfPi.SetMantExp(halfPi, -1)
+	q := newFloat(p).Quo(x, halfPi)
+	n, _ := q.Add(q, big.NewFloat(0.5*float64(q.Sign()))).Int(nil) // round
+	r := newFloat(p).Mul(newFloat(p).SetInt(n), halfPi)
+	r.Sub(x, r)
+
+	quadrant := new(big.Int).Add(n, big.NewInt(quarter))
+	quadrant.And(quadrant, big.NewInt(3))
+	// sin(r + k pi/2) is sin r, cos r, -sin r, -cos r for k = 0, 1, 2, 3.
+	sum, term := newFloat(p).Set(r), newFloat(p).Set(r)
+	i := int64(1)
+	if quadrant.Int64()%2 == 1 {
+		sum.SetInt64(1)
+		term.SetInt64(1)
+		i = 0
+	}
+	r2 := newFloat(p).Mul(r, r)
+	r2.Neg(r2)
+	for ; ; i += 2 {
+		term.Mul(term, r2)
+		term.Quo(term, floatInt((i+1)*(i+2), p))
+		if negligible(term, sum, p) {
+			break
+		}
+		sum.Add(sum, term)
+	}
+	if quadrant.Int64() >= 2 {
+		sum.Neg(sum)
+	}
+	return newFloat(prec).Set(sum), nil
+}
+
+// floatSinh returns sinh(x) if sign is -1, cosh(x) if it is +1, from
+// (e^x + sign e^-x) / 2, with enough bits for the cancellation of small x.
+func floatSinh(x *big.Float, sign int64, prec uint) (*big.Float, error) {
+	p := prec + guardBits + uint(max(0, -x.MantExp(nil)))
+	ex, err := floatExp(x, p)
+	if err != nil {
+		return nil, err
+	}
+	inv := newFloat(p).Quo(floatInt(sign, p), ex)
+	z := newFloat(p).Add(ex, inv)
+	return newFloat(prec).SetMantExp(z, -1), nil
+}
+
+// floatRound returns x rounded to an integer: halves away from zero, or
+// to even.
+func floatRound(x *big.Float, even bool, prec uint) *big.Float {
+	p := max(prec, x.MinPrec()) + 1
+	t := floatTrunc(x, p)
+	frac := newFloat(p).Sub(x, t)
+	frac.Abs(frac)
+	half := big.NewFloat(0.5)
+	c := frac.Cmp(half)
+	n, _ := t.Int(nil)
+	if c > 0 || c == 0 && (!even || n.Bit(0) == 1) {
+		t.Add(t, floatInt(int64(x.Sign()), p))
+	}
+	return newFloat(prec).Set(t)
+}
+
+// floatFuncs are the arbitrary-precision implementations of the
+// functions of DefaultRegistry, for EvalFloat. Arguments are already
+// rounded to prec and may be modified.
+var floatFuncs map[string]func(args []*big.Float, prec uint) (*big.Float, error)
+
+func init() {
+	one := func(f func(x *big.Float, prec uint) (*big.Float, error)) func([]*big.Float, uint) (*big.Float, error) {
+		return func(args []*big.Float, prec uint) (*big.Float, error) { return f(args[0], prec) }
+	}
+	exact := func(f func(x *big.Float, prec uint) *big.Float) func([]*big.Float, uint) (*big.Float, error) {
+		return func(args []*big.Float, prec uint) (*big.Float, error) { return f(args[0], prec), nil }
+	}
+	// wide returns the working precision of functions whose terms
+	// cancel for x near 0.
+	wide := func(x *big.Float, prec uint) uint {
+		return prec + guardBits + uint(max(0, -x.MantExp(nil)))
+	}
+
+	floatFuncs = map[string]func(args []*big.Float, prec uint) (*big.Float, error){
+		"abs": exact(func(x *big.Float, prec uint) *big.Float { return x.Abs(x) }),
+		"ceil": exact(func(x *big.Float, prec uint) *big.Float {
+			t := floatTrunc(x, prec+1)
+			if t.Cmp(x) < 0 {
+				t.Add(t, floatInt(1, prec))
+			}
+			return newFloat(prec).Set(t)
+		}),
+		"floor": exact(func(x *big.Float, prec uint) *big.Float {
+			t := floatTrunc(x, prec+1)
+			if t.Cmp(x) > 0 {
+				t.Sub(t, floatInt(1, prec))
+			}
+			return newFloat(prec).Set(t)
+		}),
+		"trunc":       exact(floatTrunc),
+		"round":       exact(func(x *big.Float, prec uint) *big.Float { return floatRound(x, false, prec) }),
+		"roundtoeven": exact(func(x *big.Float, prec uint) *big.Float { return floatRound(x, true, prec) }),
+		"logb": one(func(x *big.Float, prec uint) (*big.Float, error) {
+			if x.Sign() == 0 {
+				return nil, errRange
+			}
+			return floatInt(int64(x.MantExp(nil)-1), prec), nil
+		}),
+		"sqrt": one(func(x *big.Float, prec uint) (*big.Float, error) {
+			if x.Sign() < 0 {
+				return nil, errDomain
+			}
+			if x.Sign() == 0 {
+				return x, nil
+			}
+			return newFloat(prec).Sqrt(x), nil
+		}),
+		"cbrt": one(func(x *big.Float, prec uint) (*big.Float, error) {
+			if x.Sign() == 0 {
+				return x, nil
+			}
+			p := prec + guardBits
+			l, _ := floatLog(newFloat(p).Abs(x), p)
+			z, err := floatExp(l.Quo(l, floatInt(3, p)), prec)
+			if err == nil && x.Sign() < 0 {
+				z.Neg(z)
+			}
+			return z, err
+		}),
+		"exp": one(floatExp),
+		"exp2": one(func(x *big.Float, prec uint) (*big.Float, error) {
+			p := prec + guardBits + uint(max(0, x.MantExp(nil)))
+			return floatExp(newFloat(p).Mul(x, ln2(p)), prec)
+		}),
+		"expm1": one(func(x *big.Float, prec uint) (*big.Float, error) {
+			p := wide(x, prec)
+			z, err := floatExp(x, p)
+			if err != nil {
+				return nil, err
+			}
+			return newFloat(prec).Sub(z, floatInt(1, p)), nil
+		}),
+		"log": one(floatLog),
+		"log1p": one(func(x *big.Float, prec uint) (*big.Float, error) {
+			p := wide(x, prec)
+			return floatLog(newFloat(p).Add(x, floatInt(1, p)), prec)
+		}),
+		"log2": one(func(x *big.Float, prec uint) (*big.Float, error) {
+			p := prec + guardBits
+			l, err := floatLog(x, p)
+			if err != nil {
+				return nil, err
+			}
+			return newFloat(prec).Quo(l, ln2(p)), nil
+		}),
+		"log10": one(func(x *big.Float, prec uint) (*big.Float, error) {
+			p := prec + guardBits
+			l, err := floatLog(x, p)
+			if err != nil {
+				return nil, err
+			}
+			ten, _ := floatLog(floatInt(10, p), p)
+			return newFloat(prec).Quo(l, ten), nil
+		}),
+		"sin": one(func(x *big.Float, prec uint) (*big.Float, error) { return floatSin(x, 0, prec) }),
+		"cos": one(func(x *big.Float, prec uint) (*big.Float, error) { return floatSin(x, 1, prec) }),
+		"tan": one(func(x *big.Float, prec uint) (*big.Float, error) {
+			p := prec + guardBits
+			s, err := floatSin(x, 0, p)
+			if err != nil {
+				return nil, err
+			}
+			c, _ := floatSin(x, 1, p)
+			return newFloat(prec).Quo(s, c), nil
+		}),
+		"atan": exact(floatAtan),
+		"asin": one(func(x *big.Float, prec uint) (*big.Float, error) {
+			// asin(x) = atan(x / sqrt((1-x)(1+x)))
+			p := prec + guardBits
+			one := floatInt(1, p)
+			d := newFloat(p).Mul(newFloat(p).Sub(one, x), newFloat(p).Add(one, x))
+			switch d.Sign() {
+			case -1:
+				return nil, errDomain
+			case 0:
+				z := floatPi(prec)
+				z.SetMantExp(z, -1)
+				if x.Sign() < 0 {
+					z.Neg(z)
+				}
+				return z, nil
+			}
+			return floatAtan(d.Quo(x, d.Sqrt(d)), prec), nil
+		}),
+		"acos": one(func(x *big.Float, prec uint) (*big.Float, error) {
+			// acos(x) = 2 atan(sqrt((1-x)/(1+x)))
+			p := prec + guardBits
+			one := floatInt(1, p)
+			n, d := newFloat(p).Sub(one, x), newFloat(p).Add(one, x)
+			switch {
+			case n.Sign() < 0 || d.Sign() < 0:
+				return nil, errDomain
+			case d.Sign() == 0:
+				return floatPi(prec), nil
+			}
+			z := floatAtan(n.Sqrt(n.Quo(n, d)), p)
+			return newFloat(prec).SetMantExp(z, 1), nil
+		}),
+		"sinh": one(func(x *big.Float, prec uint) (*big.Float, error) { return floatSinh(x, -1, prec) }),
+		"cosh": one(func(x *big.Float, prec uint) (*big.Float, error) { return floatSinh(x, 1, prec) }),
+		"tanh": one(func(x *big.Float, prec uint) (*big.Float, error) {
+			if x.MantExp(nil) > 30 {
+				return floatInt(int64(x.Sign()), prec), nil
+			}
+			p := prec + guardBits
+			s, err := floatSinh(x, -1, p)
+			if err != nil {
+				return nil, err
+			}
+			c, _ := floatSinh(x, 1, p)
+			return newFloat(prec).Quo(s, c), nil
+		}),
+		"asinh": one(func(x *big.Float, prec uint) (*big.Float, error) {
+			// asinh(x) = log(|x| + sqrt(x^2 + 1)), odd
+			p := wide(x, prec)
+			a := newFloat(p).Abs(x)
+			d := newFloat(p).Mul(a, a)
+			d.Add(d, floatInt(1, p))
+			d.Add(a, d.Sqrt(d))
+			z, err := floatLog(d, prec)
+			if err == nil && x.Sign() < 0 {
+				z.Neg(z)
+			}
+			return z, err
+		}),
+		"acosh": one(func(x *big.Float, prec uint) (*big.Float, error) {
+			// acosh(x) = log(x + sqrt(x^2 - 1)), x >= 1
+			p := prec + guardBits
+			if x.Cmp(floatInt(1, p)) < 0 {
+				return nil, errDomain
+			}
+			d := newFloat(p).Mul(x, x)
+			d.Sub(d, floatInt(1, p))
+			d.Add(x, d.Sqrt(d))
+			return floatLog(d, prec)
+		}),
+		"atanh": one(func(x *big.Float, prec uint) (*big.Float, error) {
+			// atanh(x) = log((1+x)/(1-x)) / 2, |x| < 1
+			p := wide(x, prec)
+			one := floatInt(1, p)
+			n, d := newFloat(p).Add(one, x), newFloat(p).Sub(one, x)
+			if n.Sign() <= 0 || d.Sign() <= 0 {
+				return nil, errDomain
+			}
+			z, err := floatLog(n.Quo(n, d), p)
+			if err != nil {
+				return nil, err
+			}
+			return newFloat(prec).SetMantExp(z, -1), nil
+		}),
+
+		"atan2": func(args []*big.Float, prec uint) (*big.Float, error) {
+			y, x := args[0], args[1]
+			if x.Sign() == 0 {
+				z := floatPi(prec)
+				z.SetMantExp(z, -1)
+				return z.Mul(z, floatInt(int64(y.Sign()), prec)), nil
+			}
+			p := prec + guardBits
+			z := floatAtan(newFloat(p).Quo(y, x), p)
+			if x.Sign() < 0 {
+				if y.Sign() < 0 {
+					z.Sub(z, floatPi(p))
+				} else {
+					z.Add(z, floatPi(p))
+				}
+			}
+			return newFloat(prec).Set(z), nil
+		},
+		"copysign": func(args []*big.Float, prec uint) (*big.Float, error) {
+			z := args[0].Abs(args[0])
+			if args[1].Signbit() {
+				z.Neg(z)
+			}
+			return z, nil
+		},
+		"dim": func(args []*big.Float, prec uint) (*big.Float, error) {
+			if args[0].Cmp(args[1]) <= 0 {
+				return newFloat(prec), nil
+			}
+			return newFloat(prec).Sub(args[0], args[1]), nil
+		},
+		"hypot": func(args []*big.Float, prec uint) (*big.Float, error) {
+			p := prec + guardBits
+			z := newFloat(p).Mul(args[0], args[0])
+			z.Add(z, newFloat(p).Mul(args[1], args[1]))
+			if z.Sign() == 0 {
+				return newFloat(prec), nil
+			}
+			return newFloat(prec).Sqrt(z), nil
+		},
+		"mod": func(args []*big.Float, prec uint) (*big.Float, error) {
+			if args[1].Sign() == 0 {
+				return nil, errDivZero
+			}
+			return floatMod(args[0], args[1], prec), nil
+		},
+		"remainder": func(args []*big.Float, prec uint) (*big.Float, error) {
+			x, y := args[0], args[1]
+			if y.Sign() == 0 {
+				return nil, errDivZero
+			}
+			p := prec + guardBits + uint(max(0, x.MantExp(nil)-y.MantExp(nil)))
+			q := floatRound(newFloat(p).Quo(x, y), true, p)
+			return newFloat(prec).Sub(x, q.Mul(q, y)), nil
+		},
+		"pow": func(args []*big.Float, prec uint) (*big.Float, error) {
+			return floatPow(args[0], args[1], prec)
+		},
+		"fma": func(args []*big.Float, prec uint) (*big.Float, error) {
+			// The product is exact, as for math.FMA.
+			xy := newFloat(args[0].Prec()+args[1].Prec()).Mul(args[0], args[1])
+			return newFloat(prec).Add(xy, args[2]), nil
+		},
+		"min": func(args []*big.Float, prec uint) (*big.Float, error) {
+			z := args[0]
+			for _, x := range args[1:] {
+				if x.Cmp(z) < 0 {
+					z = x
+				}
+			}
+			return z, nil
+		},
+		"max": func(args []*big.Float, prec uint) (*big.Float, error) {
+			z := args[0]
+			for _, x := range args[1:] {
+				if x.Cmp(z) > 0 {
+					z = x
+				}
+			}
+			return z, nil
+		},
+	}
+}
+
+// ratTrunc returns x rounded toward zero.
+func ratTrunc(x *big.Rat) *big.Rat {
+	return new(big.Rat).SetInt(new(big.Int).Quo(x.Num(), x.Denom()))
+}
+
+// ratMod returns x - y * trunc(x / y), like math.Mod.
+func ratMod(x, y *big.Rat) *big.Rat {
+	q := ratTrunc(new(big.Rat).Quo(x, y))
+	return q.Sub(x, q.Mul(q, y))
+}
+
+// maxRatExp bounds the integer exponents of EvalRat, whose results grow
+// with them.
+const maxRatExp = 1 << 16
+
+// ratPow returns x^y for an integer y.
+func ratPow(x, y *big.Rat) (*big.Rat, error) {
+	if !y.IsInt() {
+		return nil, errNotInteger
+	}
+	n := y.Num()
+	if n.CmpAbs(big.NewInt(maxRatExp)) > 0 {
+		return nil, errRange
+	}
+	if x.Sign() == 0 && n.Sign() < 0 {
+		return nil, errDivZero
+	}
+	k := new(big.Int).Abs(n)
+	num := new(big.Int).Exp(x.Num(), k, nil)
+	den := new(big.Int).Exp(x.Denom(), k, nil)
+	if n.Sign() < 0 {
+		num, den = den, num
+	}
+	return new(big.Rat).SetFrac(num, den), nil
+}
+
+// ratRound returns x rounded to an integer, halves away from zero.
+func ratRound(x *big.Rat) *big.Rat {
+	t := ratTrunc(x)
+	frac := new(big.Rat).Sub(x, t)
+	if frac.Abs(frac).Cmp(big.NewRat(1, 2)) >= 0 {
+		t.Add(t, big.NewRat(int64(x.Sign()), 1))
+	}
+	return t
+}
+
+// ratFuncs are the functions of DefaultRegistry with exact results,
+// for EvalRat. Arguments may be modified.
+var ratFuncs = map[string]func(args []*big.Rat) (*big.Rat, error){
+	"abs":   func(args []*big.Rat) (*big.Rat, error) { return args[0].Abs(args[0]), nil },
+	"trunc": func(args []*big.Rat) (*big.Rat, error) { return ratTrunc(args[0]), nil },
+	"round": func(args []*big.Rat) (*big.Rat, error) { return ratRound(args[0]), nil },
+	"floor": func(args []*big.Rat) (*big.Rat, error) {
+		t := ratTrunc(args[0])
+		if t.Cmp(args[0]) > 0 {
+			t.Sub(t, big.NewRat(1, 1))
+		}
+		return t, nil
+	},
+	"ceil": func(args []*big.Rat) (*big.Rat, error) {
+		t := ratTrunc(args[0])
+		if t.Cmp(args[0]) < 0 {
+			t.Add(t, big.NewRat(1, 1))
+		}
+		return t, nil
+	},
+	"copysign": func(args []*big.Rat) (*big.Rat, error) {
+		z := args[0].Abs(args[0])
+		if args[1].Sign() < 0 {
+			z.Neg(z)
+		}
+		return z, nil
+	},
+	"dim": func(args []*big.Rat) (*big.Rat, error) {
+		if args[0].Cmp(args[1]) <= 0 {
+			return new(big.Rat), nil
+		}
+		return args[0].Sub(args[0], args[1]), nil
+	},
+	"mod": func(args []*big.Rat) (*big.Rat, error) {
+		if args[1].Sign() == 0 {
+			return nil, errDivZero
+		}
+		return ratMod(args[0], args[1]), nil
+	},
+	"pow": func(args []*big.Rat) (*big.Rat, error) { return ratPow(args[0], args[1]) },
+	"fma": func(args []*big.Rat) (*big.Rat, error) {
+		z := args[0].Mul(args[0], args[1])
+		return z.Add(z, args[2]), nil
+	},
+	"min": func(args []*big.Rat) (*big.Rat, error) {
+		z := args[0]
+		for _, x := range args[1:] {
+			if x.Cmp(z) < 0 {
+				z = x
+			}
+		}
+		return z, nil
+	},
+	"max": func(args []*big.Rat) (*big.Rat, error) {
+		z := args[0]
+		for _, x := range args[1:] {
+			if x.Cmp(z) > 0 {
+				z = x
+			}
+		}
+		return z, nil
+	},
+}
@@ -19,40 +19,82 @@ func (literal) Check(vars map[Var]bool) error {
 	return nil
 }
 
+func (im imaginary) Check(vars map[Var]bool) error {
+	return fmt.Errorf("imaginary number %s in real expression", Format(im))
+}
+
 func (u unary) Check(vars map[Var]bool) error {
-	if !strings.ContainsRune("+-", u.op) {
-		return fmt.Errorf("unexpected unary op %q", u.op)
-	}
-	return u.x.Check(vars)
+	return checkDim(u, vars)
 }
 
 func (b binary) Check(vars map[Var]bool) error {
-	if !strings.ContainsRune("+-*/", b.op) {
-		return fmt.Errorf("unexpected binary op %q", b.op)
-	}
-	if err := b.x.Check(vars); err != nil {
-		return err
-	}
-	return b.y.Check(vars)
+	return checkDim(b, vars)
+}
+
+func (t ternary) Check(vars map[Var]bool) error {
+	return checkDim(t, vars)
 }
 
 func (c call) Check(vars map[Var]bool) error {
-	arity, ok := numParams[c.fn]
-	if !ok {
-		return fmt.Errorf("unknown function %q", c.fn)
+	return checkDim(c, vars)
+}
+
+// checkDim checks e, and then the dimensions of the whole of e, once.
+func checkDim(e Expr, vars map[Var]bool) error {
+	if err := check(e, vars); err != nil {
+		return err
 	}
-	if len(c.args) != arity {
-		return fmt.Errorf("call to %s has %d args, want %d",
-			c.fn, len(c.args), arity)
+	if _, _, err := dimension(e); err != nil {
+		return err
 	}
-	for _, arg := range c.args {
-		if err := arg.Check(vars); err != nil {
+	_, err := offsetScale(e)
+	return err
+}
+
+// check is like Check, but it leaves the dimensions of unary, binary,
+// ternary and call expressions to checkDim, as checking them at every
+// node would check the dimensions of each operand again and again.
+func check(e Expr, vars map[Var]bool) error {
+	switch e := e.(type) {
+	case unary:
+		if !strings.ContainsRune("+-!", e.op) {
+			return fmt.Errorf("unexpected unary op %q", e.op)
+		}
+		return check(e.x, vars)
+
+	case binary:
+		if !strings.ContainsRune("+-*/%^<>", e.op) && opNames[e.op] == "" {
+			return fmt.Errorf("unexpected binary op %q", e.op)
+		}
+		if err := check(e.x, vars); err != nil {
 			return err
 		}
+		return check(e.y, vars)
+
+	case ternary:
+		for _, x := range []Expr{e.cond, e.x, e.y} {
+			if err := check(x, vars); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case call:
+		f, ok := e.registry().Lookup(e.fn)
+		if !ok {
+			return fmt.Errorf("unknown function %q", e.fn)
+		}
+		if err := f.checkArity(len(e.args)); err != nil {
+			return err
+		}
+		for _, arg := range e.args {
+			if err := check(arg, vars); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
-	return nil
+	return e.Check(vars) // Var, literal, imaginary, quantity, apply, *Script
 }
 
-var numParams = map[string]int{"pow": 2, "sin": 1, "sqrt": 1}
-
 //!-Check
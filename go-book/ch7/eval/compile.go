@@ -0,0 +1,394 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+)
+
+// A Program is an Expr compiled for a small stack machine, for
+// evaluating the same expression many times, e.g. once per point of a
+// plot. Variables are resolved to slots, and functions to their
+// registry entries, once by Compile instead of on every evaluation.
+//
+// A Program is safe for concurrent use by multiple goroutines.
+type Program struct {
+	code     []instr
+	consts   []float64
+	funcs    []*Func
+	nvars    int
+	maxStack int
+	jumps    bool // code has conditional jumps, see EvalBatch
+}
+
+// An instr is an instruction of a Program. The meaning of a and b
+// depends on op.
+type instr struct {
+	op   opcode
+	a, b int32
+}
+
+type opcode uint8
+
+const (
+	vmConst     opcode = iota // push consts[a]
+	vmLoad                    // push vars[a]
+	vmNeg                     // -x
+	vmNot                     // !x
+	vmTruth                   // 1 if x != 0, else 0
+	vmAdd                     // x + y
+	vmSub                     // x - y
+	vmMul                     // x * y
+	vmDiv                     // x / y
+	vmMod                     // x % y
+	vmPow                     // x ^ y
+	vmLT                      // x < y
+	vmLE                      // x <= y
+	vmGT                      // x > y
+	vmGE                      // x >= y
+	vmEQ                      // x == y
+	vmNE                      // x != y
+	vmCall                    // pop b args, push funcs[a](args)
+	vmJump                    // go to a
+	vmJumpFalse               // pop, go to a if 0
+	vmJumpTrue                // pop, go to a if not 0
+)
+
+// binaryOps maps binary operators to their instructions.
+var binaryOps = map[rune]opcode{
+	'+': vmAdd, '-': vmSub, '*': vmMul, '/': vmDiv, '%': vmMod, '^': vmPow,
+	'<': vmLT, opLE: vmLE, '>': vmGT, opGE: vmGE, opEQ: vmEQ, opNE: vmNE,
+}
+
+// Compile compiles e for the variables vars: the value of vars[i] is
+// the i-th argument of Program.Eval. Like Eval with an Env without them,
+// variables not in vars are 0. e should have been checked: Compile panics
+// on operators and functions that Check rejects.
+func Compile(e Expr, vars []Var) *Program {
+	c := compiler{
+		prog:   &Program{nvars: len(vars)},
+		slots:  make(map[Var]int32),
+		consts: make(map[uint64]int32),
+		funcs:  make(map[*Func]int32),
+	}
+	for i, v := range vars {
+		if _, ok := c.slots[v]; !ok {
+			c.slots[v] = int32(i)
+		}
+	}
+	c.compile(e)
+	return c.prog
+}
+
+type compiler struct {
+	prog   *Program
+	slots  map[Var]int32
+	consts map[uint64]int32 // by math.Float64bits
+	funcs  map[*Func]int32
+	depth  int // of the stack after the code so far
+}
+
+// emit appends an instruction that changes the depth of the stack by
+// delta, and returns its address.
+func (c *compiler) emit(op opcode, a, b int32, delta int) int {
+	c.prog.code = append(c.prog.code, instr{op, a, b})
+	c.depth += delta
+	if c.depth > c.prog.maxStack {
+		c.prog.maxStack = c.depth
+	}
+	return len(c.prog.code) - 1
+}
+
+// patch sets the target of the jump at addr to the next instruction.
+func (c *compiler) patch(addr int) {
+	c.prog.code[addr].a = int32(len(c.prog.code))
+}
+
+func (c *compiler) constant(x float64) {
+	bits := math.Float64bits(x)
+	i, ok := c.consts[bits]
+	if !ok {
+		i = int32(len(c.prog.consts))
+		c.prog.consts = append(c.prog.consts, x)
+		c.consts[bits] = i
+	}
+	c.emit(vmConst, i, 0, +1)
+}
+
+func (c *compiler) compile(e Expr) {
+	switch e := e.(type) {
+	case *Script, apply:
+		x, err := inline(e)
+		if err != nil {
+			panic(fmt.Sprintf("eval: %v", err))
+		}
+		c.compile(x)
+	case literal:
+		c.constant(float64(e))
+
+	case imaginary:
+		c.constant(e.Eval(nil)) // NaN, like Eval
+
+	case quantity:
+		c.constant(e.Eval(nil))
+
+	case Var:
+		if slot, ok := c.slots[e]; ok {
+			c.emit(vmLoad, slot, 0, +1)
+		} else {
+			c.constant(0)
+		}
+
+	case unary:
+		c.compile(e.x)
+		switch e.op {
+		case '+':
+		case '-':
+			c.emit(vmNeg, 0, 0, 0)
+		case '!':
+			c.emit(vmNot, 0, 0, 0)
+		default:
+			panic(fmt.Sprintf("unsupported unary operator: %q", e.op))
+		}
+
+	case binary:
+		switch e.op {
+		case opAND, opOR:
+			// x && y is x ? truth(y) : 0, x || y is x ? 1 : truth(y).
+			c.prog.jumps = true
+			c.compile(e.x)
+			jump := vmJumpFalse
+			if e.op == opOR {
+				jump = vmJumpTrue
+			}
+			skip := c.emit(jump, 0, 0, -1)
+			c.compile(e.y)
+			c.emit(vmTruth, 0, 0, 0)
+			end := c.emit(vmJump, 0, 0, -1)
+			c.patch(skip)
+			c.constant(truth(e.op == opOR))
+			c.patch(end)
+			return
+		}
+		op, ok := binaryOps[e.op]
+		if !ok {
+			panic(fmt.Sprintf("unsupported binary operator: %q", e.op))
+		}
+		c.compile(e.x)
+		c.compile(e.y)
+		c.emit(op, 0, 0, -1)
+
+	case ternary:
+		c.prog.jumps = true
+		c.compile(e.cond)
+		skip := c.emit(vmJumpFalse, 0, 0, -1)
+		c.compile(e.x)
+		end := c.emit(vmJump, 0, 0, -1)
+		c.patch(skip)
+		c.compile(e.y)
+		c.patch(end)
+
+	case call:
+		f, ok := e.registry().Lookup(e.fn)
+		if !ok {
+			panic(fmt.Sprintf("unsupported function call: %s", e.fn))
+		}
+		i, ok := c.funcs[f]
+		if !ok {
+			i = int32(len(c.prog.funcs))
+			c.prog.funcs = append(c.prog.funcs, f)
+			c.funcs[f] = i
+		}
+		for _, arg := range e.args {
+			c.compile(arg)
+		}
+		c.emit(vmCall, i, int32(len(e.args)), 1-len(e.args))
+
+	default:
+		panic(fmt.Sprintf("unknown Expr: %T", e))
+	}
+}
+
+// Eval returns the value of the program for the values of its variables,
+// in the order given to Compile.
+func (p *Program) Eval(vars []float64) float64 {
+	if len(vars) != p.nvars {
+		panic(fmt.Sprintf("eval: Program.Eval has %d values, want %d", len(vars), p.nvars))
+	}
+	var buf [32]float64
+	stack := buf[:0]
+	if p.maxStack > len(buf) {
+		stack = make([]float64, 0, p.maxStack)
+	}
+	for pc := 0; pc < len(p.code); pc++ {
+		in := p.code[pc]
+		switch in.op {
+		case vmConst:
+			stack = append(stack, p.consts[in.a])
+		case vmLoad:
+			stack = append(stack, vars[in.a])
+		case vmCall:
+			n := len(stack) - int(in.b)
+			z := p.funcs[in.a].Impl(stack[n:])
+			stack = append(stack[:n], z)
+		case vmJump:
+			pc = int(in.a) - 1
+		case vmJumpFalse, vmJumpTrue:
+			x := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if (x != 0) == (in.op == vmJumpTrue) {
+				pc = int(in.a) - 1
+			}
+		case vmNeg, vmNot, vmTruth:
+			x := &stack[len(stack)-1]
+			*x = unaryOp(in.op, *x)
+		default:
+			y := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			x := &stack[len(stack)-1]
+			*x = binaryOp(in.op, *x, y)
+		}
+	}
+	return stack[0]
+}
+
+func unaryOp(op opcode, x float64) float64 {
+	switch op {
+	case vmNeg:
+		return -x
+	case vmNot:
+		return truth(x == 0)
+	}
+	return truth(x != 0) // vmTruth
+}
+
+func binaryOp(op opcode, x, y float64) float64 {
+	switch op {
+	case vmAdd:
+		return x + y
+	case vmSub:
+		return x - y
+	case vmMul:
+		return x * y
+	case vmDiv:
+		return x / y
+	case vmMod:
+		return math.Mod(x, y)
+	case vmPow:
+		return math.Pow(x, y)
+	case vmLT:
+		return truth(x < y)
+	case vmLE:
+		return truth(x <= y)
+	case vmGT:
+		return truth(x > y)
+	case vmGE:
+		return truth(x >= y)
+	case vmEQ:
+		return truth(x == y)
+	case vmNE:
+		return truth(x != y)
+	}
+	panic(fmt.Sprintf("eval: bad instruction %d", op))
+}
+
+// batchSize is the number of rows EvalBatch evaluates at a time.
+const batchSize = 256
+
+// EvalBatch evaluates the program once per row of cols, where cols[i]
+// holds the values of the i-th variable, and appends the results to out.
+// Each instruction is applied to a batch of rows at a time, which saves
+// the dispatch on instructions; programs with && || or ?: are evaluated
+// row by row.
+func (p *Program) EvalBatch(cols [][]float64, out []float64) []float64 {
+	if len(cols) != p.nvars {
+		panic(fmt.Sprintf("eval: Program.EvalBatch has %d columns, want %d", len(cols), p.nvars))
+	}
+	if len(cols) == 0 {
+		return append(out, p.Eval(nil))
+	}
+	rows := len(cols[0])
+	for _, col := range cols {
+		if len(col) != rows {
+			panic("eval: Program.EvalBatch columns of different lengths")
+		}
+	}
+
+	if p.jumps {
+		vars := make([]float64, len(cols))
+		for row := 0; row < rows; row++ {
+			for i, col := range cols {
+				vars[i] = col[row]
+			}
+			out = append(out, p.Eval(vars))
+		}
+		return out
+	}
+
+	stack := make([][]float64, p.maxStack)
+	for i := range stack {
+		stack[i] = make([]float64, batchSize)
+	}
+	var args []float64
+	for lo := 0; lo < rows; lo += batchSize {
+		n := min(batchSize, rows-lo)
+		sp := 0
+		for _, in := range p.code {
+			switch in.op {
+			case vmConst:
+				z := stack[sp][:n]
+				for i := range z {
+					z[i] = p.consts[in.a]
+				}
+				sp++
+			case vmLoad:
+				copy(stack[sp][:n], cols[in.a][lo:lo+n])
+				sp++
+			case vmCall:
+				sp -= int(in.b)
+				f := p.funcs[in.a]
+				if cap(args) < int(in.b) {
+					args = make([]float64, in.b)
+				}
+				args = args[:in.b]
+				for i := 0; i < n; i++ {
+					for j := range args {
+						args[j] = stack[sp+j][i]
+					}
+					stack[sp][i] = f.Impl(args)
+				}
+				sp++
+			case vmNeg, vmNot, vmTruth:
+				x := stack[sp-1][:n]
+				for i := range x {
+					x[i] = unaryOp(in.op, x[i])
+				}
+			case vmAdd, vmSub, vmMul:
+				// The commonest operators get loops of their own.
+				x, y := stack[sp-2][:n], stack[sp-1][:n]
+				switch in.op {
+				case vmAdd:
+					for i := range x {
+						x[i] += y[i]
+					}
+				case vmSub:
+					for i := range x {
+						x[i] -= y[i]
+					}
+				case vmMul:
+					for i := range x {
+						x[i] *= y[i]
+					}
+				}
+				sp--
+			default:
+				x, y := stack[sp-2][:n], stack[sp-1][:n]
+				for i := range x {
+					x[i] = binaryOp(in.op, x[i], y[i])
+				}
+				sp--
+			}
+		}
+		out = append(out, stack[0][:n]...)
+	}
+	return out
+}
@@ -0,0 +1,139 @@
+package eval
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+var compileTests = []string{
+	"sqrt(A / pi)",
+	"pow(x, 3) + pow(y, 3)",
+	"5 / 9 * (F - 32)",
+	"-1 + -x",
+	"2 ^ 3 ^ 2 - x % 3",
+	"x < y && y <= 3 || !x",
+	"x > 0 ? x * y : -x < y ? 1 : 2",
+	"min(x, y, 1) + max(x) + fma(x, y, 3)",
+	"sin(-x)*pow(1.5,-r)",
+	"x + y * (x - y) / (x * y + 1) + x + y * (x - y) / (x * y + 1) +" +
+		"x + y * (x - y) / (x * y + 1) + x + y * (x - y) / (x * y + 1)",
+	// deeper than the stack of Program.Eval without allocation
+	strings.Repeat("(1 + ", 40) + "x" + strings.Repeat(")", 40),
+}
+
+var compileVars = []Var{"x", "y", "r", "A", "pi", "F"}
+
+func TestCompile(t *testing.T) {
+	var cols [6][]float64
+	var envs []Env
+	for _, x := range []float64{-2, -0.5, 0, 1, 3} {
+		for _, y := range []float64{-1, 0, 2.5} {
+			env := Env{"x": x, "y": y, "r": math.Hypot(x, y), "A": 87616, "pi": math.Pi, "F": 212}
+			envs = append(envs, env)
+			for i, v := range compileVars {
+				cols[i] = append(cols[i], env[v])
+			}
+		}
+	}
+
+	for _, s := range compileTests {
+		expr, err := Parse(s)
+		if err != nil {
+			t.Errorf("%s: %v", s, err)
+			continue
+		}
+		prog := Compile(expr, compileVars)
+		batch := prog.EvalBatch(cols[:], nil)
+		if len(batch) != len(envs) {
+			t.Errorf("%s: EvalBatch has %d results, want %d", s, len(batch), len(envs))
+			continue
+		}
+		for row, env := range envs {
+			want := expr.Eval(env)
+			vars := make([]float64, len(compileVars))
+			for i, v := range compileVars {
+				vars[i] = env[v]
+			}
+			if got := prog.Eval(vars); !same(got, want) {
+				t.Errorf("%s: Program.Eval in %v = %g, want %g", s, env, got, want)
+			}
+			if got := batch[row]; !same(got, want) {
+				t.Errorf("%s: EvalBatch in %v = %g, want %g", s, env, got, want)
+			}
+		}
+	}
+}
+
+// same reports whether x and y are equal, or both NaN.
+func same(x, y float64) bool {
+	return x == y || math.IsNaN(x) && math.IsNaN(y)
+}
+
+func TestCompileMissingVars(t *testing.T) {
+	expr, err := Parse("x + y + 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog := Compile(expr, []Var{"y"})
+	if got := prog.Eval([]float64{2}); got != 3 {
+		t.Errorf("Eval = %g, want 3", got)
+	}
+	// Batches longer than batchSize, and results appended to out.
+	col := make([]float64, 2*batchSize+1)
+	for i := range col {
+		col[i] = float64(i)
+	}
+	out := prog.EvalBatch([][]float64{col}, []float64{-1})
+	if len(out) != len(col)+1 || out[0] != -1 || out[len(out)-1] != float64(len(col)) {
+		t.Errorf("EvalBatch = %d results ending in %g, want %d ending in %d",
+			len(out), out[len(out)-1], len(col)+1, len(col))
+	}
+}
+
+// The expression and grid of gopl.io/ch7/surface.
+const benchExpr = "sin(-x)*pow(1.5,-r)"
+
+func benchGrid() (x, y, r []float64) {
+	for i := 0; i <= 100; i++ {
+		for j := 0; j <= 100; j++ {
+			xi, yj := 30*(float64(i)/100-0.5), 30*(float64(j)/100-0.5)
+			x, y, r = append(x, xi), append(y, yj), append(r, math.Hypot(xi, yj))
+		}
+	}
+	return x, y, r
+}
+
+func BenchmarkTreeEval(b *testing.B) {
+	expr, _ := Parse(benchExpr)
+	x, y, r := benchGrid()
+	for b.Loop() {
+		for i := range x {
+			expr.Eval(Env{"x": x[i], "y": y[i], "r": r[i]})
+		}
+	}
+}
+
+func BenchmarkProgramEval(b *testing.B) {
+	expr, _ := Parse(benchExpr)
+	prog := Compile(expr, []Var{"x", "y", "r"})
+	x, y, r := benchGrid()
+	vars := make([]float64, 3)
+	for b.Loop() {
+		for i := range x {
+			vars[0], vars[1], vars[2] = x[i], y[i], r[i]
+			prog.Eval(vars)
+		}
+	}
+}
+
+func BenchmarkEvalBatch(b *testing.B) {
+	expr, _ := Parse(benchExpr)
+	prog := Compile(expr, []Var{"x", "y", "r"})
+	x, y, r := benchGrid()
+	cols := [][]float64{x, y, r}
+	out := make([]float64, 0, len(x))
+	for b.Loop() {
+		out = prog.EvalBatch(cols, out[:0])
+	}
+}
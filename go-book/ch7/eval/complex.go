@@ -0,0 +1,226 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"strings"
+)
+
+// A ComplexEnv maps variables to complex values.
+type ComplexEnv map[Var]complex128
+
+// EvalComplex returns the value of e in env, computed in complex128.
+// Imaginary numbers such as 2i are allowed, and the functions called
+// are those of ComplexFuncs. Comparisons with < <= > >= compare real
+// parts, == and != whole values; any non-zero value is true. Like Eval,
+// EvalComplex panics on errors that CheckComplex reports.
+func EvalComplex(e Expr, env ComplexEnv) complex128 {
+	switch e := e.(type) {
+	case *Script, apply:
+		x, err := inline(e)
+		if err != nil {
+			panic(fmt.Sprintf("eval: %v", err))
+		}
+		return EvalComplex(x, env)
+	case Var:
+		return env[e]
+
+	case literal:
+		return complex(float64(e), 0)
+
+	case imaginary:
+		return complex(0, float64(e))
+
+	case quantity:
+		return complex(e.Eval(nil), 0)
+
+	case unary:
+		x := EvalComplex(e.x, env)
+		switch e.op {
+		case '+':
+			return x
+		case '-':
+			// 0 - x, not -x, so that the imaginary part of -1 is +0,
+			// and log(-1) is iπ, not -iπ, by the branch cuts of cmplx.
+			return 0 - x
+		case '!':
+			return complexTruth(x == 0)
+		}
+		panic(fmt.Sprintf("unsupported unary operator: %q", e.op))
+
+	case binary:
+		switch e.op {
+		case opAND:
+			return complexTruth(EvalComplex(e.x, env) != 0 && EvalComplex(e.y, env) != 0)
+		case opOR:
+			return complexTruth(EvalComplex(e.x, env) != 0 || EvalComplex(e.y, env) != 0)
+		}
+		x, y := EvalComplex(e.x, env), EvalComplex(e.y, env)
+		switch e.op {
+		case '+':
+			return x + y
+		case '-':
+			return x - y
+		case '*':
+			return x * y
+		case '/':
+			return x / y
+		case '^':
+			return complexPow(x, y)
+		case opEQ:
+			return complexTruth(x == y)
+		case opNE:
+			return complexTruth(x != y)
+		}
+		if cmp, ok := compare(e.op, compareReal(real(x), real(y))); ok {
+			return complexTruth(cmp)
+		}
+		panic(fmt.Sprintf("unsupported binary operator: %q", e.op))
+
+	case ternary:
+		if EvalComplex(e.cond, env) != 0 {
+			return EvalComplex(e.x, env)
+		}
+		return EvalComplex(e.y, env)
+
+	case call:
+		f, ok := ComplexFuncs[e.fn]
+		if !ok {
+			panic(fmt.Sprintf("unsupported function call: %s", e.fn))
+		}
+		args := make([]complex128, len(e.args))
+		for i, arg := range e.args {
+			args[i] = EvalComplex(arg, env)
+		}
+		return f.Impl(args)
+	}
+	panic(fmt.Sprintf("unknown Expr: %T", e))
+}
+
+// CheckComplex is like e.Check, but for EvalComplex: imaginary numbers
+// are allowed, % is not, and calls must be to ComplexFuncs.
+func CheckComplex(e Expr, vars map[Var]bool) error {
+	switch e := e.(type) {
+	case *Script, apply:
+		x, err := inline(e)
+		if err != nil {
+			return err
+		}
+		return CheckComplex(x, vars)
+	case Var:
+		vars[e] = true
+	case unary:
+		if !strings.ContainsRune("+-!", e.op) {
+			return fmt.Errorf("unexpected unary op %q", e.op)
+		}
+		return CheckComplex(e.x, vars)
+	case binary:
+		if !strings.ContainsRune("+-*/^<>", e.op) && opNames[e.op] == "" {
+			return fmt.Errorf("unexpected complex binary op %q", e.op)
+		}
+		if err := CheckComplex(e.x, vars); err != nil {
+			return err
+		}
+		return CheckComplex(e.y, vars)
+	case ternary:
+		for _, x := range []Expr{e.cond, e.x, e.y} {
+			if err := CheckComplex(x, vars); err != nil {
+				return err
+			}
+		}
+	case call:
+		f, ok := ComplexFuncs[e.fn]
+		if !ok {
+			return fmt.Errorf("unknown complex function %q", e.fn)
+		}
+		if n := len(e.args); n != f.Args {
+			return fmt.Errorf("call to %s has %d args, want %d", e.fn, n, f.Args)
+		}
+		for _, arg := range e.args {
+			if err := CheckComplex(arg, vars); err != nil {
+				return err
+			}
+		}
+	}
+	return nil // literal, imaginary, quantity
+}
+
+func complexTruth(cond bool) complex128 {
+	return complex(truth(cond), 0)
+}
+
+// compareReal returns -1, 0 or +1 as x is less than, equal to or
+// greater than y.
+func compareReal(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return +1
+	}
+	return 0
+}
+
+// complexPow is cmplx.Pow, exact for small integer exponents such as
+// those of z^2 + c.
+func complexPow(x, y complex128) complex128 {
+	if n := real(y); imag(y) == 0 && n == math.Trunc(n) && math.Abs(n) <= 64 {
+		z := complex(1, 0)
+		for i := 0; i < int(math.Abs(n)); i++ {
+			z *= x
+		}
+		if n < 0 {
+			return 1 / z
+		}
+		return z
+	}
+	return cmplx.Pow(x, y)
+}
+
+// A ComplexFunc is a function that can be called from an expression
+// evaluated by EvalComplex.
+type ComplexFunc struct {
+	Args int
+	Impl func(args []complex128) complex128
+}
+
+// ComplexFuncs are the functions of EvalComplex: those of the cmplx
+// package, by their lower-case names, and abs, arg, conj, re and im.
+// Functions of real results return them as complex values.
+var ComplexFuncs = map[string]ComplexFunc{
+	"abs":  real1(cmplx.Abs),
+	"arg":  real1(cmplx.Phase),
+	"re":   real1(func(z complex128) float64 { return real(z) }),
+	"im":   real1(func(z complex128) float64 { return imag(z) }),
+	"conj": complex1(cmplx.Conj),
+
+	"exp":   complex1(cmplx.Exp),
+	"log":   complex1(cmplx.Log),
+	"log10": complex1(cmplx.Log10),
+	"sqrt":  complex1(cmplx.Sqrt),
+	"sin":   complex1(cmplx.Sin),
+	"cos":   complex1(cmplx.Cos),
+	"tan":   complex1(cmplx.Tan),
+	"cot":   complex1(cmplx.Cot),
+	"asin":  complex1(cmplx.Asin),
+	"acos":  complex1(cmplx.Acos),
+	"atan":  complex1(cmplx.Atan),
+	"sinh":  complex1(cmplx.Sinh),
+	"cosh":  complex1(cmplx.Cosh),
+	"tanh":  complex1(cmplx.Tanh),
+	"asinh": complex1(cmplx.Asinh),
+	"acosh": complex1(cmplx.Acosh),
+	"atanh": complex1(cmplx.Atanh),
+	"pow": {2, func(args []complex128) complex128 {
+		return complexPow(args[0], args[1])
+	}},
+}
+
+func complex1(f func(complex128) complex128) ComplexFunc {
+	return ComplexFunc{1, func(args []complex128) complex128 { return f(args[0]) }}
+}
+
+func real1(f func(complex128) float64) ComplexFunc {
+	return ComplexFunc{1, func(args []complex128) complex128 { return complex(f(args[0]), 0) }}
+}
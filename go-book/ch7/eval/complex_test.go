@@ -0,0 +1,112 @@
+package eval
+
+import (
+	"fmt"
+	"math/cmplx"
+	"testing"
+)
+
+func TestEvalComplex(t *testing.T) {
+	tests := []struct {
+		expr string
+		env  ComplexEnv
+		want string
+	}{
+		{"2i", nil, "(0+2i)"},
+		{"1 + 2i * 3", nil, "(1+6i)"},
+		{"1.5e1i", nil, "(0+15i)"},
+		{"z * z + c", ComplexEnv{"z": 1i, "c": 1}, "(0+0i)"},
+		{"z^2 + c", ComplexEnv{"z": 1 + 1i, "c": -1i}, "(0+1i)"},
+		{"z ^ -1", ComplexEnv{"z": 2i}, "(0-0.5i)"},
+		{"1i ^ 0.5", nil, "(0.707107+0.707107i)"},
+		{"exp(pi * 1i) + 1", ComplexEnv{"pi": 3.141592653589793}, "(0+1.22465e-16i)"},
+		{"log(-1)", nil, "(0+3.14159i)"},
+		{"sqrt(-4)", nil, "(0+2i)"},
+		{"abs(3 + 4i)", nil, "(5+0i)"},
+		{"arg(-2i)", nil, "(-1.5708+0i)"},
+		{"conj(z)", ComplexEnv{"z": 1 + 2i}, "(1-2i)"},
+		{"re(z) + im(z)", ComplexEnv{"z": 3 + 4i}, "(7+0i)"},
+		{"abs(z) > 2", ComplexEnv{"z": 2 + 1i}, "(1+0i)"},
+		{"z == 1i", ComplexEnv{"z": 1i}, "(1+0i)"},
+		{"z < 1 && !(z == 0) ? z : -z", ComplexEnv{"z": 0.5 + 3i}, "(0.5+3i)"},
+	}
+	for _, test := range tests {
+		expr, err := Parse(test.expr)
+		if err == nil {
+			err = CheckComplex(expr, map[Var]bool{})
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if got := fmt.Sprintf("%.6g", EvalComplex(expr, test.env)); got != test.want {
+			t.Errorf("%s.EvalComplex() in %v = %s, want %s", test.expr, test.env, got, test.want)
+		}
+		// Format prints imaginary numbers that parse back.
+		expr2, err := Parse(Format(expr))
+		if err != nil {
+			t.Errorf("Parse(Format(%s)): %v", test.expr, err)
+		} else if got, want := EvalComplex(expr2, test.env), EvalComplex(expr, test.env); !cmplx.IsNaN(want) && got != want {
+			t.Errorf("%s: Format = %s evaluates to %v, want %v", test.expr, Format(expr), got, want)
+		}
+	}
+}
+
+func TestComplexErrors(t *testing.T) {
+	for _, test := range []struct{ expr, check, checkComplex string }{
+		{"2i + x", "imaginary number 2i in real expression", ""},
+		{"z % 2", "", "unexpected complex binary op '%'"},
+		{"floor(z)", "", `unknown complex function "floor"`},
+		{"arg(z)", `unknown function "arg"`, ""},
+		{"abs(z, 1)", "call to abs has 2 args, want 1", "call to abs has 2 args, want 1"},
+		{"2 i", "1:3: unexpected identifier i", ""},
+	} {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			if err.Error() != test.check {
+				t.Errorf("Parse(%s) = %v, want %s", test.expr, err, test.check)
+			}
+			continue
+		}
+		for _, c := range []struct {
+			name string
+			err  error
+			want string
+		}{
+			{"Check", expr.Check(map[Var]bool{}), test.check},
+			{"CheckComplex", CheckComplex(expr, map[Var]bool{}), test.checkComplex},
+		} {
+			got := ""
+			if c.err != nil {
+				got = c.err.Error()
+			}
+			if got != c.want {
+				t.Errorf("%s(%s) = %q, want %q", c.name, test.expr, got, c.want)
+			}
+		}
+	}
+
+	expr, _ := Parse("1 + 2i")
+	if _, err := expr.EvalChecked(nil); err == nil {
+		t.Errorf("EvalChecked(%s) succeeded", Format(expr))
+	}
+	if _, err := EvalRat(expr, nil); err == nil {
+		t.Errorf("EvalRat(%s) succeeded", Format(expr))
+	}
+}
+
+// TestEvalComplexScriptOnce checks that a script is inlined once, not at
+// each evaluation, as the iterations of a fractal evaluate it.
+func TestEvalComplexScriptOnce(t *testing.T) {
+	expr, err := Parse("f(w) = w*w + c; f(f(z))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := ComplexEnv{"z": 1i, "c": 1}
+	if got := EvalComplex(expr, env); got != 1 {
+		t.Errorf("EvalComplex = %v, want (1+0i)", got)
+	}
+	if n := testing.AllocsPerRun(100, func() { EvalComplex(expr, env) }); n != 0 {
+		t.Errorf("EvalComplex of a script allocated %g times", n)
+	}
+}
@@ -16,9 +16,9 @@ func TestCoverage(t *testing.T) {
 		env   Env
 		want  string // expected error from Parse/Check or result from Eval
 	}{
-		{"x % 2", nil, "unexpected '%'"},
-		{"!true", nil, "unexpected '!'"},
-		{"log(10)", nil, `unknown function "log"`},
+		{"x = 2", nil, "1:6: script has no result"},
+		{"x & y", nil, "1:3: unexpected '&'"},
+		{"foo(10)", nil, `unknown function "foo"`},
 		{"sqrt(1, 2)", nil, "call to sqrt has 2 args, want 1"},
 		{"sqrt(A / pi)", Env{"A": 87616, "pi": math.Pi}, "167"},
 		{"pow(x, 3) + pow(y, 3)", Env{"x": 9, "y": 10}, "1729"},
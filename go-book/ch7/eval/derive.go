@@ -0,0 +1,258 @@
+package eval
+
+import (
+	"fmt"
+)
+
+// Derive returns the derivative of e with respect to v. The result is not
+// simplified: Format(Simplify(Derive(e, v))) is usually more readable.
+//
+// Comparisons and logical operators are piecewise constant, so their
+// derivative is 0; the derivative of a conditional expression is the
+// conditional expression of the derivatives. Derive panics if e calls a
+// function whose partial derivatives are not known, see SetPartials, with
+// arguments that depend on v.
+func Derive(e Expr, v Var) Expr {
+	switch e := e.(type) {
+	case *Script, apply:
+		x, err := inline(e)
+		if err != nil {
+			panic(fmt.Sprintf("eval: %v", err))
+		}
+		return Derive(x, v)
+	case literal, imaginary, quantity:
+		return literal(0)
+
+	case Var:
+		if e == v {
+			return literal(1)
+		}
+		return literal(0)
+
+	case unary:
+		switch e.op {
+		case '+', '-':
+			return unary{e.op, Derive(e.x, v)}
+		}
+		return literal(0) // '!'
+
+	case binary:
+		dx, dy := Derive(e.x, v), Derive(e.y, v)
+		switch e.op {
+		case '+', '-':
+			return binary{e.op, dx, dy}
+		case '*':
+			return binary{'+', binary{'*', dx, e.y}, binary{'*', e.x, dy}}
+		case '/':
+			return binary{'/',
+				binary{'-', binary{'*', dx, e.y}, binary{'*', e.x, dy}},
+				binary{'^', e.y, literal(2)}}
+		case '%':
+			// x % y is x - trunc(x / y) * y.
+			if !dependsOn(e.y, v) {
+				return dx
+			}
+			return binary{'-', dx, binary{'*', call{fn: "trunc", args: []Expr{binary{'/', e.x, e.y}}}, dy}}
+		case '^':
+			if !dependsOn(e.y, v) {
+				return binary{'*', binary{'*', e.y, binary{'^', e.x, binary{'-', e.y, literal(1)}}}, dx}
+			}
+			// d(x^y) = x^y * (dy * log(x) + y * dx / x)
+			return binary{'*', e, binary{'+',
+				binary{'*', dy, call{fn: "log", args: []Expr{e.x}}},
+				binary{'/', binary{'*', e.y, dx}, e.x}}}
+		}
+		return literal(0) // comparisons, && and ||
+
+	case ternary:
+		return ternary{e.cond, Derive(e.x, v), Derive(e.y, v)}
+
+	case call:
+		// The chain rule: the sum of each partial derivative
+		// times the derivative of its argument.
+		f, ok := e.registry().Lookup(e.fn)
+		var d Expr = literal(0)
+		for i, arg := range e.args {
+			if !dependsOn(arg, v) {
+				continue
+			}
+			if !ok || f.deriv == nil {
+				panic(fmt.Sprintf("eval: no derivative for %s", e.fn))
+			}
+			partial := f.deriv(e.args, i)
+			if e.reg != nil {
+				partial = bind(partial, e.reg)
+			}
+			d = binary{'+', d, binary{'*', partial, Derive(arg, v)}}
+		}
+		return d
+	}
+	panic(fmt.Sprintf("unknown Expr: %T", e))
+}
+
+// dependsOn reports whether v occurs in e.
+func dependsOn(e Expr, v Var) bool {
+	switch e := e.(type) {
+	case Var:
+		return e == v
+	case unary:
+		return dependsOn(e.x, v)
+	case binary:
+		return dependsOn(e.x, v) || dependsOn(e.y, v)
+	case ternary:
+		return dependsOn(e.cond, v) || dependsOn(e.x, v) || dependsOn(e.y, v)
+	case call:
+		for _, arg := range e.args {
+			if dependsOn(arg, v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// partialVars are the names of the arguments in the expressions given
+// to SetPartials.
+var partialVars = []Var{"x", "y", "z"}
+
+// SetPartials sets the partial derivatives of the function name of r,
+// one expression per argument, in which x, y and z stand for the first,
+// second and third arguments, e.g.
+//
+//	r.SetPartials("hypot", "x / hypot(x, y)", "y / hypot(x, y)")
+//
+// The expressions are parsed with r. Functions of other registries are
+// not affected, even if r is their clone.
+func (r *FuncRegistry) SetPartials(name string, partials ...string) error {
+	f, ok := r.Lookup(name)
+	if !ok {
+		return fmt.Errorf("unknown function %q", name)
+	}
+	if len(partials) > len(partialVars) || len(partials) < f.MinArgs ||
+		(f.MaxArgs != Variadic && len(partials) > f.MaxArgs) {
+		return fmt.Errorf("%s has %d partial derivatives, want %d", name, len(partials), f.MinArgs)
+	}
+	exprs := make([]Expr, len(partials))
+	for i, partial := range partials {
+		e, err := ParseWith(partial, r)
+		if err != nil {
+			return fmt.Errorf("partial derivative %d of %s: %v", i+1, name, err)
+		}
+		exprs[i] = e
+	}
+	g := *f
+	g.deriv = func(args []Expr, i int) Expr {
+		if i >= len(exprs) {
+			panic(fmt.Sprintf("eval: no derivative for %s with %d args", name, len(args)))
+		}
+		env := make(map[Var]Expr)
+		for j, arg := range args {
+			if j < len(partialVars) {
+				env[partialVars[j]] = arg
+			}
+		}
+		return substitute(exprs[i], env)
+	}
+	r.funcs[name] = &g
+	return nil
+}
+
+// substitute returns a copy of e in which the variables of env are
+// replaced by their expressions.
+func substitute(e Expr, env map[Var]Expr) Expr {
+	switch e := e.(type) {
+	case Var:
+		if x, ok := env[e]; ok {
+			return x
+		}
+	case unary:
+		return unary{e.op, substitute(e.x, env)}
+	case binary:
+		return binary{e.op, substitute(e.x, env), substitute(e.y, env)}
+	case ternary:
+		return ternary{substitute(e.cond, env), substitute(e.x, env), substitute(e.y, env)}
+	case call:
+		args := make([]Expr, len(e.args))
+		for i, arg := range e.args {
+			args[i] = substitute(arg, env)
+		}
+		return call{fn: e.fn, args: args, reg: e.reg}
+	case apply:
+		args := make([]Expr, len(e.args))
+		for i, arg := range e.args {
+			args[i] = substitute(arg, env)
+		}
+		return apply{e.def, args}
+	}
+	return e // literal, imaginary, quantity
+}
+
+// setDefaultPartials sets the derivatives of the functions of the default
+// registry. gamma has none. The constants of erf and its relatives are
+// 2/sqrt(pi) and sqrt(pi)/2.
+func setDefaultPartials(r *FuncRegistry) {
+	for name, partials := range map[string][]string{
+		"abs":         {"copysign(1, x)"},
+		"acos":        {"-1 / sqrt(1 - x^2)"},
+		"acosh":       {"1 / sqrt(x^2 - 1)"},
+		"asin":        {"1 / sqrt(1 - x^2)"},
+		"asinh":       {"1 / sqrt(x^2 + 1)"},
+		"atan":        {"1 / (1 + x^2)"},
+		"atanh":       {"1 / (1 - x^2)"},
+		"cbrt":        {"1 / (3 * cbrt(x)^2)"},
+		"ceil":        {"0"},
+		"cos":         {"-sin(x)"},
+		"cosh":        {"sinh(x)"},
+		"erf":         {"1.1283791670955126 * exp(-x^2)"},
+		"erfc":        {"-1.1283791670955126 * exp(-x^2)"},
+		"erfcinv":     {"-0.886226925452758 * exp(erfcinv(x)^2)"},
+		"erfinv":      {"0.886226925452758 * exp(erfinv(x)^2)"},
+		"exp":         {"exp(x)"},
+		"exp2":        {"exp2(x) * log(2)"},
+		"expm1":       {"exp(x)"},
+		"floor":       {"0"},
+		"j0":          {"-j1(x)"},
+		"j1":          {"j0(x) - j1(x) / x"},
+		"log":         {"1 / x"},
+		"log10":       {"1 / (x * log(10))"},
+		"log1p":       {"1 / (1 + x)"},
+		"log2":        {"1 / (x * log(2))"},
+		"logb":        {"0"},
+		"round":       {"0"},
+		"roundtoeven": {"0"},
+		"sin":         {"cos(x)"},
+		"sinh":        {"cosh(x)"},
+		"sqrt":        {"1 / (2 * sqrt(x))"},
+		"tan":         {"1 + tan(x)^2"},
+		"tanh":        {"1 - tanh(x)^2"},
+		"trunc":       {"0"},
+		"y0":          {"-y1(x)"},
+		"y1":          {"y0(x) - y1(x) / x"},
+
+		"atan2":     {"y / (x^2 + y^2)", "-x / (x^2 + y^2)"},
+		"copysign":  {"copysign(1, x) * copysign(1, y)", "0"},
+		"dim":       {"x > y ? 1 : 0", "x > y ? -1 : 0"},
+		"hypot":     {"x / hypot(x, y)", "y / hypot(x, y)"},
+		"mod":       {"1", "-trunc(x / y)"},
+		"nextafter": {"1", "0"},
+		"pow":       {"y * pow(x, y - 1)", "pow(x, y) * log(x)"},
+		"remainder": {"1", "-roundtoeven(x / y)"},
+		"fma":       {"y", "x", "1"},
+	} {
+		if err := r.SetPartials(name, partials...); err != nil {
+			panic(err)
+		}
+	}
+
+	// The partial derivative of min or max is 1 for the argument that is
+	// the result, 0 for the others.
+	for _, name := range []string{"min", "max"} {
+		f, _ := r.Lookup(name)
+		g := *f
+		g.deriv = func(args []Expr, i int) Expr {
+			result := call{fn: g.Name, args: args, reg: r}
+			return ternary{binary{opEQ, args[i], result}, literal(1), literal(0)}
+		}
+		r.funcs[name] = &g
+	}
+}
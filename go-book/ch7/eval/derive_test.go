@@ -0,0 +1,196 @@
+package eval
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSimplify(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"x * 1", "x"},
+		{"1 * x", "x"},
+		{"x + 0", "x"},
+		{"0 - x", "(-x)"},
+		{"x * 0 + y", "y"},
+		{"2 * 3 + x", "(x + 6)"},
+		{"sqrt(4) * x", "(2 * x)"},
+		{"x + x", "(2 * x)"},
+		{"3 * x - x + 2 * y - y", "((2 * x) + y)"},
+		{"x - x", "0"},
+		{"x * x", "(x ^ 2)"},
+		{"x * y / x", "y"},
+		{"x * y * x / z", "(((x ^ 2) * y) / z)"},
+		{"(x ^ 2) ^ 3", "(x ^ 6)"},
+		{"x ^ 1", "x"},
+		{"x ^ 0", "1"},
+		{"-(-x)", "x"},
+		{"1 / 0", "(1 / 0)"},
+		{"x > 1 ? 2 + 3 : 5", "5"},
+		{"1 < 2 ? x : y", "x"},
+		{"sin(x) * 2 + sin(x)", "(3 * sin(x))"},
+		{"x == 2 * 1", "(x == 2)"},
+		{"pow(x, 0 + 1)", "pow(x, 1)"},
+		{"(x ^ 2) ^ 0.5", "((x ^ 2) ^ 0.5)"},
+		{"x ^ 0.5 * x ^ 0.5", "((x ^ 0.5) ^ 2)"},
+		{"(x * y) ^ 0.5", "((x * y) ^ 0.5)"},
+		{"(x / y) ^ -1", "(y / x)"},
+		{"(x ^ 0.5) ^ 2", "((x ^ 0.5) ^ 2)"},
+		{"(x ^ 2) ^ 1.5 * x", "(((x ^ 2) ^ 1.5) * x)"},
+		{"abs(x) ^ 0.5 * abs(x) ^ 0.5", "abs(x)"},
+		{"(x ^ 2) ^ 0.25 * (x ^ 2) ^ 0.25", "((x ^ 2) ^ 0.5)"},
+		{"exp(x) ^ 0.5", "(exp(x) ^ 0.5)"},
+	}
+	for _, test := range tests {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if got := Format(Simplify(expr)); got != test.want {
+			t.Errorf("Simplify(%s) = %s, want %s", test.expr, got, test.want)
+		}
+	}
+}
+
+// TestSimplifyNegative compares simplified powers with the originals at
+// negative values, where fractional exponents are not defined.
+func TestSimplifyNegative(t *testing.T) {
+	for _, s := range []string{
+		"(x ^ 2) ^ 0.5", "x ^ 0.5 * x ^ 0.5", "(x * y) ^ 0.5", "(x / y) ^ 1.5",
+		"(x ^ 3) ^ (1 / 3)", "(x ^ 0.5) ^ 2 / x", "(x ^ 2) ^ 0.25 * x ^ 0.5",
+		"-(x ^ 2) ^ 0.5", "(-x) ^ 0.5 * (-x) ^ 0.5",
+	} {
+		expr, err := Parse(s)
+		if err != nil {
+			t.Errorf("%s: %v", s, err)
+			continue
+		}
+		simple := Simplify(expr)
+		for _, env := range []Env{{"x": -2, "y": -3}, {"x": -2, "y": 3}, {"x": 2, "y": 3}} {
+			want, got := expr.Eval(env), simple.Eval(env)
+			if got != want && !(math.IsNaN(got) && math.IsNaN(want)) && math.Abs(got-want) > 1e-12*math.Abs(want) {
+				t.Errorf("Simplify(%s) = %s = %g in %v, want %g", s, Format(simple), got, env, want)
+			}
+		}
+	}
+}
+
+func TestDerive(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"3", "0"},
+		{"x", "1"},
+		{"y", "0"},
+		{"x + y", "1"},
+		{"3 * x - 2", "3"},
+		{"x * x", "(2 * x)"},
+		{"x ^ 3", "(3 * (x ^ 2))"},
+		{"1 / x", "(-1 / (x ^ 2))"},
+		{"x * y", "y"},
+		{"sin(x)", "cos(x)"},
+		{"sin(x) * cos(x)", "((cos(x) ^ 2) - (sin(x) ^ 2))"},
+		{"exp(2 * x)", "(2 * exp((2 * x)))"},
+		{"log(x)", "(1 / x)"},
+		{"sqrt(x)", "(0.5 / sqrt(x))"},
+		{"pow(x, 2)", "(2 * pow(x, 1))"},
+		{"x > 0 ? x * x : -x", "((x > 0) ? (2 * x) : -1)"},
+		{"x < 1 && y", "0"},
+		{"hypot(x, 3)", "(x / hypot(x, 3))"},
+	}
+	for _, test := range tests {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if got := Format(Simplify(Derive(expr, "x"))); got != test.want {
+			t.Errorf("Derive(%s, x) = %s, want %s", test.expr, got, test.want)
+		}
+	}
+}
+
+// TestDeriveNumeric compares derivatives, with and without Simplify,
+// against central differences, for every function with derivatives.
+func TestDeriveNumeric(t *testing.T) {
+	exprs := []string{
+		"x ^ y", "x % y", "x / y - x * y", "-x + +y", "(x + y) ^ 2.5",
+		"x * x * x / (y * y)", "3 * x * y - x * y * 2 + x / x",
+		"min(x, y, 0.1)", "max(x, y)", "fma(x, y, x)",
+	}
+	for _, name := range DefaultRegistry.Names() {
+		f, _ := DefaultRegistry.Lookup(name)
+		if f.deriv == nil {
+			continue
+		}
+		switch f.MinArgs {
+		case 1:
+			exprs = append(exprs, name+"(0.3 * x + 0.1)")
+		case 2:
+			exprs = append(exprs, name+"(x, y)", name+"(y, x * y)")
+		case 3:
+			exprs = append(exprs, name+"(x, y, x * y)")
+		}
+	}
+
+	env := Env{"x": 0.55, "y": 0.7}
+	const h = 1e-6
+	for _, s := range exprs {
+		expr, err := Parse(s)
+		if err != nil {
+			t.Errorf("%s: %v", s, err)
+			continue
+		}
+		for _, v := range []Var{"x", "y"} {
+			lo, hi := Env{"x": env["x"], "y": env["y"]}, Env{"x": env["x"], "y": env["y"]}
+			lo[v] -= h
+			hi[v] += h
+			want := (expr.Eval(hi) - expr.Eval(lo)) / (2 * h)
+			d := Derive(expr, v)
+			for _, d := range []Expr{d, Simplify(d)} {
+				got := d.Eval(env)
+				if math.Abs(got-want) > 1e-4*math.Max(1, math.Abs(want)) {
+					t.Errorf("d/d%s %s = %s = %g, want %g", v, s, Format(d), got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestSetPartials(t *testing.T) {
+	reg := DefaultRegistry.Clone()
+	reg.Register2("sq", func(x, y float64) float64 { return x*x + y })
+	expr, err := ParseWith("sq(x, 3 * x)", reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Derive(%s) without partials did not panic", Format(expr))
+			}
+		}()
+		Derive(expr, "x")
+	}()
+
+	if err := reg.SetPartials("sq", "2 * x", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := Format(Simplify(Derive(expr, "x"))), "((2 * x) + 3)"; got != want {
+		t.Errorf("Derive(%s) = %s, want %s", Format(expr), got, want)
+	}
+	if err := reg.SetPartials("sq", "2 * x"); err == nil {
+		t.Errorf("SetPartials with missing partial succeeded")
+	}
+	if err := reg.SetPartials("nosuch", "1"); err == nil {
+		t.Errorf("SetPartials of unknown function succeeded")
+	}
+	if _, ok := DefaultRegistry.Lookup("sq"); ok {
+		t.Errorf("SetPartials changed DefaultRegistry")
+	}
+}
@@ -0,0 +1,192 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+)
+
+// A dual is a dual number: a value and its partial derivatives with
+// respect to the variables of Gradient. A nil d is all zeros.
+type dual struct {
+	v float64
+	d []float64
+}
+
+// Gradient returns the value of e in env and its partial derivatives
+// with respect to vars, by forward-mode automatic differentiation:
+// e is evaluated once, on dual numbers, without building derivative
+// expressions as Derive does. Calls need the partial derivatives of
+// their functions, see SetPartials, unless their arguments do not
+// depend on vars.
+func Gradient(e Expr, env Env, vars []Var) (float64, []float64, error) {
+	ev := dualEval{env: env, vars: vars}
+	z, err := ev.eval(e)
+	if err != nil {
+		return 0, nil, err
+	}
+	grad := make([]float64, len(vars))
+	copy(grad, z.d)
+	return z.v, grad, nil
+}
+
+type dualEval struct {
+	env  Env
+	vars []Var
+}
+
+func (ev dualEval) constant(x float64) dual { return dual{v: x} }
+
+// combine returns the dual of value v whose derivatives are a times
+// those of x plus b times those of y. Zero derivatives stay zero even
+// where a or b is infinite or NaN.
+func (ev dualEval) combine(v float64, a float64, x dual, b float64, y dual) dual {
+	if x.d == nil && y.d == nil {
+		return dual{v: v}
+	}
+	d := make([]float64, len(ev.vars))
+	for i := range d {
+		if x.d != nil && a != 0 && x.d[i] != 0 {
+			d[i] += a * x.d[i]
+		}
+		if y.d != nil && b != 0 && y.d[i] != 0 {
+			d[i] += b * y.d[i]
+		}
+	}
+	return dual{v, d}
+}
+
+func (ev dualEval) eval(e Expr) (dual, error) {
+	switch e := e.(type) {
+	case Var:
+		x, ok := ev.env[e]
+		for i, v := range ev.vars {
+			if v == e {
+				d := make([]float64, len(ev.vars))
+				d[i] = 1
+				return dual{x, d}, nil
+			}
+		}
+		if !ok {
+			return dual{}, &EvalError{e, "undefined variable"}
+		}
+		return ev.constant(x), nil
+
+	case literal, quantity:
+		return ev.constant(e.Eval(nil)), nil
+
+	case imaginary:
+		return dual{}, &EvalError{e, "imaginary number in real expression"}
+
+	case unary:
+		x, err := ev.eval(e.x)
+		if err != nil {
+			return dual{}, err
+		}
+		switch e.op {
+		case '+':
+			return x, nil
+		case '-':
+			return ev.combine(-x.v, -1, x, 0, dual{}), nil
+		case '!':
+			return ev.constant(truth(x.v == 0)), nil
+		}
+		return dual{}, &EvalError{e, fmt.Sprintf("unsupported unary operator: %q", e.op)}
+
+	case binary:
+		x, err := ev.eval(e.x)
+		if err != nil {
+			return dual{}, err
+		}
+		switch e.op {
+		case opAND, opOR:
+			if (x.v != 0) == (e.op == opOR) {
+				return ev.constant(truth(x.v != 0)), nil
+			}
+		}
+		y, err := ev.eval(e.y)
+		if err != nil {
+			return dual{}, err
+		}
+		switch e.op {
+		case '+':
+			return ev.combine(x.v+y.v, 1, x, 1, y), nil
+		case '-':
+			return ev.combine(x.v-y.v, 1, x, -1, y), nil
+		case '*':
+			return ev.combine(x.v*y.v, y.v, x, x.v, y), nil
+		case '/':
+			z := x.v / y.v
+			return ev.combine(z, 1/y.v, x, -z/y.v, y), nil
+		case '%':
+			z := math.Mod(x.v, y.v)
+			return ev.combine(z, 1, x, -math.Trunc(x.v/y.v), y), nil
+		case '^':
+			z := math.Pow(x.v, y.v)
+			if y.d == nil {
+				// d(x^k) = k x^(k-1) dx, also for x <= 0.
+				return ev.combine(z, y.v*math.Pow(x.v, y.v-1), x, 0, y), nil
+			}
+			lz := 0.0 // z ln x tends to 0 as z does
+			if z != 0 {
+				lz = z * math.Log(x.v)
+			}
+			return ev.combine(z, y.v*math.Pow(x.v, y.v-1), x, lz, y), nil
+		}
+		// Comparisons and logical operators are piecewise constant.
+		return ev.constant(binary{e.op, literal(x.v), literal(y.v)}.Eval(nil)), nil
+
+	case ternary:
+		cond, err := ev.eval(e.cond)
+		if err != nil {
+			return dual{}, err
+		}
+		if cond.v != 0 {
+			return ev.eval(e.x)
+		}
+		return ev.eval(e.y)
+
+	case call:
+		f, ok := e.registry().Lookup(e.fn)
+		if !ok {
+			return dual{}, &EvalError{e, fmt.Sprintf("unknown function %q", e.fn)}
+		}
+		if err := f.checkArity(len(e.args)); err != nil {
+			return dual{}, &EvalError{e, err.Error()}
+		}
+		args := make([]dual, len(e.args))
+		values := make([]float64, len(e.args))
+		lits := make([]Expr, len(e.args))
+		for i, arg := range e.args {
+			x, err := ev.eval(arg)
+			if err != nil {
+				return dual{}, err
+			}
+			args[i], values[i], lits[i] = x, x.v, literal(x.v)
+		}
+		// The chain rule, with the partial derivatives at the values of
+		// the arguments.
+		z := dual{v: f.Impl(values)}
+		for i, x := range args {
+			if x.d == nil {
+				continue
+			}
+			if f.deriv == nil {
+				return dual{}, &EvalError{e, fmt.Sprintf("no derivative for %s", e.fn)}
+			}
+			partial := f.deriv(lits, i)
+			if e.reg != nil {
+				partial = bind(partial, e.reg)
+			}
+			z = ev.combine(z.v, 1, z, partial.Eval(nil), x)
+		}
+		return z, nil
+
+	case *Script, apply:
+		x, err := inline(e)
+		if err != nil {
+			return dual{}, &EvalError{e, err.Error()}
+		}
+		return ev.eval(x)
+	}
+	panic(fmt.Sprintf("unknown Expr: %T", e))
+}
@@ -0,0 +1,343 @@
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gopl.io/ch12/sexpr"
+)
+
+// ---- constructors and inspectors ----
+
+// A Kind is a kind of expression.
+type Kind int
+
+const (
+	VarKind         Kind = iota // x
+	NumberKind                  // 3.141
+	ImaginaryKind               // 2i
+	QuantityKind                // 5 km/h
+	UnaryKind                   // -x
+	BinaryKind                  // x + y
+	ConditionalKind             // x > 0 ? x : -x
+	CallKind                    // sin(x)
+	ScriptKind                  // f(x) = x * x; f(3)
+)
+
+var kindNames = [...]string{
+	VarKind:         "var",
+	NumberKind:      "number",
+	ImaginaryKind:   "imaginary",
+	QuantityKind:    "quantity",
+	UnaryKind:       "unary",
+	BinaryKind:      "binary",
+	ConditionalKind: "conditional",
+	CallKind:        "call",
+	ScriptKind:      "script",
+}
+
+func (k Kind) String() string {
+	if 0 <= k && int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Number returns the expression of the constant x.
+func Number(x float64) Expr { return literal(x) }
+
+// Imaginary returns the expression of the imaginary constant xi.
+func Imaginary(x float64) Expr { return imaginary(x) }
+
+// Quantity returns the expression of x units, e.g., 5 km/h, in terms of
+// the units of DefaultUnits.
+func Quantity(x float64, unit string) (Expr, error) {
+	u, err := DefaultUnits.Parse(unit)
+	if err != nil {
+		return nil, fmt.Errorf("unit %q: %v", unit, err)
+	}
+	return quantity{literal(x), u}, nil
+}
+
+// Unary returns the expression op x, for op one of + - !.
+// It panics for other operators.
+func Unary(op string, x Expr) Expr {
+	r, ok := unaryOpRune(op)
+	if !ok {
+		panic(fmt.Sprintf("eval: unsupported unary operator: %q", op))
+	}
+	return unary{r, x}
+}
+
+// Binary returns the expression x op y, for op one of the binary
+// operators of Parse, e.g., "+" or "<=". It panics for other operators.
+func Binary(op string, x, y Expr) Expr {
+	r, ok := binaryOpRune(op)
+	if !ok {
+		panic(fmt.Sprintf("eval: unsupported binary operator: %q", op))
+	}
+	return binary{r, x, y}
+}
+
+// Conditional returns the expression cond ? x : y.
+func Conditional(cond, x, y Expr) Expr { return ternary{cond, x, y} }
+
+// Call returns the expression of a call to the function fn of
+// DefaultRegistry. Check reports unknown functions.
+func Call(fn string, args ...Expr) Expr {
+	return call{fn: fn, args: append([]Expr(nil), args...)}
+}
+
+func unaryOpRune(op string) (rune, bool) {
+	if len(op) == 1 && strings.Contains("+-!", op) {
+		return rune(op[0]), true
+	}
+	return 0, false
+}
+
+func binaryOpRune(op string) (rune, bool) {
+	if len(op) == 1 && strings.Contains("+-*/%^<>", op) {
+		return rune(op[0]), true
+	}
+	for r, name := range opNames {
+		if name == op {
+			return r, true
+		}
+	}
+	return 0, false
+}
+
+// Inspect returns the kind of e and its parts: the name of a variable
+// or of the function of a call, the text of a unit or of an operator,
+// or the text of a script; the value of a number, imaginary number or
+// quantity, in its unit; and the operands of an operator or the
+// arguments of a call. Rebuilding e from them with the constructor of
+// its kind returns an equal expression.
+func Inspect(e Expr) (kind Kind, name string, value float64, args []Expr) {
+	switch e := e.(type) {
+	case Var:
+		return VarKind, string(e), 0, nil
+	case literal:
+		return NumberKind, "", float64(e), nil
+	case imaginary:
+		return ImaginaryKind, "", float64(e), nil
+	case quantity:
+		return QuantityKind, e.unit.Name, float64(e.x), nil
+	case unary:
+		return UnaryKind, string(e.op), 0, []Expr{e.x}
+	case binary:
+		return BinaryKind, opName(e.op), 0, []Expr{e.x, e.y}
+	case ternary:
+		return ConditionalKind, "", 0, []Expr{e.cond, e.x, e.y}
+	case call:
+		return CallKind, e.fn, 0, append([]Expr(nil), e.args...)
+	case *Script:
+		return ScriptKind, FormatInfix(e), 0, nil
+	case apply:
+		return CallKind, e.def.name, 0, append([]Expr(nil), e.args...)
+	}
+	panic(fmt.Sprintf("unknown Expr: %T", e))
+}
+
+// ---- portable trees ----
+
+// SchemaVersion is the version of the Document schema written by
+// MarshalJSON and MarshalSexpr. Decoding rejects other versions.
+const SchemaVersion = 1
+
+// A Document is the portable form of an expression, for JSON and for
+// S-expressions as encoded by gopl.io/ch12/sexpr, which needs only its
+// strings, ints, slices and structs.
+type Document struct {
+	Version int  `json:"version"`
+	Expr    Node `json:"expr"`
+}
+
+// A Node is the portable form of one node of an expression. Numbers are
+// in the text of strconv.FormatFloat, which reads back exactly.
+type Node struct {
+	Kind  string `json:"kind"`            // a Kind, e.g. "binary"
+	Name  string `json:"name,omitempty"`  // as returned by Inspect
+	Value string `json:"value,omitempty"` // of a number, or a script's MaxDepth
+	Args  []Node `json:"args,omitempty"`  // operands or arguments
+}
+
+// NewDocument returns the portable form of e.
+func NewDocument(e Expr) Document {
+	return Document{Version: SchemaVersion, Expr: newNode(e)}
+}
+
+func newNode(e Expr) Node {
+	kind, name, value, args := Inspect(e)
+	n := Node{Kind: kind.String(), Name: name}
+	switch kind {
+	case NumberKind, ImaginaryKind, QuantityKind:
+		n.Value = strconv.FormatFloat(value, 'g', -1, 64)
+	case ScriptKind:
+		if depth := e.(*Script).MaxDepth; depth != 0 {
+			n.Value = strconv.Itoa(depth)
+		}
+	}
+	for _, arg := range args {
+		n.Args = append(n.Args, newNode(arg))
+	}
+	return n
+}
+
+// Decode returns the expression of d, whose calls are resolved with reg,
+// or DefaultRegistry if nil, and checks it.
+func (d Document) Decode(reg *FuncRegistry) (Expr, error) {
+	if d.Version != SchemaVersion {
+		return nil, fmt.Errorf("unsupported schema version %d, want %d", d.Version, SchemaVersion)
+	}
+	if reg == nil {
+		reg = DefaultRegistry
+	}
+	e, err := d.Expr.expr(reg)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.Check(map[Var]bool{}); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// nodeOperands are the numbers of operands of the kinds of nodes other
+// than calls.
+var nodeOperands = map[string]int{
+	"var": 0, "number": 0, "imaginary": 0, "quantity": 0, "script": 0,
+	"unary": 1, "binary": 2, "conditional": 3,
+}
+
+func (n Node) expr(reg *FuncRegistry) (Expr, error) {
+	var value float64
+	switch n.Kind {
+	case "number", "imaginary", "quantity":
+		var err error
+		if value, err = strconv.ParseFloat(n.Value, 64); err != nil {
+			return nil, fmt.Errorf("%s node: bad value %q", n.Kind, n.Value)
+		}
+	}
+	args := make([]Expr, len(n.Args))
+	for i, arg := range n.Args {
+		var err error
+		if args[i], err = arg.expr(reg); err != nil {
+			return nil, err
+		}
+	}
+	if k, ok := nodeOperands[n.Kind]; ok && len(args) != k {
+		return nil, fmt.Errorf("%s node %s has %d operands, want %d", n.Kind, n.Name, len(args), k)
+	}
+
+	switch n.Kind {
+	case "var":
+		if !isIdent(n.Name) {
+			return nil, fmt.Errorf("var node: bad name %q", n.Name)
+		}
+		return Var(n.Name), nil
+	case "number":
+		return literal(value), nil
+	case "imaginary":
+		return imaginary(value), nil
+	case "quantity":
+		e, err := Quantity(value, n.Name)
+		if err != nil {
+			return nil, fmt.Errorf("quantity node: %v", err)
+		}
+		return e, nil
+	case "unary":
+		op, ok := unaryOpRune(n.Name)
+		if !ok {
+			return nil, fmt.Errorf("unary node: bad operator %q", n.Name)
+		}
+		return unary{op, args[0]}, nil
+	case "binary":
+		op, ok := binaryOpRune(n.Name)
+		if !ok {
+			return nil, fmt.Errorf("binary node: bad operator %q", n.Name)
+		}
+		return binary{op, args[0], args[1]}, nil
+	case "conditional":
+		return ternary{args[0], args[1], args[2]}, nil
+	case "call":
+		if !isIdent(n.Name) {
+			return nil, fmt.Errorf("call node: bad function name %q", n.Name)
+		}
+		e := call{fn: n.Name, args: args}
+		if reg != DefaultRegistry {
+			e.reg = reg
+		}
+		return e, nil
+	case "script":
+		e, err := ParseWith(n.Name, reg)
+		if err != nil {
+			return nil, fmt.Errorf("script node: %v", err)
+		}
+		s, ok := e.(*Script)
+		if !ok {
+			return nil, fmt.Errorf("script node: %q is not a script", n.Name)
+		}
+		if n.Value != "" {
+			if s.MaxDepth, err = strconv.Atoi(n.Value); err != nil {
+				return nil, fmt.Errorf("script node: bad MaxDepth %q", n.Value)
+			}
+		}
+		return s, nil
+	}
+	return nil, fmt.Errorf("unknown node kind %q", n.Kind)
+}
+
+// isIdent reports whether s is an identifier, as Parse reads them.
+func isIdent(s string) bool {
+	for i, r := range s {
+		if !(r == '_' || unicode.IsLetter(r) || i > 0 && unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// ---- JSON and S-expressions ----
+
+// A JSONExpr holds an Expr for encoding/json, which encodes it as its
+// Document. Decoding resolves calls with DefaultRegistry and checks the
+// expression; decode a Document to use another registry.
+type JSONExpr struct{ Expr }
+
+func (j JSONExpr) MarshalJSON() ([]byte, error) {
+	return json.Marshal(NewDocument(j.Expr))
+}
+
+func (j *JSONExpr) UnmarshalJSON(data []byte) error {
+	var d Document
+	if err := json.Unmarshal(data, &d); err != nil {
+		return err
+	}
+	e, err := d.Decode(nil)
+	if err != nil {
+		return err
+	}
+	j.Expr = e
+	return nil
+}
+
+// MarshalSexpr encodes e as its Document in S-expression form, e.g.,
+//
+//	((Version 1) (Expr ((Kind "unary") (Name "-") (Value "") (Args (((Kind "var") (Name "x") (Value "") (Args ())))))))
+func MarshalSexpr(e Expr) ([]byte, error) {
+	return sexpr.Marshal(NewDocument(e))
+}
+
+// UnmarshalSexpr decodes an expression encoded by MarshalSexpr,
+// resolving its calls with reg, or DefaultRegistry if nil, and checks it.
+func UnmarshalSexpr(data []byte, reg *FuncRegistry) (Expr, error) {
+	var d Document
+	if err := sexpr.Unmarshal(data, &d); err != nil {
+		return nil, err
+	}
+	return d.Decode(reg)
+}
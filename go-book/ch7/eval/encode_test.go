@@ -0,0 +1,213 @@
+package eval
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestConstructors(t *testing.T) {
+	kmh, err := Quantity(5, "km/h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		expr Expr
+		want string
+	}{
+		{Binary("+", Var("x"), Number(1)), "(x + 1)"},
+		{Binary("<=", Unary("-", Var("x")), Imaginary(2)), "((-x) <= 2i)"},
+		{Conditional(Binary("&&", Var("a"), Var("b")), Call("sin", Var("x")), Number(-0.5)), "((a && b) ? sin(x) : -0.5)"},
+		{Call("max", Number(1), Var("y"), kmh), "max(1, y, 5 km/h)"},
+	} {
+		if got := Format(test.expr); got != test.want {
+			t.Errorf("Format = %s, want %s", got, test.want)
+		}
+	}
+
+	if _, err := Quantity(1, "parsec"); err == nil || !strings.Contains(err.Error(), "unknown unit parsec") {
+		t.Errorf(`Quantity(1, "parsec") error = %v, want unknown unit`, err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf(`Binary("=", ...) did not panic`)
+		}
+	}()
+	Binary("=", Var("x"), Var("y"))
+}
+
+// rebuild returns a copy of e built from its parts by the constructors.
+func rebuild(e Expr) Expr {
+	kind, name, value, args := Inspect(e)
+	for i, arg := range args {
+		args[i] = rebuild(arg)
+	}
+	switch kind {
+	case VarKind:
+		return Var(name)
+	case NumberKind:
+		return Number(value)
+	case ImaginaryKind:
+		return Imaginary(value)
+	case QuantityKind:
+		q, err := Quantity(value, name)
+		if err != nil {
+			panic(err)
+		}
+		return q
+	case UnaryKind:
+		return Unary(name, args[0])
+	case BinaryKind:
+		return Binary(name, args[0], args[1])
+	case ConditionalKind:
+		return Conditional(args[0], args[1], args[2])
+	case CallKind:
+		return Call(name, args...)
+	}
+	e, err := Parse(name) // ScriptKind
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+func TestInspect(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		expr := randomExpr(rng, 4)
+		if got, want := Format(rebuild(expr)), Format(expr); got != want {
+			t.Errorf("rebuild(%s) = %s", want, got)
+		}
+	}
+	if kind, name, _, args := Inspect(mustParse(t, "x >= 2")); kind != BinaryKind || name != ">=" || len(args) != 2 {
+		t.Errorf("Inspect(x >= 2) = %v, %q, %d args", kind, name, len(args))
+	}
+}
+
+func TestJSON(t *testing.T) {
+	expr := mustParse(t, "-x + sin(0.1) * 5 km/h")
+	data, err := json.Marshal(JSONExpr{expr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `{"version":1,"expr":{"kind":"binary","name":"+","args":[` +
+		`{"kind":"unary","name":"-","args":[{"kind":"var","name":"x"}]},` +
+		`{"kind":"binary","name":"*","args":[{"kind":"call","name":"sin","args":[{"kind":"number","value":"0.1"}]},` +
+		`{"kind":"quantity","name":"km/h","value":"5"}]}]}}`
+	if string(data) != want {
+		t.Errorf("json.Marshal(%s) =\n%s, want\n%s", Format(expr), data, want)
+	}
+
+	// Round trips, also as a field.
+	type formula struct {
+		Name string
+		Expr JSONExpr
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		expr := randomExpr(rng, 4)
+		if expr.Check(map[Var]bool{}) != nil {
+			continue
+		}
+		data, err := json.Marshal(formula{"f", JSONExpr{expr}})
+		if err != nil {
+			t.Fatalf("json.Marshal(%s): %v", Format(expr), err)
+		}
+		var f formula
+		if err := json.Unmarshal(data, &f); err != nil {
+			t.Errorf("json.Unmarshal(%s): %v", data, err)
+		} else if got, want := Format(f.Expr.Expr), Format(expr); got != want {
+			t.Errorf("json.Unmarshal(json.Marshal(%s)) = %s", want, got)
+		}
+	}
+
+	script := mustParse(t, "f(n) = n <= 1 ? 1 : n * f(n - 1); f(5)").(*Script)
+	script.MaxDepth = 10
+	data, err = json.Marshal(JSONExpr{script})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var j JSONExpr
+	if err := json.Unmarshal(data, &j); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := j.Expr.(*Script); !ok || got.MaxDepth != 10 || got.Eval(nil) != 120 {
+		t.Errorf("json.Unmarshal(%s) = %s", data, Format(j.Expr))
+	}
+}
+
+func TestSexpr(t *testing.T) {
+	expr := mustParse(t, "-x")
+	data, err := MarshalSexpr(expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `((Version 1) (Expr ((Kind "unary") (Name "-") (Value "") ` +
+		`(Args (((Kind "var") (Name "x") (Value "") (Args ())))))))`
+	if string(data) != want {
+		t.Errorf("MarshalSexpr(-x) =\n%s, want\n%s", data, want)
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		expr := randomExpr(rng, 4)
+		if expr.Check(map[Var]bool{}) != nil {
+			continue
+		}
+		data, err := MarshalSexpr(expr)
+		if err != nil {
+			t.Fatalf("MarshalSexpr(%s): %v", Format(expr), err)
+		}
+		got, err := UnmarshalSexpr(data, nil)
+		if err != nil {
+			t.Errorf("UnmarshalSexpr(%s): %v", data, err)
+		} else if Format(got) != Format(expr) {
+			t.Errorf("UnmarshalSexpr(MarshalSexpr(%s)) = %s", Format(expr), Format(got))
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	num := func(s string) Node { return Node{Kind: "number", Value: s} }
+	x := Node{Kind: "var", Name: "x"}
+	for _, test := range []struct {
+		doc  Document
+		want string
+	}{
+		{Document{2, x}, "unsupported schema version 2, want 1"},
+		{Document{1, Node{Kind: "lambda"}}, `unknown node kind "lambda"`},
+		{Document{1, Node{Kind: "var", Name: "1x"}}, `var node: bad name "1x"`},
+		{Document{1, num("one")}, `number node: bad value "one"`},
+		{Document{1, Node{Kind: "binary", Name: "=", Args: []Node{x, x}}}, `binary node: bad operator "="`},
+		{Document{1, Node{Kind: "binary", Name: "+", Args: []Node{x}}}, "binary node + has 1 operands, want 2"},
+		{Document{1, Node{Kind: "call", Name: "sinh", Args: []Node{x, x}}}, "call to sinh has 2 args, want 1"},
+		{Document{1, Node{Kind: "call", Name: "twice", Args: []Node{x}}}, `unknown function "twice"`},
+		{Document{1, Node{Kind: "quantity", Name: "m/parsec", Value: "1"}}, `quantity node: unit "m/parsec": 1:3: unknown unit parsec`},
+		{Document{1, Node{Kind: "binary", Name: "+", Args: []Node{num("2"), {Kind: "quantity", Name: "m", Value: "1"}}}},
+			"(2 + 1 m): incompatible dimensions 1 and m"},
+		{Document{1, Node{Kind: "script", Name: "x + 1"}}, `script node: "x + 1" is not a script`},
+	} {
+		_, err := test.doc.Decode(nil)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("Decode(%+v): got error %v, want %s", test.doc, err, test.want)
+		}
+	}
+
+	// Calls are resolved with the registry of Decode.
+	reg := DefaultRegistry.Clone()
+	reg.Register1("twice", func(x float64) float64 { return 2 * x })
+	doc := Document{1, Node{Kind: "call", Name: "twice", Args: []Node{num("21")}}}
+	if e, err := doc.Decode(reg); err != nil || e.Eval(nil) != 42 {
+		t.Errorf("Decode(twice(21)) with twice = %v, %v", e, err)
+	}
+
+	if _, err := UnmarshalSexpr([]byte(`((Version 1) (Expr ((Kind "number") (Value "1e"`), nil); err == nil {
+		t.Errorf("UnmarshalSexpr of truncated input succeeded")
+	}
+	var j JSONExpr
+	if err := json.Unmarshal([]byte(`{"version":1,"expr":{"kind":"number","value":"NaN"}}`), &j); err != nil || !math.IsNaN(j.Eval(nil)) {
+		t.Errorf("json.Unmarshal(NaN) = %v, %v", j.Expr, err)
+	}
+}
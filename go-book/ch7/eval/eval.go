@@ -27,6 +27,11 @@ func (l literal) Eval(_ Env) float64 {
 	return float64(l)
 }
 
+// Eval returns NaN: an imaginary number has no real value.
+func (imaginary) Eval(_ Env) float64 {
+	return math.NaN()
+}
+
 //!-Eval1
 
 //!+Eval2
@@ -37,34 +42,74 @@ func (u unary) Eval(env Env) float64 {
 		return +u.x.Eval(env)
 	case '-':
 		return -u.x.Eval(env)
+	case '!':
+		return truth(u.x.Eval(env) == 0)
 	}
 	panic(fmt.Sprintf("unsupported unary operator: %q", u.op))
 }
 
 func (b binary) Eval(env Env) float64 {
+	switch b.op {
+	case opAND:
+		return truth(b.x.Eval(env) != 0 && b.y.Eval(env) != 0)
+	case opOR:
+		return truth(b.x.Eval(env) != 0 || b.y.Eval(env) != 0)
+	}
+	x, y := b.x.Eval(env), b.y.Eval(env)
 	switch b.op {
 	case '+':
-		return b.x.Eval(env) + b.y.Eval(env)
+		return x + y
 	case '-':
-		return b.x.Eval(env) - b.y.Eval(env)
+		return x - y
 	case '*':
-		return b.x.Eval(env) * b.y.Eval(env)
+		return x * y
 	case '/':
-		return b.x.Eval(env) / b.y.Eval(env)
+		return x / y
+	case '%':
+		return math.Mod(x, y)
+	case '^':
+		return math.Pow(x, y)
+	case '<':
+		return truth(x < y)
+	case opLE:
+		return truth(x <= y)
+	case '>':
+		return truth(x > y)
+	case opGE:
+		return truth(x >= y)
+	case opEQ:
+		return truth(x == y)
+	case opNE:
+		return truth(x != y)
 	}
 	panic(fmt.Sprintf("unsupported binary operator: %q", b.op))
 }
 
+func (t ternary) Eval(env Env) float64 {
+	if t.cond.Eval(env) != 0 {
+		return t.x.Eval(env)
+	}
+	return t.y.Eval(env)
+}
+
+// truth returns the value of a condition: 1 if true, 0 if false.
+func truth(cond bool) float64 {
+	if cond {
+		return 1
+	}
+	return 0
+}
+
 func (c call) Eval(env Env) float64 {
-	switch c.fn {
-	case "pow":
-		return math.Pow(c.args[0].Eval(env), c.args[1].Eval(env))
-	case "sin":
-		return math.Sin(c.args[0].Eval(env))
-	case "sqrt":
-		return math.Sqrt(c.args[0].Eval(env))
+	f, ok := c.registry().Lookup(c.fn)
+	if !ok {
+		panic(fmt.Sprintf("unsupported function call: %s", c.fn))
+	}
+	args := make([]float64, len(c.args))
+	for i, arg := range c.args {
+		args[i] = arg.Eval(env)
 	}
-	panic(fmt.Sprintf("unsupported function call: %s", c.fn))
+	return f.Impl(args)
 }
 
 //!-Eval2
@@ -77,11 +77,11 @@ pow(x, 3) + pow(y, 3)
 
 func TestErrors(t *testing.T) {
 	for _, test := range []struct{ expr, wantErr string }{
-		{"x % 2", "unexpected '%'"},
-		{"math.Pi", "unexpected '.'"},
-		{"!true", "unexpected '!'"},
-		{`"hello"`, "unexpected '\"'"},
-		{"log(10)", `unknown function "log"`},
+		{"x = 2", "1:6: script has no result"},
+		{"math.Pi", "1:5: unexpected '.'"},
+		{"x & y", "1:3: unexpected '&'"},
+		{`"hello"`, "1:1: unexpected '\"'"},
+		{"foo(10)", `unknown function "foo"`},
 		{"sqrt(1, 2)", "call to sqrt has 2 args, want 1"},
 	} {
 		expr, err := Parse(test.expr)
@@ -102,12 +102,12 @@ func TestErrors(t *testing.T) {
 
 /*
 //!+errors
-x % 2               unexpected '%'
-math.Pi             unexpected '.'
-!true               unexpected '!'
-"hello"             unexpected '"'
+x = 2               1:6: script has no result
+math.Pi             1:5: unexpected '.'
+x & y               1:3: unexpected '&'
+"hello"             1:1: unexpected '"'
 
-log(10)             unknown function "log"
+foo(10)             unknown function "foo"
 sqrt(1, 2)          call to sqrt has 2 args, want 1
 //!-errors
 */
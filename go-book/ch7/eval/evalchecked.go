@@ -0,0 +1,130 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// An EvalError reports why an expression could not be evaluated.
+type EvalError struct {
+	Expr Expr // the subexpression that failed
+	Msg  string
+}
+
+func (e *EvalError) Error() string {
+	return fmt.Sprintf("%s: %s", Format(e.Expr), e.Msg)
+}
+
+func (v Var) EvalChecked(env Env) (float64, error) {
+	x, ok := env[v]
+	if !ok {
+		return 0, &EvalError{v, "undefined variable"}
+	}
+	return x, nil
+}
+
+func (l literal) EvalChecked(_ Env) (float64, error) {
+	return float64(l), nil
+}
+
+func (im imaginary) EvalChecked(_ Env) (float64, error) {
+	return 0, &EvalError{im, "imaginary number in real expression"}
+}
+
+func (u unary) EvalChecked(env Env) (float64, error) {
+	if u.op != '+' && u.op != '-' && u.op != '!' {
+		return 0, &EvalError{u, fmt.Sprintf("unsupported unary operator: %q", u.op)}
+	}
+	x, err := u.x.EvalChecked(env)
+	if err != nil {
+		return 0, err
+	}
+	return unary{u.op, literal(x)}.Eval(nil), nil
+}
+
+func (b binary) EvalChecked(env Env) (float64, error) {
+	if !strings.ContainsRune("+-*/%^<>", b.op) && opNames[b.op] == "" {
+		return 0, &EvalError{b, fmt.Sprintf("unsupported binary operator: %q", b.op)}
+	}
+	x, err := b.x.EvalChecked(env)
+	if err != nil {
+		return 0, err
+	}
+	switch b.op {
+	case opAND, opOR:
+		if (x != 0) == (b.op == opOR) {
+			return truth(x != 0), nil // y is not needed
+		}
+		y, err := b.y.EvalChecked(env)
+		if err != nil {
+			return 0, err
+		}
+		return truth(y != 0), nil
+	}
+	y, err := b.y.EvalChecked(env)
+	if err != nil {
+		return 0, err
+	}
+	if (b.op == '/' || b.op == '%') && y == 0 {
+		return 0, &EvalError{b, "division by zero"}
+	}
+	z := binary{b.op, literal(x), literal(y)}.Eval(nil)
+	if strings.ContainsRune("+-*/%^", b.op) { // arithmetic, not comparison
+		if err := checkResult(b, z, x, y); err != nil {
+			return 0, err
+		}
+	}
+	return z, nil
+}
+
+func (t ternary) EvalChecked(env Env) (float64, error) {
+	cond, err := t.cond.EvalChecked(env)
+	if err != nil {
+		return 0, err
+	}
+	if cond != 0 {
+		return t.x.EvalChecked(env)
+	}
+	return t.y.EvalChecked(env)
+}
+
+func (c call) EvalChecked(env Env) (float64, error) {
+	f, ok := c.registry().Lookup(c.fn)
+	if !ok {
+		return 0, &EvalError{c, fmt.Sprintf("unknown function %q", c.fn)}
+	}
+	if err := f.checkArity(len(c.args)); err != nil {
+		return 0, &EvalError{c, err.Error()}
+	}
+	args := make([]float64, len(c.args))
+	for i, arg := range c.args {
+		x, err := arg.EvalChecked(env)
+		if err != nil {
+			return 0, err
+		}
+		args[i] = x
+	}
+	z := f.Impl(args)
+	if err := checkResult(c, z, args...); err != nil {
+		return 0, err
+	}
+	return z, nil
+}
+
+// checkResult reports a NaN result computed from numbers as a domain
+// error, and an infinite one computed from finite numbers as out of range.
+func checkResult(e Expr, z float64, args ...float64) error {
+	nan, inf := false, false
+	for _, x := range args {
+		nan = nan || math.IsNaN(x)
+		inf = inf || math.IsInf(x, 0)
+	}
+	switch {
+	case math.IsNaN(z) && !nan:
+		return &EvalError{e, fmt.Sprintf("argument out of domain %v", args)}
+	case math.IsInf(z, 0) && !nan && !inf:
+		return &EvalError{e, fmt.Sprintf("result out of range for %v", args)}
+	}
+	return nil
+}
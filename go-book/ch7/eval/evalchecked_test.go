@@ -0,0 +1,89 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestEvalChecked(t *testing.T) {
+	tests := []struct {
+		expr string
+		env  Env
+		want string // result, or error
+	}{
+		{"5 / 9 * (F - 32)", Env{"F": 212}, "100"},
+		{"x / y", Env{"x": 1, "y": 0}, "(x / y): division by zero"},
+		{"x % 0", Env{"x": 1}, "(x % 0): division by zero"},
+		{"sqrt(-1)", nil, "sqrt((-1)): argument out of domain [-1]"},
+		{"log(x - 1)", Env{"x": 1}, "log((x - 1)): result out of range for [0]"},
+		{"(-8) ^ 0.5", nil, "((-8) ^ 0.5): argument out of domain [-8 0.5]"},
+		{"x + y", Env{"x": 1}, "y: undefined variable"},
+		{"nosuch(1)", nil, `nosuch(1): unknown function "nosuch"`},
+		{"hypot(1)", nil, "hypot(1): call to hypot has 1 args, want 2"},
+		{"x != 0 && 1 / x > 1", Env{"x": 0}, "0"},
+		{"x == 0 || 1 / x > 1", Env{"x": 0}, "1"},
+		{"x == 0 ? 0 : 1 / x", Env{"x": 0}, "0"},
+		{"x > 0 ? y : 1", Env{"x": 0}, "1"},
+		{"x + y + z", Env{"x": 1, "y": 2, "z": 3}, "6"},
+		{"x * 10", Env{"x": 1e308}, "(x * 10): result out of range for [1e+308 10]"},
+		{"x + x", Env{"x": 1e308}, "(x + x): result out of range for [1e+308 1e+308]"},
+		{"x - y", Env{"x": math.Inf(1), "y": math.Inf(1)}, "(x - y): argument out of domain [+Inf +Inf]"},
+		{"x / y", Env{"x": 1, "y": 1e-320}, "(x / y): result out of range for [1 1e-320]"},
+		{"x + 1", Env{"x": math.Inf(1)}, "+Inf"},
+	}
+	for _, test := range tests {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		var got string
+		if z, err := expr.EvalChecked(test.env); err != nil {
+			got = err.Error()
+		} else {
+			got = fmt.Sprintf("%.6g", z)
+		}
+		if got != test.want {
+			t.Errorf("%s.EvalChecked() in %v = %q, want %q", test.expr, test.env, got, test.want)
+		}
+	}
+}
+
+func TestEvalCheckedOperators(t *testing.T) {
+	for _, test := range []struct {
+		expr Expr
+		want string
+	}{
+		{unary{'~', literal(1)}, "(~1): unsupported unary operator: '~'"},
+		{binary{'#', literal(1), literal(2)}, "(1 # 2): unsupported binary operator: '#'"},
+		{binary{'+', literal(1), binary{'#', Var("x"), literal(2)}}, "(x # 2): unsupported binary operator: '#'"},
+	} {
+		if _, err := test.expr.EvalChecked(Env{"x": 1}); err == nil || err.Error() != test.want {
+			t.Errorf("%s.EvalChecked() = %v, want %s", Format(test.expr), err, test.want)
+		}
+	}
+
+	// Each node is checked once: a long sum takes linear time.
+	var sum Expr = Var("x")
+	for i := 0; i < 5000; i++ {
+		sum = binary{'+', sum, Var("x")}
+	}
+	if got, err := sum.EvalChecked(Env{"x": 1}); err != nil || got != 5001 {
+		t.Errorf("sum of 5001 x = %g, %v", got, err)
+	}
+}
+
+func TestParseErrorSnippet(t *testing.T) {
+	_, err := Parse("1 +\n\tpow(x, 2) $ 3")
+	perr, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("Parse error is %T, want *ParseError", err)
+	}
+	if got, want := perr.Error(), "2:12: unexpected '$'"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if got, want := perr.Snippet(), "\tpow(x, 2) $ 3\n\t          ^"; got != want {
+		t.Errorf("Snippet() = %q, want %q", got, want)
+	}
+}
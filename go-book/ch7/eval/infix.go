@@ -0,0 +1,121 @@
+package eval
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// FormatInfix formats an expression with only the parentheses that Parse
+// needs to read it back as the same expression, e.g., 5 / 9 * (F - 32).
+func FormatInfix(e Expr) string {
+	var buf bytes.Buffer
+	writeInfix(&buf, e, levelTernary)
+	return buf.String()
+}
+
+// The levels of expressions, from loosest to tightest binding. Binary
+// operators other than ^ have the levels of their precedence, 1 to 6.
+const (
+	levelTernary = 0
+	levelUnary   = 7
+	levelPower   = 8
+	levelPrimary = 9
+)
+
+// level returns the level of e: an operand of an operator of a higher
+// level must be parenthesized.
+func level(e Expr) int {
+	switch e := e.(type) {
+	case ternary:
+		return levelTernary
+	case binary:
+		if e.op == '^' {
+			return levelPower
+		}
+		return precedence(e.op)
+	case unary:
+		return levelUnary
+	case literal:
+		return signLevel(float64(e))
+	case imaginary:
+		return signLevel(float64(e))
+	case quantity:
+		return signLevel(float64(e.x))
+	}
+	return levelPrimary // Var, call, apply
+}
+
+// signLevel returns the level of a number: negative numbers print with
+// a unary minus.
+func signLevel(x float64) int {
+	if x < 0 {
+		return levelUnary
+	}
+	return levelPrimary
+}
+
+// writeInfix writes e, parenthesized if its level is below min.
+func writeInfix(buf *bytes.Buffer, e Expr, min int) {
+	if level(e) < min {
+		buf.WriteByte('(')
+		defer buf.WriteByte(')')
+	}
+	switch e := e.(type) {
+	case unary:
+		buf.WriteRune(e.op)
+		var x bytes.Buffer
+		writeInfix(&x, e.x, levelUnary)
+		if s := x.String(); strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+			buf.WriteByte(' ') // - -x, not --x
+		}
+		buf.Write(x.Bytes())
+
+	case binary:
+		if e.op == '^' {
+			// The base is a primary, the exponent a unary: -x^2 is
+			// -(x^2), and x^y^z is x^(y^z).
+			writeInfix(buf, e.x, levelPrimary)
+			buf.WriteString(" ^ ")
+			writeInfix(buf, e.y, levelUnary)
+			break
+		}
+		prec := precedence(e.op) // left associative
+		writeInfix(buf, e.x, prec)
+		fmt.Fprintf(buf, " %s ", opName(e.op))
+		writeInfix(buf, e.y, prec+1)
+
+	case ternary:
+		writeInfix(buf, e.cond, levelTernary+1)
+		buf.WriteString(" ? ")
+		writeInfix(buf, e.x, levelTernary)
+		buf.WriteString(" : ")
+		writeInfix(buf, e.y, levelTernary)
+
+	case call:
+		fmt.Fprintf(buf, "%s(", e.fn)
+		for i, arg := range e.args {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			writeInfix(buf, arg, levelTernary)
+		}
+		buf.WriteByte(')')
+
+	case apply:
+		writeInfix(buf, call{fn: e.def.name, args: e.args}, min)
+
+	case *Script:
+		for _, stmt := range e.stmts {
+			lhs, rhs := stmt.sides()
+			writeInfix(buf, lhs, levelTernary)
+			buf.WriteString(" = ")
+			writeInfix(buf, rhs, levelTernary)
+			buf.WriteString("; ")
+		}
+		writeInfix(buf, e.result, levelTernary)
+
+	default: // Var, literal, imaginary, quantity
+		write(buf, e)
+	}
+}
@@ -0,0 +1,142 @@
+package eval
+
+import (
+	"encoding/xml"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestFormatInfix(t *testing.T) {
+	for _, test := range []struct{ expr, want string }{
+		{"5 / 9 * (F - 32)", "5 / 9 * (F - 32)"},
+		{"((x + y) + z)", "x + y + z"},
+		{"x + (y + z)", "x + (y + z)"},
+		{"x - (y - z)", "x - (y - z)"},
+		{"(x * y) / z", "x * y / z"},
+		{"x / (y * z)", "x / (y * z)"},
+		{"-x ^ 2", "-x ^ 2"},
+		{"(-x) ^ 2", "(-x) ^ 2"},
+		{"x ^ y ^ z", "x ^ y ^ z"},
+		{"(x ^ y) ^ z", "(x ^ y) ^ z"},
+		{"x ^ -y", "x ^ -y"},
+		{"-(-x)", "- -x"},
+		{"!(x < y) || x == y && y != 0", "!(x < y) || x == y && y != 0"},
+		{"(x || y) && z", "(x || y) && z"},
+		{"(a ? b : c) ? d : e", "(a ? b : c) ? d : e"},
+		{"a ? b : (c ? d : e)", "a ? b : c ? d : e"},
+		{"if(x > 0, x, -x) + 1", "(x > 0 ? x : -x) + 1"},
+		{"pow(x, (2))", "pow(x, 2)"},
+		{"(3 m) ^ 2 / (2 s)", "3 m ^ 2 / 2 s"},
+		{"(-40 degC) ^ 2", "(-40 degC) ^ 2"},
+		{"f(x) = (x * x); f(2 + 1)", "f(x) = x * x; f(2 + 1)"},
+	} {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if got := FormatInfix(expr); got != test.want {
+			t.Errorf("FormatInfix(%s) = %s, want %s", test.expr, got, test.want)
+		}
+	}
+}
+
+// randomExpr returns a random expression of at most the given depth, of
+// the kinds of nodes that Parse returns.
+func randomExpr(rng *rand.Rand, depth int) Expr {
+	leaves := []string{"x", "y", "pi", "theta_1", "0", "2", "0.5", "1e+10", "3i", "5 km/h"}
+	if depth == 0 || rng.Intn(4) == 0 {
+		expr, err := Parse(leaves[rng.Intn(len(leaves))])
+		if err != nil {
+			panic(err)
+		}
+		return expr
+	}
+	sub := func() Expr { return randomExpr(rng, depth-1) }
+	switch rng.Intn(10) {
+	case 0:
+		return unary{rune("+-!"[rng.Intn(3)]), sub()}
+	case 1:
+		return ternary{sub(), sub(), sub()}
+	case 2:
+		fns := []string{"sin", "sqrt", "cbrt", "abs", "floor", "log", "pow", "min", "atan2"}
+		fn := fns[rng.Intn(len(fns))]
+		args := []Expr{sub()}
+		if fn == "pow" || fn == "atan2" || fn == "min" {
+			args = append(args, sub())
+		}
+		return call{fn: fn, args: args}
+	}
+	ops := []rune{'+', '-', '*', '/', '%', '^', '<', '>', opLE, opGE, opEQ, opNE, opAND, opOR}
+	return binary{ops[rng.Intn(len(ops))], sub(), sub()}
+}
+
+// TestFormatRoundTrip checks that FormatInfix is read back by Parse as
+// the same expression, and that the LaTeX and MathML are well-formed.
+func TestFormatRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		expr := randomExpr(rng, 5)
+		want := Format(expr)
+		// Parse reads -(5 km/h) as -5 km/h, which formats differently.
+		if expr, err := Parse(want); err != nil {
+			t.Fatalf("Parse(Format(%s)): %v", want, err)
+		} else {
+			want = Format(expr)
+		}
+
+		s := FormatInfix(expr)
+		expr2, err := Parse(s)
+		if err != nil {
+			t.Errorf("Parse(FormatInfix(%s)) = %s: %v", want, s, err)
+			continue
+		}
+		if got := Format(expr2); got != want {
+			t.Errorf("FormatInfix(%s) = %s, which parses as %s", want, s, got)
+		}
+		if len(s) > len(want) {
+			t.Errorf("FormatInfix(%s) = %s is longer", want, s)
+		}
+
+		if tex := FormatLaTeX(expr); !balancedLaTeX(tex) {
+			t.Errorf("FormatLaTeX(%s) = %s is unbalanced", want, tex)
+		}
+		if err := wellFormedXML(FormatMathML(expr)); err != nil {
+			t.Errorf("FormatMathML(%s): %v", want, err)
+		}
+	}
+}
+
+// balancedLaTeX reports whether the braces and \left \right pairs of
+// tex are balanced.
+func balancedLaTeX(tex string) bool {
+	depth := 0
+	for i := 0; i < len(tex); i++ {
+		switch tex[i] {
+		case '\\':
+			i++ // skip escaped character or first letter of command
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth < 0 {
+				return false
+			}
+		}
+	}
+	return depth == 0 && strings.Count(tex, `\left`) == strings.Count(tex, `\right`) &&
+		strings.Count(tex, `\begin`) == strings.Count(tex, `\end`)
+}
+
+func wellFormedXML(s string) error {
+	dec := xml.NewDecoder(strings.NewReader(s))
+	for {
+		if _, err := dec.Token(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
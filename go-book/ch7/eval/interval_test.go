@@ -0,0 +1,204 @@
+package eval
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestEvalInterval(t *testing.T) {
+	env := IntervalEnv{"x": {-1, 2}, "y": {1, 4}, "z": {0, 1}, "n": {-2, -1}, "w": {-1, 0}}
+	for _, test := range []struct {
+		expr   string
+		lo, hi float64
+	}{
+		{"x + y", 0, 6},
+		{"x - y", -5, 1},
+		{"x * y", -4, 8},
+		{"x * x", -2, 4}, // wider than the range of x^2
+		{"x ^ 2", 0, 4},
+		{"x ^ 3", -1, 8},
+		{"n ^ 2", 1, 4},
+		{"y ^ -1", 0.25, 1},
+		{"y ^ 0.5", 1, 2},
+		{"z ^ x", 0, math.Inf(1)},
+		{"2 ^ x", 0.5, 4},
+		{"x / y", -1, 2},
+		{"y / z", 1, math.Inf(1)},
+		{"y / n", -4, -0.5},
+		{"y / x", math.Inf(-1), math.Inf(1)},
+		{"y / 0", math.Inf(1), math.Inf(1)},
+		{"x / 0", math.Inf(-1), math.Inf(1)},
+		{"0 / 0", math.Inf(1), math.Inf(-1)},
+		{"y % 3", 0, 3},
+		{"(z + 1) % 3", 1, 2},
+		{"x % 0.5", -0.5, 0.5},
+		{"sqrt(x)", 0, math.Sqrt(2)},
+		{"sqrt(n)", math.Inf(1), math.Inf(-1)},
+		{"log(z)", math.Inf(-1), 0},
+		{"sin(x)", math.Sin(-1), 1},
+		{"sin(y)", math.Sin(4), 1},
+		{"cos(x)", math.Cos(2), 1},
+		{"cos(y * 2)", -1, 1},
+		{"sin(z / 2)", 0, math.Sin(0.5)},
+		{"tan(z)", 0, math.Tan(1)},
+		{"tan(y)", math.Inf(-1), math.Inf(1)},
+		{"abs(x)", 0, 2},
+		{"floor(x * 1.5)", -2, 3},
+		{"gamma(y)", 0.8856031944108, 6},
+		{"gamma(acos(0))", math.Gamma(math.Pi / 2), math.Gamma(math.Pi / 2)},
+		{"pow(x, 2) + hypot(x, y)", 1, 4 + math.Sqrt(20)},
+		{"atan2(y, x)", math.Atan2(1, 2), math.Atan2(1, -1)},
+		{"atan2(x, n)", -math.Pi, math.Pi},
+		{"atan2(-w, -1)", -math.Pi, math.Pi}, // -w is [-0, 1]
+		{"min(x, y)", -1, 2},
+		{"max(x, n, 0)", 0, 2},
+		{"x < y", 0, 1},
+		{"n < y", 1, 1},
+		{"y <= n", 0, 0},
+		{"z == 5 || y > 0", 1, 1},
+		{"!(y > 0) && x", 0, 0},
+		{"x > 5 ? 1/0 : y", 1, 4},
+		{"x > 0 ? y : n", -2, 4},
+		{"2 km + x", 1999, 2002},
+		{"f(t) = t * t + 1; f(y)", 2, 17},
+	} {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		got := EvalInterval(expr, env)
+		if !nearInterval(got, Interval{test.lo, test.hi}) {
+			t.Errorf("EvalInterval(%s) = %v, want [%g, %g]", test.expr, got, test.lo, test.hi)
+		}
+	}
+}
+
+// nearInterval reports whether x is y, widened by rounding.
+func nearInterval(x, y Interval) bool {
+	if x.IsEmpty() || y.IsEmpty() {
+		return x.IsEmpty() && y.IsEmpty()
+	}
+	return x.Lo <= y.Lo && x.Hi >= y.Hi &&
+		(x.Lo == y.Lo || nearTol(x.Lo, y.Lo, 1e-12)) &&
+		(x.Hi == y.Hi || nearTol(x.Hi, y.Hi, 1e-12))
+}
+
+func TestSetInterval(t *testing.T) {
+	reg := DefaultRegistry.Clone()
+	reg.Register1("cube", func(x float64) float64 { return x * x * x })
+	expr, err := ParseWith("cube(x) + cube(2)", reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := IntervalEnv{"x": {-1, 2}}
+	if got := EvalInterval(expr, env); got != Entire {
+		t.Errorf("EvalInterval(cube(x)) without an interval function = %v, want %v", got, Entire)
+	}
+	if err := reg.SetInterval("cube", Increasing(func(x float64) float64 { return x * x * x })); err != nil {
+		t.Fatal(err)
+	}
+	if got := EvalInterval(expr, env); !nearInterval(got, Interval{7, 16}) {
+		t.Errorf("EvalInterval(cube(x) + cube(2)) = %v, want [7, 16]", got)
+	}
+	if _, ok := DefaultRegistry.Lookup("cube"); ok {
+		t.Errorf("Register on a clone changed DefaultRegistry")
+	}
+	if err := reg.SetInterval("nosuch", Decreasing(math.Exp)); err == nil {
+		t.Errorf("SetInterval(nosuch) succeeded")
+	}
+}
+
+// TestEvalIntervalContains checks that the intervals of random
+// expressions contain their values at random points, where EvalChecked
+// reports no error.
+func TestEvalIntervalContains(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	random := func() float64 {
+		switch rng.Intn(4) {
+		case 0:
+			return float64(rng.Intn(7) - 3)
+		case 1:
+			return math.Pi * float64(rng.Intn(5)-2) / 2
+		}
+		return rng.NormFloat64() * 3
+	}
+	for i := 0; i < 3000; i++ {
+		expr := randomExpr(rng, 4)
+		x := Interval{random(), random()}
+		y := Interval{random(), random()}
+		if x.Lo > x.Hi {
+			x.Lo, x.Hi = x.Hi, x.Lo
+		}
+		if y.Lo > y.Hi {
+			y.Lo, y.Hi = y.Hi, y.Lo
+		}
+		theta := Interval{0, 1}
+		z := EvalInterval(expr, IntervalEnv{"x": x, "y": y, "theta_1": theta, "pi": {math.Pi, math.Pi}})
+		for j := 0; j < 20; j++ {
+			env := Env{"pi": math.Pi}
+			for v, r := range map[Var]Interval{"x": x, "y": y, "theta_1": theta} {
+				switch j {
+				case 0:
+					env[v] = r.Lo
+				case 1:
+					env[v] = r.Hi
+				default:
+					env[v] = r.Lo + rng.Float64()*(r.Hi-r.Lo)
+				}
+			}
+			if v, err := expr.EvalChecked(env); err == nil && !z.Contains(v) {
+				t.Errorf("%s = %g in %v, not in EvalInterval = %v", Format(expr), v, env, z)
+				break
+			}
+		}
+	}
+}
+
+// TestFunctionIntervalsContain checks that the interval functions of the
+// functions of one argument contain their values at points of random
+// boxes, from a few units in the last place wide, over which math is not
+// monotonic, to several units.
+func TestFunctionIntervalsContain(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, name := range DefaultRegistry.Names() {
+		f, _ := DefaultRegistry.Lookup(name)
+		if f.interval == nil || f.MinArgs != 1 || f.MaxArgs != 1 {
+			continue
+		}
+		for i := 0; i < 2000; i++ {
+			var lo float64
+			switch rng.Intn(4) {
+			case 0:
+				lo = float64(rng.Intn(9)-4) / 2
+			case 1:
+				lo = rng.Float64()*2 - 1
+			default:
+				lo = rng.NormFloat64() * 4
+			}
+			hi := lo
+			if rng.Intn(2) == 0 {
+				for n := rng.Intn(16); n > 0; n-- {
+					hi = math.Nextafter(hi, math.Inf(+1))
+				}
+			} else {
+				hi += rng.Float64() * 4
+			}
+			z := f.interval([]Interval{{lo, hi}})
+			for j := 0; j < 20; j++ {
+				v := lo + rng.Float64()*(hi-lo)
+				switch j {
+				case 0:
+					v = lo
+				case 1:
+					v = hi
+				}
+				if y := f.Impl([]float64{v}); !math.IsNaN(y) && !z.Contains(y) {
+					t.Errorf("%s(%v) = %v, not in %s([%v, %v]) = %v", name, v, y, name, lo, hi, z)
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package eval
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestOperators(t *testing.T) {
+	tests := []struct {
+		expr string
+		env  Env
+		want string
+	}{
+		{"2 ^ 3 ^ 2", nil, "512"}, // right associative
+		{"-2 ^ 2", nil, "-4"},     // ^ binds tighter than unary minus
+		{"2 ^ -1", nil, "0.5"},
+		{"2 * 3 ^ 2", nil, "18"},
+		{"7 % 3 + 1", nil, "2"},
+		{"-7 % 3", nil, "-1"},
+		{"x < y", Env{"x": 1, "y": 2}, "1"},
+		{"x <= y", Env{"x": 2, "y": 2}, "1"},
+		{"x > y", Env{"x": 1, "y": 2}, "0"},
+		{"x >= y", Env{"x": 1, "y": 2}, "0"},
+		{"x == y", Env{"x": 2, "y": 2}, "1"},
+		{"x != y", Env{"x": 2, "y": 2}, "0"},
+		{"1 + 1 == 2", nil, "1"},
+		{"x > 0 && x < 10", Env{"x": 5}, "1"},
+		{"x < 0 || x > 10", Env{"x": 5}, "0"},
+		{"!x", Env{"x": 5}, "0"},
+		{"!x + 1", Env{"x": 0}, "2"},
+		{"0 || 1 && 0", nil, "0"}, // && before ||
+		{"x > 0 ? x : -x", Env{"x": -3}, "3"},
+		{"x > 0 ? 1 : x < 0 ? -1 : 0", Env{"x": 0}, "0"},
+		{"if(x > 0, sqrt(x), 0)", Env{"x": 16}, "4"},
+		{"max(x > 1 ? 2 : 3, 1)", Env{"x": 5}, "2"},
+	}
+	for _, test := range tests {
+		expr, err := Parse(test.expr)
+		if err == nil {
+			err = expr.Check(map[Var]bool{})
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		got := fmt.Sprintf("%.6g", expr.Eval(test.env))
+		if got != test.want {
+			t.Errorf("%s.Eval() in %v = %q, want %q", test.expr, test.env, got, test.want)
+		}
+
+		// Format must print an expression that parses to the same value.
+		expr2, err := Parse(Format(expr))
+		if err != nil {
+			t.Errorf("%s: Parse(%s): %v", test.expr, Format(expr), err)
+			continue
+		}
+		if got2 := fmt.Sprintf("%.6g", expr2.Eval(test.env)); got2 != got {
+			t.Errorf("%s: Format = %s evaluates to %s, want %s", test.expr, Format(expr), got2, got)
+		}
+	}
+}
+
+func TestShortCircuit(t *testing.T) {
+	// undefined is not a registered function, evaluating it would panic.
+	for _, input := range []string{
+		"0 && undefined(1)",
+		"1 || undefined(1)",
+		"1 ? 2 : undefined(1)",
+		"0 ? undefined(1) : 2",
+		"if(0, undefined(1), 2)",
+	} {
+		expr, err := Parse(input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+		func() {
+			defer func() {
+				if x := recover(); x != nil {
+					t.Errorf("%s: operand was evaluated: %v", input, x)
+				}
+			}()
+			expr.Eval(nil)
+		}()
+	}
+}
+
+func TestOperatorErrors(t *testing.T) {
+	for _, test := range []struct{ expr, wantErr string }{
+		{"x ? 1", "1:6: got end of file, want ':'"},
+		{"if(x, 1)", "1:1: call to if has 2 args, want 3"},
+		{"x <= <= y", "1:6: unexpected '<='"},
+		{"x | y", "1:3: unexpected '|'"},
+	} {
+		_, err := Parse(test.expr)
+		if err == nil || err.Error() != test.wantErr {
+			t.Errorf("%s: got error %v, want %s", test.expr, err, test.wantErr)
+		}
+	}
+}
+
+func TestFormatOperators(t *testing.T) {
+	for _, test := range []struct{ expr, want string }{
+		{"a <= b && !c", "((a <= b) && (!c))"},
+		{"a ^ b % c", "((a ^ b) % c)"},
+		{"a ? b : c", "(a ? b : c)"},
+		{"if(a != b, 1, 2)", "((a != b) ? 1 : 2)"},
+	} {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if got := Format(expr); got != test.want {
+			t.Errorf("Format(%s) = %s, want %s", test.expr, got, test.want)
+		}
+	}
+
+	// Negative bases of powers are parenthesized, so that they parse back.
+	x := Var("x")
+	for _, test := range []struct {
+		expr Expr
+		want string
+	}{
+		{Binary("^", Number(-8), x), "((-8) ^ x)"},
+		{Binary("^", Number(8), x), "(8 ^ x)"},
+		{Binary("^", Unary("-", Number(8)), x), "((-8) ^ x)"},
+		{Binary("*", Number(-8), x), "(-8 * x)"},
+	} {
+		got := Format(test.expr)
+		if got != test.want {
+			t.Errorf("Format(%#v) = %s, want %s", test.expr, got, test.want)
+		}
+		parsed, err := Parse(got)
+		if err != nil {
+			t.Errorf("Parse(%s): %v", got, err)
+			continue
+		}
+		env := Env{"x": 3}
+		if a, b := test.expr.Eval(env), parsed.Eval(env); a != b {
+			t.Errorf("%s evaluates to %g, its format to %g", got, a, b)
+		}
+	}
+}
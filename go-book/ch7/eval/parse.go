@@ -15,13 +15,80 @@ import (
 // This lexer is similar to the one described in Chapter 13.
 type lexer struct {
 	scan  scanner.Scanner
-	token rune // current lookahead token
+	token rune          // current lookahead token
+	reg   *FuncRegistry // functions of the calls
+	input string
+	defs  map[string]*funcDef // functions defined by the script so far
+	units *UnitRegistry       // units of quantities
 }
 
-func (lex *lexer) next()        { lex.token = lex.scan.Scan() }
 func (lex *lexer) text() string { return lex.scan.TokenText() }
 
-type lexPanic string
+func (lex *lexer) next() {
+	lex.token = lex.scan.Scan()
+	// combine operators of two characters, e.g., '<' '=' into opLE
+	if op, ok := twoCharOps[[2]rune{lex.token, lex.scan.Peek()}]; ok {
+		pos := lex.scan.Position
+		lex.scan.Next() // invalidates Position
+		lex.scan.Position = pos
+		lex.token = op
+	}
+}
+
+var twoCharOps = map[[2]rune]rune{
+	{'<', '='}: opLE,
+	{'>', '='}: opGE,
+	{'=', '='}: opEQ,
+	{'!', '='}: opNE,
+	{'&', '&'}: opAND,
+	{'|', '|'}: opOR,
+}
+
+// A ParseError reports a syntax error and where it was found.
+type ParseError struct {
+	Pos   scanner.Position // Line and Column of the error, starting at 1
+	Msg   string
+	Input string // the text being parsed
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Pos.Line, e.Pos.Column, e.Msg)
+}
+
+// Snippet returns the line of the input with the error and, below it,
+// a caret pointing at the error column.
+func (e *ParseError) Snippet() string {
+	lines := strings.Split(e.Input, "\n")
+	if e.Pos.Line < 1 || e.Pos.Line > len(lines) {
+		return ""
+	}
+	line := lines[e.Pos.Line-1]
+	var caret strings.Builder
+	for i, r := range []rune(line) {
+		if i >= e.Pos.Column-1 {
+			break
+		}
+		if r == '\t' {
+			caret.WriteRune('\t') // keep the caret aligned
+		} else {
+			caret.WriteRune(' ')
+		}
+	}
+	caret.WriteRune('^')
+	return line + "\n" + caret.String()
+}
+
+// error returns a ParseError at the current token.
+func (lex *lexer) error(msg string) *ParseError {
+	return lex.errorAt(lex.scan.Position, msg)
+}
+
+func (lex *lexer) errorAt(pos scanner.Position, msg string) *ParseError {
+	if !pos.IsValid() {
+		pos = lex.scan.Pos() // at end of file
+	}
+	return &ParseError{Pos: pos, Msg: msg, Input: lex.input}
+}
 
 // describe returns a string describing the current token, for use in errors.
 func (lex *lexer) describe() string {
@@ -33,14 +100,25 @@ func (lex *lexer) describe() string {
 	case scanner.Int, scanner.Float:
 		return fmt.Sprintf("number %s", lex.text())
 	}
+	if name, ok := opNames[lex.token]; ok {
+		return fmt.Sprintf("'%s'", name)
+	}
 	return fmt.Sprintf("%q", rune(lex.token)) // any other rune
 }
 
 func precedence(op rune) int {
 	switch op {
-	case '*', '/':
-		return 2
+	case '*', '/', '%':
+		return 6
 	case '+', '-':
+		return 5
+	case '<', opLE, '>', opGE:
+		return 4
+	case opEQ, opNE:
+		return 3
+	case opAND:
+		return 2
+	case opOR:
 		return 1
 	}
 	return 0
@@ -48,38 +126,76 @@ func precedence(op rune) int {
 
 // ---- parser ----
 
-// Parse parses the input string as an arithmetic expression.
+// Parse parses the input string as an arithmetic expression, or as a
+// Script of definitions followed by one.
 //
 //   expr = num                         a literal number, e.g., 3.14159
+//        | num 'i'                     an imaginary number, e.g., 2i
+//        | num unit                    a quantity, e.g., 5 km/h
 //        | id                          a variable name, e.g., x
 //        | id '(' expr ',' ... ')'     a function call
-//        | '-' expr                    a unary operator (+-)
-//        | expr '+' expr               a binary operator (+-*/)
+//        | 'if' '(' expr ',' expr ',' expr ')'
+//        | '-' expr                    a unary operator (+-!)
+//        | expr '+' expr               a binary operator (+-*/%^ < <= > >= == != && ||)
+//        | expr '?' expr ':' expr      a conditional
+//
+//   script = stmt ';' ... stmt ';' expr    definitions, then the result
+//   stmt   = id '=' expr                   a variable, e.g., a = 2
+//          | id '(' id ',' ... ')' '=' expr   a function, e.g., f(x) = x*x
+//
+// Operators from lowest to highest precedence: ?: (right associative),
+// ||, &&, == !=, < <= > >=, + -, * / %, unary + - !, and ^ (right
+// associative). Comparisons and logical operators yield 1 or 0, and
+// any non-zero value is true. &&, ||, ?: and if evaluate only the
+// operands they need.
+//
+// A unit is a name of DefaultUnits, with SI prefix if any, or names
+// joined by * and / and raised to integer powers with ^, without spaces:
+// 9.8 m/s^2 is a quantity but 9.8 m / s^2 divides by the variable s.
 //
-func Parse(input string) (_ Expr, err error) {
+func Parse(input string) (Expr, error) {
+	return parse(input, DefaultRegistry)
+}
+
+func parse(input string, reg *FuncRegistry) (_ Expr, err error) {
 	defer func() {
 		switch x := recover().(type) {
 		case nil:
 			// no panic
-		case lexPanic:
-			err = fmt.Errorf("%s", x)
+		case *ParseError:
+			err = x
 		default:
 			// unexpected panic: resume state of panic.
 			panic(x)
 		}
 	}()
-	lex := new(lexer)
+	lex := &lexer{reg: reg, input: input, defs: make(map[string]*funcDef), units: DefaultUnits}
 	lex.scan.Init(strings.NewReader(input))
+	lex.scan.Error = func(_ *scanner.Scanner, msg string) { panic(lex.error(msg)) }
 	lex.scan.Mode = scanner.ScanIdents | scanner.ScanInts | scanner.ScanFloats
 	lex.next() // initial lookahead
-	e := parseExpr(lex)
+	e := parseScript(lex)
 	if lex.token != scanner.EOF {
-		return nil, fmt.Errorf("unexpected %s", lex.describe())
+		return nil, lex.error(fmt.Sprintf("unexpected %s", lex.describe()))
 	}
 	return e, nil
 }
 
-func parseExpr(lex *lexer) Expr { return parseBinary(lex, 1) }
+// expr = binary ('?' expr ':' expr)?
+func parseExpr(lex *lexer) Expr {
+	cond := parseBinary(lex, 1)
+	if lex.token != '?' {
+		return cond
+	}
+	lex.next() // consume '?'
+	x := parseExpr(lex)
+	if lex.token != ':' {
+		msg := fmt.Sprintf("got %s, want ':'", lex.describe())
+		panic(lex.error(msg))
+	}
+	lex.next() // consume ':'
+	return ternary{cond, x, parseExpr(lex)}
+}
 
 // binary = unary ('+' binary)*
 // parseBinary stops when it encounters an
@@ -97,24 +213,41 @@ func parseBinary(lex *lexer, prec1 int) Expr {
 	return lhs
 }
 
-// unary = '+' expr | primary
+// unary = '+' expr | power
 func parseUnary(lex *lexer) Expr {
-	if lex.token == '+' || lex.token == '-' {
+	if lex.token == '+' || lex.token == '-' || lex.token == '!' {
 		op := lex.token
-		lex.next() // consume '+' or '-'
-		return unary{op, parseUnary(lex)}
+		lex.next() // consume '+', '-' or '!'
+		x := parseUnary(lex)
+		if q, ok := x.(quantity); ok && op == '-' {
+			// -40 degC is 40 degrees below zero, not minus 40 degC.
+			q.x = -q.x
+			return q
+		}
+		return unary{op, x}
 	}
-	return parsePrimary(lex)
+	return parsePower(lex)
+}
+
+// power = primary ('^' unary)?
+func parsePower(lex *lexer) Expr {
+	lhs := parsePrimary(lex)
+	if lex.token != '^' {
+		return lhs
+	}
+	lex.next() // consume '^'
+	return binary{'^', lhs, parseUnary(lex)}
 }
 
 // primary = id
 //         | id '(' expr ',' ... ',' expr ')'
 //         | num
+//         | num 'i'
 //         | '(' expr ')'
 func parsePrimary(lex *lexer) Expr {
 	switch lex.token {
 	case scanner.Ident:
-		id := lex.text()
+		id, pos := lex.text(), lex.scan.Position
 		lex.next() // consume Ident
 		if lex.token != '(' {
 			return Var(id)
@@ -131,18 +264,38 @@ func parsePrimary(lex *lexer) Expr {
 			}
 			if lex.token != ')' {
 				msg := fmt.Sprintf("got %s, want ')'", lex.describe())
-				panic(lexPanic(msg))
+				panic(lex.error(msg))
 			}
 		}
 		lex.next() // consume ')'
-		return call{id, args}
+		if id == "if" {
+			if len(args) != 3 {
+				msg := fmt.Sprintf("call to if has %d args, want 3", len(args))
+				panic(lex.errorAt(pos, msg))
+			}
+			return ternary{args[0], args[1], args[2]}
+		}
+		if def, ok := lex.defs[id]; ok {
+			return apply{def, args}
+		}
+		return call{fn: id, args: args, reg: lex.reg}
 
 	case scanner.Int, scanner.Float:
 		f, err := strconv.ParseFloat(lex.text(), 64)
 		if err != nil {
-			panic(lexPanic(err.Error()))
+			panic(lex.error(err.Error()))
 		}
+		end := lex.scan.Position.Offset + len(lex.text())
 		lex.next() // consume number
+		if lex.token == scanner.Ident && lex.text() == "i" && lex.scan.Position.Offset == end {
+			lex.next() // consume 'i' right after the number
+			return imaginary(f)
+		}
+		if lex.token == scanner.Ident {
+			if _, ok := lex.units.Lookup(lex.text()); ok {
+				return quantity{literal(f), parseUnit(lex)}
+			}
+		}
 		return literal(f)
 
 	case '(':
@@ -150,11 +303,11 @@ func parsePrimary(lex *lexer) Expr {
 		e := parseExpr(lex)
 		if lex.token != ')' {
 			msg := fmt.Sprintf("got %s, want ')'", lex.describe())
-			panic(lexPanic(msg))
+			panic(lex.error(msg))
 		}
 		lex.next() // consume ')'
 		return e
 	}
 	msg := fmt.Sprintf("unexpected %s", lex.describe())
-	panic(lexPanic(msg))
+	panic(lex.error(msg))
 }
@@ -9,7 +9,7 @@ import (
 )
 
 // Format formats an expression as a string.
-// It does not attempt to remove unnecessary parens.
+// It does not attempt to remove unnecessary parens; FormatInfix does.
 func Format(e Expr) string {
 	var buf bytes.Buffer
 	write(&buf, e)
@@ -21,6 +21,12 @@ func write(buf *bytes.Buffer, e Expr) {
 	case literal:
 		fmt.Fprintf(buf, "%g", e)
 
+	case imaginary:
+		fmt.Fprintf(buf, "%gi", e)
+
+	case quantity:
+		fmt.Fprintf(buf, "%g %s", e.x, e.unit.Name)
+
 	case Var:
 		fmt.Fprintf(buf, "%s", e)
 
@@ -31,8 +37,24 @@ func write(buf *bytes.Buffer, e Expr) {
 
 	case binary:
 		buf.WriteByte('(')
+		if _, ok := e.x.(unary); !ok && e.op == '^' && level(e.x) == levelUnary {
+			// A negative number: -8 ^ x parses as -(8 ^ x).
+			buf.WriteByte('(')
+			write(buf, e.x)
+			buf.WriteByte(')')
+		} else {
+			write(buf, e.x)
+		}
+		fmt.Fprintf(buf, " %s ", opName(e.op))
+		write(buf, e.y)
+		buf.WriteByte(')')
+
+	case ternary:
+		buf.WriteByte('(')
+		write(buf, e.cond)
+		buf.WriteString(" ? ")
 		write(buf, e.x)
-		fmt.Fprintf(buf, " %c ", e.op)
+		buf.WriteString(" : ")
 		write(buf, e.y)
 		buf.WriteByte(')')
 
@@ -46,6 +68,19 @@ func write(buf *bytes.Buffer, e Expr) {
 		}
 		buf.WriteByte(')')
 
+	case apply:
+		write(buf, call{fn: e.def.name, args: e.args})
+
+	case *Script:
+		for _, stmt := range e.stmts {
+			lhs, rhs := stmt.sides()
+			write(buf, lhs)
+			buf.WriteString(" = ")
+			write(buf, rhs)
+			buf.WriteString("; ")
+		}
+		write(buf, e.result)
+
 	default:
 		panic(fmt.Sprintf("unknown Expr: %T", e))
 	}
@@ -0,0 +1,230 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Variadic is the MaxArgs of a Func that accepts any number of arguments
+// from MinArgs on.
+const Variadic = -1
+
+// A Func is a function that can be called from an expression.
+type Func struct {
+	Name    string
+	MinArgs int
+	MaxArgs int // MinArgs for a fixed arity, or Variadic
+	Impl    func(args []float64) float64
+
+	// deriv returns the partial derivative with respect to args[i],
+	// nil if not known; see SetPartials.
+	deriv func(args []Expr, i int) Expr
+
+	// interval returns the range over intervals of the arguments, nil
+	// if not known; see SetInterval.
+	interval func(args []Interval) Interval
+}
+
+// checkArity reports an error if n arguments are not accepted by f.
+func (f *Func) checkArity(n int) error {
+	switch {
+	case f.MaxArgs == Variadic && n < f.MinArgs:
+		return fmt.Errorf("call to %s has %d args, want at least %d",
+			f.Name, n, f.MinArgs)
+	case f.MaxArgs == f.MinArgs && n != f.MinArgs:
+		return fmt.Errorf("call to %s has %d args, want %d",
+			f.Name, n, f.MinArgs)
+	case f.MaxArgs != Variadic && (n < f.MinArgs || n > f.MaxArgs):
+		return fmt.Errorf("call to %s has %d args, want %d to %d",
+			f.Name, n, f.MinArgs, f.MaxArgs)
+	}
+	return nil
+}
+
+// A FuncRegistry holds the functions that expressions may call.
+// Registering functions is not safe while the registry is being used
+// by Check or Eval in other goroutines.
+type FuncRegistry struct {
+	funcs map[string]*Func
+}
+
+// NewFuncRegistry returns an empty registry.
+func NewFuncRegistry() *FuncRegistry {
+	return &FuncRegistry{funcs: make(map[string]*Func)}
+}
+
+// Register adds, or replaces, the function name, accepting from min to
+// max arguments (max may be Variadic).
+func (r *FuncRegistry) Register(name string, min, max int, impl func(args []float64) float64) {
+	if min < 0 || (max != Variadic && max < min) {
+		panic(fmt.Sprintf("eval: invalid arity %d..%d for %s", min, max, name))
+	}
+	r.funcs[name] = &Func{Name: name, MinArgs: min, MaxArgs: max, Impl: impl}
+}
+
+// Register1 adds a function of one argument.
+func (r *FuncRegistry) Register1(name string, f func(float64) float64) {
+	r.Register(name, 1, 1, func(args []float64) float64 { return f(args[0]) })
+}
+
+// Register2 adds a function of two arguments.
+func (r *FuncRegistry) Register2(name string, f func(x, y float64) float64) {
+	r.Register(name, 2, 2, func(args []float64) float64 { return f(args[0], args[1]) })
+}
+
+// Lookup returns the function name, if registered.
+func (r *FuncRegistry) Lookup(name string) (*Func, bool) {
+	f, ok := r.funcs[name]
+	return f, ok
+}
+
+// Names returns the names of the registered functions in order.
+func (r *FuncRegistry) Names() []string {
+	var names []string
+	for name := range r.funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Clone returns a copy of r, so that functions can be added to it
+// without changing r.
+func (r *FuncRegistry) Clone() *FuncRegistry {
+	clone := NewFuncRegistry()
+	for name, f := range r.funcs {
+		clone.funcs[name] = f
+	}
+	return clone
+}
+
+// DefaultRegistry is used by Parse, and by calls without a registry.
+// It holds the functions of the math package, by their lower-case names.
+var DefaultRegistry = newDefaultRegistry()
+
+func newDefaultRegistry() *FuncRegistry {
+	r := NewFuncRegistry()
+	for name, f := range map[string]func(float64) float64{
+		"abs": math.Abs, "acos": math.Acos, "acosh": math.Acosh,
+		"asin": math.Asin, "asinh": math.Asinh, "atan": math.Atan,
+		"atanh": math.Atanh, "cbrt": math.Cbrt, "ceil": math.Ceil,
+		"cos": math.Cos, "cosh": math.Cosh, "erf": math.Erf,
+		"erfc": math.Erfc, "erfcinv": math.Erfcinv, "erfinv": math.Erfinv,
+		"exp": math.Exp, "exp2": math.Exp2, "expm1": math.Expm1,
+		"floor": math.Floor, "gamma": math.Gamma, "j0": math.J0,
+		"j1": math.J1, "log": math.Log, "log10": math.Log10,
+		"log1p": math.Log1p, "log2": math.Log2, "logb": math.Logb,
+		"round": math.Round, "roundtoeven": math.RoundToEven,
+		"sin": math.Sin, "sinh": math.Sinh, "sqrt": math.Sqrt,
+		"tan": math.Tan, "tanh": math.Tanh, "trunc": math.Trunc,
+		"y0": math.Y0, "y1": math.Y1,
+	} {
+		r.Register1(name, f)
+	}
+	for name, f := range map[string]func(x, y float64) float64{
+		"atan2": math.Atan2, "copysign": math.Copysign, "dim": math.Dim,
+		"hypot": math.Hypot, "mod": math.Mod, "nextafter": math.Nextafter,
+		"pow": math.Pow, "remainder": math.Remainder,
+	} {
+		r.Register2(name, f)
+	}
+	r.Register("fma", 3, 3, func(args []float64) float64 {
+		return math.FMA(args[0], args[1], args[2])
+	})
+	r.Register("min", 1, Variadic, func(args []float64) float64 {
+		m := args[0]
+		for _, x := range args[1:] {
+			m = math.Min(m, x)
+		}
+		return m
+	})
+	r.Register("max", 1, Variadic, func(args []float64) float64 {
+		m := args[0]
+		for _, x := range args[1:] {
+			m = math.Max(m, x)
+		}
+		return m
+	})
+	setDefaultPartials(r)
+	setDefaultIntervals(r)
+	return r
+}
+
+// registry returns the registry the call was parsed with.
+func (c call) registry() *FuncRegistry {
+	if c.reg == nil {
+		return DefaultRegistry
+	}
+	return c.reg
+}
+
+// ParseWith is like Parse, but calls are resolved with reg
+// instead of DefaultRegistry.
+func ParseWith(input string, reg *FuncRegistry) (Expr, error) {
+	return parse(input, reg)
+}
+
+// CheckWith is like e.Check, but calls are resolved with reg.
+func CheckWith(e Expr, vars map[Var]bool, reg *FuncRegistry) error {
+	return bind(e, reg).Check(vars)
+}
+
+// EvalWith is like e.Eval, but calls are resolved with reg.
+func EvalWith(e Expr, env Env, reg *FuncRegistry) float64 {
+	return bind(e, reg).Eval(env)
+}
+
+// bind returns a copy of e whose calls are resolved with reg, including
+// those in the statements and functions of scripts, which are copied.
+func bind(e Expr, reg *FuncRegistry) Expr {
+	return bindDefs(e, reg, make(map[*funcDef]*funcDef))
+}
+
+// bindDefs is bind, with defs the copies of the functions bound so far.
+func bindDefs(e Expr, reg *FuncRegistry, defs map[*funcDef]*funcDef) Expr {
+	switch e := e.(type) {
+	case unary:
+		return unary{e.op, bindDefs(e.x, reg, defs)}
+	case binary:
+		return binary{e.op, bindDefs(e.x, reg, defs), bindDefs(e.y, reg, defs)}
+	case ternary:
+		return ternary{bindDefs(e.cond, reg, defs), bindDefs(e.x, reg, defs), bindDefs(e.y, reg, defs)}
+	case call:
+		args := make([]Expr, len(e.args))
+		for i, arg := range e.args {
+			args[i] = bindDefs(arg, reg, defs)
+		}
+		return call{fn: e.fn, args: args, reg: reg}
+	case apply:
+		args := make([]Expr, len(e.args))
+		for i, arg := range e.args {
+			args[i] = bindDefs(arg, reg, defs)
+		}
+		return apply{bindDef(e.def, e.def.script, reg, defs), args}
+	case *Script:
+		s := &Script{MaxDepth: e.MaxDepth}
+		for _, stmt := range e.stmts {
+			if stmt.def != nil {
+				stmt = statement{def: bindDef(stmt.def, s, reg, defs)}
+			} else {
+				stmt.x = bindDefs(stmt.x, reg, defs)
+			}
+			s.stmts = append(s.stmts, stmt)
+		}
+		s.result = bindDefs(e.result, reg, defs)
+		return s
+	}
+	return e // Var, literal, imaginary, quantity
+}
+
+// bindDef returns the copy of def, of the script s, bound to reg.
+func bindDef(def *funcDef, s *Script, reg *FuncRegistry, defs map[*funcDef]*funcDef) *funcDef {
+	if d, ok := defs[def]; ok {
+		return d
+	}
+	d := &funcDef{name: def.name, params: def.params, script: s}
+	defs[def] = d // before the body, which may call it
+	d.body = bindDefs(def.body, reg, defs)
+	return d
+}
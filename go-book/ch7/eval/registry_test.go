@@ -0,0 +1,117 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestDefaultRegistry(t *testing.T) {
+	tests := []struct {
+		expr string
+		env  Env
+		want string
+	}{
+		{"cos(0) + tan(0)", nil, "1"},
+		{"log(exp(x))", Env{"x": 2.5}, "2.5"},
+		{"abs(-3) * floor(2.7)", nil, "6"},
+		{"hypot(3, 4)", nil, "5"},
+		{"atan2(1, 1) * 4", nil, "3.14159"},
+		{"min(x, 2, -1)", Env{"x": 7}, "-1"},
+		{"max(x)", Env{"x": 7}, "7"},
+		{"fma(2, 3, 4)", nil, "10"},
+	}
+	for _, test := range tests {
+		expr, err := Parse(test.expr)
+		if err == nil {
+			err = expr.Check(map[Var]bool{})
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		got := fmt.Sprintf("%.6g", expr.Eval(test.env))
+		if got != test.want {
+			t.Errorf("%s.Eval() in %v = %q, want %q", test.expr, test.env, got, test.want)
+		}
+	}
+}
+
+func TestArityErrors(t *testing.T) {
+	reg := DefaultRegistry.Clone()
+	reg.Register("clamp", 1, 3, func(args []float64) float64 { return args[0] })
+	for _, test := range []struct{ expr, wantErr string }{
+		{"max()", "call to max has 0 args, want at least 1"},
+		{"hypot(1)", "call to hypot has 1 args, want 2"},
+		{"clamp(1, 2, 3, 4)", "call to clamp has 4 args, want 1 to 3"},
+		{"clamp()", "call to clamp has 0 args, want 1 to 3"},
+	} {
+		expr, err := ParseWith(test.expr, reg)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		err = expr.Check(map[Var]bool{})
+		if err == nil || err.Error() != test.wantErr {
+			t.Errorf("%s: got error %v, want %s", test.expr, err, test.wantErr)
+		}
+	}
+}
+
+func TestCustomRegistry(t *testing.T) {
+	reg := NewFuncRegistry()
+	reg.Register("sum", 0, Variadic, func(args []float64) float64 {
+		total := 0.0
+		for _, x := range args {
+			total += x
+		}
+		return total
+	})
+	reg.Register1("twice", func(x float64) float64 { return 2 * x })
+
+	expr, err := ParseWith("twice(sum(x, 1, 2))", reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := expr.Check(map[Var]bool{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := expr.Eval(Env{"x": 3}); got != 12 {
+		t.Errorf("Eval = %g, want 12", got)
+	}
+
+	// The default registry doesn't know sum, but a parsed expression
+	// can be checked and evaluated with another registry.
+	expr, err = Parse("sum(x, sqrt(4))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := expr.Check(map[Var]bool{}); err == nil {
+		t.Errorf("Check with the default registry accepted sum")
+	}
+	reg.Register1("sqrt", math.Sqrt)
+	if err := CheckWith(expr, map[Var]bool{}, reg); err != nil {
+		t.Fatal(err)
+	}
+	if got := EvalWith(expr, Env{"x": 3}, reg); got != 5 {
+		t.Errorf("EvalWith = %g, want 5", got)
+	}
+
+	// So can the functions, statements and calls of a script.
+	expr, err = Parse("f(t) = t < 1 ? sum(t, 1) : f(t - 1); g(u) = sqrt(u); a = sum(x, 2); f(a) + g(sum(2, 2))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := expr.Check(map[Var]bool{}); err == nil {
+		t.Errorf("Check of a script with the default registry accepted sum")
+	}
+	if err := CheckWith(expr, map[Var]bool{}, reg); err != nil {
+		t.Fatal(err)
+	}
+	if got := EvalWith(expr, Env{"x": 0.5}, reg); got != 1.5+2 {
+		t.Errorf("EvalWith of a script = %g, want 3.5", got)
+	}
+	if err := expr.Check(map[Var]bool{}); err == nil {
+		t.Errorf("CheckWith bound the script itself to the registry")
+	}
+}
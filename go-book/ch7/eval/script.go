@@ -0,0 +1,634 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"text/scanner"
+)
+
+// DefaultMaxDepth is the maximum depth of calls of user-defined
+// functions of a Script whose MaxDepth is 0.
+const DefaultMaxDepth = 1000
+
+// A Script is a sequence of statements, separated by semicolons, that
+// define functions and variables, followed by an expression, its result:
+//
+//	f(x, y) = x*x + y; g(t) = f(t, 2*t); g(3)
+//
+// A function may call itself and the functions defined before it. Its
+// parameters hide variables of the same name; other variables are those
+// of the script, defined by the statements evaluated so far, or of the
+// environment. Parse returns a *Script for input with statements.
+type Script struct {
+	stmts  []statement
+	result Expr
+
+	// MaxDepth limits the depth of calls of user-defined functions,
+	// or is 0 for DefaultMaxDepth. Deeper calls are evaluation errors.
+	MaxDepth int
+
+	// The script inlined, once, as the evaluators that know nothing of
+	// scripts, such as EvalComplex, inline it at every evaluation.
+	inlineOnce sync.Once
+	inlined    Expr
+	inlineErr  error
+}
+
+// A statement defines either a function or a variable.
+type statement struct {
+	def *funcDef // a function, or nil
+	v   Var      // or a variable
+	x   Expr     // and its value
+}
+
+// A funcDef is a user-defined function, e.g., f(x, y) = x*x + y.
+type funcDef struct {
+	name   string
+	params []Var
+	body   Expr
+	script *Script
+}
+
+// An apply is a call of a user-defined function, e.g., f(t, 2*t).
+type apply struct {
+	def  *funcDef
+	args []Expr
+}
+
+// script = (stmt ';')* expr ';'?
+// stmt   = id '=' expr
+//
+//	| id '(' id ',' ... ',' id ')' '=' expr
+func parseScript(lex *lexer) Expr {
+	s := &Script{}
+	for {
+		pos := lex.scan.Position
+		e := parseExpr(lex)
+		if lex.token == '=' {
+			lex.next() // consume '='
+			s.stmts = append(s.stmts, parseStatement(lex, s, e, pos))
+		} else {
+			s.result = e
+		}
+		if lex.token != ';' {
+			break
+		}
+		lex.next() // consume ';'
+		if lex.token == scanner.EOF {
+			break
+		}
+		if s.result != nil {
+			msg := fmt.Sprintf("unexpected %s after the result of the script", lex.describe())
+			panic(lex.error(msg))
+		}
+	}
+	if lex.token != scanner.EOF {
+		return s.result // parse reports the unexpected token
+	}
+	if s.result == nil {
+		panic(lex.error("script has no result"))
+	}
+	if len(s.stmts) == 0 {
+		return s.result
+	}
+	return s
+}
+
+// parseStatement parses the definition of lhs, parsed from pos, after
+// the '='.
+func parseStatement(lex *lexer, s *Script, lhs Expr, pos scanner.Position) statement {
+	switch lhs := lhs.(type) {
+	case Var:
+		return statement{v: lhs, x: parseExpr(lex)}
+	case call, apply:
+		var name string
+		var args []Expr
+		if c, ok := lhs.(call); ok {
+			name, args = c.fn, c.args
+		} else {
+			name, args = lhs.(apply).def.name, lhs.(apply).args
+		}
+		if _, ok := lex.defs[name]; ok {
+			panic(lex.errorAt(pos, fmt.Sprintf("redefinition of %s", name)))
+		}
+		def := &funcDef{name: name, script: s}
+		seen := make(map[Var]bool)
+		for _, arg := range args {
+			param, ok := arg.(Var)
+			if !ok || seen[param] {
+				msg := fmt.Sprintf("parameter %s of %s is not a distinct name", Format(arg), name)
+				panic(lex.errorAt(pos, msg))
+			}
+			seen[param] = true
+			def.params = append(def.params, param)
+		}
+		lex.defs[name] = def // before the body, which may call it
+		def.body = parseExpr(lex)
+		return statement{def: def}
+	}
+	panic(lex.errorAt(pos, fmt.Sprintf("cannot define %s", Format(lhs))))
+}
+
+// sides returns the two sides of stmt, e.g., f(x, y) and x*x + y.
+func (stmt statement) sides() (lhs, rhs Expr) {
+	def := stmt.def
+	if def == nil {
+		return stmt.v, stmt.x
+	}
+	params := make([]Expr, len(def.params))
+	for i, p := range def.params {
+		params[i] = p
+	}
+	return call{fn: def.name, args: params}, def.body
+}
+
+func (s *Script) maxDepth() int {
+	if s.MaxDepth == 0 {
+		return DefaultMaxDepth
+	}
+	return s.MaxDepth
+}
+
+// ---- evaluation ----
+
+// A frame evaluates the expressions of scripts: it tracks the depth of
+// calls, and the variables of the script apart from the parameters of
+// the function being evaluated.
+type frame struct {
+	globals Env
+	env     Env // globals and parameters
+	depth   int
+	checked bool // as EvalChecked
+}
+
+func (s *Script) run(env Env, checked bool) (float64, error) {
+	globals := make(Env, len(env))
+	for v, x := range env {
+		globals[v] = x
+	}
+	f := &frame{globals: globals, env: globals, checked: checked}
+	for _, stmt := range s.stmts {
+		if stmt.def == nil {
+			x, err := f.eval(stmt.x)
+			if err != nil {
+				return 0, err
+			}
+			globals[stmt.v] = x
+		}
+	}
+	return f.eval(s.result)
+}
+
+// Eval returns the result of the script, or NaN if calls are deeper
+// than MaxDepth.
+func (s *Script) Eval(env Env) float64 {
+	z, err := s.run(env, false)
+	if err != nil {
+		return math.NaN()
+	}
+	return z
+}
+
+func (s *Script) EvalChecked(env Env) (float64, error) {
+	return s.run(env, true)
+}
+
+func (a apply) Eval(env Env) float64 {
+	f := &frame{globals: env, env: env}
+	z, err := f.eval(a)
+	if err != nil {
+		return math.NaN()
+	}
+	return z
+}
+
+func (a apply) EvalChecked(env Env) (float64, error) {
+	f := &frame{globals: env, env: env, checked: true}
+	return f.eval(a)
+}
+
+func (f *frame) eval(e Expr) (float64, error) {
+	switch e := e.(type) {
+	case Var, literal, imaginary, quantity:
+		return f.value(e, e, f.env)
+
+	case unary:
+		x, err := f.eval(e.x)
+		if err != nil {
+			return 0, err
+		}
+		return f.value(e, unary{e.op, literal(x)}, nil)
+
+	case binary:
+		x, err := f.eval(e.x)
+		if err != nil {
+			return 0, err
+		}
+		if e.op == opAND || e.op == opOR {
+			if (x != 0) == (e.op == opOR) {
+				return truth(x != 0), nil // y is not needed
+			}
+		}
+		y, err := f.eval(e.y)
+		if err != nil {
+			return 0, err
+		}
+		return f.value(e, binary{e.op, literal(x), literal(y)}, nil)
+
+	case ternary:
+		cond, err := f.eval(e.cond)
+		if err != nil {
+			return 0, err
+		}
+		if cond != 0 {
+			return f.eval(e.x)
+		}
+		return f.eval(e.y)
+
+	case call:
+		args := make([]Expr, len(e.args))
+		for i, arg := range e.args {
+			x, err := f.eval(arg)
+			if err != nil {
+				return 0, err
+			}
+			args[i] = literal(x)
+		}
+		return f.value(e, call{fn: e.fn, args: args, reg: e.reg}, nil)
+
+	case apply:
+		def := e.def
+		if len(e.args) != len(def.params) {
+			msg := fmt.Sprintf("call to %s has %d args, want %d", def.name, len(e.args), len(def.params))
+			return 0, &EvalError{e, msg}
+		}
+		if max := def.script.maxDepth(); f.depth >= max {
+			return 0, &EvalError{e, fmt.Sprintf("calls nested deeper than %d", max)}
+		}
+		env := make(Env, len(f.globals)+len(def.params))
+		for v, x := range f.globals {
+			env[v] = x
+		}
+		for i, param := range def.params {
+			x, err := f.eval(e.args[i])
+			if err != nil {
+				return 0, err
+			}
+			env[param] = x
+		}
+		callee := &frame{globals: f.globals, env: env, depth: f.depth + 1, checked: f.checked}
+		return callee.eval(def.body)
+
+	case *Script:
+		return e.run(f.env, f.checked)
+	}
+	panic(fmt.Sprintf("unknown Expr: %T", e))
+}
+
+// value returns the value of e, computed as that of x in env, where x is
+// e with the values of its operands in their place.
+func (f *frame) value(e, x Expr, env Env) (float64, error) {
+	if !f.checked {
+		return x.Eval(env), nil
+	}
+	z, err := x.EvalChecked(env)
+	if err, ok := err.(*EvalError); ok {
+		return 0, &EvalError{e, err.Msg}
+	}
+	return z, err
+}
+
+// ---- checking ----
+
+// Check reports errors of the script: in calls of functions, whether
+// defined by the script or not, in the expressions, and functions that
+// always call themselves. Its variables are those of the expressions
+// that are neither parameters nor defined by the script.
+func (s *Script) Check(vars map[Var]bool) error {
+	defined := make(map[Var]bool)
+	for _, stmt := range s.stmts {
+		if stmt.def == nil {
+			defined[stmt.v] = true
+		}
+	}
+	check := func(e Expr, params []Var) error {
+		local := make(map[Var]bool)
+		if err := e.Check(local); err != nil {
+			return err
+		}
+		for _, p := range params {
+			delete(local, p)
+		}
+		for v := range local {
+			if !defined[v] {
+				vars[v] = true
+			}
+		}
+		return nil
+	}
+	for _, stmt := range s.stmts {
+		if stmt.def == nil {
+			if err := check(stmt.x, nil); err != nil {
+				return fmt.Errorf("%s: %v", stmt.v, err)
+			}
+			continue
+		}
+		def := stmt.def
+		if err := check(def.body, def.params); err != nil {
+			return fmt.Errorf("%s: %v", def.name, err)
+		}
+		if alwaysCalls(def.body, def) {
+			return fmt.Errorf("%s: recursion without a base case", def.name)
+		}
+	}
+	return check(s.result, nil)
+}
+
+func (a apply) Check(vars map[Var]bool) error {
+	if len(a.args) != len(a.def.params) {
+		return fmt.Errorf("call to %s has %d args, want %d", a.def.name, len(a.args), len(a.def.params))
+	}
+	for _, arg := range a.args {
+		if err := arg.Check(vars); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// alwaysCalls reports whether evaluating e always calls def, whatever
+// the values of the variables.
+func alwaysCalls(e Expr, def *funcDef) bool {
+	switch e := e.(type) {
+	case apply:
+		if e.def == def {
+			return true
+		}
+		return anyCalls(e.args, def)
+	case call:
+		return anyCalls(e.args, def)
+	case unary:
+		return alwaysCalls(e.x, def)
+	case binary:
+		if e.op == opAND || e.op == opOR {
+			return alwaysCalls(e.x, def) // y may not be evaluated
+		}
+		return alwaysCalls(e.x, def) || alwaysCalls(e.y, def)
+	case ternary:
+		return alwaysCalls(e.cond, def) || alwaysCalls(e.x, def) && alwaysCalls(e.y, def)
+	}
+	return false
+}
+
+func anyCalls(args []Expr, def *funcDef) bool {
+	for _, arg := range args {
+		if alwaysCalls(arg, def) {
+			return true
+		}
+	}
+	return false
+}
+
+// calls reports whether e has a call of def.
+func calls(e Expr, def *funcDef) bool {
+	switch e := e.(type) {
+	case apply:
+		if e.def == def {
+			return true
+		}
+		return callsAny(e.args, def)
+	case call:
+		return callsAny(e.args, def)
+	case unary:
+		return calls(e.x, def)
+	case binary:
+		return calls(e.x, def) || calls(e.y, def)
+	case ternary:
+		return calls(e.cond, def) || calls(e.x, def) || calls(e.y, def)
+	}
+	return false
+}
+
+func callsAny(args []Expr, def *funcDef) bool {
+	for _, arg := range args {
+		if calls(arg, def) {
+			return true
+		}
+	}
+	return false
+}
+
+// ---- inlining ----
+
+// inline returns e with the variables and the calls of user-defined
+// functions of its scripts replaced by their expressions, for Derive,
+// Simplify, Compile and the other evaluators, which know nothing of
+// scripts. Recursive functions cannot be inlined. A script is inlined
+// once, and its expression shared by later calls.
+func inline(e Expr) (Expr, error) {
+	switch e := e.(type) {
+	case *Script:
+		e.inlineOnce.Do(func() {
+			env := make(map[Var]Expr)
+			for _, stmt := range e.stmts {
+				if stmt.def == nil {
+					x, err := inline(stmt.x)
+					if err != nil {
+						e.inlineErr = err
+						return
+					}
+					env[stmt.v] = substitute(x, env)
+				}
+			}
+			x, err := inline(e.result)
+			if err != nil {
+				e.inlineErr = err
+				return
+			}
+			e.inlined = substitute(x, env)
+		})
+		return e.inlined, e.inlineErr
+
+	case apply:
+		def := e.def
+		if len(e.args) != len(def.params) {
+			return nil, fmt.Errorf("call to %s has %d args, want %d", def.name, len(e.args), len(def.params))
+		}
+		if calls(def.body, def) {
+			return nil, fmt.Errorf("recursive function %s cannot be inlined", def.name)
+		}
+		// Rename the parameters to names no variable has, so that they
+		// don't capture the variables of the functions the body calls:
+		// in g(y) = f(2*y), the y of the body of f is a variable of the
+		// script, not the parameter of g.
+		renamed := make(map[Var]Expr)
+		for _, param := range def.params {
+			renamed[param] = Var(fmt.Sprintf("%s#%s", param, def.name))
+		}
+		body, err := inline(substitute(def.body, renamed))
+		if err != nil {
+			return nil, err
+		}
+		env := make(map[Var]Expr)
+		for i, param := range def.params {
+			if env[renamed[param].(Var)], err = inline(e.args[i]); err != nil {
+				return nil, err
+			}
+		}
+		return substitute(body, env), nil
+
+	case unary:
+		x, err := inline(e.x)
+		return unary{e.op, x}, err
+
+	case binary:
+		x, err := inline(e.x)
+		if err != nil {
+			return nil, err
+		}
+		y, err := inline(e.y)
+		return binary{e.op, x, y}, err
+
+	case ternary:
+		cond, err := inline(e.cond)
+		if err != nil {
+			return nil, err
+		}
+		x, err := inline(e.x)
+		if err != nil {
+			return nil, err
+		}
+		y, err := inline(e.y)
+		return ternary{cond, x, y}, err
+
+	case call:
+		args := make([]Expr, len(e.args))
+		for i, arg := range e.args {
+			x, err := inline(arg)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = x
+		}
+		return call{fn: e.fn, args: args, reg: e.reg}, nil
+	}
+	return e, nil // Var, literal, imaginary, quantity
+}
+
+// Size returns the number of nodes of e with the calls of the
+// user-defined functions of its scripts inlined, as Compile and the
+// evaluators that know nothing of scripts see it, or math.MaxInt if it
+// is larger. It takes time in the length of the script, not of the
+// inlined expression, which may be exponentially longer, so it can
+// bound the work of inlining before it starts.
+func Size(e Expr) int {
+	s := sizer{
+		forms: make(map[*funcDef][]float64),
+		envs:  make(map[*Script]map[Var]float64),
+	}
+	n := s.size(e, nil)
+	if !(n < math.MaxInt) {
+		return math.MaxInt
+	}
+	return int(n)
+}
+
+// A sizer computes the sizes of inlined expressions. The size of the
+// body of a function is linear in the sizes of its arguments, so each
+// function's form, its size with all arguments of size 0 followed by
+// the size each argument adds, is computed once.
+type sizer struct {
+	forms map[*funcDef][]float64 // nil while being computed
+	envs  map[*Script]map[Var]float64
+}
+
+// size returns the size of e inlined, where env holds the sizes of the
+// expressions its variables stand for.
+func (s sizer) size(e Expr, env map[Var]float64) float64 {
+	switch e := e.(type) {
+	case *Script:
+		local := make(map[Var]float64)
+		for v, n := range env {
+			local[v] = n
+		}
+		s.envs[e] = local
+		for _, stmt := range e.stmts {
+			if stmt.def == nil {
+				local[stmt.v] = s.size(stmt.x, local)
+			}
+		}
+		return s.size(e.result, local)
+
+	case apply:
+		args := make([]float64, len(e.args))
+		for i, arg := range e.args {
+			args[i] = s.size(arg, env)
+		}
+		form, ok := s.forms[e.def]
+		if !ok {
+			form = s.form(e.def)
+		}
+		if form == nil || len(args) != len(e.def.params) {
+			// A recursive or malformed call, which is not inlined.
+			n := 1.0
+			for _, arg := range args {
+				n += arg
+			}
+			return n
+		}
+		n := form[0]
+		for i, arg := range args {
+			n += form[1+i] * arg
+		}
+		return n
+
+	case Var:
+		if n, ok := env[e]; ok {
+			return n
+		}
+		return 1
+
+	case unary:
+		return 1 + s.size(e.x, env)
+
+	case binary:
+		return 1 + s.size(e.x, env) + s.size(e.y, env)
+
+	case ternary:
+		return 1 + s.size(e.cond, env) + s.size(e.x, env) + s.size(e.y, env)
+
+	case call:
+		n := 1.0
+		for _, arg := range e.args {
+			n += s.size(arg, env)
+		}
+		return n
+	}
+	return 1 // literal, imaginary, quantity
+}
+
+// form computes and records the form of def, whose body sees the
+// variables of its script.
+func (s sizer) form(def *funcDef) []float64 {
+	s.forms[def] = nil
+	local := make(map[Var]float64)
+	for v, n := range s.envs[def.script] {
+		local[v] = n
+	}
+	for _, param := range def.params {
+		local[param] = 0
+	}
+	form := []float64{s.size(def.body, local)}
+	for _, param := range def.params {
+		local[param] = 1
+		d := s.size(def.body, local) - form[0]
+		if math.IsNaN(d) {
+			d = math.Inf(+1) // Inf - Inf
+		}
+		form = append(form, d)
+		local[param] = 0
+	}
+	s.forms[def] = form
+	return form
+}
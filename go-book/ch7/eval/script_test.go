@@ -0,0 +1,294 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestScript(t *testing.T) {
+	tests := []struct {
+		script string
+		env    Env
+		want   float64
+	}{
+		{"f(x, y) = x*x + y; g(t) = f(t, 2*t); g(3)", nil, 15},
+		{"fact(n) = n <= 1 ? 1 : n * fact(n - 1); fact(10)", nil, 3628800},
+		{"fib(n) = if(n < 2, n, fib(n - 1) + fib(n - 2)); fib(15)", nil, 610},
+		{"a = 2; b = a * 3; a + b + x", Env{"x": 1}, 9},
+		{"f(x) = x * 2; x = 5; f(x + 1)", nil, 12},
+		{"f(t) = t + k; k = 10; f(1)", Env{"k": 1}, 11},
+		{"even(n) = n == 0 || !even(n - 1); even(7) + 2 * even(8)", nil, 2},
+		{"sin(x) = 2 * x; sin(pi)", Env{"pi": math.Pi}, 2 * math.Pi},
+		{"x = 1; x;", nil, 1},
+	}
+	for _, test := range tests {
+		expr, err := Parse(test.script)
+		if err != nil {
+			t.Errorf("%s: %v", test.script, err)
+			continue
+		}
+		if _, ok := expr.(*Script); !ok {
+			t.Errorf("Parse(%s) = %T, want *Script", test.script, expr)
+		}
+		if err := expr.Check(map[Var]bool{}); err != nil {
+			t.Errorf("%s: Check: %v", test.script, err)
+			continue
+		}
+		if got := expr.Eval(test.env); got != test.want {
+			t.Errorf("%s.Eval() = %g, want %g", test.script, got, test.want)
+		}
+		if got, err := expr.EvalChecked(test.env); err != nil || got != test.want {
+			t.Errorf("%s.EvalChecked() = %g, %v, want %g", test.script, got, err, test.want)
+		}
+		// Format prints scripts that parse back.
+		expr2, err := Parse(Format(expr))
+		if err != nil {
+			t.Errorf("Parse(Format(%s)): %v", test.script, err)
+		} else if got := expr2.Eval(test.env); got != test.want {
+			t.Errorf("%s: Format = %s evaluates to %g, want %g", test.script, Format(expr), got, test.want)
+		}
+	}
+}
+
+func TestScriptCheck(t *testing.T) {
+	expr, err := Parse("a = 2; f(t) = t * a + b; f(x) + a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := make(map[Var]bool)
+	if err := expr.Check(vars); err != nil {
+		t.Fatal(err)
+	}
+	if len(vars) != 2 || !vars["b"] || !vars["x"] {
+		t.Errorf("Check variables = %v, want b and x", vars)
+	}
+
+	for _, test := range []struct{ script, want string }{
+		{"f(x) = x; f(1, 2)", "call to f has 2 args, want 1"},
+		{"f(x, y) = x; g(t) = f(t); g(1)", "g: call to f has 1 args, want 2"},
+		{"f(x) = h(x); f(1)", `f: unknown function "h"`},
+		{"a = sqrt(); a", "a: call to sqrt has 0 args, want 1"},
+		{"f(x) = f(x - 1) + 1; f(3)", "f: recursion without a base case"},
+		{"f(x) = x > 0 ? f(x - 1) : f(x + 1); f(3)", "f: recursion without a base case"},
+		{"f(x) = sqrt(f(x)); f(3)", "f: recursion without a base case"},
+		{"f(x) = x > 0 && f(x - 1); f(3)", ""},
+		{"f(x) = x > 0 ? f(x - 1) : 0; f(3)", ""},
+	} {
+		expr, err := Parse(test.script)
+		if err != nil {
+			t.Errorf("%s: %v", test.script, err)
+			continue
+		}
+		got := ""
+		if err := expr.Check(map[Var]bool{}); err != nil {
+			got = err.Error()
+		}
+		if got != test.want {
+			t.Errorf("Check(%s) = %q, want %q", test.script, got, test.want)
+		}
+	}
+}
+
+func TestScriptParseErrors(t *testing.T) {
+	for _, test := range []struct{ script, want string }{
+		{"f(x) = 1; f(y) = 2; f(1)", "1:11: redefinition of f"},
+		{"f(1) = 2; f(1)", "1:1: parameter 1 of f is not a distinct name"},
+		{"f(x, x) = x; f(1)", "1:1: parameter x of f is not a distinct name"},
+		{"x + 1 = 2; x", "1:1: cannot define (x + 1)"},
+		{"1; 2", "1:4: unexpected number 2 after the result of the script"},
+		{"f(x) = x", "1:9: script has no result"},
+		{"x = 1 x", "1:7: unexpected identifier x"},
+	} {
+		_, err := Parse(test.script)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("Parse(%s) = %v, want %s", test.script, err, test.want)
+		}
+	}
+}
+
+func TestScriptDepth(t *testing.T) {
+	// The base case of f is never reached, which Check cannot tell.
+	expr, err := Parse("f(x) = x > 0 ? f(x + 1) : 0; f(1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := expr.Check(map[Var]bool{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := expr.Eval(nil); !math.IsNaN(got) {
+		t.Errorf("Eval = %g, want NaN", got)
+	}
+	want := "f((x + 1)): calls nested deeper than 1000"
+	if _, err := expr.EvalChecked(nil); err == nil || err.Error() != want {
+		t.Errorf("EvalChecked error = %v, want %s", err, want)
+	}
+
+	expr, _ = Parse("fact(n) = n <= 1 ? 1 : n * fact(n - 1); fact(x)")
+	expr.(*Script).MaxDepth = 5
+	if got := expr.Eval(Env{"x": 5}); got != 120 {
+		t.Errorf("fact(5) = %g, want 120", got)
+	}
+	if got := expr.Eval(Env{"x": 6}); !math.IsNaN(got) {
+		t.Errorf("fact(6) with MaxDepth 5 = %g, want NaN", got)
+	}
+	if _, err := expr.EvalChecked(Env{"x": 1 / 3.0}); err != nil {
+		t.Errorf("fact(1/3): %v", err)
+	}
+
+	// Errors within functions are those of EvalChecked.
+	expr, _ = Parse("inv(x) = 1 / x; inv(y - 2)")
+	want = "(1 / x): division by zero"
+	if _, err := expr.EvalChecked(Env{"y": 2}); err == nil || err.Error() != want {
+		t.Errorf("EvalChecked error = %v, want %s", err, want)
+	}
+}
+
+// TestScriptInline checks that the other evaluators see the definitions
+// of non-recursive functions in place of their calls.
+func TestScriptInline(t *testing.T) {
+	expr, err := Parse("sq(t) = t * t; a = 3; sq(x) + a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := Format(Simplify(Derive(expr, "x"))), "(2 * x)"; got != want {
+		t.Errorf("Derive = %s, want %s", got, want)
+	}
+	if got, want := Format(Simplify(expr)), "((x ^ 2) + 3)"; got != want {
+		t.Errorf("Simplify = %s, want %s", got, want)
+	}
+	if got := Compile(expr, []Var{"x"}).Eval([]float64{2}); got != 7 {
+		t.Errorf("Compile(...).Eval(2) = %g, want 7", got)
+	}
+	if got := EvalComplex(expr, ComplexEnv{"x": 1i}); got != 2 {
+		t.Errorf("EvalComplex(1i) = %v, want 2", got)
+	}
+	if z, err := EvalRat(expr, RatEnv{"x": big.NewRat(1, 2)}); err != nil || z.String() != "13/4" {
+		t.Errorf("EvalRat(1/2) = %v, %v, want 13/4", z, err)
+	}
+
+	expr, _ = Parse("fact(n) = n <= 1 ? 1 : n * fact(n - 1); fact(x)")
+	want := "recursive function fact cannot be inlined"
+	if _, err := EvalFloat(expr, nil, 0); err == nil || !strings.HasSuffix(err.Error(), want) {
+		t.Errorf("EvalFloat error = %v, want %s", err, want)
+	}
+	if err := CheckComplex(expr, map[Var]bool{}); err == nil {
+		t.Errorf("CheckComplex of a recursive script succeeded")
+	}
+}
+
+// TestScriptInlineCapture checks that inlining gives the values of Eval
+// when the parameters of a function have the names of variables of the
+// functions it calls.
+func TestScriptInlineCapture(t *testing.T) {
+	for _, test := range []struct {
+		script string
+		env    Env
+		want   float64
+	}{
+		{"y = 5; f(x) = x + y; g(y) = f(y*2); g(1)", nil, 7},
+		{"f(x) = x + y; g(y) = f(2); g(1)", Env{"y": 100}, 102},
+		{"f(x, y) = x - 2*y; f(y, x)", Env{"x": 1, "y": 5}, 3},
+		{"h(a) = a * k; f(k) = h(k + 1); f(2)", Env{"k": 10}, 30},
+		{"f(x) = x * y; g(x, y) = f(x + y) + f(y); g(y, 1)", Env{"y": 3}, 15},
+	} {
+		expr, err := Parse(test.script)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var vars []Var
+		var values []float64
+		for v, x := range test.env {
+			vars = append(vars, v)
+			values = append(values, x)
+		}
+		if got := expr.Eval(test.env); got != test.want {
+			t.Errorf("%s.Eval() = %g, want %g", test.script, got, test.want)
+		}
+		if got := Compile(expr, vars).Eval(values); got != test.want {
+			t.Errorf("Compile(%s).Eval() = %g, want %g", test.script, got, test.want)
+		}
+		if got := Simplify(expr).Eval(test.env); got != test.want {
+			t.Errorf("Simplify(%s) = %s, want %g", test.script, Format(Simplify(expr)), test.want)
+		}
+	}
+	expr, _ := Parse("f(x) = x + y; g(y) = f(2); g(1)")
+	if got, want := Format(Simplify(Derive(expr, "y"))), "1"; got != want {
+		t.Errorf("Derive(%s, y) = %s, want %s", Format(expr), got, want)
+	}
+}
+
+func TestScriptSize(t *testing.T) {
+	for _, script := range []string{
+		"x + 1",
+		"sin(x) > 0 ? -x : 2",
+		"sq(t) = t * t; a = 3; sq(x) + a",
+		"a = x + 1; b = a * a; b / a",
+		"f(t) = t + 1; g(t, u) = f(t) * f(u) * u; g(f(x), 2)",
+		"y = 5; f(x) = x + y; g(y) = f(y*2); g(1)",
+		"f(x) = x + y; g(y) = f(2); g(1)",
+		"h(a) = a * k; f(k) = h(k + 1); f(2)",
+		"f(x) = x * y; g(x, y) = f(x + y) + f(y); g(y, 1)",
+	} {
+		expr, err := Parse(script)
+		if err != nil {
+			t.Fatal(err)
+		}
+		x, err := inline(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := Size(expr), nodes(x); got != want {
+			t.Errorf("Size(%s) = %d, want %d", script, got, want)
+		}
+	}
+
+	// Each function doubles the size of the last, but Size does not
+	// inline them.
+	defs := []string{"f0(t) = t + 1"}
+	for i := 1; i <= 70; i++ {
+		defs = append(defs, fmt.Sprintf("f%d(t) = f%d(t) + f%d(t)", i, i-1, i-1))
+	}
+	for _, test := range []struct {
+		n    int
+		want int
+	}{
+		{22, 1<<24 - 1},
+		{70, math.MaxInt},
+	} {
+		expr, err := Parse(strings.Join(defs[:test.n+1], "; ") + fmt.Sprintf("; f%d(x)", test.n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := Size(expr); got != test.want {
+			t.Errorf("Size(f%d(x)) = %d, want %d", test.n, got, test.want)
+		}
+	}
+
+	// A recursive call, which is not inlined, counts once.
+	expr, _ := Parse("fact(n) = n <= 1 ? 1 : n * fact(n - 1); fact(x)")
+	if got, want := Size(expr), 11; got != want {
+		t.Errorf("Size(fact(x)) = %d, want %d", got, want)
+	}
+}
+
+// nodes returns the number of nodes of e.
+func nodes(e Expr) int {
+	switch e := e.(type) {
+	case unary:
+		return 1 + nodes(e.x)
+	case binary:
+		return 1 + nodes(e.x) + nodes(e.y)
+	case ternary:
+		return 1 + nodes(e.cond) + nodes(e.x) + nodes(e.y)
+	case call:
+		n := 1
+		for _, arg := range e.args {
+			n += nodes(arg)
+		}
+		return n
+	}
+	return 1
+}
@@ -0,0 +1,357 @@
+package eval
+
+import (
+	"math"
+	"sort"
+)
+
+// Simplify returns an expression equal to e, usually smaller. It folds
+// constant subexpressions, removes identities such as x*1, x+0 and x*0,
+// and collects like terms and factors, so that x + 2*x is 3*x and
+// x * x / y is x^2 / y.
+//
+// Like most computer algebra systems, Simplify assumes that expressions
+// are finite: x*0 and x-x become 0 even though x might be NaN or ±Inf,
+// and x/x becomes 1 even though x might be 0. Constants with units, such
+// as 1 km + 300 m, fold to their values in SI units, 1300.
+func Simplify(e Expr) Expr {
+	switch e := e.(type) {
+	case quantity:
+		return literal(e.Eval(nil))
+
+	case *Script, apply:
+		if x, err := inline(e); err == nil {
+			return Simplify(x)
+		}
+		return e // recursive
+	case unary:
+		e.x = Simplify(e.x)
+		switch e.op {
+		case '+':
+			return e.x
+		case '-':
+			var s sum
+			s.add(e, 1)
+			return s.expr()
+		}
+		return fold(e)
+
+	case binary:
+		e.x, e.y = Simplify(e.x), Simplify(e.y)
+		switch e.op {
+		case '+', '-':
+			var s sum
+			s.add(e, 1)
+			return s.expr()
+		case '*', '/', '^':
+			p := product{coef: 1}
+			p.mul(e, 1)
+			return p.expr()
+		}
+		return fold(e)
+
+	case ternary:
+		e.cond, e.x, e.y = Simplify(e.cond), Simplify(e.x), Simplify(e.y)
+		if cond, ok := e.cond.(literal); ok {
+			if cond != 0 {
+				return e.x
+			}
+			return e.y
+		}
+		if Format(e.x) == Format(e.y) {
+			return e.x
+		}
+		return e
+
+	case call:
+		args := make([]Expr, len(e.args))
+		for i, arg := range e.args {
+			args[i] = Simplify(arg)
+		}
+		e.args = args
+		return fold(e)
+	}
+	return e // Var, literal, imaginary
+}
+
+// fold returns the value of e as a literal if its operands are literals
+// and its value is finite, e otherwise. The operands of e are already
+// simplified, so those without variables are literals, unless their
+// values are not finite.
+func fold(e Expr) Expr {
+	var args []Expr
+	switch e := e.(type) {
+	case unary:
+		args = []Expr{e.x}
+	case binary:
+		args = []Expr{e.x, e.y}
+	case call:
+		args = e.args
+	}
+	for _, arg := range args {
+		if _, ok := arg.(literal); !ok {
+			return e
+		}
+	}
+	z, err := e.EvalChecked(nil)
+	if err != nil || math.IsNaN(z) || math.IsInf(z, 0) {
+		return e
+	}
+	return literal(z)
+}
+
+// isConstant reports whether e has no variables. The calls of functions
+// defined by scripts may use the variables of the script, so they are not
+// constant.
+func isConstant(e Expr) bool {
+	switch e := e.(type) {
+	case Var, apply, *Script:
+		return false
+	case unary:
+		return isConstant(e.x)
+	case binary:
+		return isConstant(e.x) && isConstant(e.y)
+	case ternary:
+		return isConstant(e.cond) && isConstant(e.x) && isConstant(e.y)
+	case call:
+		for _, arg := range e.args {
+			if !isConstant(arg) {
+				return false
+			}
+		}
+	}
+	return true // literal, imaginary, quantity
+}
+
+// A sum is a constant plus terms, each a coefficient times a product
+// without coefficient. Terms of equal products are collected.
+type sum struct {
+	konst float64
+	terms []term
+}
+
+type term struct {
+	coef    float64
+	factors []factor
+	key     string // Format of the product
+}
+
+// add adds c times e to s.
+func (s *sum) add(e Expr, c float64) {
+	switch e := e.(type) {
+	case literal:
+		s.konst += c * float64(e)
+		return
+	case unary:
+		switch e.op {
+		case '+':
+			s.add(e.x, c)
+			return
+		case '-':
+			s.add(e.x, -c)
+			return
+		}
+	case binary:
+		switch e.op {
+		case '+':
+			s.add(e.x, c)
+			s.add(e.y, c)
+			return
+		case '-':
+			s.add(e.x, c)
+			s.add(e.y, -c)
+			return
+		}
+	}
+
+	p := product{coef: 1}
+	p.mul(e, 1)
+	c *= p.coef
+	p.coef = 1
+	if p.isConstant() {
+		s.konst += c
+		return
+	}
+	key := Format(p.expr())
+	for i := range s.terms {
+		if s.terms[i].key == key {
+			s.terms[i].coef += c
+			return
+		}
+	}
+	s.terms = append(s.terms, term{c, p.factors, key})
+}
+
+// expr returns s as an expression: the terms in order of appearance, then
+// the constant.
+func (s *sum) expr() Expr {
+	var e Expr
+	for _, t := range s.terms {
+		switch {
+		case t.coef == 0:
+			continue
+		case e == nil:
+			e = product{t.coef, t.factors}.expr()
+		case t.coef < 0:
+			e = binary{'-', e, product{-t.coef, t.factors}.expr()}
+		default:
+			e = binary{'+', e, product{t.coef, t.factors}.expr()}
+		}
+	}
+	switch {
+	case e == nil:
+		return literal(s.konst)
+	case s.konst < 0:
+		return binary{'-', e, literal(-s.konst)}
+	case s.konst > 0:
+		return binary{'+', e, literal(s.konst)}
+	}
+	return e
+}
+
+// A product is a coefficient times factors, each a base to a constant
+// exponent. Factors of equal bases are collected.
+//
+// Exponents are only multiplied or added when that keeps the value of the
+// product for negative bases: when they are integers, or the base is
+// known to be non-negative. Otherwise (x^2)^0.5 would become x, not |x|,
+// and x^0.5 * x^0.5 would become x, defined for negative x.
+type product struct {
+	coef    float64
+	factors []factor
+}
+
+type factor struct {
+	base Expr
+	key  string // Format(base)
+	exp  float64
+}
+
+// mul multiplies p by e to the power k.
+func (p *product) mul(e Expr, k float64) {
+	switch e := e.(type) {
+	case literal:
+		if z := math.Pow(float64(e), k); !math.IsNaN(z) && !math.IsInf(z, 0) {
+			p.coef *= z
+			return
+		}
+	case unary:
+		switch {
+		case e.op == '+':
+			p.mul(e.x, k)
+			return
+		case e.op == '-' && k == math.Trunc(k):
+			p.coef *= math.Pow(-1, k)
+			p.mul(e.x, k)
+			return
+		}
+	case binary:
+		switch {
+		case e.op == '*' && isInteger(k):
+			p.mul(e.x, k)
+			p.mul(e.y, k)
+			return
+		case e.op == '/' && isInteger(k):
+			p.mul(e.x, k)
+			p.mul(e.y, -k)
+			return
+		case e.op == '^':
+			exp, ok := e.y.(literal)
+			if ok && (isInteger(k) && isInteger(float64(exp)) || nonNegative(e.x)) {
+				p.mul(e.x, k*float64(exp))
+				return
+			}
+		}
+	}
+
+	key := Format(e)
+	for i := range p.factors {
+		f := &p.factors[i]
+		if f.key == key && (isInteger(f.exp) && isInteger(k) || nonNegative(e)) {
+			f.exp += k
+			return
+		}
+	}
+	p.factors = append(p.factors, factor{e, key, k})
+}
+
+func isInteger(x float64) bool {
+	return x == math.Trunc(x)
+}
+
+// nonNegative reports whether e is known to be non-negative, or NaN,
+// whatever the values of its variables.
+func nonNegative(e Expr) bool {
+	switch e := e.(type) {
+	case literal:
+		return e >= 0
+	case binary:
+		if exp, ok := e.y.(literal); ok && e.op == '^' && math.Mod(float64(exp), 2) == 0 {
+			return true
+		}
+	case call:
+		switch e.fn {
+		case "abs", "sqrt", "exp", "cosh", "hypot":
+			return e.builtinFunc()
+		}
+	}
+	return false
+}
+
+// isConstant reports whether p has no factors other than its coefficient.
+func (p product) isConstant() bool {
+	for _, f := range p.factors {
+		if f.exp != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// expr returns p as an expression: the coefficient times the factors of
+// positive exponents, in order of their bases, divided by those of
+// negative exponents.
+func (p product) expr() Expr {
+	if p.coef == 0 {
+		return literal(0)
+	}
+	factors := append([]factor(nil), p.factors...)
+	sort.SliceStable(factors, func(i, j int) bool { return factors[i].key < factors[j].key })
+	var num, den Expr
+	for _, f := range factors {
+		switch {
+		case f.exp > 0:
+			num = times(num, power(f.base, f.exp))
+		case f.exp < 0:
+			den = times(den, power(f.base, -f.exp))
+		}
+	}
+	switch {
+	case num == nil:
+		num = literal(p.coef)
+	case p.coef == -1:
+		num = unary{'-', num}
+	case p.coef != 1:
+		num = binary{'*', literal(p.coef), num}
+	}
+	if den == nil {
+		return num
+	}
+	return binary{'/', num, den}
+}
+
+// times returns x * y, or y if x is nil.
+func times(x, y Expr) Expr {
+	if x == nil {
+		return y
+	}
+	return binary{'*', x, y}
+}
+
+// power returns x ^ k.
+func power(x Expr, k float64) Expr {
+	if k == 1 {
+		return x
+	}
+	return binary{'^', x, literal(k)}
+}
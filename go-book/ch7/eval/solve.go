@@ -0,0 +1,257 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+)
+
+// SolveOptions are the limits of Newton, Minimize and Integrate. Zero
+// fields take the defaults of each.
+type SolveOptions struct {
+	MaxIter int     // iterations, or intervals of Integrate
+	Tol     float64 // tolerance of the result
+}
+
+func (opts *SolveOptions) limits(maxIter int, tol float64) (int, float64) {
+	if opts != nil && opts.MaxIter > 0 {
+		maxIter = opts.MaxIter
+	}
+	if opts != nil && opts.Tol > 0 {
+		tol = opts.Tol
+	}
+	return maxIter, tol
+}
+
+// A ConvergenceError reports that a solver did not reach its tolerance
+// within its iteration limit.
+type ConvergenceError struct {
+	Solver     string  // "Newton", "Minimize" or "Integrate"
+	Iterations int     // iterations done
+	Estimate   float64 // the last estimate of the result
+}
+
+func (e *ConvergenceError) Error() string {
+	return fmt.Sprintf("%s did not converge in %d iterations (estimate %.6g)",
+		e.Solver, e.Iterations, e.Estimate)
+}
+
+// with returns a copy of env with vars set to x.
+func with(env Env, vars []Var, x []float64) Env {
+	env2 := make(Env, len(env)+len(vars))
+	for v, x := range env {
+		env2[v] = x
+	}
+	for i, v := range vars {
+		env2[v] = x[i]
+	}
+	return env2
+}
+
+func finite(x float64) bool {
+	return !math.IsNaN(x) && !math.IsInf(x, 0)
+}
+
+// ---- root finding ----
+
+// Newton returns a root of e as a function of v, the other variables
+// being those of env, by Newton's method from x0. It stops when a step
+// is within Tol (default 1e-12) of x, relative to x if |x| > 1, or
+// reports a ConvergenceError after MaxIter (default 100) steps.
+func Newton(e Expr, v Var, x0 float64, env Env, opts *SolveOptions) (float64, error) {
+	maxIter, tol := opts.limits(100, 1e-12)
+	x := x0
+	vars := []Var{v}
+	env = with(env, vars, []float64{x})
+	for i := 0; i < maxIter; i++ {
+		env[v] = x
+		y, grad, err := Gradient(e, env, vars)
+		if err != nil {
+			return x, err
+		}
+		if y == 0 {
+			return x, nil
+		}
+		if !finite(y) || !finite(grad[0]) {
+			return x, fmt.Errorf("Newton: %s is not finite at %s = %g", Format(e), v, x)
+		}
+		if grad[0] == 0 {
+			return x, fmt.Errorf("Newton: zero derivative at %s = %g", v, x)
+		}
+		step := y / grad[0]
+		x -= step
+		if math.Abs(step) <= tol*math.Max(1, math.Abs(x)) {
+			return x, nil
+		}
+	}
+	return x, &ConvergenceError{"Newton", maxIter, x}
+}
+
+// ---- minimization ----
+
+// A Bounds is a closed interval of a variable of Minimize. Use ±Inf for
+// no bound.
+type Bounds struct{ Min, Max float64 }
+
+// Unbounded is the Bounds of a variable of any value.
+var Unbounded = Bounds{math.Inf(-1), math.Inf(+1)}
+
+func (b Bounds) clamp(x float64) float64 {
+	return math.Max(b.Min, math.Min(b.Max, x))
+}
+
+// projected returns x - b.clamp(x - g), the gradient g projected at x
+// within b, without subtracting nearly equal numbers when x is large.
+func (b Bounds) projected(x, g float64) float64 {
+	switch {
+	case g > 0 && x-b.Min < g:
+		return x - b.Min
+	case g < 0 && x-b.Max > g:
+		return x - b.Max
+	}
+	return g
+}
+
+// Minimize returns values of vars, within bounds, at which e is
+// minimal, at least locally, and the minimum, by projected gradient
+// descent from x0 with a backtracking line search. A nil bounds leaves
+// all variables unbounded. It stops when the projected gradient is
+// within Tol (default 1e-9) of zero, or steps no longer decrease e
+// with it within √Tol, as rounding limits. It reports an error if steps
+// stop decreasing e further from a minimum, as when e is unbounded
+// below and the steps diverge, and a ConvergenceError after MaxIter
+// (default 10000) steps.
+func Minimize(e Expr, vars []Var, x0 []float64, bounds []Bounds, env Env, opts *SolveOptions) ([]float64, float64, error) {
+	if len(x0) != len(vars) || (bounds != nil && len(bounds) != len(vars)) {
+		return nil, 0, fmt.Errorf("Minimize: %d variables, %d initial values and %d bounds",
+			len(vars), len(x0), len(bounds))
+	}
+	maxIter, tol := opts.limits(10000, 1e-9)
+	bound := func(i int) Bounds {
+		if bounds == nil {
+			return Unbounded
+		}
+		return bounds[i]
+	}
+	x := make([]float64, len(vars))
+	for i := range x {
+		x[i] = bound(i).clamp(x0[i])
+	}
+	env = with(env, vars, x)
+	f := func(x []float64) (float64, []float64, error) {
+		for i, v := range vars {
+			env[v] = x[i]
+		}
+		return Gradient(e, env, vars)
+	}
+
+	y, grad, err := f(x)
+	if err != nil {
+		return nil, 0, err
+	}
+	t := 1.0 // step length
+	next := make([]float64, len(x))
+	for iter := 0; iter < maxIter; iter++ {
+		if !finite(y) {
+			return x, y, fmt.Errorf("Minimize: %s is not finite at %v", Format(e), x)
+		}
+		// The projected gradient is zero at a minimum on a bound.
+		norm := 0.0
+		for i := range x {
+			norm = math.Max(norm, math.Abs(bound(i).projected(x[i], grad[i])))
+		}
+		if norm <= tol {
+			return x, y, nil
+		}
+		// Backtrack until the step decreases e enough (Armijo).
+		for {
+			decrease := 0.0
+			for i := range x {
+				next[i] = bound(i).clamp(x[i] - t*grad[i])
+				decrease += grad[i] * (x[i] - next[i])
+			}
+			y2, grad2, err := f(next)
+			if err != nil {
+				return nil, 0, err
+			}
+			if finite(y2) && y2 < y && y2 <= y-1e-4*decrease {
+				x, next = next, x
+				y, grad = y2, grad2
+				t *= 2
+				break
+			}
+			t /= 2
+			if decrease <= tol*tol {
+				if norm <= math.Sqrt(tol) {
+					return x, y, nil // rounding limits the steps
+				}
+				return x, y, fmt.Errorf("Minimize: no step decreases %s at %v, where its projected gradient is %g",
+					Format(e), x, norm)
+			}
+		}
+	}
+	return x, y, &ConvergenceError{"Minimize", maxIter, y}
+}
+
+// ---- integration ----
+
+// Integrate returns the integral of e as a function of v from a to b,
+// the other variables being those of env, by adaptive Simpson's rule.
+// Intervals are split until their error estimate is within their share
+// of Tol (default 1e-10); splitting more than MaxIter (default 100000)
+// of them reports a ConvergenceError. Errors of Check are reported before
+// e is evaluated.
+func Integrate(e Expr, v Var, a, b float64, env Env, opts *SolveOptions) (float64, error) {
+	if err := e.Check(map[Var]bool{}); err != nil {
+		return 0, fmt.Errorf("Integrate: %v", err)
+	}
+	maxIter, tol := opts.limits(100000, 1e-10)
+	s := simpson{env: with(env, []Var{v}, []float64{a}), e: e, v: v, maxIter: maxIter}
+	fa, fb, fm := s.f(a), s.f(b), s.f((a+b)/2)
+	whole := (b - a) / 6 * (fa + 4*fm + fb)
+	z := s.integrate(a, b, fa, fm, fb, whole, tol, 50)
+	if s.err != nil {
+		return z, s.err
+	}
+	if s.splits > maxIter {
+		return z, &ConvergenceError{"Integrate", maxIter, z}
+	}
+	return z, nil
+}
+
+type simpson struct {
+	env     Env
+	e       Expr
+	v       Var
+	maxIter int
+	splits  int
+	err     error
+}
+
+func (s *simpson) f(x float64) float64 {
+	s.env[s.v] = x
+	y := s.e.Eval(s.env)
+	if !finite(y) && s.err == nil {
+		s.err = fmt.Errorf("Integrate: %s is not finite at %s = %g", Format(s.e), s.v, x)
+	}
+	return y
+}
+
+// integrate returns the integral over [a, b], given the values at a, b
+// and its midpoint m, and whole, its estimate by Simpson's rule.
+func (s *simpson) integrate(a, b, fa, fm, fb, whole, tol float64, depth int) float64 {
+	m := (a + b) / 2
+	lm, rm := (a+m)/2, (m+b)/2
+	flm, frm := s.f(lm), s.f(rm)
+	left := (m - a) / 6 * (fa + 4*flm + fm)
+	right := (b - m) / 6 * (fm + 4*frm + fb)
+	delta := left + right - whole
+	if s.err != nil || depth <= 0 || s.splits > s.maxIter || math.Abs(delta) <= 15*tol {
+		if depth <= 0 {
+			s.splits = s.maxIter + 1 // cannot reach tol
+		}
+		return left + right + delta/15 // Richardson extrapolation
+	}
+	s.splits++
+	return s.integrate(a, m, fa, flm, fm, left, tol/2, depth-1) +
+		s.integrate(m, b, fm, frm, fb, right, tol/2, depth-1)
+}
@@ -0,0 +1,198 @@
+package eval
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGradient(t *testing.T) {
+	vars := []Var{"x", "y"}
+	for _, test := range []struct {
+		expr   string
+		env    Env
+		want   float64
+		dx, dy float64
+	}{
+		{"x * x * y + sin(x)", Env{"x": 0, "y": 3}, 0, 1, 0},
+		{"x * x * y + sin(x)", Env{"x": 2, "y": 3}, 12 + math.Sin(2), 12 + math.Cos(2), 4},
+		{"x ^ y", Env{"x": 2, "y": 3}, 8, 12, 8 * math.Log(2)},
+		{"x ^ 2", Env{"x": -3, "y": 0}, 9, -6, 0},
+		{"x / y - z", Env{"x": 1, "y": 2, "z": 5}, -4.5, 0.5, -0.25},
+		{"x > y ? x : y", Env{"x": 1, "y": 2}, 2, 0, 1},
+		{"hypot(x, y)", Env{"x": 3, "y": 4}, 5, 0.6, 0.8},
+		{"f(a) = a * a; f(x + y)", Env{"x": 1, "y": 2}, 9, 6, 6},
+		{"2 m * x", Env{"x": 1, "y": 0}, 2, 2, 0},
+	} {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		got, grad, err := Gradient(expr, test.env, vars)
+		if err != nil {
+			t.Errorf("Gradient(%s): %v", test.expr, err)
+			continue
+		}
+		if !near(got, test.want) || !near(grad[0], test.dx) || !near(grad[1], test.dy) {
+			t.Errorf("Gradient(%s) in %v = %g, %v, want %g, [%g %g]",
+				test.expr, test.env, got, grad, test.want, test.dx, test.dy)
+		}
+		// Derive agrees.
+		for i, v := range vars {
+			if d := Derive(expr, v).Eval(test.env); !near(d, grad[i]) {
+				t.Errorf("Derive(%s, %s) = %g, Gradient %g", test.expr, v, d, grad[i])
+			}
+		}
+	}
+	// 0 ^ y is 0 for y > 0, so its derivative in y is 0, not 0 * log(0).
+	_, grad, err := Gradient(mustParse(t, "x ^ y"), Env{"x": 0, "y": 2}, vars)
+	if err != nil || grad[0] != 0 || grad[1] != 0 {
+		t.Errorf("Gradient(x ^ y) in x=0, y=2 = %v, %v, want [0 0]", grad, err)
+	}
+}
+
+func TestGradientErrors(t *testing.T) {
+	reg := DefaultRegistry.Clone()
+	reg.Register1("twice", func(x float64) float64 { return 2 * x })
+	for _, test := range []struct{ expr, want string }{
+		{"x + z", `z: undefined variable`},
+		{"twice(x)", `twice(x): no derivative for twice`},
+		{"2i * x", `2i: imaginary number in real expression`},
+	} {
+		expr, err := ParseWith(test.expr, reg)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		_, _, err = Gradient(expr, Env{"x": 1}, []Var{"x"})
+		if err == nil || err.Error() != test.want {
+			t.Errorf("Gradient(%s): got error %v, want %s", test.expr, err, test.want)
+		}
+	}
+	// A function without partials is a constant of constant arguments.
+	expr, _ := ParseWith("twice(3) * x", reg)
+	if _, grad, err := Gradient(expr, Env{"x": 1}, []Var{"x"}); err != nil || grad[0] != 6 {
+		t.Errorf("Gradient(twice(3) * x) = %v, %v, want [6]", grad, err)
+	}
+}
+
+func TestNewton(t *testing.T) {
+	for _, test := range []struct {
+		expr string
+		x0   float64
+		want float64
+	}{
+		{"x * x - 2", 1, math.Sqrt2},
+		{"cos(x) - x", 1, 0.7390851332151607},
+		{"exp(x) - 10", 0, math.Log(10)},
+		{"x ^ 3 - a", 1, 3}, // a = 27
+	} {
+		x, err := Newton(mustParse(t, test.expr), "x", test.x0, Env{"a": 27}, nil)
+		if err != nil || !near(x, test.want) {
+			t.Errorf("Newton(%s, %g) = %g, %v, want %g", test.expr, test.x0, x, err, test.want)
+		}
+	}
+
+	_, err := Newton(mustParse(t, "x * x + 1"), "x", 0.5, nil, nil)
+	if _, ok := err.(*ConvergenceError); !ok {
+		t.Errorf("Newton(x * x + 1) error = %v, want a ConvergenceError", err)
+	}
+	_, err = Newton(mustParse(t, "x * x - 1"), "x", 0, nil, nil)
+	if want := "Newton: zero derivative at x = 0"; err == nil || err.Error() != want {
+		t.Errorf("Newton(x * x - 1, 0) error = %v, want %s", err, want)
+	}
+	_, err = Newton(mustParse(t, "x * x - 2"), "x", 1, nil, &SolveOptions{MaxIter: 2})
+	if want := "Newton did not converge in 2 iterations (estimate 1.41667)"; err == nil || err.Error() != want {
+		t.Errorf("Newton with MaxIter 2: error = %v, want %s", err, want)
+	}
+}
+
+func TestMinimize(t *testing.T) {
+	vars := []Var{"x", "y"}
+	quad := mustParse(t, "(x - 1) ^ 2 + 2 * (y + 2) ^ 2")
+
+	x, y, err := Minimize(quad, vars, []float64{0, 0}, nil, nil, nil)
+	if err != nil || !nearTol(x[0], 1, 1e-6) || !nearTol(x[1], -2, 1e-6) || !nearTol(y, 0, 1e-9) {
+		t.Errorf("Minimize(%s) = %v, %g, %v, want [1 -2], 0", Format(quad), x, y, err)
+	}
+
+	bounds := []Bounds{{2, 5}, {-1, math.Inf(1)}}
+	x, y, err = Minimize(quad, vars, []float64{4, 3}, bounds, nil, nil)
+	if err != nil || !nearTol(x[0], 2, 1e-9) || !nearTol(x[1], -1, 1e-9) || !nearTol(y, 3, 1e-9) {
+		t.Errorf("Minimize(%s) within %v = %v, %g, %v, want [2 -1], 3", Format(quad), bounds, x, y, err)
+	}
+
+	rosenbrock := mustParse(t, "(1 - x) ^ 2 + 100 * (y - x ^ 2) ^ 2")
+	x, _, err = Minimize(rosenbrock, vars, []float64{-1.2, 1}, nil, nil, &SolveOptions{MaxIter: 100000, Tol: 1e-8})
+	if err != nil || !nearTol(x[0], 1, 1e-4) || !nearTol(x[1], 1, 1e-4) {
+		t.Errorf("Minimize(Rosenbrock) = %v, %v, want [1 1]", x, err)
+	}
+	_, _, err = Minimize(rosenbrock, vars, []float64{-1.2, 1}, nil, nil, &SolveOptions{MaxIter: 10})
+	if _, ok := err.(*ConvergenceError); !ok {
+		t.Errorf("Minimize(Rosenbrock) with MaxIter 10: error = %v, want a ConvergenceError", err)
+	}
+
+	// An unbounded objective diverges, not converges where the steps
+	// are lost to rounding.
+	x, y, err = Minimize(mustParse(t, "x"), []Var{"x"}, []float64{0}, nil, nil, nil)
+	if err == nil {
+		t.Errorf("Minimize(x) = %v, %g, want an error", x, y)
+	}
+	x, y, err = Minimize(mustParse(t, "x - y"), vars, []float64{0, 0}, []Bounds{{-1, 1}, Unbounded}, nil, nil)
+	if err == nil {
+		t.Errorf("Minimize(x - y) with y unbounded = %v, %g, want an error", x, y)
+	}
+
+	_, _, err = Minimize(quad, vars, []float64{0}, nil, nil, nil)
+	if want := "Minimize: 2 variables, 1 initial values and 0 bounds"; err == nil || err.Error() != want {
+		t.Errorf("Minimize with 1 initial value: error = %v, want %s", err, want)
+	}
+}
+
+func TestIntegrate(t *testing.T) {
+	for _, test := range []struct {
+		expr string
+		a, b float64
+		want float64
+	}{
+		{"x ^ 2", 0, 3, 9},
+		{"sin(x)", 0, math.Pi, 2},
+		{"sqrt(x)", 0, 1, 2.0 / 3},
+		{"k * exp(-x)", 0, 1, 2 * (1 - math.Exp(-1))}, // k = 2
+		{"x", 1, -1, 0},
+		{"x ^ 2", 3, 0, -9},
+	} {
+		z, err := Integrate(mustParse(t, test.expr), "x", test.a, test.b, Env{"k": 2}, nil)
+		if err != nil || !nearTol(z, test.want, 1e-8) {
+			t.Errorf("Integrate(%s, %g, %g) = %g, %v, want %g", test.expr, test.a, test.b, z, err, test.want)
+		}
+	}
+
+	_, err := Integrate(mustParse(t, "1 / x"), "x", -1, 1, nil, nil)
+	if want := "Integrate: (1 / x) is not finite at x = 0"; err == nil || err.Error() != want {
+		t.Errorf("Integrate(1 / x) error = %v, want %s", err, want)
+	}
+	for _, test := range []struct{ expr, want string }{
+		{"foo(x)", `Integrate: unknown function "foo"`},
+		{"hypot(x)", "Integrate: call to hypot has 1 args, want 2"},
+		{"x * (1 s + 1 m)", "Integrate: (1 s + 1 m): incompatible dimensions s and m"},
+	} {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Integrate(expr, "x", 0, 1, nil, nil); err == nil || err.Error() != test.want {
+			t.Errorf("Integrate(%s) error = %v, want %s", test.expr, err, test.want)
+		}
+	}
+	_, err = Integrate(mustParse(t, "sin(1 / x)"), "x", 0.001, 1, nil, &SolveOptions{MaxIter: 10})
+	if _, ok := err.(*ConvergenceError); !ok {
+		t.Errorf("Integrate(sin(1 / x)) with MaxIter 10: error = %v, want a ConvergenceError", err)
+	}
+}
+
+func near(x, y float64) bool { return nearTol(x, y, 1e-9) }
+
+func nearTol(x, y, tol float64) bool {
+	return math.Abs(x-y) <= tol*math.Max(1, math.Abs(y))
+}
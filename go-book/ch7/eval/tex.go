@@ -0,0 +1,489 @@
+package eval
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+)
+
+// greek maps the names of Greek letters to their LaTeX commands and
+// characters, so that pi renders as π.
+var greek = map[string]struct{ tex, char string }{
+	"alpha": {`\alpha`, "α"}, "beta": {`\beta`, "β"}, "gamma": {`\gamma`, "γ"},
+	"delta": {`\delta`, "δ"}, "epsilon": {`\epsilon`, "ε"}, "zeta": {`\zeta`, "ζ"},
+	"eta": {`\eta`, "η"}, "theta": {`\theta`, "θ"}, "kappa": {`\kappa`, "κ"},
+	"lambda": {`\lambda`, "λ"}, "mu": {`\mu`, "μ"}, "nu": {`\nu`, "ν"},
+	"xi": {`\xi`, "ξ"}, "pi": {`\pi`, "π"}, "rho": {`\rho`, "ρ"},
+	"sigma": {`\sigma`, "σ"}, "tau": {`\tau`, "τ"}, "phi": {`\phi`, "φ"},
+	"chi": {`\chi`, "χ"}, "psi": {`\psi`, "ψ"}, "omega": {`\omega`, "ω"},
+	"Gamma": {`\Gamma`, "Γ"}, "Delta": {`\Delta`, "Δ"}, "Theta": {`\Theta`, "Θ"},
+	"Lambda": {`\Lambda`, "Λ"}, "Xi": {`\Xi`, "Ξ"}, "Pi": {`\Pi`, "Π"},
+	"Sigma": {`\Sigma`, "Σ"}, "Phi": {`\Phi`, "Φ"}, "Psi": {`\Psi`, "Ψ"},
+	"Omega": {`\Omega`, "Ω"},
+}
+
+// texOps are the LaTeX and MathML symbols of the binary operators.
+var texOps = map[rune]struct{ tex, char string }{
+	'+': {"+", "+"}, '-': {"-", "−"}, '*': {`\cdot`, "⋅"}, '%': {`\bmod`, "mod"},
+	'<': {"<", "<"}, '>': {">", ">"}, opLE: {`\le`, "≤"}, opGE: {`\ge`, "≥"},
+	opEQ: {"=", "="}, opNE: {`\ne`, "≠"}, opAND: {`\land`, "∧"}, opOR: {`\lor`, "∨"},
+}
+
+// texFuncs are the functions with LaTeX operators, e.g., \sin; log is
+// the natural logarithm. Others render as \operatorname{name}.
+var texFuncs = map[string]string{
+	"sin": `\sin`, "cos": `\cos`, "tan": `\tan`, "asin": `\arcsin`,
+	"acos": `\arccos`, "atan": `\arctan`, "sinh": `\sinh`, "cosh": `\cosh`,
+	"tanh": `\tanh`, "exp": `\exp`, "log": `\ln`, "log10": `\log_{10}`,
+	"log2": `\log_{2}`, "min": `\min`, "max": `\max`,
+}
+
+// texLevel is the level of e in LaTeX and MathML: fractions, powers and
+// roots are drawn, not written inline, so they need no parentheses. A
+// quantity is parenthesized as a base, since (3 m)^2 is not 3 m^2.
+func texLevel(e Expr) int {
+	switch e := e.(type) {
+	case quantity:
+		return levelUnary
+	case binary:
+		if e.op == '/' {
+			return levelPrimary
+		}
+	case call:
+		if e.fn == "pow" && len(e.args) == 2 {
+			return levelPower
+		}
+	}
+	return level(e)
+}
+
+// baseLevel returns the minimum level of x as the base of a power: a
+// fraction is parenthesized though it needs no parentheses elsewhere.
+func baseLevel(x Expr) int {
+	if x, ok := x.(binary); ok && x.op == '/' {
+		return levelPrimary + 1
+	}
+	return levelPrimary
+}
+
+// number returns the digits of x, and its power of ten: 1e+10 is
+// 1 times 10^10.
+func number(x float64) (mant, exp string) {
+	s := strconv.FormatFloat(x, 'g', -1, 64)
+	if i := strings.IndexByte(s, 'e'); i >= 0 {
+		exp, _ := strconv.Atoi(s[i+1:])
+		return s[:i], strconv.Itoa(exp)
+	}
+	return s, ""
+}
+
+// ---- LaTeX ----
+
+// FormatLaTeX formats an expression as LaTeX math, e.g.,
+// \frac{5}{9} \cdot \left(F - 32\right), with fractions for /,
+// superscripts for ^ and pow, \sqrt for sqrt and cbrt, and cases for
+// conditional expressions.
+func FormatLaTeX(e Expr) string {
+	var buf bytes.Buffer
+	writeLaTeX(&buf, e, levelTernary)
+	return buf.String()
+}
+
+func writeLaTeX(buf *bytes.Buffer, e Expr, min int) {
+	if texLevel(e) < min {
+		buf.WriteString(`\left(`)
+		defer buf.WriteString(`\right)`)
+	}
+	switch e := e.(type) {
+	case literal:
+		writeLaTeXNumber(buf, float64(e))
+
+	case imaginary:
+		writeLaTeXNumber(buf, float64(e))
+		buf.WriteString("i")
+
+	case quantity:
+		writeLaTeXNumber(buf, float64(e.x))
+		fmt.Fprintf(buf, `\,\mathrm{%s}`, latexUnit(e.unit.Name))
+
+	case Var:
+		buf.WriteString(latexName(string(e)))
+
+	case unary:
+		switch e.op {
+		case '!':
+			buf.WriteString(`\neg `)
+		default:
+			buf.WriteRune(e.op)
+		}
+		writeLaTeX(buf, e.x, levelUnary)
+
+	case binary:
+		switch e.op {
+		case '/':
+			buf.WriteString(`\frac{`)
+			writeLaTeX(buf, e.x, levelTernary)
+			buf.WriteString("}{")
+			writeLaTeX(buf, e.y, levelTernary)
+			buf.WriteString("}")
+		case '^':
+			writeLaTeXPower(buf, e.x, e.y)
+		default:
+			prec := precedence(e.op)
+			writeLaTeX(buf, e.x, prec)
+			fmt.Fprintf(buf, " %s ", texOps[e.op].tex)
+			writeLaTeX(buf, e.y, prec+1)
+		}
+
+	case ternary:
+		buf.WriteString(`\begin{cases} `)
+		writeLaTeX(buf, e.x, levelTernary)
+		buf.WriteString(` & \text{if } `)
+		writeLaTeX(buf, e.cond, levelTernary)
+		buf.WriteString(` \\ `)
+		writeLaTeX(buf, e.y, levelTernary)
+		buf.WriteString(` & \text{otherwise} \end{cases}`)
+
+	case call:
+		writeLaTeXCall(buf, e.fn, e.args)
+
+	case apply:
+		writeLaTeXCall(buf, e.def.name, e.args)
+
+	case *Script:
+		for _, stmt := range e.stmts {
+			lhs, rhs := stmt.sides()
+			writeLaTeX(buf, lhs, levelTernary)
+			buf.WriteString(" = ")
+			writeLaTeX(buf, rhs, levelTernary)
+			buf.WriteString(`; \quad `)
+		}
+		writeLaTeX(buf, e.result, levelTernary)
+
+	default:
+		panic(fmt.Sprintf("unknown Expr: %T", e))
+	}
+}
+
+func writeLaTeXNumber(buf *bytes.Buffer, x float64) {
+	mant, exp := number(x)
+	if exp == "" {
+		buf.WriteString(mant)
+		return
+	}
+	fmt.Fprintf(buf, `%s \times 10^{%s}`, mant, exp)
+}
+
+func writeLaTeXPower(buf *bytes.Buffer, x, y Expr) {
+	buf.WriteString("{")
+	writeLaTeX(buf, x, baseLevel(x))
+	buf.WriteString("}^{")
+	writeLaTeX(buf, y, levelTernary)
+	buf.WriteString("}")
+}
+
+func writeLaTeXCall(buf *bytes.Buffer, fn string, args []Expr) {
+	if len(args) == 1 {
+		switch fn {
+		case "sqrt", "cbrt":
+			buf.WriteString(`\sqrt`)
+			if fn == "cbrt" {
+				buf.WriteString("[3]")
+			}
+			buf.WriteString("{")
+			writeLaTeX(buf, args[0], levelTernary)
+			buf.WriteString("}")
+			return
+		case "abs", "floor", "ceil":
+			delims := map[string][2]string{
+				"abs":   {`\left|`, `\right|`},
+				"floor": {`\left\lfloor `, `\right\rfloor`},
+				"ceil":  {`\left\lceil `, `\right\rceil`},
+			}[fn]
+			buf.WriteString(delims[0])
+			writeLaTeX(buf, args[0], levelTernary)
+			buf.WriteString(delims[1])
+			return
+		}
+	}
+	if fn == "pow" && len(args) == 2 {
+		writeLaTeXPower(buf, args[0], args[1])
+		return
+	}
+	if op, ok := texFuncs[fn]; ok {
+		buf.WriteString(op)
+	} else if len([]rune(fn)) == 1 {
+		buf.WriteString(fn) // f(x)
+	} else {
+		fmt.Fprintf(buf, `\operatorname{%s}`, strings.ReplaceAll(fn, "_", `\_`))
+	}
+	buf.WriteString(`\left(`)
+	for i, arg := range args {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		writeLaTeX(buf, arg, levelTernary)
+	}
+	buf.WriteString(`\right)`)
+}
+
+// latexName returns the LaTeX of a variable: Greek letters by their
+// commands, other names of several letters upright, and x_1 subscripted.
+func latexName(name string) string {
+	if i := strings.IndexByte(name, '_'); i > 0 && i < len(name)-1 {
+		return fmt.Sprintf("%s_{%s}", latexName(name[:i]), latexName(name[i+1:]))
+	}
+	if g, ok := greek[name]; ok {
+		return g.tex
+	}
+	if len([]rune(name)) == 1 {
+		return name
+	}
+	return `\mathrm{` + strings.ReplaceAll(name, "_", `\_`) + "}"
+}
+
+// latexUnit returns the LaTeX of a unit, within \mathrm.
+func latexUnit(name string) string {
+	var buf strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] != '^' {
+			buf.WriteByte(name[i])
+			continue
+		}
+		j := i + 1
+		for j < len(name) && (name[j] == '-' || '0' <= name[j] && name[j] <= '9') {
+			j++
+		}
+		fmt.Fprintf(&buf, "^{%s}", name[i+1:j])
+		i = j - 1
+	}
+	r := strings.NewReplacer("degC", `{}^{\circ}C`, "degF", `{}^{\circ}F`,
+		"µ", `\mu `, "Ω", `\Omega `, "*", `\cdot `)
+	return r.Replace(buf.String())
+}
+
+// ---- MathML ----
+
+// FormatMathML formats an expression as a MathML math element, drawn
+// like FormatLaTeX.
+func FormatMathML(e Expr) string {
+	var buf bytes.Buffer
+	buf.WriteString(`<math xmlns="http://www.w3.org/1998/Math/MathML">`)
+	writeMathML(&buf, e, levelTernary)
+	buf.WriteString(`</math>`)
+	return buf.String()
+}
+
+func writeMathML(buf *bytes.Buffer, e Expr, min int) {
+	if texLevel(e) < min {
+		buf.WriteString(`<mrow><mo>(</mo>`)
+		defer buf.WriteString(`<mo>)</mo></mrow>`)
+	}
+	switch e := e.(type) {
+	case literal:
+		writeMathMLNumber(buf, float64(e))
+
+	case imaginary:
+		buf.WriteString("<mrow>")
+		writeMathMLNumber(buf, float64(e))
+		buf.WriteString("<mi>i</mi></mrow>")
+
+	case quantity:
+		buf.WriteString("<mrow>")
+		writeMathMLNumber(buf, float64(e.x))
+		buf.WriteString(`<mspace width="0.2em"/>`)
+		writeMathMLUnit(buf, e.unit.Name)
+		buf.WriteString("</mrow>")
+
+	case Var:
+		buf.WriteString(mathMLName(string(e)))
+
+	case unary:
+		op := string(e.op)
+		switch e.op {
+		case '!':
+			op = "¬"
+		case '-':
+			op = "−"
+		}
+		fmt.Fprintf(buf, "<mrow><mo>%s</mo>", op)
+		writeMathML(buf, e.x, levelUnary)
+		buf.WriteString("</mrow>")
+
+	case binary:
+		switch e.op {
+		case '/':
+			buf.WriteString("<mfrac>")
+			writeMathMLRow(buf, e.x)
+			writeMathMLRow(buf, e.y)
+			buf.WriteString("</mfrac>")
+		case '^':
+			writeMathMLPower(buf, e.x, e.y)
+		default:
+			prec := precedence(e.op)
+			buf.WriteString("<mrow>")
+			writeMathML(buf, e.x, prec)
+			fmt.Fprintf(buf, "<mo>%s</mo>", html.EscapeString(texOps[e.op].char))
+			writeMathML(buf, e.y, prec+1)
+			buf.WriteString("</mrow>")
+		}
+
+	case ternary:
+		buf.WriteString(`<mrow><mo>{</mo><mtable><mtr><mtd>`)
+		writeMathML(buf, e.x, levelTernary)
+		buf.WriteString(`</mtd><mtd><mtext>if </mtext>`)
+		writeMathML(buf, e.cond, levelTernary)
+		buf.WriteString(`</mtd></mtr><mtr><mtd>`)
+		writeMathML(buf, e.y, levelTernary)
+		buf.WriteString(`</mtd><mtd><mtext>otherwise</mtext></mtd></mtr></mtable></mrow>`)
+
+	case call:
+		writeMathMLCall(buf, e.fn, e.args)
+
+	case apply:
+		writeMathMLCall(buf, e.def.name, e.args)
+
+	case *Script:
+		buf.WriteString("<mrow>")
+		for _, stmt := range e.stmts {
+			lhs, rhs := stmt.sides()
+			writeMathML(buf, lhs, levelTernary)
+			buf.WriteString("<mo>=</mo>")
+			writeMathML(buf, rhs, levelTernary)
+			buf.WriteString(`<mo separator="true">;</mo>`)
+		}
+		writeMathML(buf, e.result, levelTernary)
+		buf.WriteString("</mrow>")
+
+	default:
+		panic(fmt.Sprintf("unknown Expr: %T", e))
+	}
+}
+
+// writeMathMLRow writes e as a single element, an argument of a layout
+// such as mfrac.
+func writeMathMLRow(buf *bytes.Buffer, e Expr) {
+	buf.WriteString("<mrow>")
+	writeMathML(buf, e, levelTernary)
+	buf.WriteString("</mrow>")
+}
+
+func writeMathMLNumber(buf *bytes.Buffer, x float64) {
+	mant, exp := number(x)
+	neg := strings.HasPrefix(mant, "-")
+	mant = strings.TrimPrefix(mant, "-")
+	if neg {
+		buf.WriteString("<mrow><mo>−</mo>")
+	}
+	if exp == "" {
+		fmt.Fprintf(buf, "<mn>%s</mn>", mant)
+	} else {
+		fmt.Fprintf(buf, "<mrow><mn>%s</mn><mo>×</mo><msup><mn>10</mn><mn>%s</mn></msup></mrow>", mant, exp)
+	}
+	if neg {
+		buf.WriteString("</mrow>")
+	}
+}
+
+// writeMathMLUnit writes the unit name, e.g., m/s^2, with superscripts
+// for its exponents.
+func writeMathMLUnit(buf *bytes.Buffer, name string) {
+	name = strings.NewReplacer("degC", "°C", "degF", "°F").Replace(name)
+	var parts []string // the factors and the operators between them
+	start := 0
+	for i, r := range name {
+		if r == '*' || r == '/' {
+			parts = append(parts, name[start:i], string(r))
+			start = i + 1
+		}
+	}
+	parts = append(parts, name[start:])
+	if len(parts) > 1 {
+		buf.WriteString("<mrow>")
+		defer buf.WriteString("</mrow>")
+	}
+	for _, part := range parts {
+		switch part {
+		case "*":
+			buf.WriteString("<mo>⋅</mo>")
+		case "/":
+			buf.WriteString("<mo>/</mo>")
+		default:
+			base, exp, ok := strings.Cut(part, "^")
+			k, err := strconv.Atoi(exp)
+			if !ok || err != nil {
+				fmt.Fprintf(buf, `<mi mathvariant="normal">%s</mi>`, html.EscapeString(part))
+				continue
+			}
+			fmt.Fprintf(buf, `<msup><mi mathvariant="normal">%s</mi>`, html.EscapeString(base))
+			writeMathMLNumber(buf, float64(k))
+			buf.WriteString("</msup>")
+		}
+	}
+}
+
+func writeMathMLPower(buf *bytes.Buffer, x, y Expr) {
+	buf.WriteString("<msup>")
+	buf.WriteString("<mrow>")
+	writeMathML(buf, x, baseLevel(x))
+	buf.WriteString("</mrow>")
+	writeMathMLRow(buf, y)
+	buf.WriteString("</msup>")
+}
+
+func writeMathMLCall(buf *bytes.Buffer, fn string, args []Expr) {
+	if len(args) == 1 {
+		switch fn {
+		case "sqrt":
+			buf.WriteString("<msqrt>")
+			writeMathML(buf, args[0], levelTernary)
+			buf.WriteString("</msqrt>")
+			return
+		case "cbrt":
+			buf.WriteString("<mroot>")
+			writeMathMLRow(buf, args[0])
+			buf.WriteString("<mn>3</mn></mroot>")
+			return
+		case "abs", "floor", "ceil":
+			delims := map[string][2]string{
+				"abs":   {"|", "|"},
+				"floor": {"⌊", "⌋"},
+				"ceil":  {"⌈", "⌉"},
+			}[fn]
+			fmt.Fprintf(buf, "<mrow><mo>%s</mo>", delims[0])
+			writeMathML(buf, args[0], levelTernary)
+			fmt.Fprintf(buf, "<mo>%s</mo></mrow>", delims[1])
+			return
+		}
+	}
+	if fn == "pow" && len(args) == 2 {
+		writeMathMLPower(buf, args[0], args[1])
+		return
+	}
+	name := fn
+	if fn == "log" {
+		name = "ln"
+	}
+	// U+2061 is the invisible function application operator.
+	fmt.Fprintf(buf, "<mrow><mi>%s</mi><mo>\u2061</mo><mrow><mo>(</mo>", html.EscapeString(name))
+	for i, arg := range args {
+		if i > 0 {
+			buf.WriteString(`<mo separator="true">,</mo>`)
+		}
+		writeMathML(buf, arg, levelTernary)
+	}
+	buf.WriteString("<mo>)</mo></mrow></mrow>")
+}
+
+// mathMLName returns the MathML of a variable, like latexName.
+func mathMLName(name string) string {
+	if i := strings.IndexByte(name, '_'); i > 0 && i < len(name)-1 {
+		return fmt.Sprintf("<msub>%s%s</msub>", mathMLName(name[:i]), mathMLName(name[i+1:]))
+	}
+	if g, ok := greek[name]; ok {
+		return "<mi>" + g.char + "</mi>"
+	}
+	return "<mi>" + html.EscapeString(name) + "</mi>"
+}
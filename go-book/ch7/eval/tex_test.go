@@ -0,0 +1,62 @@
+package eval
+
+import "testing"
+
+func TestFormatLaTeX(t *testing.T) {
+	for _, test := range []struct{ expr, want string }{
+		{"5 / 9 * (F - 32)", `\frac{5}{9} \cdot \left(F - 32\right)`},
+		{"(x + 1) / (x - 1)", `\frac{x + 1}{x - 1}`},
+		{"x ^ (y + 1)", `{x}^{y + 1}`},
+		{"(a / b) ^ 2", `{\left(\frac{a}{b}\right)}^{2}`},
+		{"pow(x + 1, 3)", `{\left(x + 1\right)}^{3}`},
+		{"sqrt(x^2 + y^2)", `\sqrt{{x}^{2} + {y}^{2}}`},
+		{"cbrt(8)", `\sqrt[3]{8}`},
+		{"abs(x) + floor(y)", `\left|x\right| + \left\lfloor y\right\rfloor`},
+		{"sin(theta) * log(x)", `\sin\left(\theta\right) \cdot \ln\left(x\right)`},
+		{"gamma(x_1) + erf(rate)", `\operatorname{gamma}\left(x_{1}\right) + \operatorname{erf}\left(\mathrm{rate}\right)`},
+		{"x <= 1 && !(y != 2)", `x \le 1 \land \neg \left(y \ne 2\right)`},
+		{"x > 0 ? x : -x", `\begin{cases} x & \text{if } x > 0 \\ -x & \text{otherwise} \end{cases}`},
+		{"6.02e23 * 1.5e-7", `6.02 \times 10^{23} \cdot 1.5 \times 10^{-7}`},
+		{"9.8 m/s^2 + 20 degC * 0", `9.8\,\mathrm{m/s^{2}} + 20\,\mathrm{{}^{\circ}C} \cdot 0`},
+		{"f(x) = x % 2; f(3)", `f\left(x\right) = x \bmod 2; \quad f\left(3\right)`},
+		{"(3 m)^2", `{\left(3\,\mathrm{m}\right)}^{2}`},
+		{"3 m^2", `3\,\mathrm{m^{2}}`},
+		{"-(2 s) * 4 kg", `-2\,\mathrm{s} \cdot 4\,\mathrm{kg}`},
+	} {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if got := FormatLaTeX(expr); got != test.want {
+			t.Errorf("FormatLaTeX(%s) =\n%s, want\n%s", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestFormatMathML(t *testing.T) {
+	const math = `<math xmlns="http://www.w3.org/1998/Math/MathML">`
+	for _, test := range []struct{ expr, want string }{
+		{"x < 1", `<mrow><mi>x</mi><mo>&lt;</mo><mn>1</mn></mrow>`},
+		{"(a + 1) / 2", `<mfrac><mrow><mrow><mi>a</mi><mo>+</mo><mn>1</mn></mrow></mrow><mrow><mn>2</mn></mrow></mfrac>`},
+		{"pi ^ -2", `<msup><mrow><mi>π</mi></mrow><mrow><mrow><mo>−</mo><mn>2</mn></mrow></mrow></msup>`},
+		{"sqrt(x)", `<msqrt><mi>x</mi></msqrt>`},
+		{"3 m^2", `<mrow><mn>3</mn><mspace width="0.2em"/><msup><mi mathvariant="normal">m</mi><mn>2</mn></msup></mrow>`},
+		{"(3 m)^2", `<msup><mrow><mrow><mo>(</mo><mrow><mn>3</mn><mspace width="0.2em"/><mi mathvariant="normal">m</mi></mrow><mo>)</mo></mrow></mrow><mrow><mn>2</mn></mrow></msup>`},
+		{"9.8 kg*m/s^-2", `<mrow><mn>9.8</mn><mspace width="0.2em"/><mrow><mi mathvariant="normal">kg</mi><mo>⋅</mo>` +
+			`<mi mathvariant="normal">m</mi><mo>/</mo><msup><mi mathvariant="normal">s</mi><mrow><mo>−</mo><mn>2</mn></mrow></msup></mrow></mrow>`},
+		{"20 degC", `<mrow><mn>20</mn><mspace width="0.2em"/><mi mathvariant="normal">°C</mi></mrow>`},
+		{"2 * (x - y)", `<mrow><mn>2</mn><mo>⋅</mo><mrow><mo>(</mo><mrow><mi>x</mi><mo>−</mo><mi>y</mi></mrow><mo>)</mo></mrow></mrow>`},
+		{"max(x, 1e10)", "<mrow><mi>max</mi><mo>⁡</mo><mrow><mo>(</mo><mi>x</mi><mo separator=\"true\">,</mo>" +
+			"<mrow><mn>1</mn><mo>×</mo><msup><mn>10</mn><mn>10</mn></msup></mrow><mo>)</mo></mrow></mrow>"},
+	} {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if got, want := FormatMathML(expr), math+test.want+"</math>"; got != want {
+			t.Errorf("FormatMathML(%s) =\n%s, want\n%s", test.expr, got, want)
+		}
+	}
+}
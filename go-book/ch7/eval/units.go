@@ -0,0 +1,646 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"text/scanner"
+
+	"gopl.io/ch2/tempconv"
+)
+
+// A Dim is the dimension of a physical quantity: the exponents of the SI
+// base units m, kg, s, A, K, mol and cd. The zero Dim is dimensionless.
+type Dim [7]int8
+
+var baseUnits = [len(Dim{})]string{"m", "kg", "s", "A", "K", "mol", "cd"}
+
+// String returns d in terms of base units, e.g., "m*kg/s^2", or "1" if
+// d is dimensionless.
+func (d Dim) String() string {
+	var num, den []string
+	for i, k := range d {
+		name := baseUnits[i]
+		if k < 0 {
+			k = -k
+			if k != 1 {
+				name += fmt.Sprintf("^%d", k)
+			}
+			den = append(den, name)
+		} else if k > 0 {
+			if k != 1 {
+				name += fmt.Sprintf("^%d", k)
+			}
+			num = append(num, name)
+		}
+	}
+	s := strings.Join(num, "*")
+	if s == "" {
+		s = "1"
+	}
+	for _, name := range den {
+		s += "/" + name
+	}
+	return s
+}
+
+// add returns d times e^k, or false if an exponent is out of the range
+// of a Dim.
+func (d Dim) add(e Dim, k int) (Dim, bool) {
+	for i := range d {
+		if e[i] == 0 {
+			continue
+		}
+		if k < -math.MaxInt8 || k > math.MaxInt8 {
+			return Dim{}, false
+		}
+		n := int(d[i]) + int(e[i])*k
+		if n < math.MinInt8 || n > math.MaxInt8 {
+			return Dim{}, false
+		}
+		d[i] = int8(n)
+	}
+	return d, true
+}
+
+// root returns the nth root of d, if its exponents are multiples of n,
+// which must be a non-zero int8.
+func (d Dim) root(n int) (Dim, bool) {
+	if n == 0 || n < -math.MaxInt8 || n > math.MaxInt8 {
+		return Dim{}, false
+	}
+	for i := range d {
+		if int(d[i])%n != 0 {
+			return Dim{}, false
+		}
+		d[i] /= int8(n)
+	}
+	return d, true
+}
+
+// A Unit is a unit of measurement: x units are x*Scale + Offset in SI
+// base units of dimension Dim. Only temperatures such as degC have an
+// Offset; Check rejects adding two of them, or scaling one.
+type Unit struct {
+	Name   string
+	Dim    Dim
+	Scale  float64
+	Offset float64
+}
+
+// times returns u times v^k. Units with offsets cannot be combined.
+func (u Unit) times(v Unit, k int) (Unit, error) {
+	for _, w := range []Unit{u, v} {
+		if w.Offset != 0 {
+			return Unit{}, fmt.Errorf("unit %s cannot be combined with others", w.Name)
+		}
+	}
+	d, ok := u.Dim.add(v.Dim, k)
+	if !ok {
+		return Unit{}, fmt.Errorf("unit %s^%d out of range", v.Name, k)
+	}
+	return Unit{Dim: d, Scale: u.Scale * math.Pow(v.Scale, float64(k))}, nil
+}
+
+// A UnitRegistry holds the units of quantities in expressions, e.g.,
+// 5 km/h. Units may be registered to take SI prefixes, as m does in km.
+type UnitRegistry struct {
+	units    map[string]Unit
+	prefixed map[string]bool
+}
+
+// NewUnitRegistry returns a registry with no units.
+func NewUnitRegistry() *UnitRegistry {
+	return &UnitRegistry{units: make(map[string]Unit), prefixed: make(map[string]bool)}
+}
+
+// Register adds u, which takes SI prefixes if prefixes is true.
+func (r *UnitRegistry) Register(u Unit, prefixes bool) {
+	r.units[u.Name] = u
+	r.prefixed[u.Name] = prefixes
+}
+
+// siPrefixes are the SI prefixes, da before d.
+var siPrefixes = []struct {
+	prefix string
+	factor float64
+}{
+	{"da", 1e1}, {"Q", 1e30}, {"R", 1e27}, {"Y", 1e24}, {"Z", 1e21},
+	{"E", 1e18}, {"P", 1e15}, {"T", 1e12}, {"G", 1e9}, {"M", 1e6},
+	{"k", 1e3}, {"h", 1e2}, {"d", 1e-1}, {"c", 1e-2}, {"m", 1e-3},
+	{"µ", 1e-6}, {"u", 1e-6}, {"n", 1e-9}, {"p", 1e-12}, {"f", 1e-15},
+	{"a", 1e-18}, {"z", 1e-21}, {"y", 1e-24}, {"r", 1e-27}, {"q", 1e-30},
+}
+
+// Lookup returns the unit of the given name, which may be that of a
+// registered unit with an SI prefix.
+func (r *UnitRegistry) Lookup(name string) (Unit, bool) {
+	if u, ok := r.units[name]; ok {
+		return u, true
+	}
+	for _, p := range siPrefixes {
+		base := strings.TrimPrefix(name, p.prefix)
+		if u, ok := r.units[base]; ok && base != name && r.prefixed[base] {
+			u.Name = name
+			u.Scale *= p.factor
+			return u, true
+		}
+	}
+	return Unit{}, false
+}
+
+// Names returns the names of the registered units, in order.
+func (r *UnitRegistry) Names() []string {
+	var names []string
+	for name := range r.units {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Parse parses a unit such as km/h, m/s^2 or kg*m^2/s^2 in terms of the
+// units of r. It has no spaces.
+func (r *UnitRegistry) Parse(s string) (_ Unit, err error) {
+	defer func() {
+		switch x := recover().(type) {
+		case nil:
+			// no panic
+		case *ParseError:
+			err = x
+		default:
+			panic(x)
+		}
+	}()
+	lex := &lexer{units: r, input: s}
+	lex.scan.Init(strings.NewReader(s))
+	lex.scan.Error = func(_ *scanner.Scanner, msg string) { panic(lex.error(msg)) }
+	lex.scan.Mode = scanner.ScanIdents | scanner.ScanInts
+	lex.next() // initial lookahead
+	if lex.token != scanner.Ident {
+		panic(lex.error(fmt.Sprintf("got %s, want a unit", lex.describe())))
+	}
+	u := parseUnit(lex)
+	if lex.token != scanner.EOF {
+		panic(lex.error(fmt.Sprintf("unexpected %s", lex.describe())))
+	}
+	return u, nil
+}
+
+// unit = name ('^' int)? (('*' | '/') name ('^' int)?)*, without spaces
+func parseUnit(lex *lexer) Unit {
+	end := -1 // of the previous token, for parts of the unit
+	adjacent := func() bool {
+		return end < 0 || lex.scan.Position.Offset == end
+	}
+	next := func() {
+		end = lex.scan.Position.Offset + len(lex.text())
+		lex.next()
+	}
+	start := lex.scan.Position
+	u := Unit{Scale: 1}
+	sign := 1
+	for first := true; ; first = false {
+		if lex.token != scanner.Ident {
+			panic(lex.error(fmt.Sprintf("got %s, want a unit", lex.describe())))
+		}
+		v, ok := lex.units.Lookup(lex.text())
+		if !ok {
+			panic(lex.error(fmt.Sprintf("unknown unit %s", lex.text())))
+		}
+		next() // consume unit name
+		k := 1
+		if lex.token == '^' && adjacent() {
+			next() // consume '^'
+			neg := lex.token == '-' && adjacent()
+			if neg {
+				next() // consume '-'
+			}
+			if lex.token != scanner.Int || !adjacent() {
+				panic(lex.error(fmt.Sprintf("got %s, want an integer exponent", lex.describe())))
+			}
+			fmt.Sscan(lex.text(), &k)
+			if neg {
+				k = -k
+			}
+			next() // consume exponent
+		}
+		if first && k == 1 {
+			u = v // possibly with an offset
+		} else {
+			var err error
+			if u, err = u.times(v, sign*k); err != nil {
+				panic(lex.errorAt(start, err.Error()))
+			}
+		}
+		if (lex.token != '*' && lex.token != '/') || !adjacent() {
+			u.Name = lex.input[start.Offset:end]
+			return u
+		}
+		sign = 1
+		if lex.token == '/' {
+			sign = -1
+		}
+		next() // consume '*' or '/'
+		if !adjacent() {
+			panic(lex.error("spaces in unit"))
+		}
+	}
+}
+
+// DefaultUnits are the units of Parse: the SI base and derived units,
+// with SI prefixes; common non-SI units such as min, h, ft, mi, lb and
+// L; angles rad and deg; and the temperatures degC and degF,
+// which convert as ch2/tempconv does.
+var DefaultUnits = newDefaultUnits()
+
+func newDefaultUnits() *UnitRegistry {
+	r := NewUnitRegistry()
+	for i, name := range baseUnits {
+		var d Dim
+		d[i] = 1
+		if name == "kg" {
+			r.Register(Unit{Name: "g", Dim: d, Scale: 1e-3}, true)
+			continue
+		}
+		r.Register(Unit{Name: name, Dim: d, Scale: 1}, true)
+	}
+	for _, u := range []struct {
+		name, def string
+		scale     float64
+		prefixes  bool
+	}{
+		{"Hz", "s^-1", 1, true},
+		{"N", "kg*m/s^2", 1, true},
+		{"Pa", "N/m^2", 1, true},
+		{"J", "N*m", 1, true},
+		{"W", "J/s", 1, true},
+		{"C", "A*s", 1, true},
+		{"V", "W/A", 1, true},
+		{"ohm", "V/A", 1, true},
+		{"Ω", "V/A", 1, true},
+		{"L", "dm^3", 1, true},
+		{"min", "s", 60, false},
+		{"h", "min", 60, false},
+		{"d", "h", 24, false},
+		{"in", "cm", 2.54, false},
+		{"ft", "in", 12, false},
+		{"yd", "ft", 3, false},
+		{"mi", "yd", 1760, false},
+		{"mph", "mi/h", 1, false},
+		{"lb", "kg", 0.45359237, false},
+		{"bar", "Pa", 1e5, true},
+		{"eV", "J", 1.602176634e-19, true},
+	} {
+		def, err := r.Parse(u.def)
+		if err != nil {
+			panic(err)
+		}
+		r.Register(Unit{Name: u.name, Dim: def.Dim, Scale: u.scale * def.Scale}, u.prefixes)
+	}
+	r.Register(Unit{Name: "rad", Scale: 1}, true)
+	r.Register(Unit{Name: "deg", Scale: math.Pi / 180}, false)
+
+	// Temperatures in SI units are kelvins above absolute zero.
+	r.Register(Unit{Name: "degC", Dim: r.units["K"].Dim, Scale: 1,
+		Offset: float64(0 - tempconv.AbsoluteZeroC)}, false)
+	r.Register(Unit{Name: "degF", Dim: r.units["K"].Dim,
+		Scale:  float64(tempconv.FToC(1) - tempconv.FToC(0)),
+		Offset: float64(tempconv.FToC(0) - tempconv.AbsoluteZeroC)}, false)
+	return r
+}
+
+// ---- quantities ----
+
+// A quantity is a number with a unit, e.g., 5 km/h. Its value is in SI
+// base units.
+type quantity struct {
+	x    literal
+	unit Unit
+}
+
+func (q quantity) Eval(_ Env) float64 {
+	return float64(q.x)*q.unit.Scale + q.unit.Offset
+}
+
+func (quantity) Check(vars map[Var]bool) error {
+	return nil
+}
+
+func (q quantity) EvalChecked(_ Env) (float64, error) {
+	return q.Eval(nil), nil
+}
+
+// expr returns the value of q as an expression of literals, for the
+// evaluators that know nothing of units.
+func (q quantity) expr() Expr {
+	var e Expr = binary{'*', q.x, literal(q.unit.Scale)}
+	if q.unit.Offset != 0 {
+		e = binary{'+', e, literal(q.unit.Offset)}
+	}
+	return e
+}
+
+// EvalIn returns the value of e in env in the given unit, e.g., "km/h",
+// which must have the dimension of e, if that is known.
+func EvalIn(e Expr, env Env, unit string) (float64, error) {
+	u, err := DefaultUnits.Parse(unit)
+	if err != nil {
+		return 0, err
+	}
+	d, known, err := dimension(e)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := offsetScale(e); err != nil {
+		return 0, err
+	}
+	if known && d != u.Dim {
+		return 0, fmt.Errorf("cannot convert %s of dimension %s to %s", Format(e), d, u.Name)
+	}
+	z, err := e.EvalChecked(env)
+	if err != nil {
+		return 0, err
+	}
+	return (z - u.Offset) / u.Scale, nil
+}
+
+// ---- dimensional analysis ----
+
+// dimension returns the dimension of e, and whether it is known, or an
+// error if its operands have incompatible dimensions, e.g., 3 m + 2 s.
+// The dimensions of variables, and of the calls of functions defined by
+// scripts, are not known: they may be of any dimension.
+func dimension(e Expr) (Dim, bool, error) {
+	switch e := e.(type) {
+	case literal:
+		return Dim{}, true, nil
+
+	case quantity:
+		return e.unit.Dim, true, nil
+
+	case unary:
+		d, known, err := dimension(e.x)
+		if e.op == '!' {
+			return Dim{}, true, err
+		}
+		return d, known, err
+
+	case binary:
+		x, xknown, err := dimension(e.x)
+		if err != nil {
+			return Dim{}, false, err
+		}
+		y, yknown, err := dimension(e.y)
+		if err != nil {
+			return Dim{}, false, err
+		}
+		switch e.op {
+		case '*', '/':
+			k := 1
+			if e.op == '/' {
+				k = -1
+			}
+			d, ok := x.add(y, k)
+			if !ok {
+				return Dim{}, false, fmt.Errorf("%s: dimension out of range", Format(e))
+			}
+			return d, xknown && yknown, nil
+		case '^':
+			return powerDim(e, e.y, x, xknown, y, yknown)
+		case opAND, opOR:
+			return Dim{}, true, nil
+		}
+		d, known, err := sameDim(e, []Dim{x, y}, []bool{xknown, yknown})
+		if e.op != '+' && e.op != '-' && e.op != '%' {
+			return Dim{}, true, err // a comparison
+		}
+		return d, known, err
+
+	case ternary:
+		if _, _, err := dimension(e.cond); err != nil {
+			return Dim{}, false, err
+		}
+		dims, known, err := dimensions([]Expr{e.x, e.y})
+		if err != nil {
+			return Dim{}, false, err
+		}
+		return sameDim(e, dims, known)
+
+	case call:
+		if !e.builtinFunc() {
+			return Dim{}, true, dimensionless(e, e.args)
+		}
+		switch e.fn {
+		case "abs", "ceil", "floor", "round", "roundtoeven", "trunc",
+			"min", "max", "hypot", "dim", "mod", "remainder", "nextafter":
+			dims, known, err := dimensions(e.args)
+			if err != nil {
+				return Dim{}, false, err
+			}
+			return sameDim(e, dims, known)
+		case "copysign":
+			if _, _, err := dimension(e.args[1]); err != nil {
+				return Dim{}, false, err
+			}
+			return dimension(e.args[0])
+		case "sqrt", "cbrt":
+			d, known, err := dimension(e.args[0])
+			if err != nil || !known {
+				return Dim{}, false, err
+			}
+			n := map[string]int{"sqrt": 2, "cbrt": 3}[e.fn]
+			if d, ok := d.root(n); ok {
+				return d, true, nil
+			}
+			return Dim{}, false, fmt.Errorf("%s: %s of dimension %s", Format(e), e.fn, d)
+		case "pow":
+			x, xknown, err := dimension(e.args[0])
+			if err != nil {
+				return Dim{}, false, err
+			}
+			y, yknown, err := dimension(e.args[1])
+			if err != nil {
+				return Dim{}, false, err
+			}
+			return powerDim(e, e.args[1], x, xknown, y, yknown)
+		}
+		return Dim{}, true, dimensionless(e, e.args)
+
+	case apply:
+		for _, arg := range e.args {
+			if _, _, err := dimension(arg); err != nil {
+				return Dim{}, false, err
+			}
+		}
+	}
+	return Dim{}, false, nil // Var, imaginary, apply, *Script
+}
+
+// builtinFunc reports whether c calls a function of DefaultRegistry,
+// whose dimensions dimension knows.
+func (c call) builtinFunc() bool {
+	_, builtin, err := c.builtin()
+	return err == nil && builtin
+}
+
+// dimensions returns the dimensions of args, and whether each is known.
+func dimensions(args []Expr) ([]Dim, []bool, error) {
+	dims := make([]Dim, len(args))
+	known := make([]bool, len(args))
+	for i, arg := range args {
+		var err error
+		if dims[i], known[i], err = dimension(arg); err != nil {
+			return nil, nil, err
+		}
+	}
+	return dims, known, nil
+}
+
+// sameDim returns the dimension of the operands of e, of dimensions dims,
+// which must agree where known.
+func sameDim(e Expr, dims []Dim, known []bool) (Dim, bool, error) {
+	var d Dim
+	dknown := false
+	for i, x := range dims {
+		if !known[i] {
+			continue
+		}
+		if dknown && x != d {
+			return Dim{}, false, fmt.Errorf("%s: incompatible dimensions %s and %s", Format(e), d, x)
+		}
+		d, dknown = x, true
+	}
+	return d, dknown, nil
+}
+
+// dimensionless reports an error unless args, of e, are dimensionless.
+func dimensionless(e Expr, args []Expr) error {
+	for _, arg := range args {
+		d, known, err := dimension(arg)
+		if err != nil {
+			return err
+		}
+		if known && d != (Dim{}) {
+			return fmt.Errorf("%s: argument of dimension %s, want dimensionless", Format(e), d)
+		}
+	}
+	return nil
+}
+
+// powerDim returns the dimension of x^y, of e: y must be dimensionless,
+// and constant unless x is dimensionless too.
+func powerDim(e, exp Expr, x Dim, xknown bool, y Dim, yknown bool) (Dim, bool, error) {
+	if yknown && y != (Dim{}) {
+		return Dim{}, false, fmt.Errorf("%s: exponent of dimension %s", Format(e), y)
+	}
+	if !xknown || x == (Dim{}) {
+		return x, xknown, nil
+	}
+	if !isConstant(exp) {
+		return Dim{}, false, fmt.Errorf("%s: variable exponent of dimension %s", Format(e), x)
+	}
+	k := exp.Eval(nil)
+	if k != math.Trunc(k) {
+		// A root, e.g., x^0.5, of a degree that fits in a Dim.
+		if n := math.Round(1 / k); math.Abs(n) <= math.MaxInt8 && 1/n == k {
+			if d, ok := x.root(int(n)); ok {
+				return d, true, nil
+			}
+		}
+		return Dim{}, false, fmt.Errorf("%s: fractional power of dimension %s", Format(e), x)
+	}
+	if math.Abs(k) > math.MaxInt8 {
+		return Dim{}, false, fmt.Errorf("%s: dimension out of range", Format(e))
+	}
+	d, ok := Dim{}.add(x, int(k))
+	if !ok {
+		return Dim{}, false, fmt.Errorf("%s: dimension out of range", Format(e))
+	}
+	return d, true, nil
+}
+
+// offsetScale reports whether e is a temperature on a scale with an
+// offset, such as degC, rather than a difference of temperatures, or an
+// error if e adds two such temperatures, or scales one: in SI base units,
+// 20 degC + 10 degC is 576.3 K, or 303.15 degC, and 2 * 20 degC is
+// 586.3 K. The sum of such a temperature and a difference, or the
+// difference of two, is sound.
+func offsetScale(e Expr) (bool, error) {
+	switch e := e.(type) {
+	case quantity:
+		return e.unit.Offset != 0, nil
+
+	case unary:
+		x, err := offsetScale(e.x)
+		switch {
+		case err != nil || e.op == '!':
+			return false, err
+		case x && e.op == '-':
+			return false, offsetError(e, "-")
+		}
+		return x, nil
+
+	case binary:
+		x, err := offsetScale(e.x)
+		if err != nil {
+			return false, err
+		}
+		y, err := offsetScale(e.y)
+		if err != nil {
+			return false, err
+		}
+		switch e.op {
+		case '+':
+			if x && y {
+				return false, fmt.Errorf("%s: cannot add two temperatures on an offset scale", Format(e))
+			}
+			return x || y, nil
+		case '-':
+			return x && !y, nil
+		case '*', '/', '%', '^':
+			if x || y {
+				return false, offsetError(e, opName(e.op))
+			}
+		}
+		return false, nil // a comparison, or logical
+
+	case ternary:
+		if _, err := offsetScale(e.cond); err != nil {
+			return false, err
+		}
+		x, err := offsetScale(e.x)
+		if err != nil {
+			return false, err
+		}
+		y, err := offsetScale(e.y)
+		return x || y, err
+
+	case call:
+		any := false
+		for _, arg := range e.args {
+			x, err := offsetScale(arg)
+			if err != nil {
+				return false, err
+			}
+			any = any || x
+		}
+		if any && (e.fn != "min" && e.fn != "max" || !e.builtinFunc()) {
+			return false, offsetError(e, e.fn)
+		}
+		return any, nil
+
+	case apply:
+		for _, arg := range e.args {
+			if _, err := offsetScale(arg); err != nil {
+				return false, err
+			}
+		}
+	}
+	return false, nil
+}
+
+func offsetError(e Expr, op string) error {
+	return fmt.Errorf("%s: cannot apply %s to a temperature on an offset scale", Format(e), op)
+}
@@ -0,0 +1,192 @@
+package eval
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestEvalIn(t *testing.T) {
+	tests := []struct {
+		expr string
+		env  Env
+		unit string
+		want float64
+	}{
+		{"3 m", nil, "m", 3},
+		{"5 km/h", nil, "m/s", 1.3888888888888888},
+		{"1 km + 300 m", nil, "m", 1300},
+		{"20 degC", nil, "K", 293.15},
+		{"68 degF", nil, "degC", 20},
+		{"100 degC", nil, "degF", 212},
+		{"-40 degC", nil, "degF", -40},
+		{"20 degC > 60 degF", nil, "rad", 1},
+		{"9.8 m/s^2 * 2 s", nil, "m/s", 19.6},
+		{"1 N*m", nil, "J", 1},
+		{"3 ft", nil, "m", 0.9144},
+		{"60 mph", nil, "km/h", 96.56064},
+		{"2 h", nil, "min", 120},
+		{"1 L", nil, "cm^3", 1000},
+		{"5 mm", nil, "µm", 5000},
+		{"1 kHz * 1 ms", nil, "rad", 1},
+		{"sqrt(4 m^2)", nil, "m", 2},
+		{"(3 m) ^ 2", nil, "m^2", 9},
+		{"(16 m^4) ^ 0.25", nil, "m", 2},
+		{"x * 2 m", Env{"x": 3}, "cm", 600},
+		{"2 km / h", Env{"h": 4}, "m", 500},
+		{"max(1 m, 3 ft)", nil, "m", 1},
+		{"abs(-2 kPa)", nil, "bar", 0.02},
+		{"sin(90 deg)", nil, "rad", 1},
+		{"20 degC + 10 K", nil, "degC", 30},
+		{"30 degC - 20 degC", nil, "K", 10},
+		{"86 degF - 5 K", nil, "degC", 25},
+		{"min(20 degC, 300 K)", nil, "degC", 20},
+		{"x > 0 ? 20 degC : 30 degC", Env{"x": 1}, "degC", 20},
+		{"(30 degC - 20 degC) * 2", nil, "K", 20},
+	}
+	for _, test := range tests {
+		expr, err := Parse(test.expr)
+		if err == nil {
+			err = expr.Check(map[Var]bool{})
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		got, err := EvalIn(expr, test.env, test.unit)
+		if err != nil {
+			t.Errorf("EvalIn(%s, %s): %v", test.expr, test.unit, err)
+			continue
+		}
+		if math.Abs(got-test.want) > 1e-12*math.Max(1, math.Abs(test.want)) {
+			t.Errorf("EvalIn(%s, %s) = %g, want %g", test.expr, test.unit, got, test.want)
+		}
+		// Format prints quantities that parse back.
+		expr2, err := Parse(Format(expr))
+		if err != nil {
+			t.Errorf("Parse(Format(%s)): %v", test.expr, err)
+		} else if got, want := expr2.Eval(test.env), expr.Eval(test.env); got != want {
+			t.Errorf("%s: Format = %s evaluates to %g, want %g", test.expr, Format(expr), got, want)
+		}
+	}
+}
+
+func TestUnitErrors(t *testing.T) {
+	for _, test := range []struct{ expr, want string }{
+		{"3 m + 2 s", "(3 m + 2 s): incompatible dimensions m and s"},
+		{"1 m < 2 kg", "(1 m < 2 kg): incompatible dimensions m and kg"},
+		{"x > 0 ? 1 m : 1 s", "((x > 0) ? 1 m : 1 s): incompatible dimensions m and s"},
+		{"2 m + 1", "(2 m + 1): incompatible dimensions m and 1"},
+		{"min(1 m, 2 m, 3 s)", "min(1 m, 2 m, 3 s): incompatible dimensions m and s"},
+		{"sin(3 m)", "sin(3 m): argument of dimension m, want dimensionless"},
+		{"2 ^ (1 m)", "(2 ^ 1 m): exponent of dimension m"},
+		{"(1 m) ^ x", "(1 m ^ x): variable exponent of dimension m"},
+		{"(1 m) ^ 1.5", "(1 m ^ 1.5): fractional power of dimension m"},
+		{"sqrt(2 m)", "sqrt(2 m): sqrt of dimension m"},
+		{"(2 s) ^ 1e-300", "(2 s ^ 1e-300): fractional power of dimension s"},
+		{"2 s ^ 2.5e-10", "(2 s ^ 2.5e-10): fractional power of dimension s"},
+		{"(2 s) ^ -0.0078125", "(2 s ^ (-0.0078125)): fractional power of dimension s"},
+		{"2 m ^ 200", "(2 m ^ 200): dimension out of range"},
+		{"(3 m) ^ 128", "(3 m ^ 128): dimension out of range"},
+		{"(3 m) ^ 1e300", "(3 m ^ 1e+300): dimension out of range"},
+		{"(1 m^100) * (1 m^100)", "(1 m^100 * 1 m^100): dimension out of range"},
+		{"1 m^100/s*m^100", "1:3: unit m^100 out of range"},
+		{"2 degC/h", "1:3: unit degC cannot be combined with others"},
+		{"3 m/x", "1:5: unknown unit x"},
+		{"3 m^x", "1:5: got identifier x, want an integer exponent"},
+		{"3 m/ s", "1:6: spaces in unit"},
+		{"20 degC + 10 degC", "(20 degC + 10 degC): cannot add two temperatures on an offset scale"},
+		{"2 * 20 degC", "(2 * 20 degC): cannot apply * to a temperature on an offset scale"},
+		{"(20 degC + 1 K) / 2", "((20 degC + 1 K) / 2): cannot apply / to a temperature on an offset scale"},
+		{"-(20 degC + 1 K)", "(-(20 degC + 1 K)): cannot apply - to a temperature on an offset scale"},
+		{"abs(20 degC)", "abs(20 degC): cannot apply abs to a temperature on an offset scale"},
+		{"max(20 degC, 300 K) + 1 degF", "(max(20 degC, 300 K) + 1 degF): cannot add two temperatures on an offset scale"},
+	} {
+		expr, err := Parse(test.expr)
+		if err == nil {
+			err = expr.Check(map[Var]bool{})
+		}
+		if err == nil || err.Error() != test.want {
+			t.Errorf("%s: got error %v, want %s", test.expr, err, test.want)
+		}
+	}
+
+	expr, _ := Parse("3 m + x")
+	if err := expr.Check(map[Var]bool{}); err != nil {
+		t.Errorf("%s: %v", Format(expr), err)
+	}
+	want := "cannot convert 3 m of dimension m to s"
+	if _, err := EvalIn(mustParse(t, "3 m"), nil, "s"); err == nil || err.Error() != want {
+		t.Errorf("EvalIn(3 m, s) = %v, want %s", err, want)
+	}
+}
+
+// TestCheckLarge checks long sums and deep nests of operators, whose
+// dimensions Check would take exponential time to analyze per node.
+func TestCheckLarge(t *testing.T) {
+	sum := "x" + strings.Repeat(" + x", 999)
+	nest := strings.Repeat("min(1 m, ", 100) + "x" + strings.Repeat(")", 100)
+	cond := strings.Repeat("x > 0 ? 1 m : ", 100) + "2 m"
+	for _, s := range []string{sum, nest, cond, sum + " + 1 s"} {
+		expr := mustParse(t, s)
+		if err := expr.Check(map[Var]bool{}); err != nil {
+			t.Errorf("Check: %v", err)
+		}
+	}
+
+	expr := mustParse(t, nest+" + 1 s")
+	if err := expr.Check(map[Var]bool{}); err == nil || !strings.HasSuffix(err.Error(), "incompatible dimensions m and s") {
+		t.Errorf("Check = %v, want incompatible dimensions m and s", err)
+	}
+}
+
+func TestUnits(t *testing.T) {
+	for _, test := range []struct{ unit, dim string }{
+		{"N", "m*kg/s^2"},
+		{"kHz", "1/s"},
+		{"J/K", "m^2*kg/s^2/K"},
+		{"ohm", "m^2*kg/s^3/A^2"},
+		{"rad", "1"},
+		{"mol/L", "mol/m^3"},
+	} {
+		u, err := DefaultUnits.Parse(test.unit)
+		if err != nil {
+			t.Errorf("%s: %v", test.unit, err)
+			continue
+		}
+		if got := u.Dim.String(); got != test.dim {
+			t.Errorf("%s has dimension %s, want %s", test.unit, got, test.dim)
+		}
+	}
+
+	// Prefixes apply only to units registered to take them.
+	r := NewUnitRegistry()
+	r.Register(Unit{Name: "m", Dim: Dim{1}, Scale: 1}, true)
+	for name, ok := range map[string]bool{"m": true, "km": true, "dam": true, "s": false, "kkm": false} {
+		if _, got := r.Lookup(name); got != ok {
+			t.Errorf("Lookup(%s) = %t, want %t", name, got, ok)
+		}
+	}
+
+	// Other evaluators see quantities as their values in SI units.
+	expr := mustParse(t, "1 km + 300 m")
+	if got := Format(Simplify(expr)); got != "1300" {
+		t.Errorf("Simplify = %s, want 1300", got)
+	}
+	if z, err := EvalRat(expr, nil); err != nil || z.String() != "1300/1" {
+		t.Errorf("EvalRat = %v, %v, want 1300/1", z, err)
+	}
+	if got := Format(Simplify(Derive(mustParse(t, "x * 3 km"), "x"))); got != "3000" {
+		t.Errorf("Derive = %s, want 3000", got)
+	}
+}
+
+// mustParse parses s, failing the test if it is not an expression.
+func mustParse(t *testing.T, s string) Expr {
+	t.Helper()
+	expr, err := Parse(s)
+	if err != nil {
+		t.Fatalf("%s: %v", s, err)
+	}
+	return expr
+}
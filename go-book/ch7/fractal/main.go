@@ -0,0 +1,208 @@
+// The fractal program emits a PNG image of a fractal whose iteration
+// formula and escape condition are eval expressions, generalizing
+// gopl.io/ch3/mandelbrot.
+//
+// Each pixel stands for a complex point c. Starting from z = start, the
+// program sets z = iterate until escape is true, and shades the pixel by
+// the number of iterations n, or black if it never escapes. With -value,
+// each pixel is instead colored by the complex value of an expression.
+// The expressions may use c, z and n. For example:
+//
+//	fractal > mandelbrot.png
+//	fractal -iterate 'z^3 + c' > multibrot.png
+//	fractal -start c -iterate 'z^2 + (-0.8 + 0.156i)' > julia.png
+//	fractal -preset newton > newton.png
+//	fractal -value 'sqrt(c)' -luma 128 > sqrt.png
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"os"
+	"runtime"
+	"sync"
+
+	"gopl.io/ch7/eval"
+)
+
+// A preset sets the defaults of the flags of a fractal of ch3/mandelbrot.
+type preset struct {
+	start, iterate, escape, value string
+	iterations, contrast, luma    int
+}
+
+var presets = map[string]preset{
+	"mandelbrot": {start: "0", iterate: "z*z + c", escape: "abs(z) > 2", iterations: 200, contrast: 15},
+	// Newton's method for z^4 - 1.
+	"newton": {start: "c", iterate: "z - (z - 1/z^3) / 4", escape: "abs(z^4 - 1) < 1e-6", iterations: 37, contrast: 7},
+	"acos":   {value: "acos(c)", luma: 192},
+	"sqrt":   {value: "sqrt(c)", luma: 128},
+}
+
+var (
+	presetName = flag.String("preset", "mandelbrot", "mandelbrot, newton, acos or sqrt; other flags override it")
+	start      = flag.String("start", "", "initial z")
+	iterate    = flag.String("iterate", "", "next z")
+	escape     = flag.String("escape", "", "condition that ends the iteration")
+	value      = flag.String("value", "", "color by this value instead of iterating")
+	iterations = flag.Int("iterations", 0, "maximum number of iterations")
+	contrast   = flag.Int("contrast", 0, "gray levels per iteration")
+	luma       = flag.Int("luma", 0, "luma of -value colors")
+	size       = flag.Int("size", 1024, "width and height in pixels")
+	xmin       = flag.Float64("xmin", -2, "left of the image")
+	xmax       = flag.Float64("xmax", +2, "right of the image")
+	ymin       = flag.Float64("ymin", -2, "top of the image")
+	ymax       = flag.Float64("ymax", +2, "bottom of the image")
+)
+
+func main() {
+	flag.Parse()
+	p, ok := presets[*presetName]
+	if !ok {
+		log.Fatalf("fractal: unknown preset %q", *presetName)
+	}
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if !set["value"] && p.value != "" && (set["start"] || set["iterate"] || set["escape"]) {
+		p = presets["mandelbrot"] // iterate, though the preset colors by value
+	}
+	for _, f := range []struct {
+		name  string
+		s     *string
+		value string
+	}{{"start", start, p.start}, {"iterate", iterate, p.iterate}, {"escape", escape, p.escape}, {"value", value, p.value}} {
+		if !set[f.name] {
+			*f.s = f.value
+		}
+	}
+	for _, f := range []struct {
+		name  string
+		n     *int
+		value int
+	}{{"iterations", iterations, p.iterations}, {"contrast", contrast, p.contrast}, {"luma", luma, p.luma}} {
+		if !set[f.name] {
+			*f.n = f.value
+		}
+	}
+	if *value == "" && (*start == "" || *iterate == "" || *escape == "") {
+		log.Fatal("fractal: -start, -iterate and -escape are required without -value")
+	}
+	if *size < 1 || *size > 1<<14 {
+		log.Fatalf("fractal: size %d out of range", *size)
+	}
+
+	var f pointFunc
+	var err error
+	if *value != "" {
+		f, err = valueColor(*value, uint8(*luma))
+	} else {
+		f, err = escapeColor(*start, *iterate, *escape, *iterations, uint8(*contrast))
+	}
+	if err != nil {
+		log.Fatalf("fractal: %v", err)
+	}
+	img := render(f, *size, *size, *xmin, *ymin, *xmax, *ymax)
+	if err := png.Encode(os.Stdout, img); err != nil {
+		log.Fatalf("fractal: %v", err)
+	}
+}
+
+// A pointFunc returns the color of point c, evaluating in env, which
+// it may modify.
+type pointFunc func(c complex128, env eval.ComplexEnv) color.Color
+
+// parse parses and checks a complex expression of the variables c, z
+// and n.
+func parse(name, s string) (eval.Expr, error) {
+	expr, err := eval.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("-%s: %v", name, err)
+	}
+	vars := make(map[eval.Var]bool)
+	if err := eval.CheckComplex(expr, vars); err != nil {
+		return nil, fmt.Errorf("-%s: %v", name, err)
+	}
+	for v := range vars {
+		if v != "c" && v != "z" && v != "n" {
+			return nil, fmt.Errorf("-%s: undefined variable: %s", name, v)
+		}
+	}
+	return expr, nil
+}
+
+// escapeColor returns the shading of escape-time fractals, like
+// ch3/mandelbrot: lighter for points that escape sooner.
+func escapeColor(start, iterate, escape string, iterations int, contrast uint8) (pointFunc, error) {
+	z0, err := parse("start", start)
+	if err != nil {
+		return nil, err
+	}
+	next, err := parse("iterate", iterate)
+	if err != nil {
+		return nil, err
+	}
+	done, err := parse("escape", escape)
+	if err != nil {
+		return nil, err
+	}
+	return func(c complex128, env eval.ComplexEnv) color.Color {
+		env["c"], env["n"] = c, 0
+		env["z"] = eval.EvalComplex(z0, env)
+		for n := 0; n < iterations; n++ {
+			env["z"] = eval.EvalComplex(next, env)
+			if eval.EvalComplex(done, env) != 0 {
+				return color.Gray{255 - contrast*uint8(n)}
+			}
+			env["n"] = complex(float64(n+1), 0)
+		}
+		return color.Black
+	}, nil
+}
+
+// valueColor returns the coloring of ch3/mandelbrot's acos and sqrt: the
+// real and imaginary parts of the value as the blue and red chroma.
+func valueColor(value string, luma uint8) (pointFunc, error) {
+	expr, err := parse("value", value)
+	if err != nil {
+		return nil, err
+	}
+	return func(c complex128, env eval.ComplexEnv) color.Color {
+		env["c"], env["z"], env["n"] = c, c, 0
+		v := eval.EvalComplex(expr, env)
+		blue := uint8(real(v)*128) + 127
+		red := uint8(imag(v)*128) + 127
+		return color.YCbCr{luma, blue, red}
+	}, nil
+}
+
+// render computes the image, rows in parallel.
+func render(f pointFunc, width, height int, xmin, ymin, xmax, ymax float64) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	rows := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			env := make(eval.ComplexEnv)
+			for py := range rows {
+				y := float64(py)/float64(height)*(ymax-ymin) + ymin
+				for px := 0; px < width; px++ {
+					x := float64(px)/float64(width)*(xmax-xmin) + xmin
+					// Image point (px, py) represents complex value c.
+					img.Set(px, py, f(complex(x, y), env))
+				}
+			}
+		}()
+	}
+	for py := 0; py < height; py++ {
+		rows <- py
+	}
+	close(rows)
+	wg.Wait()
+	return img
+}
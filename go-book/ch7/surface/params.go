@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"gopl.io/ch7/eval"
+)
+
+// Limits on the requests of /plot.
+const (
+	maxExpr   = 1000 // bytes of expr
+	maxNodes  = 2000 // of expr with its functions inlined
+	minCanvas = 16   // pixels
+	maxCanvas = 4096
+	maxCells  = 400
+	maxVars   = 10
+)
+
+// params are the options of a plot.
+type params struct {
+	width, height          int
+	cells                  int
+	xmin, xmax, ymin, ymax float64
+	zrange                 zrange
+	zset                   bool    // zrange is given, not autoscaled
+	angle                  float64 // radians
+	env                    eval.Env
+	colors                 gradient
+	format                 string
+}
+
+// parseParams returns the params of the query form, or an error for
+// missing, malformed or out of range values.
+func parseParams(form url.Values) (*params, error) {
+	p := &params{format: "svg", env: eval.Env{}}
+	if n := len(form.Get("expr")); n > maxExpr {
+		return nil, fmt.Errorf("expr is %d bytes, more than %d", n, maxExpr)
+	}
+
+	var err error
+	integer := func(name string, v *int, def, lo, hi int) {
+		*v = def
+		s := form.Get(name)
+		if s == "" || err != nil {
+			return
+		}
+		n, e := strconv.Atoi(s)
+		if e != nil || n < lo || n > hi {
+			err = fmt.Errorf("bad %s %q: want an integer in [%d, %d]", name, s, lo, hi)
+			return
+		}
+		*v = n
+	}
+	number := func(name string, v *float64, def float64) bool {
+		*v = def
+		s := form.Get(name)
+		if s == "" || err != nil {
+			return false
+		}
+		x, e := strconv.ParseFloat(s, 64)
+		if e != nil || math.IsNaN(x) || math.IsInf(x, 0) {
+			err = fmt.Errorf("bad %s %q: want a finite number", name, s)
+			return false
+		}
+		*v = x
+		return true
+	}
+	integer("width", &p.width, 600, minCanvas, maxCanvas)
+	integer("height", &p.height, 320, minCanvas, maxCanvas)
+	integer("cells", &p.cells, 100, 1, maxCells)
+	number("xmin", &p.xmin, -15)
+	number("xmax", &p.xmax, 15)
+	number("ymin", &p.ymin, -15)
+	number("ymax", &p.ymax, 15)
+	zmin := number("zmin", &p.zrange.lo, 0)
+	zmax := number("zmax", &p.zrange.hi, 0)
+	number("angle", &p.angle, 30)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case p.xmin >= p.xmax:
+		return nil, fmt.Errorf("xmin %g is not less than xmax %g", p.xmin, p.xmax)
+	case p.ymin >= p.ymax:
+		return nil, fmt.Errorf("ymin %g is not less than ymax %g", p.ymin, p.ymax)
+	case zmin != zmax:
+		return nil, fmt.Errorf("zmin and zmax must be given together")
+	case zmin && p.zrange.lo >= p.zrange.hi:
+		return nil, fmt.Errorf("zmin %g is not less than zmax %g", p.zrange.lo, p.zrange.hi)
+	case p.angle <= 0 || p.angle >= 90:
+		return nil, fmt.Errorf("bad angle %g: want degrees in (0, 90)", p.angle)
+	}
+	p.zset = zmin
+	p.angle *= math.Pi / 180
+
+	vars := form["var"]
+	if len(vars) > maxVars {
+		return nil, fmt.Errorf("%d vars, more than %d", len(vars), maxVars)
+	}
+	for _, s := range vars {
+		name, value, ok := strings.Cut(s, "=")
+		if !ok {
+			return nil, fmt.Errorf("bad var %q: want name=value", s)
+		}
+		v := eval.Var(name)
+		if !isVarName(name) || v == "x" || v == "y" || v == "r" {
+			return nil, fmt.Errorf("bad var name %q", name)
+		}
+		x, e := strconv.ParseFloat(value, 64)
+		if e != nil || math.IsNaN(x) || math.IsInf(x, 0) {
+			return nil, fmt.Errorf("bad value of var %s: %q", name, value)
+		}
+		if _, ok := p.env[v]; ok {
+			return nil, fmt.Errorf("var %s given twice", name)
+		}
+		p.env[v] = x
+	}
+
+	name := form.Get("color")
+	if name == "" {
+		name = "white"
+	}
+	var ok bool
+	if p.colors, ok = gradients[name]; !ok {
+		return nil, fmt.Errorf("unknown color %q", name)
+	}
+
+	if s := form.Get("format"); s != "" {
+		if s != "svg" && s != "png" {
+			return nil, fmt.Errorf("unknown format %q: want svg or png", s)
+		}
+		p.format = s
+	}
+	return p, nil
+}
+
+// isVarName reports whether s is a variable name of eval.Parse.
+func isVarName(s string) bool {
+	e, err := eval.Parse(s)
+	if err != nil {
+		return false
+	}
+	_, ok := e.(eval.Var)
+	return ok
+}
+
+// -- color gradients --
+
+// A gradient is a sequence of colors evenly spaced from the lowest
+// heights to the highest.
+type gradient []color.RGBA
+
+var white = color.RGBA{0xff, 0xff, 0xff, 0xff}
+
+var gradients = map[string]gradient{
+	"white":   {white},
+	"grey":    {{0x40, 0x40, 0x40, 0xff}, {0xf0, 0xf0, 0xf0, 0xff}},
+	"redblue": {{0x00, 0x00, 0xff, 0xff}, white, {0xff, 0x00, 0x00, 0xff}},
+	"heat": {
+		{0x00, 0x00, 0x00, 0xff}, {0x80, 0x00, 0x00, 0xff}, {0xff, 0x40, 0x00, 0xff},
+		{0xff, 0xc0, 0x00, 0xff}, {0xff, 0xff, 0xc0, 0xff},
+	},
+	"viridis": {
+		{0x44, 0x01, 0x54, 0xff}, {0x3b, 0x52, 0x8b, 0xff}, {0x21, 0x91, 0x8c, 0xff},
+		{0x5e, 0xc9, 0x62, 0xff}, {0xfd, 0xe7, 0x25, 0xff},
+	},
+}
+
+// at returns the color of g at t, from 0 for the lowest heights to 1
+// for the highest; t outside [0, 1] is clamped.
+func (g gradient) at(t float64) color.RGBA {
+	if len(g) == 1 || !(t > 0) {
+		return g[0]
+	}
+	if t >= 1 {
+		return g[len(g)-1]
+	}
+	t *= float64(len(g) - 1)
+	i := int(t)
+	t -= float64(i)
+	mix := func(a, b uint8) uint8 { return uint8(float64(a) + t*(float64(b)-float64(a)) + 0.5) }
+	a, b := g[i], g[i+1]
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 0xff}
+}
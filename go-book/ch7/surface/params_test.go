@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"net/url"
+	"testing"
+)
+
+func TestParseParams(t *testing.T) {
+	for _, test := range []struct {
+		query string
+		want  string // the error, or "" for none
+	}{
+		{"", ""},
+		{"width=16&height=4096&cells=400&var=k=2&var=a_1=-1e300&color=viridis&format=png", ""},
+		{"zmin=-1&zmax=1&angle=89.9", ""},
+		{"width=15", `bad width "15": want an integer in [16, 4096]`},
+		{"height=4097", `bad height "4097": want an integer in [16, 4096]`},
+		{"cells=0", `bad cells "0": want an integer in [1, 400]`},
+		{"xmin=Inf", `bad xmin "Inf": want a finite number`},
+		{"ymax=NaN", `bad ymax "NaN": want a finite number`},
+		{"xmin=1&xmax=1", "xmin 1 is not less than xmax 1"},
+		{"ymin=2&ymax=-2", "ymin 2 is not less than ymax -2"},
+		{"zmin=0", "zmin and zmax must be given together"},
+		{"zmin=1&zmax=0", "zmin 1 is not less than zmax 0"},
+		{"angle=90", "bad angle 90: want degrees in (0, 90)"},
+		{"angle=0", "bad angle 0: want degrees in (0, 90)"},
+		{"var=k", `bad var "k": want name=value`},
+		{"var=r=1", `bad var name "r"`},
+		{"var=2k=1", `bad var name "2k"`},
+		{"var=k=1/2", `bad value of var k: "1/2"`},
+		{"var=k=1&var=k=2", "var k given twice"},
+		{"var=a=1&var=b=1&var=c=1&var=d=1&var=e=1&var=f=1&var=g=1&var=h=1&var=i=1&var=j=1&var=k=1", "11 vars, more than 10"},
+		{"color=sepia", `unknown color "sepia"`},
+		{"format=gif", `unknown format "gif": want svg or png`},
+	} {
+		form, err := url.ParseQuery(test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = parseParams(form)
+		if got := fmt.Sprint(err); (err != nil || test.want != "") && got != test.want {
+			t.Errorf("parseParams(%s) = %s, want %s", test.query, got, test.want)
+		}
+	}
+
+	p, err := parseParams(url.Values{"angle": {"45"}, "zmin": {"-1"}, "zmax": {"2"}, "var": {"k=3"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.angle != math.Pi/4 || !p.zset || p.zrange != (zrange{-1, 2}) || p.env["k"] != 3 ||
+		p.width != 600 || p.height != 320 || p.cells != 100 || p.format != "svg" {
+		t.Errorf("parseParams(angle=45&zmin=-1&zmax=2&var=k=3) = %+v", p)
+	}
+}
+
+func TestGradientAt(t *testing.T) {
+	black := color.RGBA{0x00, 0x00, 0x00, 0xff}
+	bw := gradient{black, white}
+	for _, test := range []struct {
+		g    gradient
+		t    float64
+		want color.RGBA
+	}{
+		{bw, 0, black},
+		{bw, 1, white},
+		{bw, 0.5, color.RGBA{0x80, 0x80, 0x80, 0xff}},
+		{bw, -1, black},
+		{bw, 2, white},
+		{bw, math.NaN(), black},
+		{gradients["white"], 0.7, white},
+		{gradients["redblue"], 0.5, white},
+		{gradients["redblue"], 0.75, color.RGBA{0xff, 0x80, 0x80, 0xff}},
+		{gradients["heat"], 1, color.RGBA{0xff, 0xff, 0xc0, 0xff}},
+	} {
+		if got := test.g.at(test.t); got != test.want {
+			t.Errorf("%v.at(%g) = %v, want %v", test.g, test.t, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sort"
+)
+
+// -- a software rasterizer for PNG plots --
+
+var grey = color.RGBA{0x80, 0x80, 0x80, 0xff}
+
+// rasterize paints polys in order on a white canvas, as the SVG of
+// writeSVG draws them: each filled and outlined in grey. Polygons
+// entirely off the canvas are skipped.
+func rasterize(width, height int, polys []polygon) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{white}, image.Point{}, draw.Src)
+	for _, poly := range polys {
+		if !onCanvas(img.Bounds(), poly.pts[:]) {
+			continue
+		}
+		fill(img, poly.pts[:], poly.fill)
+		for i, a := range poly.pts {
+			b := poly.pts[(i+1)%len(poly.pts)]
+			line(img, a, b, grey, 0.7)
+		}
+	}
+	return img
+}
+
+// onCanvas reports whether the bounding box of pts overlaps r, and its
+// points are finite.
+func onCanvas(r image.Rectangle, pts []point) bool {
+	xmin, xmax := math.Inf(+1), math.Inf(-1)
+	ymin, ymax := math.Inf(+1), math.Inf(-1)
+	for _, p := range pts {
+		if math.IsNaN(p.x+p.y) || math.IsInf(p.x+p.y, 0) {
+			return false
+		}
+		xmin, xmax = math.Min(xmin, p.x), math.Max(xmax, p.x)
+		ymin, ymax = math.Min(ymin, p.y), math.Max(ymax, p.y)
+	}
+	return xmax >= float64(r.Min.X) && xmin <= float64(r.Max.X) &&
+		ymax >= float64(r.Min.Y) && ymin <= float64(r.Max.Y)
+}
+
+// fill paints the polygon pts with c, by the even-odd rule, at the
+// pixels whose centers are inside it.
+func fill(img *image.RGBA, pts []point, c color.RGBA) {
+	b := img.Bounds()
+	ymin, ymax := math.Inf(+1), math.Inf(-1)
+	for _, p := range pts {
+		ymin, ymax = math.Min(ymin, p.y), math.Max(ymax, p.y)
+	}
+	// Clamp before converting, as out of range conversions to int
+	// are undefined.
+	y0 := int(math.Ceil(math.Max(ymin-0.5, float64(b.Min.Y))))
+	y1 := int(math.Floor(math.Min(ymax-0.5, float64(b.Max.Y-1))))
+	var xs []float64
+	for y := y0; y <= y1; y++ {
+		cy := float64(y) + 0.5
+		xs = xs[:0]
+		for i, p := range pts {
+			q := pts[(i+1)%len(pts)]
+			if (p.y <= cy) != (q.y <= cy) {
+				xs = append(xs, p.x+(cy-p.y)*(q.x-p.x)/(q.y-p.y))
+			}
+		}
+		sort.Float64s(xs)
+		for i := 0; i+1 < len(xs); i += 2 {
+			x0 := int(math.Ceil(math.Max(xs[i]-0.5, float64(b.Min.X))))
+			x1 := int(math.Floor(math.Min(xs[i+1]-0.5, float64(b.Max.X-1))))
+			for x := x0; x <= x1; x++ {
+				img.SetRGBA(x, y, c)
+			}
+		}
+	}
+}
+
+// line draws the line from a to b in c, blended with the canvas by
+// alpha, a pixel at each step along its longer axis, of the part of it
+// on the canvas.
+func line(img *image.RGBA, a, b point, c color.RGBA, alpha float64) {
+	r := img.Bounds()
+	a, b, ok := clip(a, b, r)
+	if !ok {
+		return
+	}
+	dx, dy := b.x-a.x, b.y-a.y
+	n := int(math.Ceil(math.Max(math.Abs(dx), math.Abs(dy))))
+	for i := 0; i <= n; i++ {
+		t := 0.0
+		if n > 0 {
+			t = float64(i) / float64(n)
+		}
+		x, y := int(math.Floor(a.x+t*dx)), int(math.Floor(a.y+t*dy))
+		if !(image.Point{x, y}.In(r)) {
+			continue
+		}
+		old := img.RGBAAt(x, y)
+		mix := func(old, new uint8) uint8 {
+			return uint8(float64(old)*(1-alpha) + float64(new)*alpha + 0.5)
+		}
+		img.SetRGBA(x, y, color.RGBA{mix(old.R, c.R), mix(old.G, c.G), mix(old.B, c.B), 0xff})
+	}
+}
+
+// clip returns the part of the segment from a to b within r, widened by
+// a pixel, by the Liang-Barsky algorithm, and false if there is none.
+func clip(a, b point, r image.Rectangle) (point, point, bool) {
+	if !onCanvas(r, []point{a, b}) {
+		return a, b, false
+	}
+	xmin, xmax := float64(r.Min.X-1), float64(r.Max.X+1)
+	ymin, ymax := float64(r.Min.Y-1), float64(r.Max.Y+1)
+	dx, dy := b.x-a.x, b.y-a.y
+	// The ends cut by an edge are put on it, not at a + t*(b-a), which
+	// loses the edge to rounding when a and b are far off the canvas.
+	onX := func(x float64) point { return point{x, a.y + (x-a.x)/dx*dy} }
+	onY := func(y float64) point { return point{a.x + (y-a.y)/dy*dx, y} }
+	t0, t1 := 0.0, 1.0
+	p0, p1 := a, b
+	for _, edge := range []struct {
+		p, q float64
+		at   point
+	}{
+		{-dx, a.x - xmin, onX(xmin)},
+		{dx, xmax - a.x, onX(xmax)},
+		{-dy, a.y - ymin, onY(ymin)},
+		{dy, ymax - a.y, onY(ymax)},
+	} {
+		switch t := edge.q / edge.p; {
+		case edge.p == 0:
+			if edge.q < 0 {
+				return a, b, false // parallel to the edge, outside it
+			}
+		case edge.p < 0 && t > t0:
+			t0, p0 = t, edge.at
+		case edge.p > 0 && t < t1:
+			t1, p1 = t, edge.at
+		}
+	}
+	if t0 > t1 {
+		return a, b, false
+	}
+	clamp := func(p point) point {
+		return point{math.Max(xmin, math.Min(xmax, p.x)), math.Max(ymin, math.Min(ymax, p.y))}
+	}
+	return clamp(p0), clamp(p1), true
+}
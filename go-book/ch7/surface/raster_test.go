@@ -0,0 +1,87 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestClip(t *testing.T) {
+	r := image.Rect(0, 0, 10, 10)
+	inf := math.Inf(+1)
+	for _, test := range []struct {
+		a, b   point
+		ok     bool
+		ca, cb point
+	}{
+		{point{1, 1}, point{8, 5}, true, point{1, 1}, point{8, 5}},
+		{point{-21, 5}, point{31, 5}, true, point{-1, 5}, point{11, 5}},
+		{point{5, -1e300}, point{5, 1e300}, true, point{5, -1}, point{5, 11}},
+		{point{-5, -5}, point{-2, 20}, false, point{}, point{}},
+		{point{30, 0}, point{0, 30}, false, point{}, point{}}, // past the corner
+		{point{inf, 5}, point{5, 5}, false, point{}, point{}},
+		{point{math.NaN(), 5}, point{5, 5}, false, point{}, point{}},
+	} {
+		ca, cb, ok := clip(test.a, test.b, r)
+		if ok != test.ok || ok && (!nearPoint(ca, test.ca) || !nearPoint(cb, test.cb)) {
+			t.Errorf("clip(%v, %v) = %v, %v, %t, want %v, %v, %t", test.a, test.b, ca, cb, ok, test.ca, test.cb, test.ok)
+		}
+	}
+}
+
+func nearPoint(a, b point) bool {
+	return math.Abs(a.x-b.x) < 1e-9 && math.Abs(a.y-b.y) < 1e-9
+}
+
+func TestFill(t *testing.T) {
+	red := color.RGBA{0xff, 0x00, 0x00, 0xff}
+	for _, test := range []struct {
+		pts  []point
+		want int // pixels filled
+	}{
+		{[]point{{2, 2}, {6, 2}, {6, 5}, {2, 5}}, 12},
+		{[]point{{0, 0}, {4, 0}, {0, 4}}, 10}, // with the centers on the edge
+		{[]point{{-1e300, -1e300}, {1e300, -1e300}, {1e300, 1e300}, {-1e300, 1e300}}, 100},
+		{[]point{{20, 20}, {30, 20}, {30, 30}}, 0},
+		{[]point{{2, 2}, {2, 2}, {2, 2}}, 0},
+	} {
+		img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+		fill(img, test.pts, red)
+		n := 0
+		for i := 0; i < len(img.Pix); i += 4 {
+			if img.Pix[i] == 0xff {
+				n++
+			}
+		}
+		if n != test.want {
+			t.Errorf("fill(%v) filled %d pixels, want %d", test.pts, n, test.want)
+		}
+	}
+}
+
+func TestRasterize(t *testing.T) {
+	red := color.RGBA{0xff, 0x00, 0x00, 0xff}
+	polys := []polygon{
+		{[4]point{{2, 2}, {8, 2}, {8, 8}, {2, 8}}, red},
+		{[4]point{{-1e300, 0}, {1e300, 0}, {math.NaN(), 5}, {0, 5}}, red}, // skipped
+		{[4]point{{100, 100}, {200, 100}, {200, 200}, {100, 200}}, red},   // off the canvas
+	}
+	img := rasterize(10, 10, polys)
+	for _, test := range []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{0, 0, white},
+		{5, 5, red},
+		{9, 9, white},
+	} {
+		if got := img.RGBAAt(test.x, test.y); got != test.want {
+			t.Errorf("rasterize: pixel (%d, %d) = %v, want %v", test.x, test.y, got, test.want)
+		}
+	}
+	// The outline blends grey into the fill.
+	if got := img.RGBAAt(5, 2); got == red || got == white {
+		t.Errorf("rasterize: pixel (5, 2) of the outline = %v", got)
+	}
+}
@@ -4,10 +4,29 @@
 // See page 203.
 
 // The surface program plots the 3-D surface of a user-provided function.
+//
+// The /plot handler takes the function as expr, of x, y and r, the
+// distance from (0,0), and these optional parameters:
+//
+//	width, height  canvas size in pixels (600, 320)
+//	cells          number of grid cells along each axis (100)
+//	xmin, xmax     x axis range (-15, 15)
+//	ymin, ymax     y axis range (-15, 15)
+//	zmin, zmax     z axis range, by default that of the heights
+//	angle          angle of the x and y axes, in degrees (30)
+//	var            a variable of expr as name=value, e.g. k=2; repeatable
+//	color          fill by height: white, grey, redblue, heat or viridis
+//	format         svg or png
+//
+// For example:
+//
+//	http://localhost:8000/plot?expr=sin(k*r)/r&var=k=0.5&color=redblue&format=png
 package main
 
 import (
 	"fmt"
+	"image/color"
+	"image/png"
 	"io"
 	"log"
 	"math"
@@ -19,44 +38,90 @@ import "gopl.io/ch7/eval"
 
 //!-parseAndCheck
 
-// -- copied from gopl.io/ch3/surface --
+// -- generalized from gopl.io/ch3/surface --
 
-const (
-	width, height = 600, 320            // canvas size in pixels
-	cells         = 100                 // number of grid cells
-	xyrange       = 30.0                // x, y axis range (-xyrange..+xyrange)
-	xyscale       = width / 2 / xyrange // pixels per x or y unit
-	zscale        = height * 0.4        // pixels per z unit
-)
+// A point is a point on the canvas.
+type point struct{ x, y float64 }
 
-var sin30, cos30 = 0.5, math.Sqrt(3.0 / 4.0) // sin(30°), cos(30°)
+// A polygon is a cell of the surface, projected onto the canvas.
+type polygon struct {
+	pts  [4]point
+	fill color.RGBA
+}
 
-func corner(f func(x, y float64) float64, i, j int) (float64, float64) {
-	// find point (x,y) at corner of cell (i,j)
-	x := xyrange * (float64(i)/cells - 0.5)
-	y := xyrange * (float64(j)/cells - 0.5)
+// heights returns the heights f at the corners of the cells, by row i
+// along x and column j along y.
+func (p *params) heights(f func(x, y float64) float64) [][]float64 {
+	h := make([][]float64, p.cells+1)
+	for i := range h {
+		h[i] = make([]float64, p.cells+1)
+		for j := range h[i] {
+			h[i][j] = f(p.x(i), p.y(j))
+		}
+	}
+	return h
+}
 
-	z := f(x, y) // compute surface height z
+// x and y return the coordinates of the corner (i, j) of the grid.
+func (p *params) x(i int) float64 { return p.xmin + (p.xmax-p.xmin)*float64(i)/float64(p.cells) }
+func (p *params) y(j int) float64 { return p.ymin + (p.ymax-p.ymin)*float64(j)/float64(p.cells) }
 
-	// project (x,y,z) isometrically onto 2-D SVG canvas (sx,sy)
-	sx := width/2 + (x-y)*cos30*xyscale
-	sy := height/2 + (x+y)*sin30*xyscale - z*zscale
-	return sx, sy
+// surface returns the cells of the plot of heights h within zr, in the
+// order to paint them: those with a non-finite corner are left out.
+func surface(p *params, h [][]float64, zr zrange) []polygon {
+	// The x and y axes are scaled alike, to fit the canvas width. The z
+	// axis fits zr into 40% of the canvas height.
+	xyscale := float64(p.width) / (p.xmax - p.xmin + p.ymax - p.ymin)
+	zscale := float64(p.height) * 0.4
+	if zr.hi > zr.lo {
+		zscale /= zr.hi - zr.lo
+	}
+	xmid, ymid, zmid := (p.xmin+p.xmax)/2, (p.ymin+p.ymax)/2, (zr.lo+zr.hi)/2
+	sin, cos := math.Sin(p.angle), math.Cos(p.angle)
+	corner := func(i, j int) point {
+		// project (x,y,z) onto 2-D canvas (sx,sy)
+		x, y, z := p.x(i)-xmid, p.y(j)-ymid, h[i][j]-zmid
+		return point{
+			float64(p.width)/2 + (x-y)*cos*xyscale,
+			float64(p.height)/2 + (x+y)*sin*xyscale - z*zscale,
+		}
+	}
+
+	var polys []polygon
+	for i := 0; i < p.cells; i++ {
+		for j := 0; j < p.cells; j++ {
+			sum := 0.0
+			for _, z := range []float64{h[i+1][j], h[i][j], h[i][j+1], h[i+1][j+1]} {
+				sum += z
+			}
+			if math.IsNaN(sum) || math.IsInf(sum, 0) {
+				continue // a corner is not finite
+			}
+			t := 0.5
+			if zr.hi > zr.lo {
+				t = (sum/4 - zr.lo) / (zr.hi - zr.lo)
+			}
+			polys = append(polys, polygon{
+				pts:  [4]point{corner(i+1, j), corner(i, j), corner(i, j+1), corner(i+1, j+1)},
+				fill: p.colors.at(t),
+			})
+		}
+	}
+	return polys
 }
 
-func surface(w io.Writer, f func(x, y float64) float64) {
+func writeSVG(w io.Writer, width, height int, polys []polygon) {
 	fmt.Fprintf(w, "<svg xmlns='http://www.w3.org/2000/svg' "+
 		"style='stroke: grey; fill: white; stroke-width: 0.7' "+
 		"width='%d' height='%d'>", width, height)
-	for i := 0; i < cells; i++ {
-		for j := 0; j < cells; j++ {
-			ax, ay := corner(f, i+1, j)
-			bx, by := corner(f, i, j)
-			cx, cy := corner(f, i, j+1)
-			dx, dy := corner(f, i+1, j+1)
-			fmt.Fprintf(w, "<polygon points='%g,%g %g,%g %g,%g %g,%g'/>\n",
-				ax, ay, bx, by, cx, cy, dx, dy)
+	for _, poly := range polys {
+		a, b, c, d := poly.pts[0], poly.pts[1], poly.pts[2], poly.pts[3]
+		fmt.Fprintf(w, "<polygon points='%g,%g %g,%g %g,%g %g,%g'",
+			a.x, a.y, b.x, b.y, c.x, c.y, d.x, d.y)
+		if poly.fill != white {
+			fmt.Fprintf(w, " fill='#%02x%02x%02x'", poly.fill.R, poly.fill.G, poly.fill.B)
 		}
+		fmt.Fprintln(w, "/>")
 	}
 	fmt.Fprintln(w, "</svg>")
 }
@@ -64,7 +129,7 @@ func surface(w io.Writer, f func(x, y float64) float64) {
 // -- main code for gopl.io/ch7/surface --
 
 //!+parseAndCheck
-func parseAndCheck(s string) (eval.Expr, error) {
+func parseAndCheck(s string, env eval.Env) (eval.Expr, error) {
 	if s == "" {
 		return nil, fmt.Errorf("empty expression")
 	}
@@ -77,7 +142,7 @@ func parseAndCheck(s string) (eval.Expr, error) {
 		return nil, err
 	}
 	for v := range vars {
-		if v != "x" && v != "y" && v != "r" {
+		if _, ok := env[v]; !ok && v != "x" && v != "y" && v != "r" {
 			return nil, fmt.Errorf("undefined variable: %s", v)
 		}
 	}
@@ -89,20 +154,127 @@ func parseAndCheck(s string) (eval.Expr, error) {
 //!+plot
 func plot(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
-	expr, err := parseAndCheck(r.Form.Get("expr"))
+	p, err := parseParams(r.Form)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	expr, err := parseAndCheck(r.Form.Get("expr"), p.env)
 	if err != nil {
 		http.Error(w, "bad expr: "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	w.Header().Set("Content-Type", "image/svg+xml")
-	surface(w, func(x, y float64) float64 {
+	// Scripts of a few lines may inline to millions of nodes.
+	if n := eval.Size(expr); n > maxNodes {
+		http.Error(w, fmt.Sprintf("expr has %d nodes inlined, more than %d", n, maxNodes), http.StatusBadRequest)
+		return
+	}
+	// Compile once instead of walking the tree for each corner.
+	vars := []eval.Var{"x", "y", "r"}
+	for v := range p.env {
+		vars = append(vars, v)
+	}
+	prog, err := compile(expr, vars)
+	if err != nil {
+		http.Error(w, "bad expr: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	values := make([]float64, len(vars))
+	for i, v := range vars[3:] {
+		values[3+i] = p.env[v]
+	}
+	f := func(x, y float64) float64 {
 		r := math.Hypot(x, y) // distance from (0,0)
-		return expr.Eval(eval.Env{"x": x, "y": y, "r": r})
-	})
+		values[0], values[1], values[2] = x, y, r
+		return prog.Eval(values)
+	}
+	h := p.heights(f)
+	zr := p.zrange
+	if !p.zset {
+		zr = autoscale(expr, p, h)
+	}
+	polys := surface(p, h, zr)
+	if p.format == "png" {
+		w.Header().Set("Content-Type", "image/png")
+		png.Encode(w, rasterize(p.width, p.height, polys))
+		return
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	writeSVG(w, p.width, p.height, polys)
 }
 
 //!-plot
 
+// compile is eval.Compile, which panics on recursive scripts.
+func compile(expr eval.Expr, vars []eval.Var) (prog *eval.Program, err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			err = fmt.Errorf("%v", x)
+		}
+	}()
+	return eval.Compile(expr, vars), nil
+}
+
+// A zrange is a range of heights.
+type zrange struct{ lo, hi float64 }
+
+// autoscale returns the range of the heights of the plot of expr. The
+// range of z over boxes of cells comes from interval arithmetic, or, for
+// boxes where it is unbounded, such as near the origin of sin(r)/r, from
+// the heights h at their corners.
+func autoscale(expr eval.Expr, p *params, h [][]float64) zrange {
+	env := eval.IntervalEnv{}
+	for v, x := range p.env {
+		env[v] = eval.Interval{Lo: x, Hi: x}
+	}
+	zr := eval.Empty
+	step := (p.cells + 31) / 32 // cells per box along each axis, for at most 32×32 boxes
+	for i0 := 0; i0 < p.cells; i0 += step {
+		for j0 := 0; j0 < p.cells; j0 += step {
+			i1, j1 := min(i0+step, p.cells), min(j0+step, p.cells)
+			env["x"] = eval.Interval{Lo: p.x(i0), Hi: p.x(i1)}
+			env["y"] = eval.Interval{Lo: p.y(j0), Hi: p.y(j1)}
+			env["r"] = distance(env["x"], env["y"])
+			z := eval.EvalInterval(expr, env)
+			if math.IsInf(z.Lo, 0) || math.IsInf(z.Hi, 0) {
+				z = eval.Empty
+				for i := i0; i <= i1; i++ {
+					for j := j0; j <= j1; j++ {
+						if v := h[i][j]; !math.IsNaN(v) && !math.IsInf(v, 0) {
+							z.Lo, z.Hi = math.Min(z.Lo, v), math.Max(z.Hi, v)
+						}
+					}
+				}
+			}
+			if !z.IsEmpty() {
+				zr.Lo, zr.Hi = math.Min(zr.Lo, z.Lo), math.Max(zr.Hi, z.Hi)
+			}
+		}
+	}
+	if zr.IsEmpty() {
+		return zrange{0, 0}
+	}
+	return zrange{zr.Lo, zr.Hi}
+}
+
+// distance returns the range of the distance from (0,0) of the points
+// of the box x, y.
+func distance(x, y eval.Interval) eval.Interval {
+	nearest := func(r eval.Interval) float64 {
+		if r.Contains(0) {
+			return 0
+		}
+		return math.Min(math.Abs(r.Lo), math.Abs(r.Hi))
+	}
+	farthest := func(r eval.Interval) float64 {
+		return math.Max(math.Abs(r.Lo), math.Abs(r.Hi))
+	}
+	return eval.Interval{
+		Lo: math.Max(0, math.Nextafter(math.Hypot(nearest(x), nearest(y)), math.Inf(-1))),
+		Hi: math.Nextafter(math.Hypot(farthest(x), farthest(y)), math.Inf(+1)),
+	}
+}
+
 //!+main
 func main() {
 	http.HandleFunc("/plot", plot)
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"gopl.io/ch7/eval"
+)
+
+func TestPlotLimits(t *testing.T) {
+	// f22 inlines to 2^24 - 1 nodes.
+	defs := []string{"f0(t) = t + 1"}
+	for i := 1; i <= 22; i++ {
+		defs = append(defs, fmt.Sprintf("f%d(t) = f%d(t) + f%d(t)", i, i-1, i-1))
+	}
+	nested := strings.Join(defs, "; ") + "; f22(x)"
+
+	for _, test := range []struct {
+		query url.Values
+		code  int
+		want  string // in the body
+	}{
+		{url.Values{"expr": {"sin(r)/r"}, "cells": {"10"}}, http.StatusOK, "<svg"},
+		{url.Values{"expr": {"x"}, "cells": {"4"}, "format": {"png"}}, http.StatusOK, "\x89PNG"},
+		{url.Values{"expr": {strings.Repeat("x+", maxExpr/2) + "x"}}, http.StatusBadRequest, "more than 1000"},
+		{url.Values{"expr": {nested}}, http.StatusBadRequest, "expr has 16777215 nodes inlined, more than 2000"},
+		{url.Values{"expr": {"x"}, "width": {"4097"}}, http.StatusBadRequest, "bad width"},
+		{url.Values{"expr": {"x"}, "cells": {"401"}}, http.StatusBadRequest, "bad cells"},
+		{url.Values{"expr": {"k * x"}}, http.StatusBadRequest, "undefined variable: k"},
+		{url.Values{"expr": {"f(t) = f(t); f(x)"}}, http.StatusBadRequest, "bad expr"},
+	} {
+		w := httptest.NewRecorder()
+		plot(w, httptest.NewRequest("GET", "/plot?"+test.query.Encode(), nil))
+		if body := w.Body.String(); w.Code != test.code || !strings.Contains(body, test.want) {
+			if len(body) > 100 {
+				body = body[:100]
+			}
+			t.Errorf("plot(%.60s): %d %q, want %d with %q", test.query.Encode(), w.Code, body, test.code, test.want)
+		}
+	}
+}
+
+func TestAutoscale(t *testing.T) {
+	for _, test := range []struct {
+		query  string
+		lo, hi float64
+	}{
+		{"expr=x%2By", -30, 30},
+		{"expr=x*y&xmin=0&xmax=2&ymin=-1&ymax=1", -2, 2},
+		{"expr=k&var=k=2", 2, 2},
+		{"expr=0/0", 0, 0},
+		// Unbounded boxes take the range of their finite heights.
+		{"expr=1/x&cells=10&xmin=-5&xmax=5&ymin=0&ymax=1", -1, 1},
+		{"expr=r&xmin=-3&xmax=3&ymin=-4&ymax=4", 0, 5},
+	} {
+		form, err := url.ParseQuery(test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := parseParams(form)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expr, err := parseAndCheck(form.Get("expr"), p.env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vars := []eval.Var{"x", "y", "r", "k"}
+		prog, err := compile(expr, vars)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := p.heights(func(x, y float64) float64 {
+			return prog.Eval([]float64{x, y, math.Hypot(x, y), p.env["k"]})
+		})
+		zr := autoscale(expr, p, h)
+		// The range may be wider, by rounding and the sampled heights
+		// near where the intervals are unbounded.
+		if !(zr.lo <= test.lo && zr.lo > test.lo-1e-9*(1+math.Abs(test.lo)) &&
+			zr.hi >= test.hi && zr.hi < test.hi+1e-9*(1+math.Abs(test.hi))) {
+			t.Errorf("autoscale(%s) = %v, want [%g, %g]", test.query, zr, test.lo, test.hi)
+		}
+	}
+}
+
+func TestPlotPNG(t *testing.T) {
+	w := httptest.NewRecorder()
+	plot(w, httptest.NewRequest("GET", "/plot?expr=sin(r)/r&width=64&height=48&cells=8&color=heat&format=png", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("plot PNG: %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	img, err := png.Decode(bytes.NewReader(w.Body.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 64 || b.Dy() != 48 {
+		t.Errorf("plot PNG is %v, want 64x48", b)
+	}
+	// The corners are background, the middle the surface.
+	if r, g, b, _ := img.At(0, 0).RGBA(); r != 0xffff || g != 0xffff || b != 0xffff {
+		t.Errorf("plot PNG: corner is not white")
+	}
+	if r, g, b, _ := img.At(32, 24).RGBA(); r == 0xffff && g == 0xffff && b == 0xffff {
+		t.Errorf("plot PNG: middle is white")
+	}
+}
@@ -0,0 +1,123 @@
+package thumbnail
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+)
+
+// -- EXIF orientation --
+
+// An orientation is the value of the EXIF Orientation tag of a JPEG
+// file, which tells how to turn its pixels to show them upright, as a
+// camera held sideways records them.
+type orientation int
+
+const (
+	upright    orientation = 1 + iota
+	flipH                  // mirrored left to right
+	rotate180              // upside down
+	flipV                  // mirrored top to bottom
+	transpose              // mirrored across the top left to bottom right diagonal
+	rotate90               // to be turned 90° clockwise
+	transverse             // mirrored across the other diagonal
+	rotate270              // to be turned 90° anticlockwise
+)
+
+// swapsAxes reports whether o shows the width of the pixels as height.
+func (o orientation) swapsAxes() bool { return o >= transpose && o <= rotate270 }
+
+// jpegOrientation returns the orientation of the JPEG file data, or
+// upright if it has none or it is malformed.
+func jpegOrientation(data []byte) orientation {
+	if !bytes.HasPrefix(data, []byte{0xff, 0xd8}) { // SOI
+		return upright
+	}
+	// The segments before the image data are a marker, 0xff and a
+	// byte, and a big-endian length, which counts itself.
+	for p := 2; p+4 <= len(data) && data[p] == 0xff; {
+		marker := data[p+1]
+		n := int(binary.BigEndian.Uint16(data[p+2:]))
+		if marker == 0xda || n < 2 || p+2+n > len(data) { // start of scan, or malformed
+			break
+		}
+		if seg := data[p+4 : p+2+n]; marker == 0xe1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return tiffOrientation(seg[6:])
+		}
+		p += 2 + n
+	}
+	return upright
+}
+
+// tiffOrientation returns the Orientation tag of the first IFD of the
+// TIFF structure of the EXIF data.
+func tiffOrientation(tiff []byte) orientation {
+	if len(tiff) < 8 {
+		return upright
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return upright
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return upright
+	}
+	n := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < n; i++ {
+		e := ifd + 2 + 12*i // tag, type, count, value
+		if e+12 > len(tiff) {
+			break
+		}
+		const orientationTag, shortType = 0x0112, 3
+		if order.Uint16(tiff[e:]) == orientationTag && order.Uint16(tiff[e+2:]) == shortType {
+			if o := orientation(order.Uint16(tiff[e+8:])); o >= upright && o <= rotate270 {
+				return o
+			}
+			break
+		}
+	}
+	return upright
+}
+
+// reorient returns src turned as o tells to show it upright.
+func reorient(src *image.RGBA, o orientation) *image.RGBA {
+	if o == upright {
+		return src
+	}
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := w, h
+	if o.swapsAxes() {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			// (sx, sy) is the pixel of src shown at (x, y).
+			var sx, sy int
+			switch o {
+			case flipH:
+				sx, sy = w-1-x, y
+			case rotate180:
+				sx, sy = w-1-x, h-1-y
+			case flipV:
+				sx, sy = x, h-1-y
+			case transpose:
+				sx, sy = y, x
+			case rotate90:
+				sx, sy = y, h-1-x
+			case transverse:
+				sx, sy = w-1-y, h-1-x
+			case rotate270:
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):][:4], src.Pix[sy*src.Stride+4*sx:][:4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,160 @@
+package thumbnail
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+)
+
+// A Mode is how a thumbnail fits its box.
+type Mode int
+
+const (
+	Fit  Mode = iota // all of the image, within the box
+	Crop             // the middle of the image, filling the box
+)
+
+// Options are the options of thumbnails.
+type Options struct {
+	// Width and Height are the size of the box of the thumbnail. If
+	// one is zero, a Fit thumbnail is as wide or as high as the other.
+	Width, Height int
+	Mode          Mode
+	Filter        Filter
+
+	// Format is the format of the thumbnails of streams and files:
+	// "jpeg", "png" or "gif", or that of the image if empty.
+	Format string
+	// Quality is the quality of JPEG thumbnails, from 1 to 100, or
+	// jpeg.DefaultQuality if zero.
+	Quality int
+	// Compression is the compression of PNG thumbnails.
+	Compression png.CompressionLevel
+	// Colors is the number of colors of GIF thumbnails, from 1 to
+	// 256, or 256 if zero.
+	Colors int
+}
+
+// DefaultOptions are the options of the functions Image, ImageStream,
+// ImageFile2 and ImageFile: thumbnails that fit 128×128 pixels.
+var DefaultOptions = &Options{Width: 128, Height: 128, Mode: Fit, Filter: Bicubic}
+
+// extFormats are the formats of the file name extensions.
+var extFormats = map[string]string{".jpg": "jpeg", ".jpeg": "jpeg", ".png": "png", ".gif": "gif"}
+
+// Image returns a thumbnail-size version of src.
+func (o *Options) Image(src image.Image) image.Image {
+	return o.image(src, upright)
+}
+
+// image returns the thumbnail of src, shown as orientation tells.
+func (o *Options) image(src image.Image, orient orientation) *image.RGBA {
+	// Compute thumbnail size, preserving aspect ratio, in terms of the
+	// image as it is shown.
+	bounds := src.Bounds()
+	xs, ys := bounds.Dx(), bounds.Dy()
+	if orient.swapsAxes() {
+		xs, ys = ys, xs
+	}
+	width, height, crop := o.size(xs, ys)
+	if orient.swapsAxes() {
+		width, height = height, width
+		crop = image.Rect(crop.Min.Y, crop.Min.X, crop.Max.Y, crop.Max.X)
+	}
+	// The crop is in the middle, so it is the same turned or not.
+	crop = crop.Add(bounds.Min)
+	if crop != bounds {
+		src = subImage(src, crop)
+	}
+	return reorient(Resize(src, width, height, o.Filter), orient)
+}
+
+// size returns the size of the thumbnail of an xs × ys image, and the
+// rectangle of the image it shows, from (0, 0).
+func (o *Options) size(xs, ys int) (width, height int, crop image.Rectangle) {
+	crop = image.Rect(0, 0, xs, ys)
+	if xs == 0 || ys == 0 || o.Width <= 0 && o.Height <= 0 {
+		return 0, 0, crop
+	}
+	sx, sy := float64(o.Width)/float64(xs), float64(o.Height)/float64(ys)
+	if o.Width <= 0 {
+		sx = sy
+	} else if o.Height <= 0 {
+		sy = sx
+	}
+	if o.Mode == Crop && o.Width > 0 && o.Height > 0 {
+		// Scale to fill the box, showing the middle of the image.
+		scale := math.Max(sx, sy)
+		cw := min(xs, int(math.Round(float64(o.Width)/scale)))
+		ch := min(ys, int(math.Round(float64(o.Height)/scale)))
+		crop = image.Rect((xs-cw)/2, (ys-ch)/2, (xs-cw)/2+cw, (ys-ch)/2+ch)
+		return o.Width, o.Height, crop
+	}
+	scale := math.Min(sx, sy)
+	width = max(1, int(math.Round(float64(xs)*scale)))
+	height = max(1, int(math.Round(float64(ys)*scale)))
+	return width, height, crop
+}
+
+// subImage returns the part r of img.
+func subImage(img image.Image, r image.Rectangle) image.Image {
+	if s, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return s.SubImage(r)
+	}
+	dst := image.NewRGBA(r)
+	draw.Draw(dst, r, img, r.Min, draw.Src)
+	return dst
+}
+
+// ImageStream reads an image from r and writes a thumbnail-size
+// version of it to w, in the format of o, or else that of the image.
+// The thumbnails of JPEG images are turned upright as their EXIF
+// orientation tells.
+func (o *Options) ImageStream(w io.Writer, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	orient := upright
+	if format == "jpeg" {
+		orient = jpegOrientation(data)
+	}
+	if o.Format != "" {
+		format = o.Format
+	}
+	return o.encode(w, o.image(src, orient), format)
+}
+
+// encode writes img to w in format.
+func (o *Options) encode(w io.Writer, img image.Image, format string) error {
+	switch format {
+	case "jpeg":
+		quality := o.Quality
+		if quality == 0 {
+			quality = jpeg.DefaultQuality
+		}
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	case "png":
+		e := png.Encoder{CompressionLevel: o.Compression}
+		return e.Encode(w, img)
+	case "gif":
+		colors := o.Colors
+		if colors == 0 {
+			colors = 256
+		}
+		return gif.Encode(w, img, &gif.Options{NumColors: colors, Drawer: draw.FloydSteinberg})
+	}
+	return fmt.Errorf("unsupported format %q", format)
+}
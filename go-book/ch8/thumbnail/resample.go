@@ -0,0 +1,195 @@
+package thumbnail
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+)
+
+// A Filter is a method of resampling images.
+type Filter int
+
+const (
+	NearestNeighbor Filter = iota // the nearest pixel; fast but blocky
+	Bilinear                      // a tent over 2×2 pixels
+	Bicubic                       // Catmull-Rom over 4×4 pixels
+	Lanczos3                      // a windowed sinc over 6×6 pixels; sharpest
+)
+
+var filterNames = [...]string{
+	NearestNeighbor: "nearest",
+	Bilinear:        "bilinear",
+	Bicubic:         "bicubic",
+	Lanczos3:        "lanczos3",
+}
+
+func (f Filter) String() string {
+	if 0 <= f && int(f) < len(filterNames) {
+		return filterNames[f]
+	}
+	return fmt.Sprintf("Filter(%d)", int(f))
+}
+
+// ParseFilter returns the filter of the name returned by its String
+// method, e.g., "bicubic".
+func ParseFilter(name string) (Filter, error) {
+	for f, s := range filterNames {
+		if s == name {
+			return Filter(f), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown filter %q", name)
+}
+
+// support returns the radius of the kernel of f, in pixels of the image
+// it samples.
+func (f Filter) support() float64 {
+	switch f {
+	case Bilinear:
+		return 1
+	case Bicubic:
+		return 2
+	case Lanczos3:
+		return 3
+	}
+	return 0.5
+}
+
+// kernel returns the weight of f at the distance x from a sample.
+func (f Filter) kernel(x float64) float64 {
+	x = math.Abs(x)
+	switch f {
+	case Bilinear:
+		if x < 1 {
+			return 1 - x
+		}
+	case Bicubic:
+		// Catmull-Rom, the cubic convolution with a = -0.5.
+		if x < 1 {
+			return (1.5*x-2.5)*x*x + 1
+		} else if x < 2 {
+			return ((-0.5*x+2.5)*x-4)*x + 2
+		}
+	case Lanczos3:
+		if x == 0 {
+			return 1
+		} else if x < 3 {
+			return 3 * math.Sin(math.Pi*x) * math.Sin(math.Pi*x/3) / (math.Pi * math.Pi * x * x)
+		}
+	default: // NearestNeighbor
+		if x < 0.5 {
+			return 1
+		}
+	}
+	return 0
+}
+
+// Resize returns src resampled by f to width × height pixels.
+//
+// It filters the premultiplied pixels of an *image.RGBA, converting src
+// to one if need be, first along rows, then along columns. Shrinking,
+// the filters other than NearestNeighbor widen to cover all the pixels
+// of src, so they average rather than skip.
+func Resize(src image.Image, width, height int, f Filter) *image.RGBA {
+	s, ok := src.(*image.RGBA)
+	if !ok {
+		s = image.NewRGBA(src.Bounds())
+		draw.Draw(s, s.Rect, src, s.Rect.Min, draw.Src)
+	}
+	sw, sh := s.Rect.Dx(), s.Rect.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	if sw == 0 || sh == 0 {
+		return dst
+	}
+
+	// Along rows: tmp is width × sh pixels of 4 float32 channels.
+	tmp := make([]float32, 4*width*sh)
+	cols := weights(width, sw, f)
+	for y := 0; y < sh; y++ {
+		row := s.Pix[y*s.Stride:]
+		for x, c := range cols {
+			var r, g, b, a float32
+			for k, w := range c.w {
+				p := row[4*(c.start+k):]
+				r += w * float32(p[0])
+				g += w * float32(p[1])
+				b += w * float32(p[2])
+				a += w * float32(p[3])
+			}
+			t := tmp[4*(y*width+x):]
+			t[0], t[1], t[2], t[3] = r, g, b, a
+		}
+	}
+
+	// Along columns, into dst.
+	for y, c := range weights(height, sh, f) {
+		for x := 0; x < width; x++ {
+			var r, g, b, a float32
+			for k, w := range c.w {
+				t := tmp[4*((c.start+k)*width+x):]
+				r += w * t[0]
+				g += w * t[1]
+				b += w * t[2]
+				a += w * t[3]
+			}
+			// Filters with negative lobes may overshoot: clamp alpha,
+			// and colors to alpha, as they are premultiplied.
+			alpha := clamp(a, 255)
+			p := dst.Pix[y*dst.Stride+4*x:]
+			p[0], p[1], p[2], p[3] = uint8(clamp(r, alpha)), uint8(clamp(g, alpha)), uint8(clamp(b, alpha)), uint8(alpha)
+		}
+	}
+	return dst
+}
+
+// clamp returns x rounded to an integer in [0, hi].
+func clamp(x, hi float32) float32 {
+	if x < 0 {
+		return 0
+	} else if x > hi {
+		return hi
+	}
+	return float32(int(x + 0.5))
+}
+
+// A contribution is the weights of the samples from start of the
+// source of a pixel.
+type contribution struct {
+	start int
+	w     []float32
+}
+
+// weights returns the contributions of the src samples to each of the
+// dst samples along an axis, resampled by f.
+func weights(dst, src int, f Filter) []contribution {
+	scale := float64(src) / float64(dst)
+	stretch := 1.0 // of the kernel, to cover the source when shrinking
+	if scale > 1 && f != NearestNeighbor {
+		stretch = scale
+	}
+	support := f.support() * stretch
+	cs := make([]contribution, dst)
+	for i := range cs {
+		center := (float64(i) + 0.5) * scale // in the source
+		lo := max(0, int(math.Floor(center-support)))
+		hi := min(src, int(math.Ceil(center+support)))
+		ws := make([]float64, hi-lo)
+		sum := 0.0
+		for j := range ws {
+			ws[j] = f.kernel((float64(lo+j) + 0.5 - center) / stretch)
+			sum += ws[j]
+		}
+		c := contribution{start: lo, w: make([]float32, len(ws))}
+		if sum == 0 {
+			// Only for NearestNeighbor, centered between two samples.
+			c.start, c.w = min(int(center), src-1), []float32{1}
+		} else {
+			for j, w := range ws {
+				c.w[j] = float32(w / sum)
+			}
+		}
+		cs[i] = c
+	}
+	return cs
+}
@@ -0,0 +1,198 @@
+package thumbnail
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+var filters = []Filter{NearestNeighbor, Bilinear, Bicubic, Lanczos3}
+
+func TestResize(t *testing.T) {
+	// A uniform image stays uniform, shrunk or stretched.
+	teal := color.NRGBA{0x20, 0x90, 0x90, 0xff}
+	src := image.NewNRGBA(image.Rect(10, 10, 47, 29))
+	for i := 0; i < len(src.Pix); i += 4 {
+		copy(src.Pix[i:], []uint8{teal.R, teal.G, teal.B, teal.A})
+	}
+	for _, f := range filters {
+		for _, size := range []image.Point{{5, 3}, {37, 19}, {100, 61}} {
+			dst := Resize(src, size.X, size.Y, f)
+			if got := dst.Bounds().Size(); got != size {
+				t.Errorf("Resize(%v) size = %v, want %v", f, got, size)
+			}
+			for _, p := range []image.Point{{0, 0}, {size.X / 2, size.Y / 2}, {size.X - 1, size.Y - 1}} {
+				if got := color.NRGBAModel.Convert(dst.At(p.X, p.Y)); got != teal {
+					t.Errorf("Resize(%v) to %v at %v = %v, want %v", f, size, p, got, teal)
+				}
+			}
+		}
+	}
+
+	// Halving a checkerboard of black and white pixels: nearest
+	// neighbor picks one, the others average them to grey.
+	board := image.NewGray(image.Rect(0, 0, 16, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			if (x+y)%2 == 0 {
+				board.SetGray(x, y, color.Gray{255})
+			}
+		}
+	}
+	for _, f := range filters {
+		dst := Resize(board, 8, 8, f)
+		g := dst.RGBAAt(4, 4).R
+		if f == NearestNeighbor && g != 0 && g != 255 || f != NearestNeighbor && (g < 120 || g > 136) {
+			t.Errorf("Resize(checkerboard, %v) at the middle = %d", f, g)
+		}
+	}
+
+	for _, f := range filters {
+		if got, err := ParseFilter(f.String()); got != f || err != nil {
+			t.Errorf("ParseFilter(%q) = %v, %v", f.String(), got, err)
+		}
+	}
+	if _, err := ParseFilter("sinc"); err == nil {
+		t.Errorf("ParseFilter(sinc) succeeded")
+	}
+}
+
+func TestSize(t *testing.T) {
+	for _, test := range []struct {
+		o             Options
+		xs, ys        int
+		width, height int
+		crop          image.Rectangle
+	}{
+		{Options{Width: 128, Height: 128}, 400, 300, 128, 96, image.Rect(0, 0, 400, 300)},
+		{Options{Width: 128, Height: 128}, 300, 400, 96, 128, image.Rect(0, 0, 300, 400)},
+		{Options{Width: 200}, 400, 300, 200, 150, image.Rect(0, 0, 400, 300)},
+		{Options{Height: 30}, 400, 300, 40, 30, image.Rect(0, 0, 400, 300)},
+		{Options{Width: 100, Height: 100, Mode: Crop}, 400, 300, 100, 100, image.Rect(50, 0, 350, 300)},
+		{Options{Width: 90, Height: 30, Mode: Crop}, 300, 400, 90, 30, image.Rect(0, 150, 300, 250)},
+	} {
+		width, height, crop := test.o.size(test.xs, test.ys)
+		if width != test.width || height != test.height || crop != test.crop {
+			t.Errorf("%+v.size(%d, %d) = %d, %d, %v, want %d, %d, %v", test.o, test.xs, test.ys,
+				width, height, crop, test.width, test.height, test.crop)
+		}
+	}
+}
+
+// withOrientation returns the JPEG file data with an EXIF segment of
+// the orientation o, in the byte order of "II" or "MM".
+func withOrientation(data []byte, o orientation, byteOrder string) []byte {
+	order := binary.ByteOrder(binary.BigEndian)
+	if byteOrder == "II" {
+		order = binary.LittleEndian
+	}
+	tiff := []byte(byteOrder + "\x00\x00\x00\x00\x00\x00")
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	ifd := make([]byte, 2+12+4)
+	order.PutUint16(ifd, 1)
+	order.PutUint16(ifd[2:], 0x0112) // Orientation
+	order.PutUint16(ifd[4:], 3)      // SHORT
+	order.PutUint32(ifd[6:], 1)
+	order.PutUint16(ifd[10:], uint16(o))
+	seg := append([]byte("Exif\x00\x00"), append(tiff, ifd...)...)
+	app1 := []byte{0xff, 0xe1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(2+len(seg)))
+	return append(append(append([]byte(nil), data[:2]...), append(app1, seg...)...), data[2:]...)
+}
+
+func TestOrientation(t *testing.T) {
+	// A 64×32 image, red on the left half and blue on the right.
+	src := image.NewRGBA(image.Rect(0, 0, 64, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 64; x++ {
+			c := color.RGBA{0xff, 0, 0, 0xff}
+			if x >= 32 {
+				c = color.RGBA{0, 0, 0xff, 0xff}
+			}
+			src.SetRGBA(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, src, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		o                    orientation
+		width, height        int
+		topLeft, bottomRight string // red or blue
+	}{
+		{upright, 32, 16, "red", "blue"},
+		{flipH, 32, 16, "blue", "red"},
+		{rotate180, 32, 16, "blue", "red"},
+		{rotate90, 16, 32, "red", "blue"},   // the left is the top
+		{rotate270, 16, 32, "blue", "red"},  // the left is the bottom
+		{transpose, 16, 32, "red", "blue"},  // the left is the top
+		{transverse, 16, 32, "blue", "red"}, // the left is the bottom
+	} {
+		for _, byteOrder := range []string{"II", "MM"} {
+			data := withOrientation(buf.Bytes(), test.o, byteOrder)
+			if got := jpegOrientation(data); got != test.o {
+				t.Errorf("jpegOrientation(%d, %s) = %d", test.o, byteOrder, got)
+			}
+			var out bytes.Buffer
+			o := &Options{Width: 32, Height: 32, Format: "png"}
+			if err := o.ImageStream(&out, bytes.NewReader(data)); err != nil {
+				t.Fatal(err)
+			}
+			img, err := png.Decode(&out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			size := img.Bounds().Size()
+			name := func(x, y int) string {
+				if r, _, b, _ := img.At(x, y).RGBA(); r > b {
+					return "red"
+				}
+				return "blue"
+			}
+			if size.X != test.width || size.Y != test.height ||
+				name(0, 0) != test.topLeft || name(size.X-1, size.Y-1) != test.bottomRight {
+				t.Errorf("orientation %d: got %v with %s top left and %s bottom right, want %dx%d, %s and %s",
+					test.o, size, name(0, 0), name(size.X-1, size.Y-1), test.width, test.height, test.topLeft, test.bottomRight)
+			}
+		}
+	}
+	if got := jpegOrientation([]byte("GIF89a")); got != upright {
+		t.Errorf("jpegOrientation(GIF) = %d", got)
+	}
+}
+
+func TestFormats(t *testing.T) {
+	src := image.NewPaletted(image.Rect(0, 0, 300, 200), color.Palette{color.White, color.Black})
+	encoders := map[string]func(*bytes.Buffer) error{
+		"png":  func(b *bytes.Buffer) error { return png.Encode(b, src) },
+		"gif":  func(b *bytes.Buffer) error { return gif.Encode(b, src, nil) },
+		"jpeg": func(b *bytes.Buffer) error { return jpeg.Encode(b, src, nil) },
+	}
+	for in, encode := range encoders {
+		for _, format := range []string{"", "jpeg", "png", "gif"} {
+			var buf, out bytes.Buffer
+			if err := encode(&buf); err != nil {
+				t.Fatal(err)
+			}
+			o := &Options{Width: 60, Height: 60, Filter: Lanczos3, Format: format, Quality: 50}
+			if err := o.ImageStream(&out, &buf); err != nil {
+				t.Fatalf("%s to %q: %v", in, format, err)
+			}
+			cfg, got, err := image.DecodeConfig(&out)
+			want := format
+			if want == "" {
+				want = in
+			}
+			if err != nil || got != want || cfg.Width != 60 || cfg.Height != 40 {
+				t.Errorf("%s to %q: got %s %dx%d, %v; want %s 60x40", in, format, got, cfg.Width, cfg.Height, err, want)
+			}
+		}
+	}
+}
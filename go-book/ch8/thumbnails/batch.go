@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"image"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"gopl.io/ch8/thumbnail"
+)
+
+// A config is how to make a batch of thumbnails.
+type config struct {
+	opts    *thumbnail.Options
+	out     string // directory of the thumbnails
+	cache   string // directory of the thumbnails by their keys
+	workers int
+	// maxPixels limits the size of the images decoded, as an image of
+	// a few kilobytes may decode to gigabytes; 0 is no limit.
+	maxPixels int64
+}
+
+// A result is the outcome of making the thumbnail of an image.
+type result struct {
+	image, thumb string
+	cached       bool  // the thumbnail was in the cache
+	in, out      int64 // the sizes of the image and the thumbnail
+	err          error
+}
+
+// A summary is the outcome of a batch.
+type summary struct {
+	made, cached, failed int
+	in, out              int64 // total sizes of the images and their thumbnails
+}
+
+// A job is an image to make the thumbnail of, found in the walk of root.
+type job struct{ root, path string }
+
+// run makes the thumbnails of the images in the trees of roots, calling
+// report with the result of each, including errors of walking the trees.
+// Once ctx is cancelled, it starts no more images.
+func run(ctx context.Context, roots []string, c *config, report func(result)) summary {
+	jobs := make(chan job)
+	results := make(chan result)
+
+	// The walker.
+	go func() {
+		defer close(jobs)
+		for _, root := range roots {
+			if c.walk(ctx, root, jobs, results) != nil {
+				return // cancelled
+			}
+		}
+	}()
+
+	// The workers.
+	var wg sync.WaitGroup
+	for i := 0; i < c.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if ctx.Err() != nil {
+					continue // drain jobs, so the walker can finish
+				}
+				results <- c.make(j)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var s summary
+	for r := range results {
+		report(r)
+		switch {
+		case r.err != nil:
+			s.failed++
+			continue
+		case r.cached:
+			s.cached++
+		default:
+			s.made++
+		}
+		s.in += r.in
+		s.out += r.out
+	}
+	return s
+}
+
+// checkRoots reports an error if the thumbnails of two of roots would be
+// in the same place, as those of a/photos and b/photos in out/photos.
+func (c *config) checkRoots(roots []string) error {
+	seen := make(map[string]string) // the absolute roots by their base names
+	for _, root := range roots {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return err
+		}
+		base := filepath.Base(abs)
+		if other, ok := seen[base]; ok && other != abs {
+			return fmt.Errorf("the thumbnails of %s and %s would both be in %s", other, abs, filepath.Join(c.out, base))
+		}
+		seen[base] = abs
+	}
+	return nil
+}
+
+// imageExts are the file name extensions of images.
+var imageExts = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true}
+
+// walk sends the images in the tree of root to jobs, leaving out the
+// directories of c, and the errors of reading the tree to results. It
+// returns an error only if ctx is cancelled.
+func (c *config) walk(ctx context.Context, root string, jobs chan<- job, results chan<- result) error {
+	skip := make(map[string]bool)
+	for _, dir := range []string{c.out, c.cache} {
+		if abs, err := filepath.Abs(dir); err == nil {
+			skip[abs] = true
+		}
+	}
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			select {
+			case results <- result{image: path, err: err}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if abs, err := filepath.Abs(path); err == nil && skip[abs] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || !imageExts[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+		select {
+		case jobs <- job{root, path}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+// make makes the thumbnail of the image of j, or copies it from the
+// cache, where it is stored by key.
+func (c *config) make(j job) result {
+	r := result{image: j.path}
+	data, err := os.ReadFile(j.path)
+	if err != nil {
+		r.err = err
+		return r
+	}
+	r.in = int64(len(data))
+
+	ext := filepath.Ext(j.path)
+	if c.opts.Format != "" {
+		ext = "." + c.opts.Format
+	}
+	cached := filepath.Join(c.cache, c.key(data)+strings.ToLower(ext))
+	thumb, err := os.ReadFile(cached)
+	if err == nil {
+		r.cached = true
+	} else {
+		if c.maxPixels > 0 {
+			// Errors of the header are left to ImageStream.
+			cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+			if n := int64(cfg.Width) * int64(cfg.Height); err == nil && n > c.maxPixels {
+				r.err = fmt.Errorf("%s: %dx%d image, more than %d pixels", j.path, cfg.Width, cfg.Height, c.maxPixels)
+				return r
+			}
+		}
+		var buf bytes.Buffer
+		if err := c.opts.ImageStream(&buf, bytes.NewReader(data)); err != nil {
+			r.err = fmt.Errorf("%s: %v", j.path, err)
+			return r
+		}
+		thumb = buf.Bytes()
+		if err := writeFile(cached, thumb); err != nil {
+			r.err = err
+			return r
+		}
+	}
+	r.out = int64(len(thumb))
+
+	// The thumbnail of root/sub/foo.jpg is out/root/sub/foo.thumb.jpg.
+	rel, err := filepath.Rel(j.root, j.path)
+	if err != nil {
+		r.err = err
+		return r
+	}
+	abs, err := filepath.Abs(j.root)
+	if err != nil {
+		r.err = err
+		return r
+	}
+	base := filepath.Base(abs)
+	if rel == "." { // root is the image
+		base, rel = "", base
+	}
+	r.thumb = filepath.Join(c.out, base, strings.TrimSuffix(rel, filepath.Ext(rel))+".thumb"+ext)
+	r.err = writeFile(r.thumb, thumb)
+	return r
+}
+
+// key returns the key of the thumbnail of the image data: the SHA-256
+// of the data and of the options of the thumbnail, in hex.
+func (c *config) key(data []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%+v\n", *c.opts)
+	h.Write(data)
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// writeFile writes data to the file name, creating its directory, by
+// renaming a temporary file, so that it is never seen in part, even
+// when the command is interrupted.
+func writeFile(name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(name), ".thumb-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// print writes the summary s to w.
+func (s summary) print(w io.Writer) {
+	fmt.Fprintf(w, "%d thumbnails made, %d from the cache, %d failed\n", s.made, s.cached, s.failed)
+	if s.in == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%s of images, %s of thumbnails: %s saved (%.1f%%)\n",
+		bytesString(s.in), bytesString(s.out), bytesString(s.in-s.out), 100*float64(s.in-s.out)/float64(s.in))
+}
+
+// bytesString returns n bytes in B, kB, MB or GB.
+func bytesString(n int64) string {
+	switch x := float64(n); {
+	case n < 0:
+		return "-" + bytesString(-n)
+	case n < 1e3:
+		return fmt.Sprintf("%d B", n)
+	case n < 1e6:
+		return fmt.Sprintf("%.1f kB", x/1e3)
+	case n < 1e9:
+		return fmt.Sprintf("%.1f MB", x/1e6)
+	default:
+		return fmt.Sprintf("%.1f GB", x/1e9)
+	}
+}
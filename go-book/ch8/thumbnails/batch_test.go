@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopl.io/ch8/thumbnail"
+)
+
+// writeImages writes a tree of images, and a file that is not one, to
+// the directory dir.
+func writeImages(t *testing.T, dir string) {
+	img := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	for y := 0; y < 300; y++ {
+		for x := 0; x < 400; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(x), uint8(y), uint8(x ^ y), 0xff})
+		}
+	}
+	for _, name := range []string{"a.jpg", "sub/b.JPEG", "sub/c.png", "sub/deeper/copy-of-a.jpg"} {
+		name = filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasSuffix(name, ".png") {
+			err = png.Encode(f, img)
+		} else {
+			err = jpeg.Encode(f, img, nil)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not an image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	images := filepath.Join(dir, "images")
+	writeImages(t, images)
+	out := filepath.Join(dir, "out")
+	c := &config{opts: &thumbnail.Options{Width: 64, Height: 64}, out: out, cache: filepath.Join(out, ".cache"), workers: 3}
+
+	batch := func() (summary, map[string]bool) {
+		thumbs := make(map[string]bool)
+		s := run(context.Background(), []string{images}, c, func(r result) {
+			if r.err != nil {
+				t.Error(r.err)
+				return
+			}
+			thumbs[r.thumb] = r.cached
+		})
+		return s, thumbs
+	}
+
+	// The copy of a.jpg is found in the cache, if not made at once.
+	s, thumbs := batch()
+	if s.made+s.cached != 4 || s.made < 3 || s.failed != 0 || s.out >= s.in {
+		t.Errorf("first run: %+v", s)
+	}
+	for _, name := range []string{"a.thumb.jpg", "sub/b.thumb.JPEG", "sub/c.thumb.png", "sub/deeper/copy-of-a.thumb.jpg"} {
+		name = filepath.Join(out, "images", name)
+		if _, ok := thumbs[name]; !ok {
+			t.Errorf("no thumbnail %s, got %v", name, thumbs)
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		cfg, _, err := image.DecodeConfig(f)
+		f.Close()
+		if err != nil || cfg.Width != 64 || cfg.Height != 48 {
+			t.Errorf("%s: %dx%d, %v; want 64x48", name, cfg.Width, cfg.Height, err)
+		}
+	}
+
+	// Again, with the output within the tree: all are from the cache.
+	c.out = filepath.Join(images, "thumbs")
+	c.cache = filepath.Join(out, ".cache")
+	if s, _ := batch(); s.cached != 4 || s.made != 0 {
+		t.Errorf("second run: %+v", s)
+	}
+	if s, _ := batch(); s.cached != 4 || s.made != 0 {
+		t.Errorf("third run, with thumbnails in the tree: %+v", s)
+	}
+
+	// Other options make other thumbnails.
+	c.opts = &thumbnail.Options{Width: 32, Height: 32, Mode: thumbnail.Crop}
+	if s, _ := batch(); s.made < 3 {
+		t.Errorf("run with other options: %+v", s)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeImages(t, dir)
+	if err := os.WriteFile(filepath.Join(dir, "sub", "bad.png"), []byte("\x89PNG but not"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := t.TempDir()
+	c := &config{opts: &thumbnail.Options{Width: 64, Height: 64}, out: out, cache: filepath.Join(out, ".cache"), workers: 2}
+	var failed []string
+	s := run(context.Background(), []string{dir, filepath.Join(dir, "missing")}, c, func(r result) {
+		if r.err != nil {
+			failed = append(failed, r.image)
+		}
+	})
+	if s.failed != 2 || s.made+s.cached != 4 || len(failed) != 2 {
+		t.Errorf("run = %+v, failed %v; want 2 failed, 4 done", s, failed)
+	}
+
+	// Images too large to decode fail, and are not cached.
+	c.maxPixels = 400*300 - 1
+	c.cache = filepath.Join(out, ".cache2")
+	failed = nil
+	s = run(context.Background(), []string{dir}, c, func(r result) {
+		if r.err != nil {
+			failed = append(failed, r.err.Error())
+		}
+	})
+	if s.failed != 5 || s.made+s.cached != 0 || !strings.Contains(strings.Join(failed, "\n"), "400x300 image, more than 119999 pixels") {
+		t.Errorf("run with maxPixels = %+v, failed %q; want 5 failed", s, failed)
+	}
+	c.maxPixels = 400 * 300
+
+	// Cancelled, it makes nothing.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if s := run(ctx, []string{dir}, c, func(result) {}); s.made+s.cached+s.failed != 0 {
+		t.Errorf("cancelled run = %+v", s)
+	}
+}
+
+func TestBytesString(t *testing.T) {
+	for n, want := range map[int64]string{0: "0 B", 999: "999 B", 1500: "1.5 kB", 2_345_678: "2.3 MB", 7e9: "7.0 GB", -1500: "-1.5 kB"} {
+		if got := bytesString(n); got != want {
+			t.Errorf("bytesString(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestCheckRoots(t *testing.T) {
+	dir := t.TempDir()
+	c := &config{out: "out"}
+	for _, test := range []struct {
+		roots []string
+		ok    bool
+	}{
+		{[]string{"a/photos", "b/photos"}, false},
+		{[]string{"a/photos", "a/photos/"}, true},
+		{[]string{"a/photos", "b/pictures", "a"}, true},
+		{[]string{"a/x.jpg", "b/x.jpg"}, false},
+		{[]string{dir, filepath.Join(dir, "sub", filepath.Base(dir))}, false},
+	} {
+		if err := c.checkRoots(test.roots); (err == nil) != test.ok {
+			t.Errorf("checkRoots(%q) = %v", test.roots, err)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+// The thumbnails command makes thumbnails of the JPEG, PNG and GIF
+// images in directories, using gopl.io/ch8/thumbnail.
+//
+// Usage:
+//
+//	thumbnails [flags] [dir ...]
+//
+// It walks the directories, the current one by default, and makes a
+// thumbnail of each image with a pool of -j workers. The thumbnail of
+// dir/sub/foo.jpg is -out/dir/sub/foo.thumb.jpg. Thumbnails are cached
+// by the content of their images and their options, so an image whose
+// thumbnail is in the cache, even under another name, is not decoded
+// again, and images of more than -maxpixels pixels are not decoded at
+// all. Interrupting the command stops it once the images in progress
+// are done, and interrupting it again stops it at once. Directories of
+// the same name, such as a/photos and b/photos, cannot be given
+// together, as their thumbnails would be in the same place.
+//
+// It reports the images it could not make thumbnails of, and a summary
+// of how much smaller the thumbnails are than their images.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+
+	"gopl.io/ch8/thumbnail"
+)
+
+var (
+	workers = flag.Int("j", runtime.NumCPU(), "number of `workers`")
+	out     = flag.String("out", "thumbnails", "`directory` of the thumbnails")
+	cache   = flag.String("cache", "", "`directory` of the cache (default out/.cache)")
+	width   = flag.Int("width", 128, "width of the box of the thumbnails")
+	height  = flag.Int("height", 128, "height of the box of the thumbnails")
+	crop    = flag.Bool("crop", false, "crop the images to fill the box, rather than fit them within it")
+	filter  = flag.String("filter", "bicubic", "resampling `filter`: nearest, bilinear, bicubic or lanczos3")
+	format  = flag.String("format", "", "`format` of the thumbnails: jpeg, png or gif (default that of the images)")
+	quality = flag.Int("quality", 0, "quality of JPEG thumbnails, 1 to 100 (default 75)")
+	pixels  = flag.Int64("maxpixels", 1<<26, "images of more `pixels` are not decoded (0 for no limit)")
+)
+
+func main() {
+	flag.Parse()
+	roots := flag.Args()
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+	c, err := newConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "thumbnails: %v\n", err)
+		os.Exit(2)
+	}
+	if err := c.checkRoots(roots); err != nil {
+		fmt.Fprintf(os.Stderr, "thumbnails: %v\n", err)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop() // so that a second interrupt kills the command
+	}()
+	s := run(ctx, roots, c, func(r result) {
+		if r.err != nil {
+			fmt.Fprintf(os.Stderr, "thumbnails: %v\n", r.err)
+		}
+	})
+	if ctx.Err() != nil {
+		fmt.Println("interrupted")
+	}
+	s.print(os.Stdout)
+	if s.failed > 0 || ctx.Err() != nil {
+		os.Exit(1)
+	}
+}
+
+// newConfig returns the config of the flags.
+func newConfig() (*config, error) {
+	f, err := thumbnail.ParseFilter(*filter)
+	if err != nil {
+		return nil, err
+	}
+	switch *format {
+	case "", "jpeg", "png", "gif":
+	default:
+		return nil, fmt.Errorf("unsupported format %q", *format)
+	}
+	if *workers < 1 {
+		return nil, fmt.Errorf("-j %d: want at least one worker", *workers)
+	}
+	if *width < 0 || *height < 0 || *width == 0 && *height == 0 {
+		return nil, fmt.Errorf("bad box %dx%d", *width, *height)
+	}
+	if *quality < 0 || *quality > 100 {
+		return nil, fmt.Errorf("-quality %d: want 1 to 100", *quality)
+	}
+	if *pixels < 0 {
+		return nil, fmt.Errorf("-maxpixels %d: want 0 or more", *pixels)
+	}
+	opts := &thumbnail.Options{Width: *width, Height: *height, Filter: f, Format: *format, Quality: *quality}
+	if *crop {
+		opts.Mode = thumbnail.Crop
+	}
+	c := &config{opts: opts, out: *out, cache: *cache, workers: *workers, maxPixels: *pixels}
+	if c.cache == "" {
+		c.cache = filepath.Join(c.out, ".cache")
+	}
+	return c, nil
+}